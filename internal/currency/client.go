@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -16,6 +17,22 @@ var (
 	MaxRetries = 5
 )
 
+// Client fetches ECB rates and keeps those already fetched, keyed by endpoint
+// and date, so repeated lookups (e.g. by the sale simulator) do not call the
+// API again.
+type Client struct {
+	mu    sync.Mutex
+	rates map[string]float64
+	// now returns the current time; a rate published later today must not be
+	// hidden by a fallback cached before it.
+	now func() time.Time
+}
+
+// NewClient creates a Client with an empty cache.
+func NewClient() *Client {
+	return &Client{rates: map[string]float64{}, now: time.Now}
+}
+
 // rateResponse defines the structure of the JSON response from the Frankfurter API.
 type rateResponse struct {
 	Amount float64            `json:"amount"`
@@ -24,6 +41,12 @@ type rateResponse struct {
 	Rates  map[string]float64 `json:"rates"`
 }
 
+// FetchUSDToEUR fetches the ECB USD to EUR rate for a date without caching it.
+// See Client.FetchUSDToEUR.
+func FetchUSDToEUR(dateStr string) (float64, error) {
+	return NewClient().FetchUSDToEUR(dateStr)
+}
+
 // FetchUSDToEUR queries the Frankfurter API to get the historical USD to EUR
 // exchange rate for a specific date, as published by the European Central Bank (ECB).
 //
@@ -32,6 +55,10 @@ type rateResponse struct {
 // retries by requesting the rate for the previous day. This process is repeated up
 // to MaxRetries times.
 //
+// Rates are cached under the date they were published for. A rate found for an
+// earlier date is also cached under the requested date when that date has
+// passed, but not for today, whose rate may still be published.
+//
 // Parameters:
 //   - dateStr: The date for which to fetch the rate, in "YYYY-MM-DD" format.
 //
@@ -39,12 +66,19 @@ type rateResponse struct {
 //   - A float64 representing the EUR equivalent of 1 USD for the given date.
 //   - An error if the date format is invalid, the API is unreachable after retries,
 //     or if a rate cannot be found within the retry limit.
-func FetchUSDToEUR(dateStr string) (float64, error) {
+func (c *Client) FetchUSDToEUR(dateStr string) (float64, error) {
 	targetDate, err := time.Parse("2006-01-02", dateStr)
 	if err != nil {
 		return 0, fmt.Errorf("invalid date format: %v", err)
 	}
 
+	c.mu.Lock()
+	cached, ok := c.rates[BaseURL+"/"+dateStr]
+	c.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
 	client := &http.Client{Timeout: 10 * time.Second}
 
 	for i := 0; i < MaxRetries; i++ {
@@ -83,11 +117,28 @@ func FetchUSDToEUR(dateStr string) (float64, error) {
 		}
 
 		// Success. If we had to backtrack, log a notice for transparency.
-		if currentDateStr != dateStr {
-			fmt.Printf("Notice: No rate for %s. Used rate from %s: %.4f\n", dateStr, currentDateStr, rate)
+		published := currentDateStr
+		if result.Date != "" {
+			published = result.Date
+		}
+		if published != dateStr {
+			fmt.Printf("Notice: No rate for %s. Used rate from %s: %.4f\n", dateStr, published, rate)
 		}
+		c.mu.Lock()
+		c.rates[BaseURL+"/"+published] = rate
+		if published == dateStr || dateStr < c.now().Format("2006-01-02") {
+			c.rates[BaseURL+"/"+dateStr] = rate
+		}
+		c.mu.Unlock()
 		return rate, nil
 	}
 
 	return 0, fmt.Errorf("could not find an ECB rate for %s within %d days", dateStr, MaxRetries)
 }
+
+// TodayUSDToEUR returns the most recent ECB USD to EUR rate available today.
+// Once today's rate is published it is cached, so later calls do not reach
+// the API; until then each call checks for it.
+func (c *Client) TodayUSDToEUR() (float64, error) {
+	return c.FetchUSDToEUR(c.now().Format("2006-01-02"))
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestFetchUSDToEUR(t *testing.T) {
@@ -71,3 +72,43 @@ func TestFetchUSDToEUR(t *testing.T) {
 		t.Error("expected an error for API error, but got nil")
 	}
 }
+
+func TestClientCache(t *testing.T) {
+	published, rate, calls := "2024-01-05", 0.8, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprintf(w, `{"date":%q,"rates":{"EUR":%g}}`, published, rate)
+	}))
+	defer server.Close()
+
+	originalBaseURL := BaseURL
+	BaseURL = server.URL
+	defer func() { BaseURL = originalBaseURL }()
+
+	client := NewClient()
+	client.now = func() time.Time { return time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC) }
+
+	// A past date falls back to the last published rate, which is cached
+	// under both dates.
+	if got, _ := client.FetchUSDToEUR("2024-01-06"); got != 0.8 {
+		t.Errorf("expected rate 0.8, got %f", got)
+	}
+	client.FetchUSDToEUR("2024-01-06")
+	client.FetchUSDToEUR("2024-01-05")
+	if calls != 1 {
+		t.Errorf("expected one API call, got %d", calls)
+	}
+
+	// Today's rate is not yet published; the fallback is not kept for today.
+	if got, _ := client.TodayUSDToEUR(); got != 0.8 {
+		t.Errorf("expected the fallback rate 0.8, got %f", got)
+	}
+	published, rate = "2024-01-08", 0.9
+	if got, _ := client.TodayUSDToEUR(); got != 0.9 {
+		t.Errorf("expected today's rate once published, got %f", got)
+	}
+	client.TodayUSDToEUR()
+	if calls != 3 {
+		t.Errorf("expected today's published rate to be cached, got %d API calls", calls)
+	}
+}
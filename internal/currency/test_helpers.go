@@ -0,0 +1,25 @@
+package currency
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// UseTestRate points the package at a stub API that returns the given EUR rate
+// for every date, so that tests do not depend on network access. The original
+// endpoint is restored when the test ends.
+func UseTestRate(t *testing.T, rate float64) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"rates":{"EUR":%g}}`, rate)
+	}))
+	originalBaseURL := BaseURL
+	BaseURL = server.URL
+	t.Cleanup(func() {
+		BaseURL = originalBaseURL
+		server.Close()
+	})
+}
@@ -3,6 +3,7 @@ package db
 import (
 	"database/sql"
 	"log"
+	"strings"
 
 	_ "modernc.org/sqlite" // Pure Go SQLite driver, CGO_ENABLED=0 friendly
 )
@@ -19,7 +20,10 @@ CREATE TABLE IF NOT EXISTS vests (
     symbol TEXT NOT NULL,             -- Stock ticker symbol (e.g., GOOGL)
     quantity REAL NOT NULL,        -- Number of shares vested
     strike_price_cents INTEGER NOT NULL, -- Price per share in USD cents at vest time
-    ecb_rate REAL NOT NULL            -- USD to EUR ECB reference rate on the vest date
+    ecb_rate REAL NOT NULL,           -- USD to EUR ECB reference rate on the vest date
+    source TEXT NOT NULL DEFAULT 'RSU', -- How the lot was acquired (RSU, CORPORATE_ACTION, ...)
+    parent_id TEXT,                   -- Lot this one was derived from, if any
+    owner_id TEXT NOT NULL DEFAULT '' -- Household member owning the lot; empty for the primary taxpayer
 );
 
 -- sales stores records of stock sales.
@@ -27,10 +31,12 @@ CREATE TABLE IF NOT EXISTS vests (
 CREATE TABLE IF NOT EXISTS sales (
     id TEXT PRIMARY KEY,              -- Unique identifier for the sale
     date TEXT NOT NULL,               -- Sale date (YYYY-MM-DD)
+    symbol TEXT NOT NULL DEFAULT '',  -- Stock ticker symbol; empty matches any lot
     quantity REAL NOT NULL,        -- Total number of shares sold
     price_cents INTEGER NOT NULL,     -- Price per share in USD cents at sale time
     ecb_rate REAL NOT NULL,           -- USD to EUR ECB reference rate on the sale date
-    is_settled BOOLEAN NOT NULL DEFAULT 0 -- Flag for CGT calculation status
+    is_settled BOOLEAN NOT NULL DEFAULT 0, -- Flag for CGT calculation status
+    owner_id TEXT NOT NULL DEFAULT '' -- Household member making the sale; empty for the primary taxpayer
 );
 
 -- sale_lots links vests to sales, specifying how many shares from a
@@ -45,6 +51,9 @@ CREATE TABLE IF NOT EXISTS sale_lots (
 );
 
 CREATE TABLE IF NOT EXISTS settled_sales (
+    sale_id TEXT,
+    vest_id TEXT,
+    owner_id TEXT NOT NULL DEFAULT '',
     sale_date TEXT,
     ticker TEXT,
     num_shares REAL,
@@ -62,8 +71,333 @@ CREATE TABLE IF NOT EXISTS settled_sales (
     net_proceeds_eur INTEGER,
     type TEXT
 );
+
+-- corporate_actions records spin-offs, mergers and returns of capital that
+-- re-apportion the cost basis of existing lots.
+CREATE TABLE IF NOT EXISTS corporate_actions (
+    id TEXT PRIMARY KEY,              -- Unique identifier for the action
+    date TEXT NOT NULL,               -- Effective date / first dealing day (YYYY-MM-DD)
+    type TEXT NOT NULL,               -- SPINOFF, MERGER or RETURN_OF_CAPITAL
+    symbol TEXT NOT NULL,             -- Security whose lots are affected
+    new_symbol TEXT NOT NULL DEFAULT '', -- Security received, if any
+    ratio REAL NOT NULL DEFAULT 0,    -- New shares received per old share
+    old_value_cents INTEGER NOT NULL DEFAULT 0, -- Market value per old share in USD cents
+    new_value_cents INTEGER NOT NULL DEFAULT 0, -- Market value per new share in USD cents
+    cash_cents INTEGER NOT NULL DEFAULT 0,      -- Cash received per old share in USD cents
+    ecb_rate REAL NOT NULL            -- USD to EUR ECB reference rate on the action date
+);
+
+-- corporate_action_disposals links the part disposals recorded in
+-- settled_sales for cash received in a corporate action back to the action.
+CREATE TABLE IF NOT EXISTS corporate_action_disposals (
+    sale_id TEXT PRIMARY KEY,         -- sale_id of the part disposal in settled_sales
+    action_id TEXT NOT NULL,          -- Foreign key to the corporate_actions table
+    owner_id TEXT NOT NULL DEFAULT '', -- Household member receiving the cash
+    FOREIGN KEY(action_id) REFERENCES corporate_actions(id)
+);
+
+-- espp_purchases holds the ESPP-specific details of lots bought through an
+-- Employee Stock Purchase Plan. The lot itself lives in vests, priced at the
+-- market value on the purchase date, so it joins the common FIFO pool.
+CREATE TABLE IF NOT EXISTS espp_purchases (
+    id TEXT PRIMARY KEY,              -- Unique identifier for the purchase
+    vest_id TEXT NOT NULL,            -- Foreign key to the lot in the vests table
+    offering_date TEXT NOT NULL,      -- Start of the offering period (YYYY-MM-DD)
+    purchase_price_cents INTEGER NOT NULL, -- Discounted price paid per share in USD cents
+    market_value_cents INTEGER NOT NULL,   -- Market value per share in USD cents on the purchase date
+    FOREIGN KEY(vest_id) REFERENCES vests(id)
+);
+
+-- option_grants stores grants of unapproved share options.
+CREATE TABLE IF NOT EXISTS option_grants (
+    id TEXT PRIMARY KEY,              -- Unique identifier for the grant
+    symbol TEXT NOT NULL,             -- Stock ticker symbol
+    grant_date TEXT NOT NULL,         -- Grant date (YYYY-MM-DD)
+    quantity REAL NOT NULL,           -- Number of options granted
+    exercise_price_cents INTEGER NOT NULL -- Exercise price per share in USD cents
+);
+
+-- option_exercises records each exercise, the RTSO computed on the spread and
+-- the acquisition lot created in vests.
+CREATE TABLE IF NOT EXISTS option_exercises (
+    id TEXT PRIMARY KEY,              -- Unique identifier for the exercise
+    grant_id TEXT NOT NULL,           -- Foreign key to the option_grants table
+    vest_id TEXT NOT NULL,            -- Foreign key to the lot in the vests table
+    date TEXT NOT NULL,               -- Exercise date (YYYY-MM-DD)
+    quantity REAL NOT NULL,           -- Number of options exercised
+    market_price_cents INTEGER NOT NULL, -- Market value per share in USD cents
+    ecb_rate REAL NOT NULL,           -- USD to EUR ECB reference rate on the exercise date
+    spread_eur_cents INTEGER NOT NULL,   -- Taxable spread in EUR cents
+    income_tax_cents INTEGER NOT NULL,   -- Income tax element of RTSO in EUR cents
+    usc_cents INTEGER NOT NULL,          -- USC element of RTSO in EUR cents
+    prsi_cents INTEGER NOT NULL,         -- PRSI element of RTSO in EUR cents
+    rtso_due_date TEXT NOT NULL,         -- RTSO1 payment deadline (YYYY-MM-DD)
+    FOREIGN KEY(grant_id) REFERENCES option_grants(id),
+    FOREIGN KEY(vest_id) REFERENCES vests(id)
+);
+
+-- vest_payroll stores the taxable amount and deductions our employer reported
+-- through PAYE for a vest, used to reconcile payroll against the CGT base cost.
+CREATE TABLE IF NOT EXISTS vest_payroll (
+    vest_id TEXT PRIMARY KEY,         -- Foreign key to the vests table
+    taxable_eur_cents INTEGER NOT NULL, -- Taxable amount reported by payroll in EUR cents
+    paye_cents INTEGER NOT NULL DEFAULT 0, -- PAYE deducted in EUR cents
+    usc_cents INTEGER NOT NULL DEFAULT 0,  -- USC deducted in EUR cents
+    prsi_cents INTEGER NOT NULL DEFAULT 0, -- PRSI deducted in EUR cents
+    FOREIGN KEY(vest_id) REFERENCES vests(id)
+);
+
+-- dividends stores cash dividends received, converted at the ECB rate on the
+-- payment date, for the annual foreign income summary.
+CREATE TABLE IF NOT EXISTS dividends (
+    id TEXT PRIMARY KEY,              -- Unique identifier for the dividend
+    date TEXT NOT NULL,               -- Payment date (YYYY-MM-DD)
+    symbol TEXT NOT NULL,             -- Stock ticker symbol
+    account TEXT NOT NULL DEFAULT '', -- Brokerage account
+    gross_cents INTEGER NOT NULL,     -- Gross dividend in USD cents
+    withholding_cents INTEGER NOT NULL DEFAULT 0, -- Foreign tax withheld in USD cents
+    ecb_rate REAL NOT NULL,           -- USD to EUR ECB reference rate on the payment date
+    owner_id TEXT NOT NULL DEFAULT '' -- Household member receiving the dividend; empty for the primary taxpayer
+);
+
+-- securities classifies ticker symbols by asset class. Symbols without a row
+-- are ordinary shares.
+CREATE TABLE IF NOT EXISTS securities (
+    symbol TEXT PRIMARY KEY,          -- Stock ticker symbol
+    asset_class TEXT NOT NULL DEFAULT 'SHARE', -- SHARE or ETF
+    name TEXT NOT NULL DEFAULT ''     -- Optional description
+);
+
+-- exit_tax_disposals stores ETF disposals taxed under the gross roll-up regime,
+-- which bypass the CGT calculation in settled_sales.
+CREATE TABLE IF NOT EXISTS exit_tax_disposals (
+    sale_id TEXT NOT NULL DEFAULT '', -- Sale that triggered the disposal
+    vest_id TEXT NOT NULL,            -- Lot disposed of
+    date TEXT NOT NULL,               -- Disposal date (YYYY-MM-DD)
+    symbol TEXT NOT NULL,             -- Stock ticker symbol
+    shares REAL NOT NULL,             -- Number of units disposed of
+    proceeds_cents INTEGER NOT NULL,  -- Disposal value in EUR cents
+    cost_cents INTEGER NOT NULL,      -- Acquisition cost in EUR cents
+    gain_cents INTEGER NOT NULL,      -- Gain (or unrelieved loss) in EUR cents
+    tax_cents INTEGER NOT NULL,       -- Exit tax in EUR cents
+    type TEXT NOT NULL                -- DISPOSAL or DEEMED
+);
+
+-- lot_adjustments removes shares from a lot without a sale, e.g. when a
+-- corporate action replaces the lot with re-apportioned successor lots.
+CREATE TABLE IF NOT EXISTS lot_adjustments (
+    vest_id TEXT NOT NULL,            -- Foreign key to the vests table
+    reference_id TEXT NOT NULL,       -- The event that caused the adjustment
+    date TEXT NOT NULL,               -- Date of the adjustment (YYYY-MM-DD)
+    quantity REAL NOT NULL,           -- Number of shares removed from the lot
+    reason TEXT NOT NULL,             -- Short description, e.g. CORPORATE_ACTION
+    FOREIGN KEY(vest_id) REFERENCES vests(id)
+);
+
+-- transfers records gifts, inheritances and spouse transfers. Transfers in
+-- create a lot in vests; a gift made creates a sale at market value; a spouse
+-- transfer out removes shares through lot_adjustments without a disposal.
+CREATE TABLE IF NOT EXISTS transfers (
+    id TEXT PRIMARY KEY,              -- Unique identifier for the transfer
+    date TEXT NOT NULL,               -- Date of the transfer (YYYY-MM-DD)
+    direction TEXT NOT NULL,          -- IN or OUT
+    type TEXT NOT NULL,               -- GIFT, INHERITANCE or SPOUSE
+    symbol TEXT NOT NULL,             -- Security transferred
+    quantity REAL NOT NULL,           -- Number of shares transferred
+    market_value_cents INTEGER NOT NULL DEFAULT 0, -- Market value per share in USD cents
+    ecb_rate REAL NOT NULL,           -- USD to EUR ECB reference rate applied
+    counterparty TEXT NOT NULL DEFAULT '', -- Donor, deceased, spouse or recipient
+    original_date TEXT NOT NULL DEFAULT '',        -- Spouse's acquisition date (SPOUSE IN)
+    original_cost_cents INTEGER NOT NULL DEFAULT 0, -- Spouse's cost per share in USD cents (SPOUSE IN)
+    vest_id TEXT,                     -- Lot created by a transfer in
+    sale_id TEXT,                     -- Disposal created by a gift made
+    owner_id TEXT NOT NULL DEFAULT '', -- Household member; empty for the primary taxpayer
+    spouse_in_household BOOLEAN NOT NULL DEFAULT 0, -- Spouse is a household member (SPOUSE)
+    spouse_id TEXT NOT NULL DEFAULT '', -- Household spouse; empty for the primary taxpayer
+    linked_id TEXT                    -- Matching transfer recorded for a household spouse
+);
+
+-- transfer_lots records the lots moved by a spouse transfer: those given up by
+-- a transfer out and those created by a transfer in, each keeping the original
+-- acquisition date, cost and rate.
+CREATE TABLE IF NOT EXISTS transfer_lots (
+    transfer_id TEXT NOT NULL,        -- Foreign key to the transfers table
+    vest_id TEXT NOT NULL,            -- Lot given up or created
+    original_date TEXT NOT NULL,      -- Original acquisition date (YYYY-MM-DD)
+    quantity REAL NOT NULL,           -- Number of shares transferred from the lot
+    cost_cents INTEGER NOT NULL,      -- Original cost per share in USD cents
+    ecb_rate REAL NOT NULL,           -- USD to EUR ECB reference rate on the original date
+    FOREIGN KEY(transfer_id) REFERENCES transfers(id)
+);
+
+-- residence_periods records when each household member was resident or
+-- ordinarily resident in Ireland.
+CREATE TABLE IF NOT EXISTS residence_periods (
+    id TEXT PRIMARY KEY,              -- Unique identifier for the period
+    owner_id TEXT NOT NULL DEFAULT '', -- Household member; empty for the primary taxpayer
+    start_date TEXT NOT NULL,         -- First day of the period (YYYY-MM-DD)
+    end_date TEXT NOT NULL DEFAULT '', -- Last day of the period; empty if ongoing
+    resident BOOLEAN NOT NULL,        -- Resident in Ireland during the period
+    ordinarily_resident BOOLEAN NOT NULL -- Ordinarily resident in Ireland during the period
+);
+
+-- grants stores RSU grants and the parameters of their vesting schedule.
+CREATE TABLE IF NOT EXISTS grants (
+    id TEXT PRIMARY KEY,              -- Unique identifier for the grant
+    grant_number TEXT NOT NULL DEFAULT '', -- Broker's grant identifier
+    symbol TEXT NOT NULL,             -- Stock ticker symbol
+    plan TEXT NOT NULL DEFAULT '',    -- Plan name on the broker's release export
+    grant_date TEXT NOT NULL,         -- Grant date (YYYY-MM-DD)
+    total_units REAL NOT NULL,        -- Units granted
+    vest_start_date TEXT NOT NULL,    -- Vesting commencement date (YYYY-MM-DD)
+    cadence_months INTEGER NOT NULL,  -- Months between tranches
+    tranches INTEGER NOT NULL,        -- Number of tranches
+    cliff_months INTEGER NOT NULL DEFAULT 0, -- Months before the first vest
+    owner_id TEXT NOT NULL DEFAULT '' -- Household member holding the grant; empty for the primary taxpayer
+);
+
+-- grant_releases links imported releases (lots in vests) to the scheduled
+-- tranche of a grant they fulfil.
+CREATE TABLE IF NOT EXISTS grant_releases (
+    grant_id TEXT NOT NULL,           -- Foreign key to the grants table
+    tranche INTEGER NOT NULL,         -- 1-based tranche number
+    vest_id TEXT NOT NULL,            -- Foreign key to the vests table
+    order_number TEXT NOT NULL DEFAULT '', -- Broker's release order number
+    FOREIGN KEY(grant_id) REFERENCES grants(id),
+    FOREIGN KEY(vest_id) REFERENCES vests(id),
+    PRIMARY KEY (grant_id, tranche)
+);
+
+-- attachments stores evidence files attached to vests and sales.
+CREATE TABLE IF NOT EXISTS attachments (
+    id TEXT PRIMARY KEY,              -- Unique identifier for the attachment
+    entity_type TEXT NOT NULL,        -- VEST or SALE
+    entity_id TEXT NOT NULL,          -- ID of the vest or sale
+    filename TEXT NOT NULL,           -- Original file name
+    content_type TEXT NOT NULL DEFAULT '', -- MIME type as uploaded
+    data BLOB NOT NULL,               -- File content
+    uploaded_at TEXT NOT NULL         -- RFC 3339 timestamp
+);
+
+-- closed_years snapshots each person's annual computation when the return is
+-- filed, and locks the year's transactions while the year is closed.
+CREATE TABLE IF NOT EXISTS closed_years (
+    owner_id TEXT NOT NULL DEFAULT '', -- Household member; empty for the primary taxpayer
+    year INTEGER NOT NULL,            -- Tax year
+    closed_at TEXT NOT NULL,          -- RFC 3339 time the year was last closed
+    locked BOOLEAN NOT NULL,          -- False while an amendment is in progress
+    tax_cents INTEGER NOT NULL,       -- CGT for the year as filed, in EUR cents
+    snapshot TEXT NOT NULL,           -- The filed worksheet as JSON
+    PRIMARY KEY (owner_id, year)
+);
+
+-- year_amendments records each reopening of a closed year.
+CREATE TABLE IF NOT EXISTS year_amendments (
+    id TEXT PRIMARY KEY,              -- Unique identifier for the amendment
+    owner_id TEXT NOT NULL DEFAULT '', -- Household member; empty for the primary taxpayer
+    year INTEGER NOT NULL,            -- Tax year amended
+    reason TEXT NOT NULL DEFAULT '',  -- Why the year was reopened
+    reopened_at TEXT NOT NULL,        -- RFC 3339 time the year was reopened
+    closed_at TEXT NOT NULL DEFAULT '', -- RFC 3339 time it was closed again; empty while open
+    filed_tax_cents INTEGER NOT NULL, -- CGT as filed, in EUR cents
+    amended_tax_cents INTEGER NOT NULL DEFAULT 0 -- CGT as amended, in EUR cents
+);
+
+-- cgt_payments records payments of CGT made to Revenue.
+CREATE TABLE IF NOT EXISTS cgt_payments (
+    id TEXT PRIMARY KEY,              -- Unique identifier for the payment
+    owner_id TEXT NOT NULL DEFAULT '', -- Household member; empty for the primary taxpayer
+    date TEXT NOT NULL,               -- Payment date (YYYY-MM-DD)
+    amount_cents INTEGER NOT NULL,    -- Amount paid in EUR cents
+    year INTEGER NOT NULL,            -- Tax year paid for
+    period TEXT NOT NULL,             -- INITIAL or LATER payment period
+    reference TEXT NOT NULL DEFAULT '' -- ROS or bank reference
+);
+
+-- rate_failures records transactions rejected because their exchange rate
+-- could not be fetched.
+CREATE TABLE IF NOT EXISTS rate_failures (
+    id TEXT PRIMARY KEY,              -- Unique identifier for the failure
+    record TEXT NOT NULL,             -- Description of the transaction
+    date TEXT NOT NULL,               -- Rate date requested (YYYY-MM-DD)
+    error TEXT NOT NULL,              -- Error returned by the rate service
+    failed_at TEXT NOT NULL           -- RFC 3339 time of the failure
+);
+
+-- sent_reminders records the reminders already emailed, so each is sent once.
+CREATE TABLE IF NOT EXISTS sent_reminders (
+    key TEXT PRIMARY KEY,             -- Identifies the reminder, e.g. deadline-<owner>-2024-INITIAL
+    sent_at TEXT NOT NULL             -- RFC 3339 time the reminder was sent
+);
+
+-- webhooks stores the endpoints notified of portfolio events.
+CREATE TABLE IF NOT EXISTS webhooks (
+    id TEXT PRIMARY KEY,              -- Unique identifier for the webhook
+    url TEXT NOT NULL,                -- Endpoint the payloads are posted to
+    secret TEXT NOT NULL,             -- HMAC-SHA256 signing secret
+    events TEXT NOT NULL DEFAULT '',  -- Comma-separated events, or empty for all
+    created_at TEXT NOT NULL          -- RFC 3339 time the webhook was added
+);
+
+-- webhook_deliveries is the queue and log of payloads posted to webhooks.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id TEXT PRIMARY KEY,              -- Unique identifier for the delivery
+    webhook_id TEXT NOT NULL,         -- The webhook the payload is for
+    event TEXT NOT NULL,              -- Event name, e.g. sale.settled
+    payload TEXT NOT NULL,            -- JSON body
+    status TEXT NOT NULL,             -- 'PENDING', 'DELIVERED' or 'FAILED'
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_code INTEGER NOT NULL DEFAULT 0, -- HTTP status of the last attempt
+    error TEXT NOT NULL DEFAULT '',   -- Error of the last attempt
+    created_at TEXT NOT NULL,         -- RFC 3339 time the event occurred
+    next_attempt_at TEXT NOT NULL DEFAULT '', -- RFC 3339 time of the next attempt
+    delivered_at TEXT NOT NULL DEFAULT '',    -- RFC 3339 time of delivery
+    FOREIGN KEY(webhook_id) REFERENCES webhooks(id)
+);
+
+-- prices stores closing prices per security and date, for valuing open lots.
+CREATE TABLE IF NOT EXISTS prices (
+    symbol TEXT NOT NULL,             -- Ticker symbol
+    date TEXT NOT NULL,               -- YYYY-MM-DD
+    price_cents INTEGER NOT NULL,     -- Close in USD cents (EUR cents for crypto-assets)
+    open_cents INTEGER NOT NULL DEFAULT 0, -- Day's trading range, 0 when unknown
+    high_cents INTEGER NOT NULL DEFAULT 0,
+    low_cents INTEGER NOT NULL DEFAULT 0,
+    source TEXT NOT NULL DEFAULT '',  -- CSV, OHLC, MANUAL or the provider name
+    PRIMARY KEY (symbol, date)
+);
+
+-- persons lists the members of a jointly assessed household other than the
+-- primary taxpayer, who is identified by an empty owner_id.
+CREATE TABLE IF NOT EXISTS persons (
+    id TEXT PRIMARY KEY,              -- Unique identifier for the person
+    name TEXT NOT NULL                -- Display name
+);
 `
 
+// migrations upgrades databases created by earlier versions of the schema.
+// Each statement adds a column that is already present in 'schema' for fresh
+// databases, so "duplicate column" errors are expected and ignored.
+var migrations = []string{
+	`ALTER TABLE vests ADD COLUMN source TEXT NOT NULL DEFAULT 'RSU'`,
+	`ALTER TABLE vests ADD COLUMN parent_id TEXT`,
+	`ALTER TABLE sales ADD COLUMN symbol TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE settled_sales ADD COLUMN sale_id TEXT`,
+	`ALTER TABLE settled_sales ADD COLUMN vest_id TEXT`,
+	`ALTER TABLE vests ADD COLUMN owner_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE sales ADD COLUMN owner_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE settled_sales ADD COLUMN owner_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE prices ADD COLUMN open_cents INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE prices ADD COLUMN high_cents INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE prices ADD COLUMN low_cents INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE transfers ADD COLUMN owner_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE transfers ADD COLUMN spouse_in_household BOOLEAN NOT NULL DEFAULT 0`,
+	`ALTER TABLE transfers ADD COLUMN spouse_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE transfers ADD COLUMN linked_id TEXT`,
+	`ALTER TABLE dividends ADD COLUMN owner_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE grants ADD COLUMN owner_id TEXT NOT NULL DEFAULT ''`,
+}
+
 // InitDB establishes a connection to a SQLite database at the given file path.
 // If the database file does not exist, it will be created.
 // It then ensures the necessary table schema is created by executing the statements
@@ -91,6 +425,13 @@ func InitDB(filepath string) *sql.DB {
 		log.Fatalf("Failed to create schema: %v", err)
 	}
 
+	// Bring databases created by older versions up to date.
+	for _, m := range migrations {
+		if _, err := db.Exec(m); err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			log.Fatalf("Failed to migrate schema: %v", err)
+		}
+	}
+
 	log.Println("Database initialized successfully at", filepath)
 	return db
 }
@@ -2,7 +2,10 @@ package importer
 
 import (
 	"encoding/csv"
+	"fmt"
 	"io"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -53,6 +56,8 @@ func ParseVestCSV(r io.Reader) ([]models.Vest, error) {
 			Date:             vestDate.Format("2006-01-02"),
 			Quantity:         quantity,
 			StrikePriceCents: priceCents,
+			OrderNumber:      record[1],
+			Plan:             record[2],
 		})
 	}
 
@@ -112,3 +117,298 @@ func ParseSaleCSV(r io.Reader) ([]models.Sale, error) {
 
 	return sales, nil
 }
+
+// ParseESPPCSV parses a broker ESPP purchase report and returns a slice of
+// ESPPPurchase objects. Symbol, IDs and exchange rates are left for the caller.
+func ParseESPPCSV(r io.Reader) ([]models.ESPPPurchase, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	// Skip header
+	if _, err := reader.Read(); err != nil {
+		return nil, err
+	}
+
+	var purchases []models.ESPPPurchase
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Purchase Date,Offering Date,Offering FMV,Purchase FMV,Purchase Price,Quantity
+		// 31-Dec-2024,01-Jul-2024,$180.00,$190.00,$153.00,12.5
+		purchaseDate, err := time.Parse("02-Jan-2006", record[0])
+		if err != nil {
+			return nil, err
+		}
+		offeringDate, err := time.Parse("02-Jan-2006", record[1])
+		if err != nil {
+			return nil, err
+		}
+
+		marketValue, err := strconv.ParseFloat(strings.TrimPrefix(record[3], "$"), 64)
+		if err != nil {
+			return nil, err
+		}
+		purchasePrice, err := strconv.ParseFloat(strings.TrimPrefix(record[4], "$"), 64)
+		if err != nil {
+			return nil, err
+		}
+
+		quantity, err := strconv.ParseFloat(record[5], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		purchases = append(purchases, models.ESPPPurchase{
+			PurchaseDate:       purchaseDate.Format("2006-01-02"),
+			OfferingDate:       offeringDate.Format("2006-01-02"),
+			Quantity:           quantity,
+			PurchasePriceCents: int64(math.Round(purchasePrice * 100)),
+			MarketValueCents:   int64(math.Round(marketValue * 100)),
+		})
+	}
+
+	return purchases, nil
+}
+
+// ParseDividendCSV parses a broker dividend history export and returns a slice
+// of Dividend objects. IDs, accounts and exchange rates are left for the caller.
+func ParseDividendCSV(r io.Reader) ([]models.Dividend, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	// Skip header
+	if _, err := reader.Read(); err != nil {
+		return nil, err
+	}
+
+	var dividends []models.Dividend
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Payment Date,Symbol,Gross Amount,Tax Withheld,Net Amount
+		// 16-Jun-2025,GOOGL,$42.00,-$6.30,$35.70
+		payDate, err := time.Parse("02-Jan-2006", record[0])
+		if err != nil {
+			return nil, err
+		}
+
+		gross, err := parseDollars(record[2])
+		if err != nil {
+			return nil, err
+		}
+		withheld, err := parseDollars(record[3])
+		if err != nil {
+			return nil, err
+		}
+
+		dividends = append(dividends, models.Dividend{
+			Date:             payDate.Format("2006-01-02"),
+			Symbol:           record[1],
+			GrossCents:       int64(math.Round(math.Abs(gross) * 100)),
+			WithholdingCents: int64(math.Round(math.Abs(withheld) * 100)),
+		})
+	}
+
+	return dividends, nil
+}
+
+// ParsePriceCSV parses a price history (Date,Symbol,Close) with dates in
+// "YYYY-MM-DD" format and returns a slice of Price objects. Sources are left
+// for the caller.
+func ParsePriceCSV(r io.Reader) ([]models.Price, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	// Skip header
+	if _, err := reader.Read(); err != nil {
+		return nil, err
+	}
+
+	var prices []models.Price
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Date,Symbol,Close
+		// 2025-06-16,GOOGL,$176.77
+		date, err := time.Parse("2006-01-02", record[0])
+		if err != nil {
+			return nil, err
+		}
+		price, err := parseDollars(record[2])
+		if err != nil {
+			return nil, err
+		}
+
+		prices = append(prices, models.Price{
+			Symbol:     strings.TrimSpace(record[1]),
+			Date:       date.Format("2006-01-02"),
+			PriceCents: int64(math.Round(price * 100)),
+		})
+	}
+
+	return prices, nil
+}
+
+// ParseOHLCCSV parses a daily price history for one security in the standard
+// OHLC layout (Date,Open,High,Low,Close[,Adj Close,Volume]) with dates in
+// "YYYY-MM-DD" format. Rows without prices (shown as "null" by some providers)
+// are skipped. Symbols and sources are left for the caller.
+func ParseOHLCCSV(r io.Reader) ([]models.Price, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	// Skip header
+	if _, err := reader.Read(); err != nil {
+		return nil, err
+	}
+
+	var prices []models.Price
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 5 {
+			return nil, fmt.Errorf("expected Date,Open,High,Low,Close but got %d fields", len(record))
+		}
+
+		// Date,Open,High,Low,Close,Adj Close,Volume
+		// 2025-06-16,174.73,177.34,173.87,176.77,176.56,34539200
+		date, err := time.Parse("2006-01-02", record[0])
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(record[4], "null") || record[4] == "" {
+			continue
+		}
+
+		var cents [4]int64
+		for i, field := range record[1:5] {
+			value, err := parseDollars(field)
+			if err != nil {
+				return nil, err
+			}
+			cents[i] = int64(math.Round(value * 100))
+		}
+
+		prices = append(prices, models.Price{
+			Date:       date.Format("2006-01-02"),
+			OpenCents:  cents[0],
+			HighCents:  cents[1],
+			LowCents:   cents[2],
+			PriceCents: cents[3],
+		})
+	}
+
+	return prices, nil
+}
+
+// parseDollars parses an amount such as "$1,234.56" or "-$6.30" into dollars.
+// An empty field is treated as zero.
+func parseDollars(s string) (float64, error) {
+	s = strings.NewReplacer("$", "", ",", "").Replace(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// ParseCryptoCSV parses a generic exchange trade history and returns the trades
+// sorted by date, so that acquisitions are recorded before later disposals.
+func ParseCryptoCSV(r io.Reader) ([]models.CryptoTradeRecord, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	// Skip header
+	if _, err := reader.Read(); err != nil {
+		return nil, err
+	}
+
+	var trades []models.CryptoTradeRecord
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Date,Type,Asset,Quantity,Price EUR,Quote Asset,Quote Quantity,Fee EUR
+		// 2024-03-01T10:15:00Z,TRADE,BTC,0.5,58000.00,ETH,9.1,12.50
+		if len(record[0]) < 10 {
+			return nil, fmt.Errorf("invalid trade date %q", record[0])
+		}
+		tradeDate, err := time.Parse("2006-01-02", record[0][:10])
+		if err != nil {
+			return nil, err
+		}
+
+		tradeType := strings.ToUpper(record[1])
+		switch tradeType {
+		case models.CryptoBuy, models.CryptoSell, models.CryptoTrade:
+		default:
+			return nil, fmt.Errorf("unknown trade type %q", record[1])
+		}
+
+		quantity, err := strconv.ParseFloat(record[3], 64)
+		if err != nil {
+			return nil, err
+		}
+		price, err := strconv.ParseFloat(record[4], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		trade := models.CryptoTradeRecord{
+			Date:          tradeDate.Format("2006-01-02"),
+			Type:          tradeType,
+			Asset:         strings.ToUpper(record[2]),
+			Quantity:      math.Abs(quantity),
+			ValueEURCents: int64(math.Round(price * math.Abs(quantity) * 100)),
+			QuoteAsset:    strings.ToUpper(record[5]),
+		}
+		if record[6] != "" {
+			if trade.QuoteQuantity, err = strconv.ParseFloat(record[6], 64); err != nil {
+				return nil, err
+			}
+		}
+		if record[7] != "" {
+			fee, err := strconv.ParseFloat(record[7], 64)
+			if err != nil {
+				return nil, err
+			}
+			trade.FeeEURCents = int64(math.Round(fee * 100))
+		}
+		if tradeType == models.CryptoTrade && (trade.QuoteAsset == "" || trade.QuoteQuantity <= 0) {
+			return nil, fmt.Errorf("trade on %s is missing the quote asset or quantity", trade.Date)
+		}
+
+		trades = append(trades, trade)
+	}
+
+	sort.SliceStable(trades, func(i, j int) bool { return trades[i].Date < trades[j].Date })
+	return trades, nil
+}
@@ -29,6 +29,9 @@ func TestParseVestCSV(t *testing.T) {
 	if vest.StrikePriceCents != 31847 {
 		t.Errorf("Expected price 31847, got %d", vest.StrikePriceCents)
 	}
+	if vest.OrderNumber != "RB9995EE17" || vest.Plan != "GSU Class C" {
+		t.Errorf("Expected order RB9995EE17 under GSU Class C, got %s under %s", vest.OrderNumber, vest.Plan)
+	}
 }
 
 func TestParseSaleCSV(t *testing.T) {
@@ -56,3 +59,134 @@ func TestParseSaleCSV(t *testing.T) {
 		t.Errorf("Expected price 100, got %d", sale.PriceCents)
 	}
 }
+
+func TestParseESPPCSV(t *testing.T) {
+	csvData := `Purchase Date,Offering Date,Offering FMV,Purchase FMV,Purchase Price,Quantity
+31-Dec-2024,01-Jul-2024,$180.00,$190.00,$153.00,12.5`
+
+	purchases, err := ParseESPPCSV(strings.NewReader(csvData))
+	if err != nil {
+		t.Fatalf("ParseESPPCSV failed: %v", err)
+	}
+
+	if len(purchases) != 1 {
+		t.Fatalf("Expected 1 purchase, got %d", len(purchases))
+	}
+
+	p := purchases[0]
+	if p.PurchaseDate != "2024-12-31" || p.OfferingDate != "2024-07-01" {
+		t.Errorf("Unexpected dates: %s / %s", p.PurchaseDate, p.OfferingDate)
+	}
+	if p.Quantity != 12.5 {
+		t.Errorf("Expected quantity 12.5, got %f", p.Quantity)
+	}
+	if p.PurchasePriceCents != 15300 || p.MarketValueCents != 19000 {
+		t.Errorf("Unexpected prices: paid %d, market %d", p.PurchasePriceCents, p.MarketValueCents)
+	}
+}
+
+func TestParseDividendCSV(t *testing.T) {
+	csvData := `Payment Date,Symbol,Gross Amount,Tax Withheld,Net Amount
+16-Jun-2025,GOOGL,"$1,042.00",-$156.30,$885.70
+15-Sep-2025,META,$21.00,,$21.00`
+
+	dividends, err := ParseDividendCSV(strings.NewReader(csvData))
+	if err != nil {
+		t.Fatalf("ParseDividendCSV failed: %v", err)
+	}
+
+	if len(dividends) != 2 {
+		t.Fatalf("Expected 2 dividends, got %d", len(dividends))
+	}
+
+	d := dividends[0]
+	if d.Date != "2025-06-16" || d.Symbol != "GOOGL" {
+		t.Errorf("Unexpected dividend: %+v", d)
+	}
+	if d.GrossCents != 104200 || d.WithholdingCents != 15630 {
+		t.Errorf("Unexpected amounts: gross %d, withheld %d", d.GrossCents, d.WithholdingCents)
+	}
+	if dividends[1].WithholdingCents != 0 {
+		t.Errorf("Expected no withholding, got %d", dividends[1].WithholdingCents)
+	}
+}
+
+func TestParsePriceCSV(t *testing.T) {
+	csvData := `Date,Symbol,Close
+2025-06-16,GOOGL,$176.77
+2025-06-17,BTC,"95,120.50"`
+
+	prices, err := ParsePriceCSV(strings.NewReader(csvData))
+	if err != nil {
+		t.Fatalf("ParsePriceCSV failed: %v", err)
+	}
+
+	if len(prices) != 2 {
+		t.Fatalf("Expected 2 prices, got %d", len(prices))
+	}
+	if p := prices[0]; p.Date != "2025-06-16" || p.Symbol != "GOOGL" || p.PriceCents != 17677 {
+		t.Errorf("Unexpected price: %+v", p)
+	}
+	if prices[1].PriceCents != 9512050 {
+		t.Errorf("Expected 9512050 cents, got %d", prices[1].PriceCents)
+	}
+
+	if _, err := ParsePriceCSV(strings.NewReader("Date,Symbol,Close\n16/06/2025,GOOGL,1.00")); err == nil {
+		t.Error("Expected an error for an invalid date")
+	}
+}
+
+func TestParseOHLCCSV(t *testing.T) {
+	csvData := `Date,Open,High,Low,Close,Adj Close,Volume
+2025-06-16,174.73,177.34,173.87,176.77,176.56,34539200
+2025-06-17,null,null,null,null,null,null
+2025-06-18,176.00,178.10,175.50,177.95,177.74,28101000`
+
+	prices, err := ParseOHLCCSV(strings.NewReader(csvData))
+	if err != nil {
+		t.Fatalf("ParseOHLCCSV failed: %v", err)
+	}
+
+	if len(prices) != 2 {
+		t.Fatalf("Expected 2 prices with the null row skipped, got %d", len(prices))
+	}
+	p := prices[0]
+	if p.Date != "2025-06-16" || p.OpenCents != 17473 || p.HighCents != 17734 || p.LowCents != 17387 || p.PriceCents != 17677 {
+		t.Errorf("Unexpected price: %+v", p)
+	}
+
+	if _, err := ParseOHLCCSV(strings.NewReader("Date,Close\n2025-06-16,176.77")); err == nil {
+		t.Error("Expected an error for a file without a trading range")
+	}
+}
+
+func TestParseCryptoCSV(t *testing.T) {
+	csvData := `Date,Type,Asset,Quantity,Price EUR,Quote Asset,Quote Quantity,Fee EUR
+2024-03-01T10:15:00Z,trade,BTC,0.5,58000.00,ETH,9.1,12.50
+2024-01-05,BUY,btc,1,40000.00,EUR,,5.00`
+
+	trades, err := ParseCryptoCSV(strings.NewReader(csvData))
+	if err != nil {
+		t.Fatalf("ParseCryptoCSV failed: %v", err)
+	}
+
+	if len(trades) != 2 {
+		t.Fatalf("Expected 2 trades, got %d", len(trades))
+	}
+	if trades[0].Date != "2024-01-05" || trades[0].Type != "BUY" || trades[0].Asset != "BTC" {
+		t.Errorf("Expected trades sorted by date, got %+v", trades[0])
+	}
+	trade := trades[1]
+	if trade.Type != "TRADE" || trade.QuoteAsset != "ETH" || trade.QuoteQuantity != 9.1 {
+		t.Errorf("Unexpected trade: %+v", trade)
+	}
+	if trade.ValueEURCents != 2900000 || trade.FeeEURCents != 1250 {
+		t.Errorf("Unexpected amounts: value %d, fee %d", trade.ValueEURCents, trade.FeeEURCents)
+	}
+
+	invalid := `Date,Type,Asset,Quantity,Price EUR,Quote Asset,Quote Quantity,Fee EUR
+2024-01-01,SWAP,BTC,1,1,,,`
+	if _, err := ParseCryptoCSV(strings.NewReader(invalid)); err == nil {
+		t.Error("Expected an error for an unknown trade type")
+	}
+}
@@ -16,13 +16,37 @@ type Vest struct {
 	StrikePriceCents int64 `json:"strike_price_cents"`
 	// ECBRate is the ECB reference exchange rate (EUR per 1 USD) on the vesting date.
 	ECBRate float64 `json:"ecb_rate"`
+	// Source describes how the lot was acquired, e.g. "RSU" or "CORPORATE_ACTION".
+	Source string `json:"source"`
+	// ParentID is the ID of the lot this one was derived from, if any.
+	ParentID string `json:"parent_id,omitempty"`
+	// OwnerID is the household member who owns the lot; empty for the primary taxpayer.
+	OwnerID string `json:"owner_id,omitempty"`
+	// OrderNumber and Plan identify the release in the broker's export. They
+	// are only set on imported vests and are used to reconcile the release
+	// against a grant's vesting schedule.
+	OrderNumber string `json:"order_number,omitempty"`
+	Plan        string `json:"plan,omitempty"`
 }
 
+// Lot sources recorded in Vest.Source.
+const (
+	SourceRSU             = "RSU"
+	SourceESPP            = "ESPP"
+	SourceOptionExercise  = "OPTION"
+	SourceCrypto          = "CRYPTO"
+	SourceCorporateAction = "CORPORATE_ACTION"
+	SourceTransfer        = "TRANSFER"
+	SourceNegligibleValue = "NEGLIGIBLE_VALUE"
+)
+
 // Sale represents a single stock sale event, treated as a disposal for CGT.
 type Sale struct {
 	ID string `json:"id"` // Unique identifier (UUID) for the sale event.
 	// Date of the sale in "YYYY-MM-DD" format.
 	Date string `json:"date"`
+	// Symbol is the stock ticker sold. An empty symbol matches lots of any symbol.
+	Symbol string `json:"symbol"`
 	// Quantity is the total number of shares sold in this event.
 	Quantity float64 `json:"quantity"`
 	// PriceCents is the price of a single share in USD cents at the time of sale.
@@ -32,6 +56,8 @@ type Sale struct {
 	// IsSettled is a flag indicating whether the CGT implications for this sale
 	// have been calculated and accounted for.
 	IsSettled bool `json:"is_settled"`
+	// OwnerID is the household member who made the sale; empty for the primary taxpayer.
+	OwnerID string `json:"owner_id,omitempty"`
 }
 
 // SaleLot represents a component of a Sale, linking a specific number of shares
@@ -63,9 +89,12 @@ func ParseDate(dateStr string) (time.Time, error) {
 // SettledSale represents a completed sale with its full tax breakdown.
 // This is the model for our exportable spreadsheet view.
 type SettledSale struct {
+	SaleID             string  // from Sale (or corporate_action_disposals for part disposals)
+	VestID             string  // from Vest
+	OwnerID            string  // from Sale (the household member who made the disposal)
 	SaleDate           string  // from Sale
 	Ticker             string  // from Vest
-	NumShares          float64   // from SaleLot
+	NumShares          float64 // from SaleLot
 	SalePriceUSD       int64   // from Sale
 	GainLossUSD        int64   // Calculated: (SalePriceUSD - VestPriceUSD) * NumShares
 	BookValueUSD       int64   // Calculated: VestPriceUSD * NumShares
@@ -80,3 +109,564 @@ type SettledSale struct {
 	NetProceedsEUR     int64   // Calculated: EuroSaleEUR - CGTTaxDueEUR
 	Type               string  // Always "FIFO"
 }
+
+// Corporate action types.
+const (
+	ActionSpinOff         = "SPINOFF"
+	ActionMerger          = "MERGER"
+	ActionReturnOfCapital = "RETURN_OF_CAPITAL"
+)
+
+// CorporateAction represents an event such as a spin-off, a cash-and-stock
+// merger or a return of capital. The original EUR cost of each affected lot is
+// apportioned between the continuing shares, any new shares and any cash
+// received, in proportion to their market values on the first dealing day.
+type CorporateAction struct {
+	ID string `json:"id"` // Unique identifier (UUID) for the action.
+	// Date is the effective date in "YYYY-MM-DD" format.
+	Date string `json:"date"`
+	// Type is one of ActionSpinOff, ActionMerger or ActionReturnOfCapital.
+	Type string `json:"type"`
+	// Symbol is the ticker of the security whose lots are affected.
+	Symbol string `json:"symbol"`
+	// NewSymbol is the ticker of the security received, if any.
+	NewSymbol string `json:"new_symbol"`
+	// Ratio is the number of new shares received per old share.
+	Ratio float64 `json:"ratio"`
+	// OldValueCents is the market value of one old share in USD cents after the event.
+	OldValueCents int64 `json:"old_value_cents"`
+	// NewValueCents is the market value of one new share in USD cents.
+	NewValueCents int64 `json:"new_value_cents"`
+	// CashCents is the cash received per old share in USD cents.
+	CashCents int64 `json:"cash_cents"`
+	// ECBRate is the ECB reference exchange rate (EUR per 1 USD) on the action date.
+	ECBRate float64 `json:"ecb_rate"`
+}
+
+// ESPPPurchase represents shares bought through an Employee Stock Purchase Plan.
+// The discount is taxed through payroll as income, so the CGT base cost of the
+// resulting lot is the market value on the purchase date rather than the
+// (discounted) price actually paid.
+type ESPPPurchase struct {
+	ID string `json:"id"` // Unique identifier (UUID) for the purchase.
+	// VestID is the ID of the acquisition lot created for this purchase.
+	VestID string `json:"vest_id"`
+	// Symbol is the stock ticker purchased.
+	Symbol string `json:"symbol"`
+	// PurchaseDate is the date the shares were bought, in "YYYY-MM-DD" format.
+	PurchaseDate string `json:"purchase_date"`
+	// OfferingDate is the start of the offering period, in "YYYY-MM-DD" format.
+	OfferingDate string `json:"offering_date"`
+	// Quantity is the number of shares purchased.
+	Quantity float64 `json:"quantity"`
+	// PurchasePriceCents is the discounted price paid per share in USD cents.
+	PurchasePriceCents int64 `json:"purchase_price_cents"`
+	// MarketValueCents is the market value per share in USD cents on the purchase date.
+	MarketValueCents int64 `json:"market_value_cents"`
+	// ECBRate is the ECB reference exchange rate (EUR per 1 USD) on the purchase date.
+	ECBRate float64 `json:"ecb_rate"`
+}
+
+// OptionGrant represents a grant of unapproved share options.
+type OptionGrant struct {
+	ID string `json:"id"` // Unique identifier (UUID) for the grant.
+	// Symbol is the stock ticker the options are over.
+	Symbol string `json:"symbol"`
+	// GrantDate is the date the options were granted, in "YYYY-MM-DD" format.
+	GrantDate string `json:"grant_date"`
+	// Quantity is the number of options granted.
+	Quantity float64 `json:"quantity"`
+	// ExercisePriceCents is the price payable per share on exercise, in USD cents.
+	ExercisePriceCents int64 `json:"exercise_price_cents"`
+	// ExercisedQty is the number of options already exercised (computed, not stored).
+	ExercisedQty float64 `json:"exercised_qty"`
+}
+
+// OptionExercise represents the exercise of share options and the Relevant Tax
+// on Share Options (RTSO) due on the spread. All tax amounts are in EUR cents.
+type OptionExercise struct {
+	ID string `json:"id"` // Unique identifier (UUID) for the exercise.
+	// GrantID is the foreign key referencing the parent OptionGrant.
+	GrantID string `json:"grant_id"`
+	// VestID is the ID of the acquisition lot created by the exercise.
+	VestID string `json:"vest_id"`
+	// Date of the exercise in "YYYY-MM-DD" format.
+	Date string `json:"date"`
+	// Quantity is the number of options exercised.
+	Quantity float64 `json:"quantity"`
+	// MarketPriceCents is the market value per share in USD cents on the exercise date.
+	MarketPriceCents int64 `json:"market_price_cents"`
+	// ECBRate is the ECB reference exchange rate (EUR per 1 USD) on the exercise date.
+	ECBRate float64 `json:"ecb_rate"`
+	// SpreadEURCents is the taxable gain on exercise: (market - exercise price) x quantity.
+	SpreadEURCents int64 `json:"spread_eur_cents"`
+	// IncomeTaxCents, USCCents and PRSICents make up the RTSO payable.
+	IncomeTaxCents int64 `json:"income_tax_cents"`
+	USCCents       int64 `json:"usc_cents"`
+	PRSICents      int64 `json:"prsi_cents"`
+	// RTSODueDate is the date by which the RTSO1 payment must be made (exercise + 30 days).
+	RTSODueDate string `json:"rtso_due_date"`
+}
+
+// RTSOTotalCents returns the total Relevant Tax on Share Options payable.
+func (e OptionExercise) RTSOTotalCents() int64 {
+	return e.IncomeTaxCents + e.USCCents + e.PRSICents
+}
+
+// VestPayroll holds the income-tax side of an RSU vest as reported on the
+// employer's payslip. All amounts are in EUR cents.
+type VestPayroll struct {
+	// VestID is the foreign key referencing the Vest.
+	VestID string `json:"vest_id"`
+	// TaxableEURCents is the taxable amount payroll recorded for the vest.
+	TaxableEURCents int64 `json:"taxable_eur_cents"`
+	// PAYECents, USCCents and PRSICents are the deductions reported on the payslip.
+	PAYECents int64 `json:"paye_cents"`
+	USCCents  int64 `json:"usc_cents"`
+	PRSICents int64 `json:"prsi_cents"`
+}
+
+// Dividend represents a cash dividend received on a security. Dividends are
+// income rather than CGT, but are declared on the same return together with
+// the foreign tax withheld at source.
+type Dividend struct {
+	ID string `json:"id"` // Unique identifier (UUID) for the dividend.
+	// Date is the payment date in "YYYY-MM-DD" format.
+	Date string `json:"date"`
+	// Symbol is the stock ticker that paid the dividend.
+	Symbol string `json:"symbol"`
+	// Account is the brokerage account the dividend was paid into.
+	Account string `json:"account"`
+	// GrossCents is the gross dividend in USD cents, before withholding.
+	GrossCents int64 `json:"gross_cents"`
+	// WithholdingCents is the foreign tax withheld at source in USD cents.
+	WithholdingCents int64 `json:"withholding_cents"`
+	// ECBRate is the ECB reference exchange rate (EUR per 1 USD) on the payment date.
+	ECBRate float64 `json:"ecb_rate"`
+	// OwnerID is the household member who received the dividend; empty for
+	// the primary taxpayer.
+	OwnerID string `json:"owner_id"`
+}
+
+// Asset classes recorded in Security.AssetClass.
+const (
+	// AssetClassShare is an ordinary share chargeable to CGT.
+	AssetClassShare = "SHARE"
+	// AssetClassETF is an EU-domiciled fund taxed under the gross roll-up
+	// regime (exit tax and eight-year deemed disposal) rather than CGT.
+	AssetClassETF = "ETF"
+	// AssetClassCrypto is a crypto-asset chargeable to CGT. Crypto lots and
+	// disposals are priced in EUR; see CryptoPriceScale.
+	AssetClassCrypto = "CRYPTO"
+)
+
+// CryptoPriceScale is the number of stored price units per euro cent on
+// crypto-asset lots and disposals. Tokens can be worth a small fraction of a
+// cent, so their prices are held in millionths of a cent and carry CryptoRate
+// in place of an ECB rate, converting them to euro cents as a rate would.
+const CryptoPriceScale = 1_000_000
+
+// CryptoRate is the rate recorded on crypto-asset lots and disposals.
+const CryptoRate = 1.0 / CryptoPriceScale
+
+// PriceScale returns the number of stored price units per cent of the price
+// currency of a lot or sale recorded at the given rate, and the rate that
+// converts those cents to euro cents.
+func PriceScale(rate float64) (scale, eurRate float64) {
+	if rate == CryptoRate {
+		return CryptoPriceScale, 1.0
+	}
+	return 1, rate
+}
+
+// UnitPrice returns a stored lot or sale price per unit, recorded at the given
+// rate, in cents of its price currency: USD for shares and EUR for
+// crypto-assets.
+func UnitPrice(cents int64, rate float64) float64 {
+	scale, _ := PriceScale(rate)
+	return float64(cents) / scale
+}
+
+// PriceEUR returns a stored lot or sale price per unit, recorded at the given
+// rate, in euro cents. Every reader of a stored price that needs its EUR value
+// goes through PriceEUR so that crypto-asset prices are unscaled.
+func PriceEUR(cents int64, rate float64) float64 {
+	scale, eurRate := PriceScale(rate)
+	return float64(cents) / scale * eurRate
+}
+
+// Security describes how a ticker symbol is taxed. Symbols without a Security
+// record are treated as ordinary shares.
+type Security struct {
+	// Symbol is the stock ticker, e.g. "GOOGL".
+	Symbol string `json:"symbol"`
+	// AssetClass is one of the AssetClass constants.
+	AssetClass string `json:"asset_class"`
+	// Name is an optional human-readable description.
+	Name string `json:"name"`
+}
+
+// ExitTaxDisposal is an actual or deemed disposal of an ETF lot under the
+// gross roll-up regime. All amounts are in EUR cents.
+type ExitTaxDisposal struct {
+	// SaleID is the sale that triggered the disposal (empty for deemed disposals).
+	SaleID string `json:"sale_id"`
+	// VestID is the lot disposed of.
+	VestID string `json:"vest_id"`
+	// Date of the disposal in "YYYY-MM-DD" format.
+	Date   string  `json:"date"`
+	Symbol string  `json:"symbol"`
+	Shares float64 `json:"shares"`
+	// ProceedsCents and CostCents are converted at the sale and acquisition rates respectively.
+	ProceedsCents int64 `json:"proceeds_cents"`
+	CostCents     int64 `json:"cost_cents"`
+	// GainCents may be negative, but losses give no relief beyond a credit for
+	// exit tax paid on the lot's deemed disposals.
+	GainCents int64 `json:"gain_cents"`
+	// TaxCents is negative for such a credit.
+	TaxCents int64 `json:"tax_cents"`
+	// Type is "DISPOSAL" or "DEEMED".
+	Type string `json:"type"`
+}
+
+// Crypto trade types recorded in CryptoTrade.Type.
+const (
+	CryptoBuy   = "BUY"   // Asset bought for EUR.
+	CryptoSell  = "SELL"  // Asset sold for EUR.
+	CryptoTrade = "TRADE" // Asset exchanged for QuoteAsset.
+)
+
+// CryptoTradeRecord is a single row of an exchange trade history. A crypto-to-
+// crypto trade is both a disposal of Asset and an acquisition of QuoteAsset,
+// each at the EUR market value of the trade.
+type CryptoTradeRecord struct {
+	// Date of the trade in "YYYY-MM-DD" format.
+	Date string `json:"date"`
+	// Type is one of CryptoBuy, CryptoSell or CryptoTrade.
+	Type string `json:"type"`
+	// Asset is the crypto-asset bought, sold or given up, e.g. "BTC".
+	Asset string `json:"asset"`
+	// Quantity is the number of units of Asset.
+	Quantity float64 `json:"quantity"`
+	// ValueEURCents is the EUR market value of the Quantity traded, in cents.
+	ValueEURCents int64 `json:"value_eur_cents"`
+	// QuoteAsset and QuoteQuantity describe what was received in a TRADE.
+	QuoteAsset    string  `json:"quote_asset"`
+	QuoteQuantity float64 `json:"quote_quantity"`
+	// FeeEURCents is the exchange fee in EUR cents, an allowable incidental cost.
+	FeeEURCents int64 `json:"fee_eur_cents"`
+}
+
+// Grant represents an RSU grant and its vesting schedule. TotalUnits vest in
+// Tranches equal instalments every CadenceMonths from VestStartDate; any
+// instalments falling before the cliff vest together on the cliff date.
+type Grant struct {
+	ID string `json:"id"` // Unique identifier (UUID) for the grant.
+	// GrantNumber is the broker's identifier for the grant.
+	GrantNumber string `json:"grant_number"`
+	Symbol      string `json:"symbol"`
+	// Plan is the plan name as shown on the broker's release export, e.g. "GSU Class C".
+	Plan string `json:"plan"`
+	// GrantDate and VestStartDate are in "YYYY-MM-DD" format.
+	GrantDate     string  `json:"grant_date"`
+	TotalUnits    float64 `json:"total_units"`
+	VestStartDate string  `json:"vest_start_date"`
+	// CadenceMonths is the interval between tranches, e.g. 1 for monthly or 3 for quarterly.
+	CadenceMonths int `json:"cadence_months"`
+	// Tranches is the number of instalments in the schedule.
+	Tranches int `json:"tranches"`
+	// CliffMonths is the period from VestStartDate before anything vests.
+	CliffMonths int `json:"cliff_months"`
+	// VestedUnits is the number of units released so far (calculated).
+	VestedUnits float64 `json:"vested_units"`
+	// OwnerID is the household member holding the grant; empty for the
+	// primary taxpayer.
+	OwnerID string `json:"owner_id"`
+}
+
+// UnvestedUnits returns the units of the grant not yet released.
+func (g Grant) UnvestedUnits() float64 {
+	return max(g.TotalUnits-g.VestedUnits, 0)
+}
+
+// Vest tranche statuses recorded in VestTranche.Status.
+const (
+	TrancheVested   = "VESTED"
+	TrancheOverdue  = "OVERDUE"
+	TrancheUpcoming = "UPCOMING"
+)
+
+// VestTranche is a single scheduled instalment of a Grant, together with the
+// release it was reconciled against, if any.
+type VestTranche struct {
+	GrantID string `json:"grant_id"`
+	// Number is the 1-based position of the tranche in the schedule.
+	Number int `json:"number"`
+	// Date is the scheduled vest date in "YYYY-MM-DD" format.
+	Date        string  `json:"date"`
+	ExpectedQty float64 `json:"expected_qty"`
+	// Status is TrancheVested, TrancheOverdue (past but not released) or TrancheUpcoming.
+	Status string `json:"status"`
+	// VestID, OrderNumber, ReleaseDate and ActualQty describe the matched release.
+	VestID      string  `json:"vest_id,omitempty"`
+	OrderNumber string  `json:"order_number,omitempty"`
+	ReleaseDate string  `json:"release_date,omitempty"`
+	ActualQty   float64 `json:"actual_qty,omitempty"`
+}
+
+// Person is a member of a jointly assessed household. Lots and sales with an
+// empty owner belong to the primary taxpayer, who has no Person record.
+type Person struct {
+	ID   string `json:"id"`   // Unique identifier (UUID) for the person.
+	Name string `json:"name"` // Display name.
+}
+
+// ResidencePeriod records a person's Irish tax residence status over a span of
+// dates. Disposals are chargeable while the person is resident or ordinarily
+// resident; dates not covered by any period are treated as resident.
+type ResidencePeriod struct {
+	ID string `json:"id"` // Unique identifier (UUID) for the period.
+	// OwnerID is the household member; empty for the primary taxpayer.
+	OwnerID string `json:"owner_id"`
+	// StartDate is the first day of the period in "YYYY-MM-DD" format.
+	StartDate string `json:"start_date"`
+	// EndDate is the last day of the period, or empty if it is ongoing.
+	EndDate string `json:"end_date"`
+	// Resident and OrdinarilyResident are the person's status during the period.
+	Resident           bool `json:"resident"`
+	OrdinarilyResident bool `json:"ordinarily_resident"`
+}
+
+// Transfer directions recorded in Transfer.Direction.
+const (
+	TransferIn  = "IN"
+	TransferOut = "OUT"
+)
+
+// Transfer types recorded in Transfer.Type.
+const (
+	TransferGift        = "GIFT"
+	TransferInheritance = "INHERITANCE"
+	TransferSpouse      = "SPOUSE"
+)
+
+// Transfer represents shares moving into or out of the portfolio other than by
+// a purchase or sale. Gifts and inheritances received are acquisitions at
+// market value, gifts made are disposals at market value, and transfers between
+// spouses are at no gain/no loss with the original acquisition date and cost.
+type Transfer struct {
+	ID string `json:"id"` // Unique identifier (UUID) for the transfer.
+	// Date is the date of the transfer in "YYYY-MM-DD" format.
+	Date string `json:"date"`
+	// Direction is TransferIn or TransferOut.
+	Direction string `json:"direction"`
+	// Type is one of TransferGift, TransferInheritance or TransferSpouse.
+	Type string `json:"type"`
+	// Symbol is the ticker of the shares transferred.
+	Symbol string `json:"symbol"`
+	// Quantity is the number of shares transferred.
+	Quantity float64 `json:"quantity"`
+	// MarketValueCents is the market value per share in USD cents on the
+	// transfer date. A crypto-asset is valued in EUR and, once recorded, holds
+	// its value in the units of CryptoPriceScale like its lots.
+	MarketValueCents int64 `json:"market_value_cents"`
+	// ECBRate is the ECB reference exchange rate (EUR per 1 USD) on the
+	// transfer date, applied to gifts and inheritances, or CryptoRate for a
+	// crypto-asset. Spouse transfers keep the rate of each lot in Lots instead.
+	ECBRate float64 `json:"ecb_rate"`
+	// Counterparty is the person the shares were received from or given to.
+	Counterparty string `json:"counterparty"`
+	// OriginalDate is the spouse's acquisition date, for a spouse transfer in
+	// of a single lot.
+	OriginalDate string `json:"original_date,omitempty"`
+	// OriginalCostCents is the spouse's cost per share in USD cents, for a
+	// spouse transfer in of a single lot.
+	OriginalCostCents int64 `json:"original_cost_cents,omitempty"`
+	// Lots are the spouse's lots transferred, each with its own acquisition
+	// date, cost and ECB rate. A spouse transfer in may give them in place of
+	// OriginalDate and OriginalCostCents.
+	Lots []TransferLot `json:"lots,omitempty"`
+	// OwnerID is the household member who made or received the transfer;
+	// empty for the primary taxpayer.
+	OwnerID string `json:"owner_id,omitempty"`
+	// SpouseInHousehold is set when the spouse is a household member,
+	// identified by SpouseID (empty for the primary taxpayer). The shares then
+	// move between the two members' pools and both sides are recorded.
+	SpouseInHousehold bool   `json:"spouse_in_household,omitempty"`
+	SpouseID          string `json:"spouse_id,omitempty"`
+	// LinkedID is the matching transfer recorded for a household spouse.
+	LinkedID string `json:"linked_id,omitempty"`
+	// VestID is the lot created by a transfer in of a single lot.
+	VestID string `json:"vest_id,omitempty"`
+	// SaleID is the disposal recorded for a gift made.
+	SaleID string `json:"sale_id,omitempty"`
+}
+
+// TransferLot is one lot moved by a spouse transfer.
+type TransferLot struct {
+	// VestID is the lot given up by a transfer out, or created by a transfer in.
+	VestID string `json:"vest_id"`
+	// Date is the original acquisition date of the lot in "YYYY-MM-DD" format.
+	Date string `json:"date"`
+	// Quantity is the number of shares transferred from the lot.
+	Quantity float64 `json:"quantity"`
+	// CostCents is the original cost per share in USD cents.
+	CostCents int64 `json:"cost_cents"`
+	// ECBRate is the ECB reference exchange rate on the original acquisition date.
+	ECBRate float64 `json:"ecb_rate"`
+}
+
+// Price is a closing price for a security on a date, used to value open lots
+// and to check recorded vest and sale prices.
+type Price struct {
+	Symbol string `json:"symbol"`
+	// Date is the price date in "YYYY-MM-DD" format.
+	Date string `json:"date"`
+	// PriceCents is the closing price per share in USD cents (EUR cents for crypto-assets).
+	PriceCents int64 `json:"price_cents"`
+	// OpenCents, HighCents and LowCents complete the day's trading range when
+	// imported from an OHLC history; they are zero for a closing price only.
+	OpenCents int64 `json:"open_cents,omitempty"`
+	HighCents int64 `json:"high_cents,omitempty"`
+	LowCents  int64 `json:"low_cents,omitempty"`
+	// Source is "CSV", "MANUAL" or the name of the price provider.
+	Source string `json:"source"`
+}
+
+// Range returns the day's low and high, falling back to the close when no
+// trading range was recorded.
+func (p Price) Range() (low, high int64) {
+	if p.LowCents <= 0 || p.HighCents <= 0 {
+		return p.PriceCents, p.PriceCents
+	}
+	return p.LowCents, p.HighCents
+}
+
+// Attachment is a piece of evidence, such as a broker confirmation or release
+// statement, attached to a vest or sale and included in the audit pack.
+type Attachment struct {
+	ID string `json:"id"` // Unique identifier (UUID) for the attachment.
+	// EntityType is AttachmentVest or AttachmentSale, and EntityID the record's ID.
+	EntityType  string `json:"entity_type"`
+	EntityID    string `json:"entity_id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	// UploadedAt is the upload time in RFC 3339 format.
+	UploadedAt string `json:"uploaded_at"`
+	// Data is the file content. It is only loaded when building an audit pack.
+	Data []byte `json:"-"`
+}
+
+// Record types an Attachment can belong to.
+const (
+	AttachmentVest = "VEST"
+	AttachmentSale = "SALE"
+)
+
+// YearClosure records a person's tax year as closed once the return is filed.
+// While Locked, transactions dated in the year cannot be added or settled.
+type YearClosure struct {
+	OwnerID string `json:"owner_id"`
+	Year    int    `json:"year"`
+	// ClosedAt is the time the year was last closed, in RFC 3339 format.
+	ClosedAt string `json:"closed_at"`
+	Locked   bool   `json:"locked"`
+	// TaxCents is the CGT for the year in EUR cents when it was last closed.
+	TaxCents int64 `json:"tax_cents"`
+}
+
+// YearAmendment records the reopening of a closed tax year to amend its
+// return, and the tax before and after once the year is closed again.
+type YearAmendment struct {
+	ID      string `json:"id"` // Unique identifier (UUID) for the amendment.
+	OwnerID string `json:"owner_id"`
+	Year    int    `json:"year"`
+	Reason  string `json:"reason"`
+	// ReopenedAt and ClosedAt are RFC 3339 times; ClosedAt is empty while the
+	// amendment is in progress.
+	ReopenedAt string `json:"reopened_at"`
+	ClosedAt   string `json:"closed_at"`
+	// FiledTaxCents and AmendedTaxCents are the year's CGT in EUR cents as
+	// filed and as amended.
+	FiledTaxCents   int64 `json:"filed_tax_cents"`
+	AmendedTaxCents int64 `json:"amended_tax_cents"`
+}
+
+// CGT payment periods recorded in CGTPayment.Period.
+const (
+	PaymentPeriodInitial = "INITIAL" // Disposals from 1 January to 30 November.
+	PaymentPeriodLater   = "LATER"   // Disposals in December.
+)
+
+// CGTPayment is a payment of Capital Gains Tax made to Revenue.
+type CGTPayment struct {
+	ID      string `json:"id"` // Unique identifier (UUID) for the payment.
+	OwnerID string `json:"owner_id"`
+	// Date is the payment date in "YYYY-MM-DD" format.
+	Date        string `json:"date"`
+	AmountCents int64  `json:"amount_cents"` // Amount paid in EUR cents.
+	// Year and Period identify the liability the payment is for.
+	Year   int    `json:"year"`
+	Period string `json:"period"`
+	// Reference is the ROS or bank reference for the payment.
+	Reference string `json:"reference"`
+}
+
+// RateFailure records a transaction that could not be recorded because its
+// ECB exchange rate could not be fetched, so that it can be followed up.
+type RateFailure struct {
+	ID string `json:"id"` // Unique identifier (UUID) for the failure.
+	// Record describes the transaction, e.g. "vest of GOOGL".
+	Record string `json:"record"`
+	// Date is the transaction's rate date in "YYYY-MM-DD" format.
+	Date  string `json:"date"`
+	Error string `json:"error"`
+	// FailedAt is the time of the failure in RFC 3339 format.
+	FailedAt string `json:"failed_at"`
+}
+
+// Portfolio events delivered to webhooks.
+const (
+	EventVestAdded       = "vest.added"
+	EventSaleAdded       = "sale.added"
+	EventSaleSettled     = "sale.settled"
+	EventSaleUnsettled   = "sale.unsettled"
+	EventImportCompleted = "import.completed"
+	EventYearClosed      = "year.closed"
+)
+
+// Webhook delivery statuses recorded in WebhookDelivery.Status.
+const (
+	DeliveryPending   = "PENDING"   // Waiting for its first or next attempt.
+	DeliveryDelivered = "DELIVERED" // Accepted by the endpoint with a 2xx response.
+	DeliveryFailed    = "FAILED"    // Abandoned after the last retry.
+)
+
+// Webhook is an endpoint that receives signed JSON payloads for portfolio events.
+type Webhook struct {
+	ID  string `json:"id"` // Unique identifier (UUID) for the webhook.
+	URL string `json:"url"`
+	// Secret signs each payload with HMAC-SHA256.
+	Secret string `json:"-"`
+	// Events are the events delivered to the webhook; empty for every event.
+	Events    []string `json:"events"`
+	CreatedAt string   `json:"created_at"` // RFC 3339 time the webhook was added.
+}
+
+// WebhookDelivery is one event queued for, or delivered to, a webhook.
+type WebhookDelivery struct {
+	ID        string `json:"id"` // Unique identifier (UUID) for the delivery.
+	WebhookID string `json:"webhook_id"`
+	Event     string `json:"event"`
+	// Payload is the JSON body posted to the webhook.
+	Payload  string `json:"payload"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	// ResponseCode and Error describe the last attempt.
+	ResponseCode int    `json:"response_code"`
+	Error        string `json:"error"`
+	// CreatedAt, NextAttemptAt and DeliveredAt are RFC 3339 times.
+	CreatedAt     string `json:"created_at"`
+	NextAttemptAt string `json:"next_attempt_at"`
+	DeliveredAt   string `json:"delivered_at"`
+}
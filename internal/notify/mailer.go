@@ -0,0 +1,64 @@
+// Package notify delivers notifications to the user by email.
+package notify
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Mailer sends a plain-text email to the configured recipients.
+type Mailer interface {
+	Send(subject, body string) error
+}
+
+// SMTPMailer sends email through an SMTP server, e.g. a mail provider's
+// submission port or a local sink such as MailHog for testing. The connection
+// is upgraded with STARTTLS when the server offers it.
+type SMTPMailer struct {
+	Host string
+	Port string
+	// Username and Password are optional; PLAIN authentication is used when a
+	// username is set.
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Send delivers one message to every recipient.
+func (m *SMTPMailer) Send(subject, body string) error {
+	if m.Host == "" || m.From == "" || len(m.To) == 0 {
+		return fmt.Errorf("SMTP mailer requires a host, sender and recipients")
+	}
+	port := m.Port
+	if port == "" {
+		port = "25"
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	if err := smtp.SendMail(net.JoinHostPort(m.Host, port), auth, m.From, m.To, m.message(subject, body)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// message formats the headers and body with CRLF line endings.
+func (m *SMTPMailer) message(subject, body string) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + m.From + "\r\n")
+	b.WriteString("To: " + strings.Join(m.To, ", ") + "\r\n")
+	b.WriteString("Subject: " + strings.NewReplacer("\r", "", "\n", " ").Replace(subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
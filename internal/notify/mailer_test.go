@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+// smtpSink accepts one SMTP session and returns the commands and message data
+// it received.
+func smtpSink(t *testing.T) (addr string, received chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received = make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+		var lines []string
+		reply("220 sink ready")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+			case "EHLO", "HELO", "MAIL", "RCPT":
+				reply("250 OK")
+			case "DATA":
+				reply("354 end with .")
+				for {
+					data, err := r.ReadString('\n')
+					if err != nil || data == ".\r\n" {
+						break
+					}
+					lines = append(lines, strings.TrimRight(data, "\r\n"))
+				}
+				reply("250 queued")
+			case "QUIT":
+				reply("221 bye")
+				received <- lines
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+		received <- lines
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	addr, received := smtpSink(t)
+	host, port, _ := net.SplitHostPort(addr)
+
+	m := &SMTPMailer{Host: host, Port: port, From: "tracker@example.com", To: []string{"a@example.com", "b@example.com"}}
+	if err := m.Send("CGT due\nsoon", "Pay by 15 December.\nReference CG1."); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	session := strings.Join(<-received, "\n")
+	for _, want := range []string{
+		"MAIL FROM:<tracker@example.com>",
+		"RCPT TO:<a@example.com>",
+		"RCPT TO:<b@example.com>",
+		"To: a@example.com, b@example.com",
+		"Subject: CGT due soon",
+		"Pay by 15 December.\nReference CG1.",
+	} {
+		if !strings.Contains(session, want) {
+			t.Errorf("expected %q in the session:\n%s", want, session)
+		}
+	}
+
+	if err := (&SMTPMailer{Host: host}).Send("x", "y"); err == nil {
+		t.Error("expected a mailer without recipients to be refused")
+	}
+}
@@ -0,0 +1,73 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDocumentWriteTo(t *testing.T) {
+	d := New(A4Height, A4Width)
+	d.SetTitle("CGT (2024)")
+	d.Text(36, 50, Bold, 14, "Gain (€)")
+	d.AddPage()
+	d.TextRight(200, 50, Regular, 10, "1,234.56")
+	d.Line(36, 60, 200, 60, 0.5)
+	if d.PageCount() != 2 {
+		t.Fatalf("expected 2 pages, got %d", d.PageCount())
+	}
+
+	var buf bytes.Buffer
+	if _, err := d.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	out := buf.Bytes()
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatal("unexpected file framing")
+	}
+	if !bytes.Contains(out, []byte("/Count 2")) || !bytes.Contains(out, []byte("/Title (CGT \\(2024\\))")) {
+		t.Error("expected two pages and the escaped title")
+	}
+
+	// Every cross-reference entry points at its object.
+	start, _ := strconv.Atoi(string(regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(out)[1]))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n`).FindAllSubmatch(out[start:], -1)
+	if len(entries) != 9 {
+		t.Fatalf("expected 9 objects, got %d", len(entries))
+	}
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		if !bytes.HasPrefix(out[off:], []byte(fmt.Sprintf("%d 0 obj", i+1))) {
+			t.Errorf("xref entry %d does not point at its object", i+1)
+		}
+	}
+
+	// The first page's content stream draws the title in the euro encoding.
+	i := bytes.Index(out, []byte("stream\n")) + len("stream\n")
+	zr, err := zlib.NewReader(bytes.NewReader(out[i:]))
+	if err != nil {
+		t.Fatalf("content stream not compressed: %v", err)
+	}
+	content, _ := io.ReadAll(zr)
+	if !strings.Contains(string(content), "BT /F2 14 Tf 36 545.28 Td (Gain \\(\x80\\)) Tj ET") {
+		t.Errorf("unexpected content: %q", content)
+	}
+}
+
+func TestTextWidthAndWrap(t *testing.T) {
+	if w := TextWidth(Regular, 10, "10.00"); w != 25.02 {
+		t.Errorf("unexpected width %v", w)
+	}
+	if TextWidth(Bold, 10, "Rate") <= TextWidth(Regular, 10, "Rate") {
+		t.Error("expected bold text to be wider")
+	}
+	lines := Wrap(Regular, 10, 60, "the quick brown fox jumps\nover")
+	if len(lines) != 4 || lines[0] != "the quick" || lines[3] != "over" {
+		t.Errorf("unexpected lines: %q", lines)
+	}
+}
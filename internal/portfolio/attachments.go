@@ -0,0 +1,94 @@
+package portfolio
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"irish-cgt-tracker/internal/models"
+)
+
+// MaxAttachmentBytes is the largest evidence file accepted.
+const MaxAttachmentBytes = 10 << 20
+
+// AddAttachment stores an evidence file against a vest or sale.
+//
+// Parameters:
+//   - a: The attachment, including its data. ID and UploadedAt are populated
+//     by this method, and Filename is reduced to its base name.
+//
+// Returns:
+//   - A pointer to the stored models.Attachment.
+//   - An error if the record does not exist, the file is empty or too large,
+//     or the database insertion fails.
+func (s *Service) AddAttachment(a models.Attachment) (*models.Attachment, error) {
+	var table string
+	switch a.EntityType {
+	case models.AttachmentVest:
+		table = "vests"
+	case models.AttachmentSale:
+		table = "sales"
+	default:
+		return nil, fmt.Errorf("unknown attachment record type %q", a.EntityType)
+	}
+	if len(a.Data) == 0 || len(a.Data) > MaxAttachmentBytes {
+		return nil, fmt.Errorf("an attachment must be between 1 byte and %d MB", MaxAttachmentBytes>>20)
+	}
+	a.Filename = filepath.Base(a.Filename)
+	if a.Filename == "." || a.Filename == string(filepath.Separator) {
+		return nil, fmt.Errorf("an attachment requires a file name")
+	}
+
+	var exists int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE id = ?", a.EntityID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if exists == 0 {
+		return nil, fmt.Errorf("%s %s not found", a.EntityType, a.EntityID)
+	}
+
+	a.ID = uuid.New().String()
+	a.UploadedAt = time.Now().UTC().Format(time.RFC3339)
+	query := `INSERT INTO attachments (id, entity_type, entity_id, filename, content_type, data, uploaded_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	if _, err := s.db.Exec(query, a.ID, a.EntityType, a.EntityID, a.Filename, a.ContentType, a.Data, a.UploadedAt); err != nil {
+		return nil, fmt.Errorf("failed to insert attachment: %w", err)
+	}
+	return &a, nil
+}
+
+// GetAttachments retrieves the details of all attachments, without their data,
+// newest first.
+func (s *Service) GetAttachments() ([]models.Attachment, error) {
+	return s.queryAttachments(`
+		SELECT id, entity_type, entity_id, filename, content_type, uploaded_at, NULL
+		FROM attachments ORDER BY uploaded_at DESC`)
+}
+
+// getAttachmentsWithData retrieves all attachments including their content,
+// oldest first.
+func (s *Service) getAttachmentsWithData() ([]models.Attachment, error) {
+	return s.queryAttachments(`
+		SELECT id, entity_type, entity_id, filename, content_type, uploaded_at, data
+		FROM attachments ORDER BY uploaded_at ASC`)
+}
+
+// queryAttachments scans attachment rows selected in the column order used above.
+func (s *Service) queryAttachments(query string) ([]models.Attachment, error) {
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []models.Attachment
+	for rows.Next() {
+		var a models.Attachment
+		if err := rows.Scan(&a.ID, &a.EntityType, &a.EntityID, &a.Filename, &a.ContentType, &a.UploadedAt, &a.Data); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, nil
+}
@@ -0,0 +1,449 @@
+package portfolio
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"irish-cgt-tracker/internal/models"
+)
+
+// Provenance notes recorded against each exchange rate in an audit pack.
+const (
+	RateProvenanceECB  = "ECB euro reference rate for USD on the date, or the last rate published before it (retrieved from the Frankfurter API)"
+	RateProvenanceEUR  = "Priced in EUR; no conversion"
+	RateProvenanceLot  = "Acquisition rate of the original lot"
+	RateProvenanceNone = "Not converted"
+)
+
+// RateRecord is an exchange rate used in the year's records and where it came from.
+type RateRecord struct {
+	Date       string  `json:"date"`
+	Rate       float64 `json:"rate"`
+	Provenance string  `json:"provenance"`
+	// Record identifies what the rate was applied to, e.g. "VEST <id>".
+	Record string `json:"record"`
+}
+
+// AuditPack is everything behind one person's CGT return for a tax year.
+type AuditPack struct {
+	Year        int           `json:"year"`
+	Person      string        `json:"person"`
+	GeneratedAt string        `json:"generated_at"`
+	Worksheet   *CGTWorksheet `json:"worksheet"`
+	// Vests are the lots acquired in the year and those disposed of in it.
+	Vests []models.Vest `json:"vests"`
+	Sales []models.Sale `json:"sales"`
+	// MatchedLots is the calculation breakdown of each sale against each lot.
+	MatchedLots      []models.SettledSale     `json:"matched_lots"`
+	Rates            []RateRecord             `json:"rates"`
+	CorporateActions []models.CorporateAction `json:"corporate_actions"`
+	ExitTaxDisposals []models.ExitTaxDisposal `json:"exit_tax_disposals"`
+	// Attachments lists the evidence for the pack's vests and sales.
+	Attachments []models.Attachment `json:"attachments"`
+}
+
+// GetAuditPack gathers the records behind the Service's person's CGT return
+// for a tax year: the worksheet, every sale in the year with its lot-by-lot
+// calculation, the vests acquired or disposed of, each exchange rate with its
+// provenance, the corporate actions and ETF disposals affecting the person's
+// lots and attached evidence.
+//
+// Parameters:
+//   - year: The tax year.
+//
+// Returns:
+//   - The AuditPack, with attachment data loaded.
+//   - An error if a database query fails.
+func (s *Service) GetAuditPack(year int) (*AuditPack, error) {
+	ws, err := s.GetCGTWorksheet(year)
+	if err != nil {
+		return nil, err
+	}
+	pack := &AuditPack{Year: year, Person: ws.Person, GeneratedAt: time.Now().UTC().Format(time.RFC3339), Worksheet: ws}
+	inYear := func(date string) bool { return disposalYear(date) == year }
+
+	securities, err := s.GetSecurities()
+	if err != nil {
+		return nil, err
+	}
+	crypto := map[string]bool{}
+	for _, sec := range securities {
+		crypto[sec.Symbol] = sec.AssetClass == models.AssetClassCrypto
+	}
+
+	sales, err := s.GetAllSales()
+	if err != nil {
+		return nil, err
+	}
+	records := map[string]bool{}
+	for i := len(sales) - 1; i >= 0; i-- { // Oldest first.
+		sale := sales[i].Sale
+		if sale.OwnerID != s.owner || !inYear(sale.Date) {
+			continue
+		}
+		pack.Sales = append(pack.Sales, sale)
+		records[models.AttachmentSale+sale.ID] = true
+		provenance := RateProvenanceECB
+		if crypto[sale.Symbol] {
+			provenance = RateProvenanceEUR
+		}
+		_, rate := models.PriceScale(sale.ECBRate)
+		pack.Rates = append(pack.Rates, RateRecord{Date: sale.Date, Rate: rate, Provenance: provenance, Record: models.AttachmentSale + " " + sale.ID})
+	}
+
+	if pack.MatchedLots, err = s.getSettledSalesForOwner(year); err != nil {
+		return nil, err
+	}
+	disposed := map[string]bool{}
+	for _, m := range pack.MatchedLots {
+		disposed[m.VestID] = true
+	}
+
+	vests, err := s.getVests()
+	if err != nil {
+		return nil, err
+	}
+	owned := map[string]bool{}
+	for _, v := range vests {
+		owned[v.ID] = v.OwnerID == s.owner
+		if v.OwnerID != s.owner || !(inYear(v.Date) || disposed[v.ID]) {
+			continue
+		}
+		pack.Vests = append(pack.Vests, v)
+		records[models.AttachmentVest+v.ID] = true
+		provenance := RateProvenanceECB
+		switch {
+		case v.Source == models.SourceCrypto || crypto[v.Symbol]:
+			provenance = RateProvenanceEUR
+		case v.ParentID != "":
+			provenance = RateProvenanceLot
+		}
+		_, rate := models.PriceScale(v.ECBRate)
+		pack.Rates = append(pack.Rates, RateRecord{Date: v.Date, Rate: rate, Provenance: provenance, Record: models.AttachmentVest + " " + v.ID})
+	}
+
+	actions, err := s.GetCorporateActions()
+	if err != nil {
+		return nil, err
+	}
+	affected, err := s.getOwnerCorporateActionIDs()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(actions) - 1; i >= 0; i-- {
+		if a := actions[i]; inYear(a.Date) && affected[a.ID] {
+			pack.CorporateActions = append(pack.CorporateActions, a)
+			pack.Rates = append(pack.Rates, RateRecord{Date: a.Date, Rate: a.ECBRate, Provenance: RateProvenanceECB, Record: "CORPORATE_ACTION " + a.ID})
+		}
+	}
+
+	exitTax, err := s.GetExitTaxDisposals()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(exitTax) - 1; i >= 0; i-- {
+		if d := exitTax[i]; inYear(d.Date) && owned[d.VestID] && (d.SaleID == "" || records[models.AttachmentSale+d.SaleID]) {
+			pack.ExitTaxDisposals = append(pack.ExitTaxDisposals, d)
+		}
+	}
+
+	attachments, err := s.getAttachmentsWithData()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range attachments {
+		if records[a.EntityType+a.EntityID] {
+			pack.Attachments = append(pack.Attachments, a)
+		}
+	}
+	return pack, nil
+}
+
+// WriteAuditPack writes the audit pack for a tax year as a zip archive
+// containing a human-readable summary, the full pack as JSON, a CSV per record
+// type and the attached evidence under evidence/.
+//
+// Parameters:
+//   - w: The destination of the archive.
+//   - year: The tax year.
+//
+// Returns:
+//   - An error if the pack cannot be built or written.
+func (s *Service) WriteAuditPack(w io.Writer, year int) error {
+	pack, err := s.GetAuditPack(year)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	if err := writeZipFile(zw, "summary.txt", []byte(pack.Summary())); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(pack, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeZipFile(zw, "pack.json", data); err != nil {
+		return err
+	}
+
+	tables := []struct {
+		name   string
+		header []string
+		rows   [][]string
+	}{
+		{"vests.csv", []string{"ID", "Date", "Symbol", "Quantity", "Price", "ECB Rate", "Source", "Parent ID"}, vestRows(pack.Vests)},
+		{"sales.csv", []string{"ID", "Date", "Symbol", "Quantity", "Price", "ECB Rate", "Settled"}, saleRows(pack.Sales)},
+		{"matched_lots.csv", matchedLotHeader, matchedLotRows(pack.MatchedLots)},
+		{"rates.csv", []string{"Date", "Rate", "Provenance", "Record"}, rateRows(pack.Rates)},
+		{"corporate_actions.csv", []string{"ID", "Date", "Type", "Symbol", "New Symbol", "Ratio", "Old Value", "New Value", "Cash", "ECB Rate"}, actionRows(pack.CorporateActions)},
+		{"exit_tax.csv", []string{"Sale ID", "Vest ID", "Date", "Symbol", "Shares", "Proceeds EUR", "Cost EUR", "Gain EUR", "Tax EUR", "Type"}, exitTaxRows(pack.ExitTaxDisposals)},
+	}
+	for _, t := range tables {
+		if err := writeZipCSV(zw, t.name, t.header, t.rows); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range pack.Attachments {
+		name := path.Join("evidence", strings.ToLower(a.EntityType)+"-"+a.EntityID, a.ID[:8]+"-"+a.Filename)
+		if err := writeZipFile(zw, name, a.Data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// Summary returns a plain-text account of the year's computation and of each
+// disposal, for a reader without the application.
+func (p *AuditPack) Summary() string {
+	var b strings.Builder
+	ws := p.Worksheet
+	fmt.Fprintf(&b, "Capital Gains Tax audit pack: %s, tax year %d\n", p.Person, p.Year)
+	fmt.Fprintf(&b, "Generated %s\n\n", p.GeneratedAt)
+
+	fmt.Fprintf(&b, "COMPUTATION (EUR)\n")
+	lines := []struct {
+		label string
+		cents int64
+	}{
+		{"Consideration", ws.ConsiderationCents},
+		{"Chargeable gains", ws.ChargeableGainsCents},
+		{"Losses in year", ws.LossesCents},
+		{"Losses brought forward used", ws.LossesBroughtForwardCents},
+		{"Personal exemption", ws.ExemptionCents},
+		{"Net chargeable gain", ws.NetChargeableGainCents},
+		{"Capital gains tax", ws.TaxCents},
+		{"Losses carried forward", ws.LossesCarriedForwardCents},
+	}
+	for _, l := range lines {
+		fmt.Fprintf(&b, "  %-30s %12s\n", l.label, centsString(l.cents))
+	}
+	for _, period := range ws.Periods {
+		fmt.Fprintf(&b, "  %-30s %12s due %s\n", period.Label, centsString(period.TaxCents), period.DueDate)
+	}
+
+	fmt.Fprintf(&b, "\nDISPOSALS\n")
+	if len(p.MatchedLots) == 0 {
+		fmt.Fprintf(&b, "  None.\n")
+	}
+	acquired := map[string]string{}
+	for _, v := range p.Vests {
+		acquired[v.ID] = v.Date
+	}
+	for _, m := range p.MatchedLots {
+		fmt.Fprintf(&b, "  %s %s: %g shares acquired %s (%s)\n", m.SaleDate, m.Ticker, m.NumShares, acquired[m.VestID], m.Type)
+		fmt.Fprintf(&b, "    Proceeds %s x %.4f = EUR %s; cost %s x %.4f; gain EUR %s\n",
+			centsString(m.GrossProceedUSD), m.ExchangeRateAtSale, centsString(m.EuroSaleEUR),
+			centsString(m.BookValueUSD), m.ExchangeRateAtVest, centsString(m.EuroGainEUR))
+	}
+
+	fmt.Fprintf(&b, "\nCONTENTS\n")
+	fmt.Fprintf(&b, "  %d vests, %d sales, %d matched lots, %d rates, %d corporate actions, %d ETF disposals, %d evidence files\n",
+		len(p.Vests), len(p.Sales), len(p.MatchedLots), len(p.Rates), len(p.CorporateActions), len(p.ExitTaxDisposals), len(p.Attachments))
+	fmt.Fprintf(&b, "  Prices are in USD (EUR for crypto-assets); rates are EUR per 1 USD.\n")
+	return b.String()
+}
+
+// getSettledSalesForOwner retrieves the Service's person's settled lots with a
+// sale date in the year, oldest first.
+func (s *Service) getSettledSalesForOwner(year int) ([]models.SettledSale, error) {
+	rows, err := s.db.Query(`
+		SELECT COALESCE(sale_id, ''), COALESCE(vest_id, ''), owner_id, sale_date, ticker, num_shares, sale_price_usd, gain_loss_usd, book_value_usd,
+		       exchange_rate_at_vest, gross_proceed_usd, vesting_value_usd, exchange_rate_at_sale,
+		       euro_sale_eur, euro_gain_eur, cgt_tax_due_eur, completed, net_proceeds_eur, type
+		FROM settled_sales WHERE owner_id = ? AND sale_date LIKE ? ORDER BY sale_date ASC`, s.owner, fmt.Sprintf("%d-%%", year))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sales []models.SettledSale
+	for rows.Next() {
+		var ss models.SettledSale
+		if err := rows.Scan(&ss.SaleID, &ss.VestID, &ss.OwnerID, &ss.SaleDate, &ss.Ticker, &ss.NumShares, &ss.SalePriceUSD, &ss.GainLossUSD, &ss.BookValueUSD,
+			&ss.ExchangeRateAtVest, &ss.GrossProceedUSD, &ss.VestingValueUSD, &ss.ExchangeRateAtSale,
+			&ss.EuroSaleEUR, &ss.EuroGainEUR, &ss.CGTTaxDueEUR, &ss.Completed, &ss.NetProceedsEUR, &ss.Type); err != nil {
+			return nil, err
+		}
+		sales = append(sales, ss)
+	}
+	return sales, nil
+}
+
+// getOwnerCorporateActionIDs returns the IDs of the corporate actions that
+// apportioned one of the Service's person's lots.
+func (s *Service) getOwnerCorporateActionIDs() (map[string]bool, error) {
+	rows, err := s.db.Query(`
+		SELECT DISTINCT la.reference_id FROM lot_adjustments la
+		JOIN vests v ON v.id = la.vest_id
+		WHERE la.reason = ? AND v.owner_id = ?`, models.SourceCorporateAction, s.owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+// getVests retrieves every vest, including fully disposed lots, oldest first.
+func (s *Service) getVests() ([]models.Vest, error) {
+	rows, err := s.db.Query(`
+		SELECT id, date, symbol, quantity, strike_price_cents, ecb_rate, source, COALESCE(parent_id, ''), owner_id
+		FROM vests ORDER BY date ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var vests []models.Vest
+	for rows.Next() {
+		var v models.Vest
+		if err := rows.Scan(&v.ID, &v.Date, &v.Symbol, &v.Quantity, &v.StrikePriceCents, &v.ECBRate, &v.Source, &v.ParentID, &v.OwnerID); err != nil {
+			return nil, err
+		}
+		vests = append(vests, v)
+	}
+	return vests, nil
+}
+
+// matchedLotHeader names the columns of matched_lots.csv, which follow the
+// settled sales export.
+var matchedLotHeader = []string{"Sale ID", "Vest ID", "Sale Date", "Ticker", "Shares", "Sale Price USD", "Gain/Loss USD", "Book Value USD",
+	"Rate at Vest", "Gross Proceeds USD", "Vesting Value USD", "Rate at Sale", "Proceeds EUR", "Gain EUR", "CGT EUR", "Net Proceeds EUR", "Type"}
+
+func vestRows(vests []models.Vest) [][]string {
+	var rows [][]string
+	for _, v := range vests {
+		rows = append(rows, []string{v.ID, v.Date, v.Symbol, floatString(v.Quantity), priceString(v.StrikePriceCents, v.ECBRate), rateString(v.ECBRate), v.Source, v.ParentID})
+	}
+	return rows
+}
+
+func saleRows(sales []models.Sale) [][]string {
+	var rows [][]string
+	for _, s := range sales {
+		rows = append(rows, []string{s.ID, s.Date, s.Symbol, floatString(s.Quantity), priceString(s.PriceCents, s.ECBRate), rateString(s.ECBRate), strconv.FormatBool(s.IsSettled)})
+	}
+	return rows
+}
+
+func matchedLotRows(lots []models.SettledSale) [][]string {
+	var rows [][]string
+	for _, m := range lots {
+		rows = append(rows, []string{m.SaleID, m.VestID, m.SaleDate, m.Ticker, floatString(m.NumShares), centsString(m.SalePriceUSD),
+			centsString(m.GainLossUSD), centsString(m.BookValueUSD), floatString(m.ExchangeRateAtVest), centsString(m.GrossProceedUSD),
+			centsString(m.VestingValueUSD), floatString(m.ExchangeRateAtSale), centsString(m.EuroSaleEUR), centsString(m.EuroGainEUR),
+			centsString(m.CGTTaxDueEUR), centsString(m.NetProceedsEUR), m.Type})
+	}
+	return rows
+}
+
+func rateRows(rates []RateRecord) [][]string {
+	var rows [][]string
+	for _, r := range rates {
+		rows = append(rows, []string{r.Date, floatString(r.Rate), r.Provenance, r.Record})
+	}
+	return rows
+}
+
+func actionRows(actions []models.CorporateAction) [][]string {
+	var rows [][]string
+	for _, a := range actions {
+		rows = append(rows, []string{a.ID, a.Date, a.Type, a.Symbol, a.NewSymbol, floatString(a.Ratio), centsString(a.OldValueCents),
+			centsString(a.NewValueCents), centsString(a.CashCents), floatString(a.ECBRate)})
+	}
+	return rows
+}
+
+func exitTaxRows(disposals []models.ExitTaxDisposal) [][]string {
+	var rows [][]string
+	for _, d := range disposals {
+		rows = append(rows, []string{d.SaleID, d.VestID, d.Date, d.Symbol, floatString(d.Shares), centsString(d.ProceedsCents),
+			centsString(d.CostCents), centsString(d.GainCents), centsString(d.TaxCents), d.Type})
+	}
+	return rows
+}
+
+// writeZipCSV adds a CSV file with a header row to the archive.
+func writeZipCSV(zw *zip.Writer, name string, header []string, rows [][]string) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	out := csv.NewWriter(f)
+	out.Write(header)
+	out.WriteAll(rows)
+	return out.Error()
+}
+
+// writeZipFile adds a file to the archive.
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// centsString formats an amount in cents as major units with two decimals.
+func centsString(cents int64) string {
+	return strconv.FormatFloat(float64(cents)/100, 'f', 2, 64)
+}
+
+// priceString formats a stored lot or sale price per unit in units of its
+// currency. Crypto-asset prices keep the precision of models.CryptoPriceScale,
+// which is a millionth of a cent.
+func priceString(cents int64, rate float64) string {
+	if scale, _ := models.PriceScale(rate); scale == 1 {
+		return centsString(cents)
+	}
+	return strconv.FormatFloat(models.UnitPrice(cents, rate)/100, 'f', 8, 64)
+}
+
+// rateString formats the rate converting a lot or sale price to EUR.
+func rateString(rate float64) string {
+	_, eurRate := models.PriceScale(rate)
+	return floatString(eurRate)
+}
+
+// floatString formats a quantity or rate without trailing zeros.
+func floatString(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,199 @@
+package portfolio
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strings"
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestWriteAuditPack(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 0.9)
+
+	s := NewService(database)
+	vest, err := s.AddVest("2020-01-10", "ACME", 10, 10000)
+	if err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	if _, err := s.AddVest("2023-06-01", "ACME", 5, 12000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	sale, _ := s.AddSale("2024-03-01", "ACME", 4, 40000)
+	if err := s.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+	other, _ := s.AddSale("2023-03-01", "ACME", 1, 30000)
+	if err := s.SettleSale(other.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+
+	if _, err := s.AddAttachment(models.Attachment{EntityType: models.AttachmentSale, EntityID: sale.ID, Filename: "../confirm.pdf", Data: []byte("%PDF")}); err != nil {
+		t.Fatalf("AddAttachment failed: %v", err)
+	}
+	if _, err := s.AddAttachment(models.Attachment{EntityType: models.AttachmentSale, EntityID: other.ID, Filename: "old.pdf", Data: []byte("%PDF")}); err != nil {
+		t.Fatalf("AddAttachment failed: %v", err)
+	}
+	if _, err := s.AddAttachment(models.Attachment{EntityType: models.AttachmentVest, EntityID: "missing", Filename: "x.pdf", Data: []byte("x")}); err == nil {
+		t.Error("expected an error attaching to an unknown vest")
+	}
+
+	pack, err := s.GetAuditPack(2024)
+	if err != nil {
+		t.Fatalf("GetAuditPack failed: %v", err)
+	}
+	// Only the 2020 lot was matched in 2024; the 2023 lot was neither acquired
+	// nor disposed of in the year.
+	if len(pack.Sales) != 1 || len(pack.MatchedLots) != 1 || len(pack.Vests) != 1 || pack.Vests[0].ID != vest.ID {
+		t.Errorf("unexpected records: %d sales, %d lots, %+v", len(pack.Sales), len(pack.MatchedLots), pack.Vests)
+	}
+	if len(pack.Rates) != 2 || pack.Rates[0].Provenance != RateProvenanceECB || pack.Rates[0].Rate != 0.9 {
+		t.Errorf("unexpected rates: %+v", pack.Rates)
+	}
+	if len(pack.Attachments) != 1 || pack.Attachments[0].Filename != "confirm.pdf" {
+		t.Errorf("unexpected attachments: %+v", pack.Attachments)
+	}
+
+	var buf bytes.Buffer
+	if err := s.WriteAuditPack(&buf, 2024); err != nil {
+		t.Fatalf("WriteAuditPack failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+
+	for _, name := range []string{"summary.txt", "pack.json", "vests.csv", "sales.csv", "matched_lots.csv", "rates.csv", "corporate_actions.csv", "exit_tax.csv"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("missing %s", name)
+		}
+	}
+	evidence := 0
+	for name, data := range files {
+		if strings.HasPrefix(name, "evidence/sale-"+sale.ID+"/") && strings.HasSuffix(name, "confirm.pdf") && data == "%PDF" {
+			evidence++
+		}
+	}
+	if evidence != 1 {
+		t.Errorf("expected the sale's evidence in the archive, got %v", files)
+	}
+
+	lots, err := csv.NewReader(strings.NewReader(files["matched_lots.csv"])).ReadAll()
+	if err != nil || len(lots) != 2 {
+		t.Fatalf("unexpected matched_lots.csv: %v %v", lots, err)
+	}
+	// 4 shares at $400 against a $100 cost, both at 0.9: proceeds 1,440, gain 1,080.
+	if lots[1][4] != "4" || lots[1][12] != "1440.00" || lots[1][13] != "1080.00" {
+		t.Errorf("unexpected matched lot: %v", lots[1])
+	}
+	if !strings.Contains(files["summary.txt"], "tax year 2024") || !strings.Contains(files["summary.txt"], "2024-03-01 ACME: 4 shares acquired 2020-01-10") {
+		t.Errorf("unexpected summary:\n%s", files["summary.txt"])
+	}
+}
+
+func TestGetAuditPack_Household(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	spouse, _ := s.AddPerson("Spouse")
+	theirs := s.ForPerson(spouse.ID)
+
+	// Only the spouse holds the ETF and the security hit by the spin-off.
+	s.SetSecurity(models.Security{Symbol: "VWCE", AssetClass: models.AssetClassETF})
+	if _, err := theirs.AddVest("2016-03-01", "VWCE", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	s.SetPrice(models.Price{Symbol: "VWCE", Date: "2024-03-01", PriceCents: 15000, Source: "MANUAL"})
+	if _, err := s.RecordDeemedDisposals("2024-12-31"); err != nil {
+		t.Fatalf("RecordDeemedDisposals failed: %v", err)
+	}
+	theirs.AddVest("2020-01-10", "OLD", 10, 10000)
+	if _, err := s.ApplyCorporateAction(models.CorporateAction{Date: "2024-06-01", Type: models.ActionSpinOff, Symbol: "OLD", NewSymbol: "NEW",
+		Ratio: 1, OldValueCents: 5000, NewValueCents: 5000}); err != nil {
+		t.Fatalf("ApplyCorporateAction failed: %v", err)
+	}
+
+	mine, err := s.GetAuditPack(2024)
+	if err != nil {
+		t.Fatalf("GetAuditPack failed: %v", err)
+	}
+	if len(mine.ExitTaxDisposals) != 0 || len(mine.CorporateActions) != 0 {
+		t.Errorf("expected none of the spouse's records, got %+v and %+v", mine.ExitTaxDisposals, mine.CorporateActions)
+	}
+	pack, err := theirs.GetAuditPack(2024)
+	if err != nil {
+		t.Fatalf("GetAuditPack failed: %v", err)
+	}
+	if len(pack.ExitTaxDisposals) != 1 || len(pack.CorporateActions) != 1 {
+		t.Errorf("expected the spouse's deemed disposal and corporate action, got %+v and %+v", pack.ExitTaxDisposals, pack.CorporateActions)
+	}
+}
+
+func TestWriteAuditPack_Crypto(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 0.9)
+
+	s := NewService(database)
+	csvData := `Date,Type,Asset,Quantity,Price EUR,Quote Asset,Quote Quantity,Fee EUR
+2024-02-01,BUY,SHIB,1000000,0.0004,EUR,,0
+2024-05-01,SELL,SHIB,500000,0.0009,EUR,,0.50`
+	if err := s.ImportCrypto(strings.NewReader(csvData)); err != nil {
+		t.Fatalf("ImportCrypto failed: %v", err)
+	}
+
+	pack, err := s.GetAuditPack(2024)
+	if err != nil {
+		t.Fatalf("GetAuditPack failed: %v", err)
+	}
+	if len(pack.Rates) != 2 {
+		t.Fatalf("expected the sale and lot rates, got %+v", pack.Rates)
+	}
+	for _, r := range pack.Rates {
+		if r.Rate != 1 || r.Provenance != RateProvenanceEUR {
+			t.Errorf("expected crypto to be priced in EUR, got %+v", r)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := s.WriteAuditPack(&buf, 2024); err != nil {
+		t.Fatalf("WriteAuditPack failed: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	rows := map[string][][]string{}
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, ".csv") {
+			rc, _ := f.Open()
+			rows[f.Name], _ = csv.NewReader(rc).ReadAll()
+			rc.Close()
+		}
+	}
+
+	// A cost of EUR 0.0004 a unit, and proceeds of EUR 0.0009 less the fee
+	// spread over 500000 units.
+	if vests := rows["vests.csv"]; len(vests) != 2 || vests[1][4] != "0.00040000" || vests[1][5] != "1" {
+		t.Errorf("unexpected vests.csv: %v", vests)
+	}
+	if sales := rows["sales.csv"]; len(sales) != 2 || sales[1][4] != "0.00089900" || sales[1][5] != "1" {
+		t.Errorf("unexpected sales.csv: %v", sales)
+	}
+}
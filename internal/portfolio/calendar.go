@@ -0,0 +1,178 @@
+package portfolio
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"irish-cgt-tracker/internal/models"
+)
+
+// CalendarEvent is an all-day tax deadline or expected event.
+type CalendarEvent struct {
+	// UID identifies the event across refreshes of the feed.
+	UID string
+	// Date is the day of the event in "YYYY-MM-DD" format.
+	Date        string
+	Summary     string
+	Description string
+}
+
+// GetTaxCalendar lists the deadlines and expected events around a date for
+// the Service's person, in date order:
+//   - the CGT payment deadlines of the previous and current tax years, with
+//     the computed liability and the balance still to pay;
+//   - the 31 October return filing deadline for those years;
+//   - the RTSO payment deadline of each option exercise;
+//   - the next eight-year deemed disposal of each open ETF lot;
+//   - the scheduled vests of each grant not yet released.
+//
+// Parameters:
+//   - asOf: The reference date in "YYYY-MM-DD" format, typically today.
+//
+// Returns:
+//   - The events.
+//   - An error if the date is invalid or a database query fails.
+func (s *Service) GetTaxCalendar(asOf string) ([]CalendarEvent, error) {
+	date, err := models.ParseDate(asOf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid calendar date: %w", err)
+	}
+
+	var events []CalendarEvent
+	for year := date.Year() - 1; year <= date.Year(); year++ {
+		recs, err := s.ReconcileCGTPayments(year, asOf)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range recs {
+			events = append(events, CalendarEvent{
+				UID:     fmt.Sprintf("cgt-%d-%s", year, r.Key),
+				Date:    r.Period.DueDate,
+				Summary: fmt.Sprintf("CGT due for %d %s: EUR %s", year, r.Period.Label, centsString(max(r.BalanceCents, 0))),
+				Description: fmt.Sprintf("Liability EUR %s, paid EUR %s, balance EUR %s. Pay through ROS with the CG1 payment reference.",
+					centsString(r.Period.TaxCents), centsString(r.PaidCents), centsString(r.BalanceCents)),
+			})
+		}
+		events = append(events, CalendarEvent{
+			UID:         fmt.Sprintf("return-%d", year),
+			Date:        fmt.Sprintf("%d-10-31", year+1),
+			Summary:     fmt.Sprintf("Tax return for %d due", year),
+			Description: fmt.Sprintf("File Form 11 or Form 12 with the capital gains panel for %d.", year),
+		})
+	}
+
+	exercises, err := s.GetOptionExercises()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range exercises {
+		rtso := e.IncomeTaxCents + e.USCCents + e.PRSICents
+		events = append(events, CalendarEvent{
+			UID:         "rtso-" + e.ID,
+			Date:        e.RTSODueDate,
+			Summary:     fmt.Sprintf("RTSO payment due: EUR %s", centsString(rtso)),
+			Description: fmt.Sprintf("Relevant Tax on Share Options for the exercise of %g options on %s. File form RTSO1.", e.Quantity, e.Date),
+		})
+	}
+
+	deemed, err := s.GetUpcomingDeemedDisposals(date, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deemed {
+		events = append(events, CalendarEvent{
+			UID:         fmt.Sprintf("etf-%s-%s", d.ID, d.AnniversaryDate),
+			Date:        d.AnniversaryDate,
+			Summary:     fmt.Sprintf("ETF deemed disposal: %s", d.Symbol),
+			Description: fmt.Sprintf("Eight-year deemed disposal of %g units of %s acquired %s. Exit tax is due on the gain.", d.RemainingQty, d.Symbol, d.Date),
+		})
+	}
+
+	grants, err := s.GetGrants()
+	if err != nil {
+		return nil, err
+	}
+	symbols := map[string]string{}
+	for _, g := range grants {
+		symbols[g.ID] = g.Symbol
+	}
+	schedule, err := s.GetVestSchedule(asOf)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range schedule {
+		if t.Status != models.TrancheUpcoming {
+			continue
+		}
+		events = append(events, CalendarEvent{
+			UID:         fmt.Sprintf("vest-%s-%d", t.GrantID, t.Number),
+			Date:        t.Date,
+			Summary:     fmt.Sprintf("Projected vest: %g %s", t.ExpectedQty, symbols[t.GrantID]),
+			Description: fmt.Sprintf("Tranche %d of the grant. The release is taxed through payroll and starts a new CGT lot.", t.Number),
+		})
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Date < events[j].Date })
+	return events, nil
+}
+
+// WriteCalendar writes the events as an iCalendar (RFC 5545) feed of all-day
+// events that calendar applications can subscribe to.
+//
+// Parameters:
+//   - w: The destination of the feed.
+//   - name: The calendar name shown by subscribing applications.
+//   - events: The events, typically from GetTaxCalendar.
+//
+// Returns:
+//   - An error if writing fails.
+func WriteCalendar(w io.Writer, name string, events []CalendarEvent) error {
+	var b strings.Builder
+	line := func(content string) {
+		// Fold lines longer than 75 octets, continuing with a space.
+		for len(content) > 75 {
+			cut := 75
+			for cut > 0 && !utf8.RuneStart(content[cut]) {
+				cut--
+			}
+			b.WriteString(content[:cut] + "\r\n ")
+			content = content[cut:]
+		}
+		b.WriteString(content + "\r\n")
+	}
+
+	now := time.Now().UTC().Format("20060102T150405Z")
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//irish-cgt-tracker//Tax Calendar//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:" + escapeText(name))
+	for _, e := range events {
+		d, err := models.ParseDate(e.Date)
+		if err != nil {
+			continue
+		}
+		line("BEGIN:VEVENT")
+		line("UID:" + e.UID + "@irish-cgt-tracker")
+		line("DTSTAMP:" + now)
+		line("DTSTART;VALUE=DATE:" + d.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + d.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY:" + escapeText(e.Summary))
+		line("DESCRIPTION:" + escapeText(e.Description))
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// escapeText escapes an iCalendar TEXT value.
+func escapeText(s string) string {
+	return strings.NewReplacer("\\", "\\\\", ";", "\\;", ",", "\\,", "\n", "\\n").Replace(s)
+}
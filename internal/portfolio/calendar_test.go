@@ -0,0 +1,112 @@
+package portfolio
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestGetTaxCalendar(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	s.AddVest("2020-01-10", "ACME", 10, 10000)
+	sale, _ := s.AddSale("2024-03-01", "ACME", 10, 40000)
+	if err := s.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+	s.AddCGTPayment(models.CGTPayment{Date: "2024-12-01", AmountCents: 10000, Year: 2024, Period: models.PaymentPeriodInitial})
+
+	grant, _ := s.AddOptionGrant(models.OptionGrant{Symbol: "ACME", GrantDate: "2020-01-01", Quantity: 100, ExercisePriceCents: 1000})
+	if _, err := s.ExerciseOptions(grant.ID, "2025-05-01", 10, 3000, RTSORates{IncomeTax: 0.40, USC: 0.08, PRSI: 0.04}); err != nil {
+		t.Fatalf("ExerciseOptions failed: %v", err)
+	}
+	s.SetSecurity(models.Security{Symbol: "VWCE", AssetClass: models.AssetClassETF})
+	s.AddVest("2018-07-01", "VWCE", 5, 10000)
+	s.AddGrant(models.Grant{Symbol: "GOOG", Plan: "GSU", GrantDate: "2025-01-01", TotalUnits: 40, VestStartDate: "2024-12-25", CadenceMonths: 3, Tranches: 4})
+
+	events, err := s.GetTaxCalendar("2025-06-01")
+	if err != nil {
+		t.Fatalf("GetTaxCalendar failed: %v", err)
+	}
+	byUID := map[string]CalendarEvent{}
+	for i, e := range events {
+		byUID[e.UID] = e
+		if i > 0 && e.Date < events[i-1].Date {
+			t.Errorf("events out of order at %s", e.UID)
+		}
+	}
+
+	// 570.90 due for 2024, less the 100.00 paid.
+	if e := byUID["cgt-2024-INITIAL"]; e.Date != "2024-12-15" || !strings.HasSuffix(e.Summary, "EUR 470.90") {
+		t.Errorf("unexpected CGT deadline: %+v", e)
+	}
+	if e := byUID["cgt-2025-LATER"]; e.Date != "2026-01-31" {
+		t.Errorf("unexpected later period deadline: %+v", e)
+	}
+	if e := byUID["return-2024"]; e.Date != "2025-10-31" {
+		t.Errorf("unexpected filing deadline: %+v", e)
+	}
+	// A $200 spread taxed at 52%.
+	rtso := 0
+	for _, e := range events {
+		if strings.HasPrefix(e.UID, "rtso-") && e.Date == "2025-05-31" && e.Summary == "RTSO payment due: EUR 104.00" {
+			rtso++
+		}
+	}
+	if rtso != 1 {
+		t.Errorf("expected the RTSO deadline, got %+v", events)
+	}
+	etf := 0
+	for _, e := range events {
+		if strings.HasPrefix(e.UID, "etf-") && e.Date == "2026-07-01" {
+			etf++
+		}
+	}
+	if etf != 1 {
+		t.Error("expected the ETF's deemed disposal")
+	}
+	// The March tranche is overdue rather than projected.
+	if _, ok := byUID["vest-"+grantID(t, s)+"-1"]; ok {
+		t.Error("expected past tranches to be left out")
+	}
+	if e := byUID["vest-"+grantID(t, s)+"-2"]; e.Date != "2025-06-25" || e.Summary != "Projected vest: 10 GOOG" {
+		t.Errorf("unexpected projected vest: %+v", e)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCalendar(&buf, "CGT, deadlines", events); err != nil {
+		t.Fatalf("WriteCalendar failed: %v", err)
+	}
+	feed := buf.String()
+	if !strings.HasPrefix(feed, "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(feed, "END:VCALENDAR\r\n") {
+		t.Errorf("unexpected feed framing: %q", feed)
+	}
+	if !strings.Contains(feed, "X-WR-CALNAME:CGT\\, deadlines\r\n") || !strings.Contains(feed, "DTSTART;VALUE=DATE:20241215\r\nDTEND;VALUE=DATE:20241216\r\n") {
+		t.Errorf("unexpected feed content: %s", feed)
+	}
+	if strings.Count(feed, "BEGIN:VEVENT") != len(events) {
+		t.Errorf("expected %d events in the feed", len(events))
+	}
+	for _, line := range strings.Split(feed, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line not folded: %q", line)
+		}
+	}
+}
+
+// grantID returns the ID of the only RSU grant.
+func grantID(t *testing.T, s *Service) string {
+	t.Helper()
+	grants, err := s.GetGrants()
+	if err != nil || len(grants) != 1 {
+		t.Fatalf("expected one grant: %v", err)
+	}
+	return grants[0].ID
+}
@@ -7,6 +7,17 @@ import (
 	"math"
 )
 
+// quantityEpsilon is the tolerance used when comparing share quantities. It is
+// small enough for fractional crypto-asset units while still absorbing
+// floating point noise.
+const quantityEpsilon = 1e-9
+
+// FourWeekDays is the window of the four-week rule (TCA 1997 s.581). Shares
+// acquired in the four weeks before a disposal are matched before older lots,
+// and a loss on shares reacquired within four weeks after the disposal can only
+// be set against a gain on the reacquired shares.
+const FourWeekDays = 28
+
 // SettleSale performs the FIFO logic to match a sale against the oldest available vests.
 func (s *Service) SettleSale(saleID string) error {
 	// 1. Fetch the sale details
@@ -17,52 +28,148 @@ func (s *Service) SettleSale(saleID string) error {
 	if sale.IsSettled {
 		return fmt.Errorf("sale %s is already settled", saleID)
 	}
+	if err := s.checkYearOpen(sale.OwnerID, sale.Date); err != nil {
+		return err
+	}
 
-	// 2. Fetch available inventory (vests with remaining shares), ordered by date (FIFO)
-	inventory, err := s.getAvailableInventory()
+	// 2. Fetch the seller's available inventory (vests with remaining shares)
+	// of the sold security, ordered by date (FIFO)
+	inventory, err := s.getInventoryForOwner(sale.OwnerID, sale.Symbol)
 	if err != nil {
 		return fmt.Errorf("could not retrieve inventory: %w", err)
 	}
 
 	// 3. FIFO Logic
-	sharesToSettle := sale.Quantity
-	for _, vest := range inventory {
-		if sharesToSettle == 0 {
-			break
+	matches, unsettled := matchFIFO(sale, inventory)
+	if unsettled > quantityEpsilon { // Allow for small floating point inaccuracies
+		// A lot imported late with the wrong date would otherwise look missing.
+		if later := quantityAcquiredAfter(sale.Date, inventory); later > quantityEpsilon {
+			return fmt.Errorf("insufficient shares available to settle sale %s. %f shares remain unsettled; %f shares are held in lots acquired after the sale on %s, so check their dates", sale.ID, unsettled, later, sale.Date)
 		}
+		return fmt.Errorf("insufficient shares available to settle sale %s. %f shares remain unsettled", sale.ID, unsettled)
+	}
 
-		sharesToUse := math.Min(sharesToSettle, vest.RemainingQty)
-		if sharesToUse > 0 {
+	// ETF lots are taxed from their value at any deemed disposal before the
+	// sale, so record those of the matched lots that have fallen due first.
+	var etfLots []models.Vest
+	for _, m := range matches {
+		if m.Lot.AssetClass == models.AssetClassETF {
+			etfLots = append(etfLots, m.Lot.Vest)
+		}
+	}
+	if len(etfLots) > 0 {
+		saleDate, err := models.ParseDate(sale.Date)
+		if err != nil {
+			return fmt.Errorf("invalid sale date: %w", err)
+		}
+		if _, err := s.recordDeemedDisposals(saleDate.AddDate(0, 0, -1).Format("2006-01-02"), etfLots); err != nil {
+			return fmt.Errorf("could not record deemed disposals: %w", err)
+		}
+	}
+
+	// The lots, their tax and the settled flag are written together so that a
+	// failure part way leaves the sale unsettled with nothing matched.
+	err = s.inTx(func(tx *Service) error {
+		for _, m := range matches {
 			// Create a "lot" linking this portion of the sale to this specific vest
-			err := s.saveLot(sale.ID, vest.ID, sharesToUse)
-			if err != nil {
+			if err := tx.saveLot(sale.ID, m.Lot.ID, m.Shares); err != nil {
 				return fmt.Errorf("failed to save sale lot: %w", err)
 			}
 
-			// Perform the CGT calculation for this specific lot and save it
-			err = s.calculateAndStoreCGT(sale, &vest.Vest, sharesToUse)
+			// Perform the tax calculation for this specific lot and save it.
+			// ETFs are taxed under the exit tax regime instead of CGT.
+			var err error
+			if m.Lot.AssetClass == models.AssetClassETF {
+				err = tx.calculateAndStoreExitTax(sale, &m.Lot.Vest, m.Shares)
+			} else {
+				err = tx.calculateAndStoreCGT(sale, &m.Lot.Vest, m.Shares)
+			}
 			if err != nil {
-				return fmt.Errorf("failed to calculate CGT for lot: %w", err)
+				return fmt.Errorf("failed to calculate tax for lot: %w", err)
 			}
 
-			sharesToSettle -= sharesToUse
-			log.Printf("Settled %f shares from sale %s against vest %s", sharesToUse, sale.ID, vest.ID)
+			log.Printf("Settled %f shares from sale %s against vest %s", m.Shares, sale.ID, m.Lot.ID)
 		}
+
+		// 4. Mark the original sale as settled
+		return tx.markSaleSettled(sale.ID)
+	})
+	if err != nil {
+		return err
+	}
+	sale.IsSettled = true
+	s.ForPerson(sale.OwnerID).emit(models.EventSaleSettled, sale)
+	return nil
+}
+
+// lotMatch is the portion of a sale matched against a single lot.
+type lotMatch struct {
+	Lot    InventoryItem
+	Shares float64
+}
+
+// matchFIFO matches a sale against the lots acquired on or before the sale
+// date. Under the four-week rule, lots acquired in the FourWeekDays before the
+// sale are matched first, oldest first; the rest of the sale is matched FIFO
+// against the older lots. It returns the matches and any quantity left
+// unmatched.
+func matchFIFO(sale *models.Sale, inventory []InventoryItem) ([]lotMatch, float64) {
+	windowStart := ""
+	if saleDate, err := models.ParseDate(sale.Date); err == nil {
+		windowStart = saleDate.AddDate(0, 0, -FourWeekDays).Format("2006-01-02")
 	}
 
-	if sharesToSettle > 0.0001 { // Allow for small floating point inaccuracies
-		return fmt.Errorf("insufficient shares available to settle sale %s. %f shares remain unsettled", sale.ID, sharesToSettle)
+	var matches []lotMatch
+	sharesToSettle := sale.Quantity
+	match := func(recent bool) {
+		for _, vest := range inventory {
+			if sharesToSettle <= quantityEpsilon {
+				break
+			}
+			if vest.Date > sale.Date {
+				break // Lots acquired after the sale cannot be matched against it.
+			}
+			if inWindow := windowStart != "" && vest.Date >= windowStart; inWindow != recent {
+				continue
+			}
+			sharesToUse := math.Min(sharesToSettle, vest.RemainingQty)
+			if sharesToUse > 0 {
+				matches = append(matches, lotMatch{Lot: vest, Shares: sharesToUse})
+				sharesToSettle -= sharesToUse
+			}
+		}
 	}
+	match(true)
+	match(false)
+	return matches, sharesToSettle
+}
 
-	// 4. Mark the original sale as settled
-	return s.markSaleSettled(sale.ID)
+// quantityAcquiredAfter returns the shares remaining in lots acquired after
+// the date.
+func quantityAcquiredAfter(date string, inventory []InventoryItem) float64 {
+	var qty float64
+	for _, item := range inventory {
+		if item.Date > date {
+			qty += item.RemainingQty
+		}
+	}
+	return qty
 }
 
 // calculateAndStoreCGT performs the core Irish CGT calculation for a single sale-vest lot.
 func (s *Service) calculateAndStoreCGT(sale *models.Sale, vest *models.Vest, numShares float64) error {
+	// Persist to the new table
+	return s.insertSettledSale(computeSettledSale(sale, vest, numShares))
+}
+
+// computeSettledSale applies the dual-conversion rule to a single sale-vest lot
+// and returns the resulting breakdown without persisting it.
+func computeSettledSale(sale *models.Sale, vest *models.Vest, numShares float64) models.SettledSale {
 	// All calculations are in cents to avoid floating point issues
-	vestValuePerShare := float64(vest.StrikePriceCents)
-	saleValuePerShare := float64(sale.PriceCents)
+	vestScale, vestRate := models.PriceScale(vest.ECBRate)
+	saleScale, saleRate := models.PriceScale(sale.ECBRate)
+	vestValuePerShare := float64(vest.StrikePriceCents) / vestScale
+	saleValuePerShare := float64(sale.PriceCents) / saleScale
 
 	// USD Calculations (per share)
 	bookValueUSD := vestValuePerShare
@@ -70,26 +177,29 @@ func (s *Service) calculateAndStoreCGT(sale *models.Sale, vest *models.Vest, num
 	gainLossUSD := grossProceedUSD - bookValueUSD
 
 	// EUR Calculations (per share, applying the "Irish Rule")
-	euroAcquisitionCost := bookValueUSD * vest.ECBRate
-	euroDisposalValue := grossProceedUSD * sale.ECBRate
+	euroAcquisitionCost := bookValueUSD * vestRate
+	euroDisposalValue := grossProceedUSD * saleRate
 	euroGain := euroDisposalValue - euroAcquisitionCost
 
 	// CGT @ 33%
-	cgtTaxDue := euroGain * 0.33
+	cgtTaxDue := euroGain * CGTRate
 	netProceeds := euroDisposalValue - cgtTaxDue
 
 	// Create the record for the settled sale lot
-	settledSale := models.SettledSale{
+	return models.SettledSale{
+		SaleID:             sale.ID,
+		VestID:             vest.ID,
+		OwnerID:            sale.OwnerID,
 		SaleDate:           sale.Date,
 		Ticker:             vest.Symbol,
 		NumShares:          numShares,
 		SalePriceUSD:       int64(saleValuePerShare),
 		GainLossUSD:        int64(gainLossUSD * numShares),
 		BookValueUSD:       int64(bookValueUSD * numShares),
-		ExchangeRateAtVest: vest.ECBRate,
+		ExchangeRateAtVest: vestRate,
 		GrossProceedUSD:    int64(grossProceedUSD * numShares),
-		VestingValueUSD:    int64(float64(vest.StrikePriceCents) * numShares),
-		ExchangeRateAtSale: sale.ECBRate,
+		VestingValueUSD:    int64(vestValuePerShare * numShares),
+		ExchangeRateAtSale: saleRate,
 		EuroSaleEUR:        int64(euroDisposalValue * numShares),
 		EuroGainEUR:        int64(euroGain * numShares),
 		CGTTaxDueEUR:       int64(cgtTaxDue * numShares),
@@ -97,21 +207,18 @@ func (s *Service) calculateAndStoreCGT(sale *models.Sale, vest *models.Vest, num
 		NetProceedsEUR:     int64(netProceeds * numShares),
 		Type:               "FIFO",
 	}
-
-	// Persist to the new table
-	return s.insertSettledSale(settledSale)
 }
 
 // insertSettledSale saves the calculated breakdown into the database.
 func (s *Service) insertSettledSale(ss models.SettledSale) error {
 	query := `
         INSERT INTO settled_sales (
-            sale_date, ticker, num_shares, sale_price_usd, gain_loss_usd, book_value_usd,
+            sale_id, vest_id, owner_id, sale_date, ticker, num_shares, sale_price_usd, gain_loss_usd, book_value_usd,
             exchange_rate_at_vest, gross_proceed_usd, vesting_value_usd, exchange_rate_at_sale,
             euro_sale_eur, euro_gain_eur, cgt_tax_due_eur, completed, net_proceeds_eur, type
-        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	_, err := s.db.Exec(query,
-		ss.SaleDate, ss.Ticker, ss.NumShares, ss.SalePriceUSD, ss.GainLossUSD, ss.BookValueUSD,
+		ss.SaleID, ss.VestID, ss.OwnerID, ss.SaleDate, ss.Ticker, ss.NumShares, ss.SalePriceUSD, ss.GainLossUSD, ss.BookValueUSD,
 		ss.ExchangeRateAtVest, ss.GrossProceedUSD, ss.VestingValueUSD, ss.ExchangeRateAtSale,
 		ss.EuroSaleEUR, ss.EuroGainEUR, ss.CGTTaxDueEUR, ss.Completed, ss.NetProceedsEUR, ss.Type,
 	)
@@ -1,9 +1,13 @@
 package portfolio
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
 )
 
 func TestSettleSale_Simple(t *testing.T) {
@@ -17,30 +21,37 @@ func TestSettleSale_Simple(t *testing.T) {
 
 	// --- Mocking ---
 	// 1. GetSale
-	mock.ExpectQuery("SELECT id, date, quantity, price_cents, ecb_rate, is_settled FROM sales WHERE id = ?").
+	mock.ExpectQuery("SELECT id, date, symbol, quantity, price_cents, ecb_rate, is_settled, owner_id FROM sales WHERE id = ?").
 		WithArgs("sale1").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "date", "quantity", "price_cents", "ecb_rate", "is_settled"}).
-			AddRow("sale1", "2024-02-01", 50.0, 15000, 0.9, false))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "date", "symbol", "quantity", "price_cents", "ecb_rate", "is_settled", "owner_id"}).
+			AddRow("sale1", "2024-02-01", "TEST", 50.0, 15000, 0.9, false, ""))
 
-	// 2. GetInventory
-	mock.ExpectQuery("SELECT v.id, v.date, v.symbol, v.quantity, v.strike_price_cents, v.ecb_rate, COALESCE(SUM(sl.quantity), 0) as used_qty FROM vests v LEFT JOIN sale_lots sl ON v.id = sl.vest_id GROUP BY v.id ORDER BY v.date ASC").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "date", "symbol", "quantity", "strike_price_cents", "ecb_rate", "used_qty"}).
-			AddRow("vest1", "2024-01-01", "TEST", 100.0, 10000, 0.8, 0))
+	// 2. checkYearOpen
+	mock.ExpectQuery("SELECT MIN(year) FROM closed_years WHERE locked = 1 AND owner_id = ? AND year BETWEEN ? AND ?").
+		WithArgs("", 2024, 2024).
+		WillReturnRows(sqlmock.NewRows([]string{"year"}).AddRow(nil))
 
-	// 3. SaveLot
+	// 3. GetInventory
+	mock.ExpectQuery("SELECT v.id, v.date, v.symbol, v.quantity, v.strike_price_cents, v.ecb_rate, v.owner_id, COALESCE(sec.asset_class, 'SHARE') as asset_class, COALESCE(SUM(sl.quantity), 0) + COALESCE((SELECT SUM(la.quantity) FROM lot_adjustments la WHERE la.vest_id = v.id), 0) as used_qty FROM vests v LEFT JOIN securities sec ON sec.symbol = v.symbol LEFT JOIN sale_lots sl ON v.id = sl.vest_id GROUP BY v.id ORDER BY v.date ASC").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "date", "symbol", "quantity", "strike_price_cents", "ecb_rate", "owner_id", "asset_class", "used_qty"}).
+			AddRow("vest1", "2024-01-01", "TEST", 100.0, 10000, 0.8, "", "SHARE", 0))
+
+	// 4. SaveLot, in the settlement transaction
+	mock.ExpectBegin()
 	mock.ExpectExec("INSERT INTO sale_lots (sale_id, vest_id, quantity) VALUES (?, ?, ?)").
 		WithArgs("sale1", "vest1", 50.0).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	// 4. insertSettledSale
-	mock.ExpectExec("INSERT INTO settled_sales ( sale_date, ticker, num_shares, sale_price_usd, gain_loss_usd, book_value_usd, exchange_rate_at_vest, gross_proceed_usd, vesting_value_usd, exchange_rate_at_sale, euro_sale_eur, euro_gain_eur, cgt_tax_due_eur, completed, net_proceeds_eur, type ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)").
-		WithArgs("2024-02-01", "TEST", 50.0, int64(15000), int64(250000), int64(500000), 0.8, int64(750000), int64(500000), 0.9, int64(675000), int64(275000), int64(90750), "Y", int64(584250), "FIFO").
+	// 5. insertSettledSale
+	mock.ExpectExec("INSERT INTO settled_sales ( sale_id, vest_id, owner_id, sale_date, ticker, num_shares, sale_price_usd, gain_loss_usd, book_value_usd, exchange_rate_at_vest, gross_proceed_usd, vesting_value_usd, exchange_rate_at_sale, euro_sale_eur, euro_gain_eur, cgt_tax_due_eur, completed, net_proceeds_eur, type ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)").
+		WithArgs("sale1", "vest1", "", "2024-02-01", "TEST", 50.0, int64(15000), int64(250000), int64(500000), 0.8, int64(750000), int64(500000), 0.9, int64(675000), int64(275000), int64(90750), "Y", int64(584250), "FIFO").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	// 5. markSaleSettled
+	// 6. markSaleSettled
 	mock.ExpectExec("UPDATE sales SET is_settled = 1 WHERE id = ?").
 		WithArgs("sale1").
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
 	// --- Execution ---
 	err = s.SettleSale("sale1")
@@ -53,3 +64,76 @@ func TestSettleSale_Simple(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestSettleSale_IgnoresLaterLots(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	s.AddVest("2024-01-10", "ACME", 10, 10000)
+	s.AddVest("2024-03-10", "ACME", 10, 20000)
+
+	// A back-dated sale can only use the lot held on the sale date.
+	sale, _ := s.AddSale("2024-02-01", "ACME", 15, 30000)
+	err := s.SettleSale(sale.ID)
+	if err == nil || !strings.Contains(err.Error(), "acquired after the sale") {
+		t.Fatalf("expected the later lot to be refused, got %v", err)
+	}
+
+	if _, err := s.SimulateSale("2024-02-01", "ACME", 15, 30000); err == nil {
+		t.Error("expected a simulation to ignore the later lot")
+	}
+	sim, err := s.SimulateSale("2024-02-01", "ACME", 10, 30000)
+	if err != nil {
+		t.Fatalf("SimulateSale failed: %v", err)
+	}
+	if len(sim.Lots) != 1 || sim.Lots[0].Lot.Date != "2024-01-10" {
+		t.Errorf("expected only the earlier lot to be matched, got %+v", sim.Lots)
+	}
+}
+
+func TestMatchFIFO_FourWeekRule(t *testing.T) {
+	inventory := []InventoryItem{
+		{Vest: models.Vest{ID: "old", Date: "2024-01-10"}, RemainingQty: 10},
+		{Vest: models.Vest{ID: "recent", Date: "2024-05-20"}, RemainingQty: 4},
+		{Vest: models.Vest{ID: "later", Date: "2024-06-20"}, RemainingQty: 10},
+	}
+
+	// The lot acquired in the four weeks before the sale is matched first.
+	matches, unmatched := matchFIFO(&models.Sale{Date: "2024-06-01", Quantity: 6}, inventory)
+	if unmatched != 0 || len(matches) != 2 || matches[0].Lot.ID != "recent" || matches[0].Shares != 4 ||
+		matches[1].Lot.ID != "old" || matches[1].Shares != 2 {
+		t.Errorf("expected 4 recent then 2 old shares, got %+v", matches)
+	}
+
+	// Outside the window the sale is matched FIFO.
+	matches, _ = matchFIFO(&models.Sale{Date: "2024-06-18", Quantity: 6}, inventory)
+	if len(matches) != 1 || matches[0].Lot.ID != "old" {
+		t.Errorf("expected the oldest lot to be matched, got %+v", matches)
+	}
+}
+
+func TestSettleSale_IsAtomic(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	s.AddVest("2020-01-10", "ACME", 10, 10000)
+	sale, _ := s.AddSale("2024-03-01", "ACME", 4, 20000)
+
+	// If the tax cannot be stored, the lot matched must not be kept either.
+	if _, err := database.Exec("DROP TABLE settled_sales"); err != nil {
+		t.Fatalf("failed to drop table: %v", err)
+	}
+	if err := s.SettleSale(sale.ID); err == nil {
+		t.Fatal("expected settling to fail")
+	}
+	if stored, _ := s.getSale(sale.ID); stored.IsSettled {
+		t.Error("expected the sale to stay unsettled")
+	}
+	if inventory, _ := s.GetInventory(); len(inventory) != 1 || inventory[0].RemainingQty != 10 {
+		t.Errorf("expected no shares to be matched, got %+v", inventory)
+	}
+}
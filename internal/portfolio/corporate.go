@@ -0,0 +1,236 @@
+package portfolio
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/google/uuid"
+	"irish-cgt-tracker/internal/models"
+)
+
+// ApplyCorporateAction records a spin-off, merger or return of capital and
+// re-apportions the cost basis of every open lot of the affected security.
+//
+// Each open lot is closed via a lot adjustment and replaced by successor lots
+// that keep the original acquisition date (so FIFO order is preserved):
+//   - a lot of the original security, if it continues to exist;
+//   - a lot of the new security, if shares are received.
+//
+// The original EUR cost is split between the continuing shares, the new shares
+// and any cash in proportion to their market values on the action date. Cash
+// received is treated as a part disposal and recorded as a settled sale, one
+// per holder, linked to the action in corporate_action_disposals.
+//
+// The action is applied in a single transaction, and is refused if no open lot
+// was acquired on or before its date.
+//
+// Parameters:
+//   - action: The event details. ID and ECBRate are populated by this method.
+//
+// Returns:
+//   - A pointer to the stored models.CorporateAction.
+//   - An error if the action is invalid, the exchange rate cannot be fetched
+//     or the database update fails.
+func (s *Service) ApplyCorporateAction(action models.CorporateAction) (*models.CorporateAction, error) {
+	if err := validateCorporateAction(&action); err != nil {
+		return nil, err
+	}
+	// The action adjusts every holder's lots, so it is refused if any person
+	// has closed the year.
+	year := disposalYear(action.Date)
+	if err := s.checkYearsOpen("1 = 1", year, year); err != nil {
+		return nil, err
+	}
+
+	rate, err := s.transactionRate("corporate action on "+action.Symbol, action.Date)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch exchange rate for %s: %w", action.Date, err)
+	}
+	action.ID = uuid.New().String()
+	action.ECBRate = rate
+
+	err = s.inTx(func(tx *Service) error {
+		inventory, err := tx.getInventoryForSymbol(action.Symbol)
+		if err != nil {
+			return fmt.Errorf("could not retrieve inventory: %w", err)
+		}
+		// Lots acquired after the event are not affected by it.
+		var affected []InventoryItem
+		for _, item := range inventory {
+			if item.Date <= action.Date {
+				affected = append(affected, item)
+			}
+		}
+		if len(affected) == 0 {
+			return fmt.Errorf("no open lots of %s acquired on or before %s to apply the corporate action to", action.Symbol, action.Date)
+		}
+
+		query := `INSERT INTO corporate_actions (id, date, type, symbol, new_symbol, ratio, old_value_cents, new_value_cents, cash_cents, ecb_rate) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		_, err = tx.db.Exec(query, action.ID, action.Date, action.Type, action.Symbol, action.NewSymbol, action.Ratio,
+			action.OldValueCents, action.NewValueCents, action.CashCents, action.ECBRate)
+		if err != nil {
+			return fmt.Errorf("failed to insert corporate action: %w", err)
+		}
+
+		// Each holder's cash forms a single part disposal.
+		disposals := map[string]string{}
+		for _, item := range affected {
+			if err := tx.apportionLot(&action, item, disposals); err != nil {
+				return fmt.Errorf("failed to apportion lot %s: %w", item.ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Corporate action recorded: %s of %s on %s", action.Type, action.Symbol, action.Date)
+	return &action, nil
+}
+
+// GetCorporateActions retrieves all recorded corporate actions, newest first.
+func (s *Service) GetCorporateActions() ([]models.CorporateAction, error) {
+	rows, err := s.db.Query(`
+		SELECT id, date, type, symbol, new_symbol, ratio, old_value_cents, new_value_cents, cash_cents, ecb_rate
+		FROM corporate_actions ORDER BY date DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var actions []models.CorporateAction
+	for rows.Next() {
+		var a models.CorporateAction
+		if err := rows.Scan(&a.ID, &a.Date, &a.Type, &a.Symbol, &a.NewSymbol, &a.Ratio,
+			&a.OldValueCents, &a.NewValueCents, &a.CashCents, &a.ECBRate); err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+	return actions, nil
+}
+
+// validateCorporateAction checks that the fields required by the action type are present.
+func validateCorporateAction(a *models.CorporateAction) error {
+	if _, err := models.ParseDate(a.Date); err != nil {
+		return fmt.Errorf("invalid corporate action date: %w", err)
+	}
+	if a.Symbol == "" {
+		return fmt.Errorf("corporate action requires a symbol")
+	}
+	switch a.Type {
+	case models.ActionSpinOff:
+		if a.NewSymbol == "" || a.Ratio <= 0 || a.NewValueCents <= 0 || a.OldValueCents <= 0 {
+			return fmt.Errorf("a spin-off requires a new symbol, ratio and market values for both securities")
+		}
+	case models.ActionMerger:
+		if a.NewSymbol == "" || a.Ratio <= 0 || a.NewValueCents <= 0 {
+			return fmt.Errorf("a merger requires a new symbol, ratio and market value for the new shares")
+		}
+		a.OldValueCents = 0 // The old shares cease to exist.
+	case models.ActionReturnOfCapital:
+		if a.CashCents <= 0 || a.OldValueCents <= 0 {
+			return fmt.Errorf("a return of capital requires the cash per share and the ex-distribution market value")
+		}
+		a.NewSymbol, a.Ratio, a.NewValueCents = "", 0, 0
+	default:
+		return fmt.Errorf("unknown corporate action type %q", a.Type)
+	}
+	if a.CashCents < 0 {
+		return fmt.Errorf("cash per share cannot be negative")
+	}
+	return nil
+}
+
+// apportionLot closes the remaining shares of a single lot and creates the
+// successor lots and part disposal required by the corporate action. disposals
+// maps each owner to the ID of their part disposal, which is created and linked
+// to the action on the owner's first lot.
+func (s *Service) apportionLot(action *models.CorporateAction, item InventoryItem, disposals map[string]string) error {
+	qty := item.RemainingQty
+
+	// Market values per old share of each component received.
+	oldValue := float64(action.OldValueCents)
+	newValue := float64(action.NewValueCents) * action.Ratio
+	cash := float64(action.CashCents)
+	total := oldValue + newValue + cash
+
+	_, err := s.db.Exec("INSERT INTO lot_adjustments (vest_id, reference_id, date, quantity, reason) VALUES (?, ?, ?, ?, ?)",
+		item.ID, action.ID, action.Date, qty, models.SourceCorporateAction)
+	if err != nil {
+		return err
+	}
+
+	costPerShare := float64(item.StrikePriceCents)
+
+	if oldValue > 0 {
+		successor := &models.Vest{
+			ID:               uuid.New().String(),
+			Date:             item.Date,
+			Symbol:           item.Symbol,
+			Quantity:         qty,
+			StrikePriceCents: int64(math.Round(costPerShare * oldValue / total)),
+			ECBRate:          item.ECBRate,
+			Source:           models.SourceCorporateAction,
+			ParentID:         item.ID,
+			OwnerID:          item.OwnerID,
+		}
+		if err := s.insertVest(successor); err != nil {
+			return err
+		}
+	}
+
+	if newValue > 0 {
+		newShares := qty * action.Ratio
+		successor := &models.Vest{
+			ID:               uuid.New().String(),
+			Date:             item.Date,
+			Symbol:           action.NewSymbol,
+			Quantity:         newShares,
+			StrikePriceCents: int64(math.Round(costPerShare * newValue / total / action.Ratio)),
+			ECBRate:          item.ECBRate,
+			Source:           models.SourceCorporateAction,
+			ParentID:         item.ID,
+			OwnerID:          item.OwnerID,
+		}
+		if err := s.insertVest(successor); err != nil {
+			return err
+		}
+	}
+
+	if cash > 0 {
+		// The cash is a part disposal: the proceeds are set against the slice
+		// of the original cost apportioned to the cash, converted at the
+		// original acquisition rate.
+		saleID, ok := disposals[item.OwnerID]
+		if !ok {
+			saleID = uuid.New().String()
+			_, err := s.db.Exec("INSERT INTO corporate_action_disposals (sale_id, action_id, owner_id) VALUES (?, ?, ?)", saleID, action.ID, item.OwnerID)
+			if err != nil {
+				return err
+			}
+			disposals[item.OwnerID] = saleID
+		}
+		disposal := &models.Sale{
+			ID:         saleID,
+			Date:       action.Date,
+			Symbol:     item.Symbol,
+			Quantity:   qty,
+			PriceCents: action.CashCents,
+			ECBRate:    action.ECBRate,
+			OwnerID:    item.OwnerID,
+		}
+		costSlice := item.Vest
+		costSlice.StrikePriceCents = int64(math.Round(costPerShare * cash / total))
+
+		ss := computeSettledSale(disposal, &costSlice, qty)
+		ss.Type = "PART DISPOSAL"
+		if err := s.insertSettledSale(ss); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
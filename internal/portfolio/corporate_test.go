@@ -0,0 +1,115 @@
+package portfolio
+
+import (
+	"math"
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestApplyCorporateAction_SpinOffWithCash(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	vest, err := s.AddVest("2020-01-10", "OLD", 100, 10000)
+	if err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+
+	// Old shares worth $60, one new share per two old worth $60 (so $30 per
+	// old share), plus $10 cash: 60/30/10 split of the original cost.
+	action, err := s.ApplyCorporateAction(models.CorporateAction{
+		Date:          "2023-06-01",
+		Type:          models.ActionSpinOff,
+		Symbol:        "OLD",
+		NewSymbol:     "NEW",
+		Ratio:         0.5,
+		OldValueCents: 6000,
+		NewValueCents: 6000,
+		CashCents:     1000,
+	})
+	if err != nil {
+		t.Fatalf("ApplyCorporateAction failed: %v", err)
+	}
+
+	inventory, err := s.GetInventory()
+	if err != nil {
+		t.Fatalf("GetInventory failed: %v", err)
+	}
+	if len(inventory) != 2 {
+		t.Fatalf("expected 2 successor lots, got %d", len(inventory))
+	}
+
+	bySymbol := map[string]InventoryItem{}
+	for _, item := range inventory {
+		if item.Date != vest.Date {
+			t.Errorf("lot %s lost its original acquisition date: %s", item.Symbol, item.Date)
+		}
+		bySymbol[item.Symbol] = item
+	}
+
+	if got := bySymbol["OLD"]; got.RemainingQty != 100 || got.StrikePriceCents != 6000 {
+		t.Errorf("unexpected OLD successor lot: qty %f, cost %d", got.RemainingQty, got.StrikePriceCents)
+	}
+	if got := bySymbol["NEW"]; got.RemainingQty != 50 || got.StrikePriceCents != 6000 {
+		t.Errorf("unexpected NEW successor lot: qty %f, cost %d", got.RemainingQty, got.StrikePriceCents)
+	}
+
+	// The cash is a part disposal: $1,000 proceeds against $1,000 of cost.
+	settled, err := s.GetSettledSales()
+	if err != nil {
+		t.Fatalf("GetSettledSales failed: %v", err)
+	}
+	if len(settled) != 1 {
+		t.Fatalf("expected 1 part disposal, got %d", len(settled))
+	}
+	if settled[0].Type != "PART DISPOSAL" || settled[0].EuroSaleEUR != 100000 || math.Abs(float64(settled[0].EuroGainEUR)) > 1 {
+		t.Errorf("unexpected part disposal: %+v", settled[0])
+	}
+	if settled[0].SaleID == action.ID {
+		t.Error("expected the part disposal to have its own ID")
+	}
+	var linked string
+	if err := database.QueryRow("SELECT action_id FROM corporate_action_disposals WHERE sale_id = ?", settled[0].SaleID).Scan(&linked); err != nil || linked != action.ID {
+		t.Errorf("expected the part disposal to be linked to action %s, got %q: %v", action.ID, linked, err)
+	}
+}
+
+func TestApplyCorporateAction_NoAffectedLots(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	if _, err := s.AddVest("2023-07-01", "OLD", 100, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+
+	// Every lot was acquired after the action, so it affects nothing.
+	_, err := s.ApplyCorporateAction(models.CorporateAction{
+		Date: "2023-06-01", Type: models.ActionMerger, Symbol: "OLD", NewSymbol: "NEW", Ratio: 1, NewValueCents: 5000,
+	})
+	if err == nil {
+		t.Fatal("expected an action affecting no lots to be refused")
+	}
+	actions, err := s.GetCorporateActions()
+	if err != nil || len(actions) != 0 {
+		t.Errorf("expected no action to be recorded, got %+v: %v", actions, err)
+	}
+}
+
+func TestApplyCorporateAction_Validation(t *testing.T) {
+	s := NewService(nil)
+	_, err := s.ApplyCorporateAction(models.CorporateAction{Date: "2023-06-01", Type: models.ActionSpinOff, Symbol: "OLD"})
+	if err == nil {
+		t.Error("expected an error for a spin-off without a new symbol")
+	}
+	_, err = s.ApplyCorporateAction(models.CorporateAction{Date: "2023-06-01", Type: "SPLIT", Symbol: "OLD"})
+	if err == nil {
+		t.Error("expected an error for an unknown action type")
+	}
+}
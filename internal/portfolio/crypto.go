@@ -0,0 +1,130 @@
+package portfolio
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+
+	"github.com/google/uuid"
+	"irish-cgt-tracker/internal/importer"
+	"irish-cgt-tracker/internal/models"
+)
+
+// RecordCryptoTrade records a crypto-asset trade priced in EUR.
+//
+// A BUY creates a lot; a SELL records a disposal; a TRADE is both a disposal
+// of the asset given up and an acquisition of the asset received, each at the
+// EUR market value of the trade. Fees are incidental costs: they are added to
+// the cost of a purchase and deducted from the proceeds of a disposal.
+// Disposals are settled immediately through the normal FIFO engine so that a
+// chronological trade history produces the correct lot matching.
+//
+// Returns:
+//   - The disposal recorded, or nil for a BUY.
+//   - An error if the trade is invalid or cannot be settled against holdings.
+func (s *Service) RecordCryptoTrade(t models.CryptoTradeRecord) (*models.Sale, error) {
+	if _, err := models.ParseDate(t.Date); err != nil {
+		return nil, fmt.Errorf("invalid trade date: %w", err)
+	}
+	if t.Asset == "" || t.Quantity <= 0 || t.ValueEURCents < 0 {
+		return nil, fmt.Errorf("a crypto trade requires an asset, a positive quantity and a value")
+	}
+
+	value := float64(t.ValueEURCents)
+	fee := float64(t.FeeEURCents)
+
+	switch t.Type {
+	case models.CryptoBuy:
+		return nil, s.addCryptoLot(t.Date, t.Asset, t.Quantity, value+fee)
+	case models.CryptoSell:
+		return s.addCryptoDisposal(t.Date, t.Asset, t.Quantity, value-fee)
+	case models.CryptoTrade:
+		if t.QuoteAsset == "" || t.QuoteQuantity <= 0 {
+			return nil, fmt.Errorf("a crypto-to-crypto trade requires the asset and quantity received")
+		}
+		sale, err := s.addCryptoDisposal(t.Date, t.Asset, t.Quantity, value-fee)
+		if err != nil {
+			return nil, err
+		}
+		return sale, s.addCryptoLot(t.Date, t.QuoteAsset, t.QuoteQuantity, value)
+	default:
+		return nil, fmt.Errorf("unknown crypto trade type %q", t.Type)
+	}
+}
+
+// ImportCrypto parses a generic exchange trade history and records every trade
+// in date order.
+func (s *Service) ImportCrypto(r io.Reader) error {
+	trades, err := importer.ParseCryptoCSV(r)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range trades {
+		if _, err := s.RecordCryptoTrade(t); err != nil {
+			return fmt.Errorf("trade on %s: %w", t.Date, err)
+		}
+	}
+
+	return nil
+}
+
+// addCryptoLot creates an EUR-priced acquisition lot for a crypto-asset from
+// the total cost of the units acquired, in cents.
+func (s *Service) addCryptoLot(date, asset string, qty, costCents float64) error {
+	if err := s.ensureCryptoSecurity(asset); err != nil {
+		return err
+	}
+	vest := &models.Vest{
+		ID:               uuid.New().String(),
+		Date:             date,
+		Symbol:           asset,
+		Quantity:         qty,
+		StrikePriceCents: cryptoUnitPrice(costCents, qty),
+		ECBRate:          models.CryptoRate,
+		Source:           models.SourceCrypto,
+	}
+	if err := s.insertVest(vest); err != nil {
+		return err
+	}
+	log.Printf("Crypto acquisition recorded: %f %s on %s", qty, asset, date)
+	return nil
+}
+
+// addCryptoDisposal records an EUR-priced disposal of a crypto-asset from the
+// total proceeds in cents, and settles it.
+func (s *Service) addCryptoDisposal(date, asset string, qty, proceedsCents float64) (*models.Sale, error) {
+	if err := s.ensureCryptoSecurity(asset); err != nil {
+		return nil, err
+	}
+	sale := &models.Sale{
+		ID:         uuid.New().String(),
+		Date:       date,
+		Symbol:     asset,
+		Quantity:   qty,
+		PriceCents: cryptoUnitPrice(proceedsCents, qty),
+		ECBRate:    models.CryptoRate,
+	}
+	if err := s.insertSale(sale); err != nil {
+		return nil, err
+	}
+	if err := s.SettleSale(sale.ID); err != nil {
+		return nil, err
+	}
+	sale.IsSettled = true
+	return sale, nil
+}
+
+// cryptoUnitPrice converts a total EUR amount in cents into the price of one
+// unit in the finer unit given by models.CryptoPriceScale.
+func cryptoUnitPrice(totalCents, qty float64) int64 {
+	return int64(math.Round(totalCents / qty * models.CryptoPriceScale))
+}
+
+// ensureCryptoSecurity classifies a symbol as a crypto-asset unless it has
+// already been classified.
+func (s *Service) ensureCryptoSecurity(symbol string) error {
+	_, err := s.db.Exec("INSERT OR IGNORE INTO securities (symbol, asset_class) VALUES (?, ?)", symbol, models.AssetClassCrypto)
+	return err
+}
@@ -0,0 +1,80 @@
+package portfolio
+
+import (
+	"strings"
+	"testing"
+
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestImportCrypto_TradesFlowIntoCGT(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	s := NewService(database)
+	csvData := `Date,Type,Asset,Quantity,Price EUR,Quote Asset,Quote Quantity,Fee EUR
+2024-01-05,BUY,BTC,1,20000.00,EUR,,10.00
+2024-06-01,TRADE,BTC,0.5,50000.00,ETH,10,15.00
+2024-12-20,SELL,ETH,4,3000.00,EUR,,0`
+	if err := s.ImportCrypto(strings.NewReader(csvData)); err != nil {
+		t.Fatalf("ImportCrypto failed: %v", err)
+	}
+
+	inventory, _ := s.GetInventory()
+	remaining := map[string]float64{}
+	for _, item := range inventory {
+		if item.AssetClass != "CRYPTO" {
+			t.Errorf("expected %s to be classified as crypto, got %s", item.Symbol, item.AssetClass)
+		}
+		remaining[item.Symbol] += item.RemainingQty
+	}
+	if remaining["BTC"] != 0.5 || remaining["ETH"] != 6 {
+		t.Errorf("unexpected holdings: %v", remaining)
+	}
+
+	// BTC leg: 0.5 x 50000 - 15 fee = 24985 proceeds, cost 0.5 x 20010 = 10005.
+	// ETH leg: 4 x 3000 = 12000 proceeds, cost 4 x 2500 = 10000 (December).
+	summary, err := s.GetCGTSummary(2024)
+	if err != nil {
+		t.Fatalf("GetCGTSummary failed: %v", err)
+	}
+	if summary.Disposals != 2 || summary.GainsCents != 1698000 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	if summary.Later.GainsCents != 200000 {
+		t.Errorf("expected the December ETH gain in the later period, got %d", summary.Later.GainsCents)
+	}
+}
+
+func TestImportCrypto_SubCentToken(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	s := NewService(database)
+	csvData := `Date,Type,Asset,Quantity,Price EUR,Quote Asset,Quote Quantity,Fee EUR
+2024-02-01,BUY,SHIB,1000000,0.0004,EUR,,0
+2024-05-01,SELL,SHIB,500000,0.0009,EUR,,0.50`
+	if err := s.ImportCrypto(strings.NewReader(csvData)); err != nil {
+		t.Fatalf("ImportCrypto failed: %v", err)
+	}
+
+	// Proceeds of 500000 x 0.09 cents less the 50 cent fee = 44950, against a
+	// cost of 500000 x 0.04 cents = 20000.
+	settled, err := s.GetSettledSales()
+	if err != nil || len(settled) != 1 {
+		t.Fatalf("expected one settled lot, got %+v: %v", settled, err)
+	}
+	if ss := settled[0]; ss.EuroSaleEUR != 44950 || ss.EuroGainEUR < 24949 || ss.EuroGainEUR > 24950 || ss.ExchangeRateAtVest != 1.0 {
+		t.Errorf("unexpected settlement of a sub-cent token: %+v", ss)
+	}
+
+	s.SetPrice(models.Price{Symbol: "SHIB", Date: "2024-05-01", PriceCents: 1})
+	valuation, err := s.GetValuation("2024-05-01")
+	if err != nil {
+		t.Fatalf("GetValuation failed: %v", err)
+	}
+	if valuation.CostEURCents != 20000 {
+		t.Errorf("expected the remaining half to cost 20000 cents, got %d", valuation.CostEURCents)
+	}
+}
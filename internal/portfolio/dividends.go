@@ -0,0 +1,162 @@
+package portfolio
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sort"
+
+	"github.com/google/uuid"
+	"irish-cgt-tracker/internal/importer"
+	"irish-cgt-tracker/internal/models"
+)
+
+// TreatyWithholdingRate is the maximum US withholding rate on dividends under
+// the Ireland-US double taxation treaty. Tax withheld above this rate is not
+// creditable in Ireland and must be reclaimed from the IRS instead.
+const TreatyWithholdingRate = 0.15
+
+// DividendIncome aggregates the dividends of one security and account for a year.
+// All amounts are in EUR cents.
+type DividendIncome struct {
+	Symbol              string
+	Account             string
+	Payments            int
+	GrossEURCents       int64
+	WithholdingEURCents int64
+	// CreditEURCents is the foreign tax credit claimable, capped at the treaty rate.
+	CreditEURCents int64
+	NetEURCents    int64
+}
+
+// ForeignIncomeSummary is the annual foreign dividend income for Form 11.
+type ForeignIncomeSummary struct {
+	Year  int
+	Lines []DividendIncome
+	// Totals across all lines.
+	GrossEURCents       int64
+	WithholdingEURCents int64
+	CreditEURCents      int64
+	NetEURCents         int64
+}
+
+// AddDividend records a cash dividend received by the Service's person,
+// fetching the ECB rate for the payment date.
+//
+// Parameters:
+//   - d: The dividend details. ID, ECBRate and OwnerID are populated by this
+//     method.
+//
+// Returns:
+//   - A pointer to the stored models.Dividend.
+//   - An error if the exchange rate cannot be fetched or the database insertion fails.
+func (s *Service) AddDividend(d models.Dividend) (*models.Dividend, error) {
+	if d.Symbol == "" || d.GrossCents <= 0 {
+		return nil, fmt.Errorf("a dividend requires a symbol and a positive gross amount")
+	}
+
+	rate, err := s.transactionRate("dividend from "+d.Symbol, d.Date)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch exchange rate for %s: %w", d.Date, err)
+	}
+	d.ID = uuid.New().String()
+	d.ECBRate = rate
+	d.OwnerID = s.owner
+
+	query := `INSERT INTO dividends (id, date, symbol, account, gross_cents, withholding_cents, ecb_rate, owner_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	if _, err := s.db.Exec(query, d.ID, d.Date, d.Symbol, d.Account, d.GrossCents, d.WithholdingCents, d.ECBRate, d.OwnerID); err != nil {
+		return nil, fmt.Errorf("failed to insert dividend: %w", err)
+	}
+
+	log.Printf("Dividend recorded: %s paid %d cents on %s @ %.4f EUR/USD", d.Symbol, d.GrossCents, d.Date, rate)
+	return &d, nil
+}
+
+// GetDividends retrieves the dividends received by the Service's person,
+// newest first.
+func (s *Service) GetDividends() ([]models.Dividend, error) {
+	rows, err := s.db.Query(`
+		SELECT id, date, symbol, account, gross_cents, withholding_cents, ecb_rate, owner_id
+		FROM dividends WHERE owner_id = ? ORDER BY date DESC`, s.owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dividends []models.Dividend
+	for rows.Next() {
+		var d models.Dividend
+		if err := rows.Scan(&d.ID, &d.Date, &d.Symbol, &d.Account, &d.GrossCents, &d.WithholdingCents, &d.ECBRate, &d.OwnerID); err != nil {
+			return nil, err
+		}
+		dividends = append(dividends, d)
+	}
+	return dividends, nil
+}
+
+// ImportDividends parses a broker dividend history and adds each payment to the portfolio.
+func (s *Service) ImportDividends(r io.Reader, account string) error {
+	dividends, err := importer.ParseDividendCSV(r)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range dividends {
+		d.Account = account
+		if _, err := s.AddDividend(d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetForeignIncomeSummary aggregates the dividends paid to the Service's person
+// in a tax year by security and account, converting each payment at its own
+// ECB rate.
+func (s *Service) GetForeignIncomeSummary(year int) (ForeignIncomeSummary, error) {
+	dividends, err := s.GetDividends()
+	if err != nil {
+		return ForeignIncomeSummary{}, err
+	}
+
+	summary := ForeignIncomeSummary{Year: year}
+	lines := map[string]*DividendIncome{}
+	for _, d := range dividends {
+		if disposalYear(d.Date) != year {
+			continue
+		}
+		key := d.Symbol + "|" + d.Account
+		line, ok := lines[key]
+		if !ok {
+			line = &DividendIncome{Symbol: d.Symbol, Account: d.Account}
+			lines[key] = line
+		}
+
+		gross := int64(math.Round(float64(d.GrossCents) * d.ECBRate))
+		withheld := int64(math.Round(float64(d.WithholdingCents) * d.ECBRate))
+		credit := min(withheld, int64(math.Round(float64(gross)*TreatyWithholdingRate)))
+
+		line.Payments++
+		line.GrossEURCents += gross
+		line.WithholdingEURCents += withheld
+		line.CreditEURCents += credit
+		line.NetEURCents += gross - withheld
+	}
+
+	for _, line := range lines {
+		summary.Lines = append(summary.Lines, *line)
+		summary.GrossEURCents += line.GrossEURCents
+		summary.WithholdingEURCents += line.WithholdingEURCents
+		summary.CreditEURCents += line.CreditEURCents
+		summary.NetEURCents += line.NetEURCents
+	}
+	sort.Slice(summary.Lines, func(i, j int) bool {
+		if summary.Lines[i].Symbol != summary.Lines[j].Symbol {
+			return summary.Lines[i].Symbol < summary.Lines[j].Symbol
+		}
+		return summary.Lines[i].Account < summary.Lines[j].Account
+	})
+	return summary, nil
+}
@@ -0,0 +1,53 @@
+package portfolio
+
+import (
+	"strings"
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestGetForeignIncomeSummary(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 0.5)
+
+	s := NewService(database)
+	csvData := `Payment Date,Symbol,Gross Amount,Tax Withheld,Net Amount
+16-Jun-2025,GOOGL,$100.00,-$15.00,$85.00
+15-Sep-2025,GOOGL,$100.00,-$30.00,$70.00
+15-Dec-2024,GOOGL,$100.00,-$15.00,$85.00`
+	if err := s.ImportDividends(strings.NewReader(csvData), "Morgan Stanley"); err != nil {
+		t.Fatalf("ImportDividends failed: %v", err)
+	}
+
+	summary, err := s.GetForeignIncomeSummary(2025)
+	if err != nil {
+		t.Fatalf("GetForeignIncomeSummary failed: %v", err)
+	}
+	if len(summary.Lines) != 1 || summary.Lines[0].Payments != 2 || summary.Lines[0].Account != "Morgan Stanley" {
+		t.Fatalf("unexpected summary lines: %+v", summary.Lines)
+	}
+	// Gross $200 = EUR 100, withheld $45 = EUR 22.50, credit capped at 15% = EUR 15.
+	if summary.GrossEURCents != 10000 || summary.WithholdingEURCents != 2250 || summary.CreditEURCents != 1500 {
+		t.Errorf("unexpected totals: %+v", summary)
+	}
+	if summary.NetEURCents != 7750 {
+		t.Errorf("expected net of 7750 cents, got %d", summary.NetEURCents)
+	}
+
+	// A spouse's dividends are reported on their own summary only.
+	spouse, _ := s.AddPerson("Spouse")
+	if _, err := s.ForPerson(spouse.ID).AddDividend(models.Dividend{Date: "2025-07-01", Symbol: "MSFT", GrossCents: 10000}); err != nil {
+		t.Fatalf("AddDividend failed: %v", err)
+	}
+	if summary, _ := s.GetForeignIncomeSummary(2025); summary.GrossEURCents != 10000 {
+		t.Errorf("expected the spouse's dividend to be left out, got %+v", summary)
+	}
+	spouseSummary, _ := s.ForPerson(spouse.ID).GetForeignIncomeSummary(2025)
+	if len(spouseSummary.Lines) != 1 || spouseSummary.Lines[0].Symbol != "MSFT" || spouseSummary.GrossEURCents != 5000 {
+		t.Errorf("unexpected spouse summary: %+v", spouseSummary)
+	}
+}
@@ -0,0 +1,109 @@
+package portfolio
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/google/uuid"
+	"irish-cgt-tracker/internal/importer"
+	"irish-cgt-tracker/internal/models"
+)
+
+// AddESPPPurchase records shares bought through an Employee Stock Purchase Plan.
+//
+// The purchase creates an acquisition lot in the common FIFO pool whose base
+// cost is the market value on the purchase date: the discount was already
+// taxed as income through payroll, so the CGT base cost is the price paid plus
+// the amount taxed, not the discounted price alone.
+//
+// Parameters:
+//   - p: The purchase details. ID, VestID and ECBRate are populated by this method.
+//
+// Returns:
+//   - A pointer to the stored models.ESPPPurchase.
+//   - An error if the exchange rate cannot be fetched or the database insertion fails.
+func (s *Service) AddESPPPurchase(p models.ESPPPurchase) (*models.ESPPPurchase, error) {
+	if p.MarketValueCents <= 0 || p.Quantity <= 0 {
+		return nil, fmt.Errorf("an ESPP purchase requires a positive quantity and market value")
+	}
+
+	rate, err := s.transactionRate("ESPP purchase", p.PurchaseDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch exchange rate for %s: %w", p.PurchaseDate, err)
+	}
+
+	vest := &models.Vest{
+		ID:               uuid.New().String(),
+		Date:             p.PurchaseDate,
+		Symbol:           p.Symbol,
+		Quantity:         p.Quantity,
+		StrikePriceCents: p.MarketValueCents,
+		ECBRate:          rate,
+		Source:           models.SourceESPP,
+	}
+	p.ID = uuid.New().String()
+	p.VestID = vest.ID
+	p.ECBRate = rate
+
+	// The lot and its ESPP record are saved together, so a lot is never left
+	// without the purchase that explains its base cost.
+	err = s.inTx(func(tx *Service) error {
+		if err := tx.insertVest(vest); err != nil {
+			return err
+		}
+		query := `INSERT INTO espp_purchases (id, vest_id, offering_date, purchase_price_cents, market_value_cents) VALUES (?, ?, ?, ?, ?)`
+		if _, err := tx.db.Exec(query, p.ID, p.VestID, p.OfferingDate, p.PurchasePriceCents, p.MarketValueCents); err != nil {
+			return fmt.Errorf("failed to insert ESPP purchase: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("ESPP purchase recorded: %f shares of %s on %s @ %.4f EUR/USD", p.Quantity, p.Symbol, p.PurchaseDate, rate)
+	return &p, nil
+}
+
+// GetESPPPurchases retrieves all ESPP purchases, newest first.
+func (s *Service) GetESPPPurchases() ([]models.ESPPPurchase, error) {
+	rows, err := s.db.Query(`
+		SELECT e.id, e.vest_id, v.symbol, v.date, e.offering_date, v.quantity,
+		       e.purchase_price_cents, e.market_value_cents, v.ecb_rate
+		FROM espp_purchases e
+		JOIN vests v ON v.id = e.vest_id
+		ORDER BY v.date DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var purchases []models.ESPPPurchase
+	for rows.Next() {
+		var p models.ESPPPurchase
+		if err := rows.Scan(&p.ID, &p.VestID, &p.Symbol, &p.PurchaseDate, &p.OfferingDate, &p.Quantity,
+			&p.PurchasePriceCents, &p.MarketValueCents, &p.ECBRate); err != nil {
+			return nil, err
+		}
+		purchases = append(purchases, p)
+	}
+	return purchases, nil
+}
+
+// ImportESPP parses a broker ESPP purchase report and adds each purchase to the portfolio.
+func (s *Service) ImportESPP(r io.Reader, symbol string) error {
+	purchases, err := importer.ParseESPPCSV(r)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range purchases {
+		p.Symbol = symbol
+		if _, err := s.AddESPPPurchase(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
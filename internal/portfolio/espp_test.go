@@ -0,0 +1,78 @@
+package portfolio
+
+import (
+	"strings"
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestImportESPP_SettlesAtMarketValue(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	if _, err := s.AddVest("2024-01-15", "GOOGL", 10, 14000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+
+	csvData := `Purchase Date,Offering Date,Offering FMV,Purchase FMV,Purchase Price,Quantity
+31-Dec-2024,01-Jul-2024,$180.00,$190.00,$153.00,10`
+	if err := s.ImportESPP(strings.NewReader(csvData), "GOOGL"); err != nil {
+		t.Fatalf("ImportESPP failed: %v", err)
+	}
+
+	purchases, err := s.GetESPPPurchases()
+	if err != nil {
+		t.Fatalf("GetESPPPurchases failed: %v", err)
+	}
+	if len(purchases) != 1 || purchases[0].Symbol != "GOOGL" || purchases[0].PurchasePriceCents != 15300 {
+		t.Fatalf("unexpected ESPP purchases: %+v", purchases)
+	}
+
+	// Selling 15 shares consumes the RSU lot first and then half of the ESPP lot.
+	sale, err := s.AddSale("2025-03-01", "GOOGL", 15, 20000)
+	if err != nil {
+		t.Fatalf("AddSale failed: %v", err)
+	}
+	if err := s.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+
+	settled, err := s.GetSettledSales()
+	if err != nil {
+		t.Fatalf("GetSettledSales failed: %v", err)
+	}
+	for _, ss := range settled {
+		if ss.VestID == purchases[0].VestID {
+			// Base cost is the $190 market value, not the $153 paid.
+			if ss.NumShares != 5 || ss.EuroGainEUR != 5000 {
+				t.Errorf("expected a gain of 5 x $10 on the ESPP lot, got %+v", ss)
+			}
+			return
+		}
+	}
+	t.Fatal("expected a settled lot against the ESPP purchase")
+}
+
+func TestAddESPPPurchase_KeepsLotAndRecordTogether(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	// Without the ESPP table the purchase fails, and must not leave a lot behind.
+	if _, err := database.Exec("DROP TABLE espp_purchases"); err != nil {
+		t.Fatalf("failed to drop table: %v", err)
+	}
+	s := NewService(database)
+	_, err := s.AddESPPPurchase(models.ESPPPurchase{Symbol: "GOOGL", PurchaseDate: "2024-12-31", Quantity: 10, PurchasePriceCents: 15300, MarketValueCents: 19000})
+	if err == nil {
+		t.Fatal("expected the purchase to fail")
+	}
+	if inventory, _ := s.GetInventory(); len(inventory) != 0 {
+		t.Errorf("expected no lot without its ESPP record, got %+v", inventory)
+	}
+}
@@ -0,0 +1,348 @@
+package portfolio
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"irish-cgt-tracker/internal/models"
+)
+
+const (
+	// ExitTaxRate is the rate of exit tax on gains from EU-domiciled funds.
+	ExitTaxRate = 0.41
+	// DeemedDisposalYears is the interval after which an ETF holding is deemed
+	// to be disposed of and reacquired at market value.
+	DeemedDisposalYears = 8
+	// DeemedPriceDays is how many days before a deemed disposal the last stored
+	// price may be, to allow for weekends and market holidays.
+	DeemedPriceDays = 7
+)
+
+// DeemedDisposal is an upcoming eight-year anniversary of an open ETF lot with
+// an estimate of the exit tax that will fall due on it.
+type DeemedDisposal struct {
+	InventoryItem
+	// AnniversaryDate is the next deemed disposal date in "YYYY-MM-DD" format.
+	AnniversaryDate string
+	// MarketValueCents, GainCents and EstimatedTaxCents are in EUR cents.
+	MarketValueCents  int64
+	GainCents         int64
+	EstimatedTaxCents int64
+}
+
+// calculateAndStoreExitTax computes the exit tax on an ETF sale-vest lot.
+// Unlike CGT, a loss gives no relief and no annual exemption applies. The gain
+// is measured from the lot's value at its last deemed disposal, if any, so a
+// gain already taxed on a deemed disposal is not taxed again, and a fall since
+// then is credited against the tax paid on it.
+func (s *Service) calculateAndStoreExitTax(sale *models.Sale, vest *models.Vest, numShares float64) error {
+	deemed, err := s.getDeemedDisposals()
+	if err != nil {
+		return err
+	}
+	proceeds := models.PriceEUR(sale.PriceCents, sale.ECBRate) * numShares
+	unitCost, taxPaid := etfUnitCost(vest, deemed[vest.ID], sale.Date)
+	d := exitTaxDisposal(sale.ID, vest, sale.Date, numShares, proceeds, unitCost*numShares, "DISPOSAL")
+	return s.insertExitTaxDisposal(creditDeemedTax(d, taxPaid))
+}
+
+// insertExitTaxDisposal saves an actual or deemed ETF disposal.
+func (s *Service) insertExitTaxDisposal(d models.ExitTaxDisposal) error {
+	query := `INSERT INTO exit_tax_disposals (sale_id, vest_id, date, symbol, shares, proceeds_cents, cost_cents, gain_cents, tax_cents, type)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.Exec(query, d.SaleID, d.VestID, d.Date, d.Symbol, d.Shares, d.ProceedsCents, d.CostCents, d.GainCents, d.TaxCents, d.Type)
+	return err
+}
+
+// etfUnitCost returns the EUR cost per unit of an ETF lot for a disposal on a
+// date: its value at the last of its deemed disposals before the date, or its
+// original cost converted at the acquisition rate. It also returns the exit tax
+// paid per unit on those deemed disposals.
+func etfUnitCost(vest *models.Vest, deemed []models.ExitTaxDisposal, date string) (cost, taxPaid float64) {
+	cost = models.PriceEUR(vest.StrikePriceCents, vest.ECBRate)
+	for _, d := range deemed {
+		if d.Date < date && d.Shares > 0 {
+			cost = float64(d.ProceedsCents) / d.Shares
+			taxPaid += float64(d.TaxCents) / d.Shares
+		}
+	}
+	return cost, taxPaid
+}
+
+// creditDeemedTax credits a loss on an actual disposal, measured from the
+// lot's last deemed disposal value, against the exit tax already paid on the
+// units sold (TCA 1997 s.739E). The credit is recorded as negative tax and
+// never exceeds the tax paid, so a fall below the original cost gives no
+// further relief.
+func creditDeemedTax(d models.ExitTaxDisposal, taxPaid float64) models.ExitTaxDisposal {
+	if d.GainCents < 0 {
+		d.TaxCents = -int64(math.Round(math.Min(float64(-d.GainCents)*ExitTaxRate, taxPaid*d.Shares)))
+	}
+	return d
+}
+
+// getDeemedDisposals returns the recorded deemed disposals of each ETF lot,
+// oldest first, keyed by lot ID.
+func (s *Service) getDeemedDisposals() (map[string][]models.ExitTaxDisposal, error) {
+	rows, err := s.db.Query(`
+		SELECT vest_id, date, symbol, shares, proceeds_cents, cost_cents, gain_cents, tax_cents
+		FROM exit_tax_disposals WHERE type = 'DEEMED' ORDER BY date ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deemed := map[string][]models.ExitTaxDisposal{}
+	for rows.Next() {
+		d := models.ExitTaxDisposal{Type: "DEEMED"}
+		if err := rows.Scan(&d.VestID, &d.Date, &d.Symbol, &d.Shares, &d.ProceedsCents, &d.CostCents, &d.GainCents, &d.TaxCents); err != nil {
+			return nil, err
+		}
+		deemed[d.VestID] = append(deemed[d.VestID], d)
+	}
+	return deemed, nil
+}
+
+// RecordDeemedDisposals records the deemed disposal of every ETF lot that has
+// reached an eight-year anniversary on or before asOf and not yet had it
+// recorded. The units held on the anniversary are valued at the stored price
+// of the security on that date, or the last price in the DeemedPriceDays
+// before it, converted at the ECB rate, and the gain since the lot's cost (or
+// its previous deemed disposal) is taxed at ExitTaxRate. Later disposals of the
+// lot are measured from that value.
+//
+// Parameters:
+//   - asOf: The last anniversary date to record, in "YYYY-MM-DD" format.
+//
+// Returns:
+//   - The deemed disposals recorded by this call, oldest first.
+//   - An error if a price or exchange rate is missing, an anniversary falls in
+//     a locked tax year of the lot's owner or a database query fails.
+func (s *Service) RecordDeemedDisposals(asOf string) ([]models.ExitTaxDisposal, error) {
+	if _, err := models.ParseDate(asOf); err != nil {
+		return nil, fmt.Errorf("invalid deemed disposal date: %w", err)
+	}
+	lots, err := s.getETFLots()
+	if err != nil {
+		return nil, err
+	}
+	return s.recordDeemedDisposals(asOf, lots)
+}
+
+// recordDeemedDisposals records the deemed disposals of the given ETF lots
+// that have fallen due on or before asOf and are not yet recorded.
+func (s *Service) recordDeemedDisposals(asOf string, lots []models.Vest) ([]models.ExitTaxDisposal, error) {
+	deemed, err := s.getDeemedDisposals()
+	if err != nil {
+		return nil, err
+	}
+
+	var recorded []models.ExitTaxDisposal
+	for _, lot := range lots {
+		acquired, err := models.ParseDate(lot.Date)
+		if err != nil {
+			return nil, err
+		}
+		for n := 1; ; n++ {
+			date := acquired.AddDate(DeemedDisposalYears*n, 0, 0).Format("2006-01-02")
+			if date > asOf {
+				break
+			}
+			if hasDeemedDisposal(deemed[lot.ID], date) {
+				continue
+			}
+			held, err := s.unitsHeldOn(lot.ID, lot.Quantity, date)
+			if err != nil {
+				return nil, err
+			}
+			if held <= quantityEpsilon {
+				break // Units sold are never reacquired.
+			}
+			if err := s.checkYearOpen(lot.OwnerID, date); err != nil {
+				return nil, err
+			}
+
+			price, err := s.deemedDisposalPrice(lot.Symbol, date)
+			if err != nil {
+				return nil, err
+			}
+			rate, err := s.transactionRate("deemed disposal of "+lot.Symbol, date)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch exchange rate for %s: %w", date, err)
+			}
+			value := float64(price) * rate * held
+			unitCost, _ := etfUnitCost(&lot, deemed[lot.ID], date)
+			cost := unitCost * held
+			d := exitTaxDisposal("", &lot, date, held, value, cost, "DEEMED")
+			if err := s.insertExitTaxDisposal(d); err != nil {
+				return nil, fmt.Errorf("failed to insert deemed disposal: %w", err)
+			}
+			deemed[lot.ID] = append(deemed[lot.ID], d)
+			recorded = append(recorded, d)
+			log.Printf("Deemed disposal recorded: %f units of %s on %s, exit tax %d cents", held, lot.Symbol, date, d.TaxCents)
+		}
+	}
+
+	sort.SliceStable(recorded, func(i, j int) bool { return recorded[i].Date < recorded[j].Date })
+	return recorded, nil
+}
+
+// hasDeemedDisposal reports whether a deemed disposal on the date is recorded.
+func hasDeemedDisposal(deemed []models.ExitTaxDisposal, date string) bool {
+	for _, d := range deemed {
+		if d.Date == date {
+			return true
+		}
+	}
+	return false
+}
+
+// getETFLots returns every lot of a security classified as an ETF, including
+// lots since sold, oldest first.
+func (s *Service) getETFLots() ([]models.Vest, error) {
+	rows, err := s.db.Query(`
+		SELECT v.id, v.date, v.symbol, v.quantity, v.strike_price_cents, v.ecb_rate, v.owner_id
+		FROM vests v JOIN securities sec ON sec.symbol = v.symbol
+		WHERE sec.asset_class = ? ORDER BY v.date ASC`, models.AssetClassETF)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lots []models.Vest
+	for rows.Next() {
+		var v models.Vest
+		if err := rows.Scan(&v.ID, &v.Date, &v.Symbol, &v.Quantity, &v.StrikePriceCents, &v.ECBRate, &v.OwnerID); err != nil {
+			return nil, err
+		}
+		lots = append(lots, v)
+	}
+	return lots, nil
+}
+
+// unitsHeldOn returns the units of a lot still held at the end of a date,
+// after the sales and lot adjustments made on or before it.
+func (s *Service) unitsHeldOn(vestID string, quantity float64, date string) (float64, error) {
+	var used float64
+	err := s.db.QueryRow(`
+		SELECT COALESCE((SELECT SUM(sl.quantity) FROM sale_lots sl JOIN sales sa ON sa.id = sl.sale_id WHERE sl.vest_id = ? AND sa.date <= ?), 0) +
+		       COALESCE((SELECT SUM(la.quantity) FROM lot_adjustments la WHERE la.vest_id = ? AND la.date <= ?), 0)`,
+		vestID, date, vestID, date).Scan(&used)
+	if err != nil {
+		return 0, err
+	}
+	return quantity - used, nil
+}
+
+// deemedDisposalPrice returns the stored price of a security on a deemed
+// disposal date, or the last price in the DeemedPriceDays before it.
+func (s *Service) deemedDisposalPrice(symbol, date string) (int64, error) {
+	d, err := models.ParseDate(date)
+	if err != nil {
+		return 0, err
+	}
+	earliest := d.AddDate(0, 0, -DeemedPriceDays).Format("2006-01-02")
+	var price int64
+	err = s.db.QueryRow(`SELECT price_cents FROM prices WHERE symbol = ? AND date BETWEEN ? AND ? ORDER BY date DESC LIMIT 1`,
+		symbol, earliest, date).Scan(&price)
+	if err != nil {
+		return 0, fmt.Errorf("no price of %s stored for the deemed disposal on %s: record one on the valuation page", symbol, date)
+	}
+	return price, nil
+}
+
+// exitTaxDisposal builds an ExitTaxDisposal from EUR proceeds and cost in cents.
+func exitTaxDisposal(saleID string, vest *models.Vest, date string, shares, proceeds, cost float64, kind string) models.ExitTaxDisposal {
+	gain := proceeds - cost
+	return models.ExitTaxDisposal{
+		SaleID:        saleID,
+		VestID:        vest.ID,
+		Date:          date,
+		Symbol:        vest.Symbol,
+		Shares:        shares,
+		ProceedsCents: int64(math.Round(proceeds)),
+		CostCents:     int64(math.Round(cost)),
+		GainCents:     int64(math.Round(gain)),
+		TaxCents:      int64(math.Round(math.Max(gain, 0) * ExitTaxRate)),
+		Type:          kind,
+	}
+}
+
+// GetExitTaxDisposals retrieves all ETF disposals taxed under the exit tax regime, newest first.
+func (s *Service) GetExitTaxDisposals() ([]models.ExitTaxDisposal, error) {
+	rows, err := s.db.Query(`
+		SELECT sale_id, vest_id, date, symbol, shares, proceeds_cents, cost_cents, gain_cents, tax_cents, type
+		FROM exit_tax_disposals ORDER BY date DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var disposals []models.ExitTaxDisposal
+	for rows.Next() {
+		var d models.ExitTaxDisposal
+		if err := rows.Scan(&d.SaleID, &d.VestID, &d.Date, &d.Symbol, &d.Shares, &d.ProceedsCents,
+			&d.CostCents, &d.GainCents, &d.TaxCents, &d.Type); err != nil {
+			return nil, err
+		}
+		disposals = append(disposals, d)
+	}
+	return disposals, nil
+}
+
+// GetUpcomingDeemedDisposals lists every open ETF lot with its next eight-year
+// anniversary on or after asOf, soonest first.
+//
+// The liability is estimated from the given current prices (USD cents per
+// unit, keyed by symbol) converted at rate. Lots without a price are valued at
+// cost, giving no estimated tax. The estimate measures the gain from the value
+// at the lot's last recorded deemed disposal, or from its original cost.
+func (s *Service) GetUpcomingDeemedDisposals(asOf time.Time, prices map[string]int64, rate float64) ([]DeemedDisposal, error) {
+	inventory, err := s.getAvailableInventory()
+	if err != nil {
+		return nil, err
+	}
+	deemed, err := s.getDeemedDisposals()
+	if err != nil {
+		return nil, err
+	}
+
+	var upcoming []DeemedDisposal
+	for _, item := range inventory {
+		if item.AssetClass != models.AssetClassETF {
+			continue
+		}
+		acquired, err := models.ParseDate(item.Date)
+		if err != nil {
+			return nil, err
+		}
+		anniversary := acquired.AddDate(DeemedDisposalYears, 0, 0)
+		for anniversary.Before(asOf) {
+			anniversary = anniversary.AddDate(DeemedDisposalYears, 0, 0)
+		}
+
+		unitCost, _ := etfUnitCost(&item.Vest, deemed[item.ID], anniversary.Format("2006-01-02"))
+		cost := unitCost * item.RemainingQty
+		value := cost
+		if price, ok := prices[item.Symbol]; ok && rate > 0 {
+			value = float64(price) * rate * item.RemainingQty
+		}
+		d := exitTaxDisposal("", &item.Vest, anniversary.Format("2006-01-02"), item.RemainingQty, value, cost, "DEEMED")
+
+		upcoming = append(upcoming, DeemedDisposal{
+			InventoryItem:     item,
+			AnniversaryDate:   d.Date,
+			MarketValueCents:  d.ProceedsCents,
+			GainCents:         d.GainCents,
+			EstimatedTaxCents: d.TaxCents,
+		})
+	}
+
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		return upcoming[i].AnniversaryDate < upcoming[j].AnniversaryDate
+	})
+	return upcoming, nil
+}
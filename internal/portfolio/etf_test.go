@@ -0,0 +1,206 @@
+package portfolio
+
+import (
+	"testing"
+	"time"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestSettleSale_ETFUsesExitTax(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	if err := s.SetSecurity(models.Security{Symbol: "VWCE", AssetClass: models.AssetClassETF}); err != nil {
+		t.Fatalf("SetSecurity failed: %v", err)
+	}
+	if _, err := s.AddVest("2020-01-15", "VWCE", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	if _, err := s.AddVest("2021-01-15", "VWCE", 10, 20000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+
+	sale, _ := s.AddSale("2024-05-01", "VWCE", 15, 15000)
+	if err := s.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+
+	settled, _ := s.GetSettledSales()
+	if len(settled) != 0 {
+		t.Errorf("expected ETF disposals to bypass CGT, got %d settled sales", len(settled))
+	}
+
+	disposals, err := s.GetExitTaxDisposals()
+	if err != nil {
+		t.Fatalf("GetExitTaxDisposals failed: %v", err)
+	}
+	if len(disposals) != 2 {
+		t.Fatalf("expected 2 exit tax disposals, got %d", len(disposals))
+	}
+	for _, d := range disposals {
+		switch d.Shares {
+		case 10: // Gain of $500 taxed at 41%.
+			if d.GainCents != 50000 || d.TaxCents != 20500 {
+				t.Errorf("unexpected gain lot: %+v", d)
+			}
+		case 5: // Loss of $250 gets no relief.
+			if d.GainCents != -25000 || d.TaxCents != 0 {
+				t.Errorf("unexpected loss lot: %+v", d)
+			}
+		}
+	}
+}
+
+func TestGetUpcomingDeemedDisposals(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	s.SetSecurity(models.Security{Symbol: "VWCE", AssetClass: models.AssetClassETF})
+	s.AddVest("2015-03-01", "VWCE", 10, 10000)
+	s.AddVest("2019-06-01", "VWCE", 10, 10000)
+	s.AddVest("2019-06-01", "GOOGL", 10, 10000)
+
+	asOf := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	upcoming, err := s.GetUpcomingDeemedDisposals(asOf, map[string]int64{"VWCE": 15000}, 0.9)
+	if err != nil {
+		t.Fatalf("GetUpcomingDeemedDisposals failed: %v", err)
+	}
+	if len(upcoming) != 2 {
+		t.Fatalf("expected 2 ETF lots, got %d", len(upcoming))
+	}
+	if upcoming[0].AnniversaryDate != "2027-06-01" || upcoming[1].AnniversaryDate != "2031-03-01" {
+		t.Errorf("unexpected anniversaries: %s, %s", upcoming[0].AnniversaryDate, upcoming[1].AnniversaryDate)
+	}
+	// Value 10 x $150 x 0.9 = EUR 1,350 against EUR 1,000 cost.
+	if upcoming[0].GainCents != 35000 || upcoming[0].EstimatedTaxCents != 14350 {
+		t.Errorf("unexpected estimate: %+v", upcoming[0])
+	}
+}
+
+func TestSettleSale_ETFAfterDeemedDisposal(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	s.SetSecurity(models.Security{Symbol: "VWCE", AssetClass: models.AssetClassETF})
+	s.AddVest("2010-01-15", "VWCE", 10, 10000)
+	sale, _ := s.AddSale("2019-03-01", "VWCE", 10, 16000)
+
+	// The eighth anniversary needs a price to value the deemed disposal.
+	if err := s.SettleSale(sale.ID); err == nil {
+		t.Fatal("expected the sale to wait for a price on the anniversary")
+	}
+	s.SetPrice(models.Price{Symbol: "VWCE", Date: "2018-01-12", PriceCents: 15000, Source: "MANUAL"})
+	if err := s.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+
+	disposals, err := s.GetExitTaxDisposals()
+	if err != nil || len(disposals) != 2 {
+		t.Fatalf("expected a deemed and an actual disposal, got %+v: %v", disposals, err)
+	}
+	// Deemed on 2018-01-15 at $150: EUR 500 gain taxed at 41%.
+	deemed, actual := disposals[1], disposals[0]
+	if deemed.Type != "DEEMED" || deemed.Date != "2018-01-15" || deemed.GainCents != 50000 || deemed.TaxCents != 20500 {
+		t.Errorf("unexpected deemed disposal: %+v", deemed)
+	}
+	// The sale is taxed only on the EUR 100 gain since the deemed disposal.
+	if actual.Type != "DISPOSAL" || actual.CostCents != 150000 || actual.GainCents != 10000 || actual.TaxCents != 4100 {
+		t.Errorf("unexpected disposal after the deemed disposal: %+v", actual)
+	}
+
+	// Recording again finds nothing new.
+	if recorded, err := s.RecordDeemedDisposals("2019-03-01"); err != nil || len(recorded) != 0 {
+		t.Errorf("expected no further deemed disposals, got %+v: %v", recorded, err)
+	}
+}
+
+func TestSettleSale_ETFDeemedDisposalsOfMatchedLots(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	spouse, _ := s.AddPerson("Spouse")
+	theirs := s.ForPerson(spouse.ID)
+	s.SetSecurity(models.Security{Symbol: "VWCE", AssetClass: models.AssetClassETF})
+	s.SetPrice(models.Price{Symbol: "VWCE", Date: "2024-01-15", PriceCents: 15000, Source: "MANUAL"})
+	s.SetPrice(models.Price{Symbol: "VWCE", Date: "2024-02-01", PriceCents: 15000, Source: "MANUAL"})
+	mine, _ := s.AddVest("2016-01-15", "VWCE", 10, 10000)
+	theirs.AddVest("2016-02-01", "VWCE", 10, 10000)
+
+	// Only the lot sold has its anniversary recorded, not the spouse's.
+	sale, _ := s.AddSale("2024-03-01", "VWCE", 10, 16000)
+	if err := s.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+	disposals, _ := s.GetExitTaxDisposals()
+	if len(disposals) != 2 || disposals[0].VestID != mine.ID || disposals[1].VestID != mine.ID {
+		t.Errorf("expected the deemed and actual disposal of the lot sold, got %+v", disposals)
+	}
+}
+
+func TestSettleSale_ETFDeemedDisposalInLockedYear(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	s.SetSecurity(models.Security{Symbol: "VWCE", AssetClass: models.AssetClassETF})
+	s.SetPrice(models.Price{Symbol: "VWCE", Date: "2023-06-01", PriceCents: 15000, Source: "MANUAL"})
+	s.AddVest("2015-06-01", "VWCE", 10, 10000)
+	if _, err := s.CloseYear(2023); err != nil {
+		t.Fatalf("CloseYear failed: %v", err)
+	}
+
+	// The 2023 anniversary cannot be added to the closed year.
+	sale, _ := s.AddSale("2024-03-01", "VWCE", 10, 16000)
+	if err := s.SettleSale(sale.ID); err == nil {
+		t.Fatal("expected the locked year to block the deemed disposal")
+	}
+	if disposals, _ := s.GetExitTaxDisposals(); len(disposals) != 0 {
+		t.Errorf("expected nothing recorded, got %+v", disposals)
+	}
+}
+
+func TestSettleSale_ETFLossCreditsDeemedTax(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	s.SetSecurity(models.Security{Symbol: "VWCE", AssetClass: models.AssetClassETF})
+	s.SetPrice(models.Price{Symbol: "VWCE", Date: "2018-01-12", PriceCents: 15000, Source: "MANUAL"})
+	s.AddVest("2010-01-15", "VWCE", 10, 10000)
+
+	// The deemed disposal at $150 paid EUR 20.50 a unit. A fall to $120 is
+	// credited at 41% of the EUR 30 loss a unit.
+	sale, _ := s.AddSale("2019-03-01", "VWCE", 5, 12000)
+	if err := s.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+	// A fall to $50 is below the original cost, so the credit stops at the tax paid.
+	later, _ := s.AddSale("2019-06-03", "VWCE", 5, 5000)
+	if err := s.SettleSale(later.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+
+	disposals, _ := s.GetExitTaxDisposals()
+	if len(disposals) != 3 {
+		t.Fatalf("expected a deemed and two actual disposals, got %+v", disposals)
+	}
+	if d := disposals[1]; d.GainCents != -15000 || d.TaxCents != -6150 {
+		t.Errorf("unexpected credit on the first sale: %+v", d)
+	}
+	if d := disposals[0]; d.GainCents != -50000 || d.TaxCents != -10250 {
+		t.Errorf("unexpected capped credit on the second sale: %+v", d)
+	}
+}
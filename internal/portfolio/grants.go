@@ -0,0 +1,256 @@
+package portfolio
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"irish-cgt-tracker/internal/models"
+)
+
+// ReleaseMatchDays is how far an imported release may fall from its scheduled
+// tranche date and still be reconciled against it, allowing for weekends,
+// holidays and broker processing delays.
+const ReleaseMatchDays = 7
+
+// AddGrant records an RSU grant held by the Service's person and its vesting
+// schedule.
+//
+// Parameters:
+//   - g: The grant details. ID and OwnerID are populated by this method.
+//
+// Returns:
+//   - A pointer to the stored models.Grant.
+//   - An error if the grant is invalid or the database insertion fails.
+func (s *Service) AddGrant(g models.Grant) (*models.Grant, error) {
+	if _, err := models.ParseDate(g.GrantDate); err != nil {
+		return nil, fmt.Errorf("invalid grant date: %w", err)
+	}
+	if _, err := models.ParseDate(g.VestStartDate); err != nil {
+		return nil, fmt.Errorf("invalid vesting start date: %w", err)
+	}
+	if g.Symbol == "" || g.TotalUnits <= 0 {
+		return nil, fmt.Errorf("a grant requires a symbol and a positive number of units")
+	}
+	if g.Tranches <= 0 || g.CadenceMonths <= 0 || g.CliffMonths < 0 {
+		return nil, fmt.Errorf("a grant requires a positive number of tranches and cadence, and a non-negative cliff")
+	}
+
+	g.ID = uuid.New().String()
+	g.OwnerID = s.owner
+	query := `INSERT INTO grants (id, grant_number, symbol, plan, grant_date, total_units, vest_start_date, cadence_months, tranches, cliff_months, owner_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.Exec(query, g.ID, g.GrantNumber, g.Symbol, g.Plan, g.GrantDate, g.TotalUnits, g.VestStartDate,
+		g.CadenceMonths, g.Tranches, g.CliffMonths, g.OwnerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert grant: %w", err)
+	}
+	return &g, nil
+}
+
+// GetGrants retrieves the grants held by the Service's person with the units
+// released against them so far.
+func (s *Service) GetGrants() ([]models.Grant, error) {
+	rows, err := s.db.Query(`
+		SELECT g.id, g.grant_number, g.symbol, g.plan, g.grant_date, g.total_units, g.vest_start_date,
+		       g.cadence_months, g.tranches, g.cliff_months, g.owner_id,
+		       COALESCE((SELECT SUM(v.quantity) FROM grant_releases r JOIN vests v ON v.id = r.vest_id WHERE r.grant_id = g.id), 0)
+		FROM grants g WHERE g.owner_id = ? ORDER BY g.grant_date ASC`, s.owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var grants []models.Grant
+	for rows.Next() {
+		var g models.Grant
+		if err := rows.Scan(&g.ID, &g.GrantNumber, &g.Symbol, &g.Plan, &g.GrantDate, &g.TotalUnits, &g.VestStartDate,
+			&g.CadenceMonths, &g.Tranches, &g.CliffMonths, &g.OwnerID, &g.VestedUnits); err != nil {
+			return nil, err
+		}
+		grants = append(grants, g)
+	}
+	return grants, nil
+}
+
+// GetVestSchedule projects every tranche of every grant held by the Service's
+// person and marks each one as
+// vested (reconciled against a release), overdue (scheduled on or before asOf
+// but not yet released) or upcoming.
+//
+// Parameters:
+//   - asOf: The reference date in "YYYY-MM-DD" format, typically today.
+//
+// Returns:
+//   - The tranches of all grants, ordered by grant and tranche number.
+//   - An error if the database query fails.
+func (s *Service) GetVestSchedule(asOf string) ([]models.VestTranche, error) {
+	grants, err := s.GetGrants()
+	if err != nil {
+		return nil, err
+	}
+	releases, err := s.getGrantReleases()
+	if err != nil {
+		return nil, err
+	}
+
+	var schedule []models.VestTranche
+	for _, g := range grants {
+		for _, t := range grantSchedule(g) {
+			if r, ok := releases[trancheKey(g.ID, t.Number)]; ok {
+				t.Status = models.TrancheVested
+				t.VestID, t.OrderNumber, t.ReleaseDate, t.ActualQty = r.VestID, r.OrderNumber, r.ReleaseDate, r.ActualQty
+			} else if t.Date <= asOf {
+				t.Status = models.TrancheOverdue
+			} else {
+				t.Status = models.TrancheUpcoming
+			}
+			schedule = append(schedule, t)
+		}
+	}
+	return schedule, nil
+}
+
+// releaseReconciled reports whether a release with the broker order number has
+// already been reconciled against one of the person's grants.
+func (s *Service) releaseReconciled(orderNumber string) (bool, error) {
+	if orderNumber == "" {
+		return false, nil
+	}
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM grant_releases r JOIN grants g ON g.id = r.grant_id
+		WHERE r.order_number = ? AND g.owner_id = ?`, orderNumber, s.owner).Scan(&count)
+	return count > 0, err
+}
+
+// reconcileRelease matches an imported release to the nearest unreleased
+// tranche of a grant for the same symbol and plan. A release that matches no
+// tranche is logged and left unreconciled; it is still a lot in the portfolio.
+func (s *Service) reconcileRelease(vest *models.Vest) error {
+	releases, err := s.getGrantReleases()
+	if err != nil {
+		return err
+	}
+	grants, err := s.GetGrants()
+	if err != nil {
+		return err
+	}
+	released, err := models.ParseDate(vest.Date)
+	if err != nil {
+		return err
+	}
+
+	var best *models.VestTranche
+	bestDistance := float64(ReleaseMatchDays) + 1
+	for _, g := range grants {
+		if g.Symbol != vest.Symbol || (g.Plan != "" && vest.Plan != "" && g.Plan != vest.Plan) {
+			continue
+		}
+		for _, t := range grantSchedule(g) {
+			if _, taken := releases[trancheKey(g.ID, t.Number)]; taken {
+				continue
+			}
+			scheduled, _ := models.ParseDate(t.Date)
+			distance := math.Abs(released.Sub(scheduled).Hours() / 24)
+			if distance < bestDistance {
+				tranche := t
+				best, bestDistance = &tranche, distance
+			}
+		}
+	}
+	if best == nil {
+		log.Printf("Release %s of %s on %s matches no scheduled tranche", vest.OrderNumber, vest.Symbol, vest.Date)
+		return nil
+	}
+
+	_, err = s.db.Exec("INSERT INTO grant_releases (grant_id, tranche, vest_id, order_number) VALUES (?, ?, ?, ?)",
+		best.GrantID, best.Number, vest.ID, vest.OrderNumber)
+	if err != nil {
+		return fmt.Errorf("failed to reconcile release: %w", err)
+	}
+	if math.Abs(best.ExpectedQty-vest.Quantity) > quantityEpsilon {
+		log.Printf("Release %s of %f units differs from the %f scheduled for %s", vest.OrderNumber, vest.Quantity, best.ExpectedQty, best.Date)
+	}
+	return nil
+}
+
+// getGrantReleases loads the releases reconciled against the person's grants,
+// keyed by grant and tranche.
+func (s *Service) getGrantReleases() (map[string]models.VestTranche, error) {
+	rows, err := s.db.Query(`
+		SELECT r.grant_id, r.tranche, r.vest_id, r.order_number, v.date, v.quantity
+		FROM grant_releases r
+		JOIN vests v ON v.id = r.vest_id
+		JOIN grants g ON g.id = r.grant_id
+		WHERE g.owner_id = ?`, s.owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	releases := map[string]models.VestTranche{}
+	for rows.Next() {
+		var t models.VestTranche
+		if err := rows.Scan(&t.GrantID, &t.Number, &t.VestID, &t.OrderNumber, &t.ReleaseDate, &t.ActualQty); err != nil {
+			return nil, err
+		}
+		releases[trancheKey(t.GrantID, t.Number)] = t
+	}
+	return releases, nil
+}
+
+// grantSchedule projects the tranches of a grant. Units are split into whole
+// units as evenly as possible, with earlier tranches taking any remainder;
+// tranches falling before the cliff are merged into a single tranche on the
+// cliff date.
+func grantSchedule(g models.Grant) []models.VestTranche {
+	start, err := models.ParseDate(g.VestStartDate)
+	if err != nil || g.Tranches <= 0 || g.CadenceMonths <= 0 {
+		return nil
+	}
+	cliff := addMonths(start, g.CliffMonths)
+
+	n := float64(g.Tranches)
+	per := math.Floor(g.TotalUnits / n)
+	extra := int(math.Floor(g.TotalUnits - per*n))
+	fraction := g.TotalUnits - per*n - float64(extra)
+
+	var tranches []models.VestTranche
+	for k := 1; k <= g.Tranches; k++ {
+		date := addMonths(start, k*g.CadenceMonths)
+		if date.Before(cliff) {
+			date = cliff
+		}
+		qty := per
+		if k <= extra {
+			qty++
+		}
+		if k == g.Tranches {
+			qty += fraction
+		}
+
+		day := date.Format("2006-01-02")
+		if last := len(tranches) - 1; last >= 0 && tranches[last].Date == day {
+			tranches[last].ExpectedQty += qty
+			continue
+		}
+		tranches = append(tranches, models.VestTranche{GrantID: g.ID, Number: len(tranches) + 1, Date: day, ExpectedQty: qty})
+	}
+	return tranches
+}
+
+// addMonths adds calendar months to a date, clamping to the last day of the
+// target month (e.g. 31 January plus one month is 28 or 29 February).
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, months, 0)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return time.Date(first.Year(), first.Month(), min(t.Day(), lastDay), 0, 0, 0, 0, time.UTC)
+}
+
+// trancheKey identifies a tranche of a grant.
+func trancheKey(grantID string, number int) string {
+	return fmt.Sprintf("%s/%d", grantID, number)
+}
@@ -0,0 +1,110 @@
+package portfolio
+
+import (
+	"strings"
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestGrantSchedule_Cliff(t *testing.T) {
+	g := models.Grant{ID: "g", TotalUnits: 100, VestStartDate: "2024-01-31", CadenceMonths: 3, Tranches: 16, CliffMonths: 12}
+	tranches := grantSchedule(g)
+
+	// The first four quarterly tranches (7 units each) vest together on the cliff.
+	if len(tranches) != 13 {
+		t.Fatalf("expected 13 tranches, got %d", len(tranches))
+	}
+	if tranches[0].Date != "2025-01-31" || tranches[0].ExpectedQty != 28 {
+		t.Errorf("unexpected cliff tranche: %+v", tranches[0])
+	}
+	// Month ends are clamped rather than rolling into the next month.
+	if tranches[1].Date != "2025-04-30" || tranches[1].ExpectedQty != 6 {
+		t.Errorf("unexpected second tranche: %+v", tranches[1])
+	}
+
+	var total float64
+	for _, tr := range tranches {
+		total += tr.ExpectedQty
+	}
+	if total != 100 {
+		t.Errorf("expected the schedule to cover all 100 units, got %f", total)
+	}
+}
+
+func TestImportVests_ReconcilesAgainstSchedule(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 0.9)
+
+	s := NewService(database)
+	grant, err := s.AddGrant(models.Grant{
+		GrantNumber: "C123", Symbol: "GOOG", Plan: "GSU Class C", GrantDate: "2025-08-01",
+		TotalUnits: 120, VestStartDate: "2025-08-25", CadenceMonths: 1, Tranches: 12,
+	})
+	if err != nil {
+		t.Fatalf("AddGrant failed: %v", err)
+	}
+
+	csvData := `Vest Date,Order Number,Plan,Type,Status,Price,Quantity,Net Cash Proceeds,Net Share Proceeds,Tax Payment Method
+26-Sep-2025,RB0001,GSU Class C,Release,Staged,$250.00,10,$0.00,5.2,Fractional Shares`
+	if err := s.ImportVests(strings.NewReader(csvData), "GOOG"); err != nil {
+		t.Fatalf("ImportVests failed: %v", err)
+	}
+
+	schedule, err := s.GetVestSchedule("2025-11-01")
+	if err != nil {
+		t.Fatalf("GetVestSchedule failed: %v", err)
+	}
+	if len(schedule) != 12 {
+		t.Fatalf("expected 12 tranches, got %d", len(schedule))
+	}
+	if schedule[0].Status != models.TrancheVested || schedule[0].OrderNumber != "RB0001" || schedule[0].ReleaseDate != "2025-09-26" {
+		t.Errorf("expected the release to fulfil the first tranche, got %+v", schedule[0])
+	}
+	if schedule[1].Status != models.TrancheOverdue || schedule[2].Status != models.TrancheUpcoming {
+		t.Errorf("unexpected statuses: %s, %s", schedule[1].Status, schedule[2].Status)
+	}
+
+	grants, _ := s.GetGrants()
+	if len(grants) != 1 || grants[0].ID != grant.ID || grants[0].VestedUnits != 10 || grants[0].UnvestedUnits() != 110 {
+		t.Errorf("unexpected grant totals: %+v", grants)
+	}
+
+	// Importing the same statement again adds no lot.
+	if err := s.ImportVests(strings.NewReader(csvData), "GOOG"); err != nil {
+		t.Fatalf("ImportVests failed: %v", err)
+	}
+	if inventory, _ := s.GetInventory(); len(inventory) != 1 {
+		t.Errorf("expected the re-imported release to be skipped, got %+v", inventory)
+	}
+	if grants, _ := s.GetGrants(); grants[0].VestedUnits != 10 {
+		t.Errorf("expected 10 vested units, got %+v", grants)
+	}
+
+	// A spouse's grants and releases are kept apart.
+	spouse, _ := s.AddPerson("Spouse")
+	spouseSvc := s.ForPerson(spouse.ID)
+	if grants, _ := spouseSvc.GetGrants(); len(grants) != 0 {
+		t.Errorf("expected the spouse to hold no grants, got %+v", grants)
+	}
+	if _, err := spouseSvc.AddGrant(models.Grant{
+		Symbol: "GOOG", Plan: "GSU Class C", GrantDate: "2025-08-01",
+		TotalUnits: 12, VestStartDate: "2025-08-25", CadenceMonths: 1, Tranches: 12,
+	}); err != nil {
+		t.Fatalf("AddGrant failed: %v", err)
+	}
+	// The spouse's release with the same order number is their own lot.
+	if err := spouseSvc.ImportVests(strings.NewReader(csvData), "GOOG"); err != nil {
+		t.Fatalf("ImportVests failed: %v", err)
+	}
+	spouseSchedule, _ := spouseSvc.GetVestSchedule("2025-11-01")
+	if len(spouseSchedule) != 12 || spouseSchedule[0].Status != models.TrancheVested {
+		t.Errorf("expected the spouse's release to fulfil their own grant, got %+v", spouseSchedule)
+	}
+	if grants, _ := s.GetGrants(); len(grants) != 1 || grants[0].ID != grant.ID {
+		t.Errorf("expected the spouse's grant to be left out, got %+v", grants)
+	}
+}
@@ -0,0 +1,171 @@
+package portfolio
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"irish-cgt-tracker/internal/models"
+)
+
+// PrimaryPersonName is the display name of the primary taxpayer, whose lots and
+// sales are recorded without an owner.
+const PrimaryPersonName = "Primary"
+
+// HouseholdMember is one person's CGT position within a household computation.
+type HouseholdMember struct {
+	Person  models.Person
+	Summary CGTSummary
+}
+
+// HouseholdSummary is the annual CGT computation for a jointly assessed
+// household. Each member has their own annual exemption, which cannot be
+// transferred; with ShareLosses set, a member's unused current-year losses are
+// set against the other members' gains. All amounts are in EUR cents.
+type HouseholdSummary struct {
+	Year        int
+	ShareLosses bool
+	Members     []HouseholdMember
+	// ChargeableCents and TaxCents are the totals across all members.
+	ChargeableCents int64
+	TaxCents        int64
+}
+
+// AddPerson adds a member to the household.
+//
+// Parameters:
+//   - name: The person's display name.
+//
+// Returns:
+//   - A pointer to the stored models.Person.
+//   - An error if the name is empty or the database insertion fails.
+func (s *Service) AddPerson(name string) (*models.Person, error) {
+	if name == "" {
+		return nil, fmt.Errorf("a person requires a name")
+	}
+	person := &models.Person{ID: uuid.New().String(), Name: name}
+	if _, err := s.db.Exec("INSERT INTO persons (id, name) VALUES (?, ?)", person.ID, person.Name); err != nil {
+		return nil, fmt.Errorf("failed to insert person: %w", err)
+	}
+	return person, nil
+}
+
+// GetPersons returns the members of the household, starting with the primary
+// taxpayer.
+func (s *Service) GetPersons() ([]models.Person, error) {
+	rows, err := s.db.Query("SELECT id, name FROM persons ORDER BY name ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	persons := []models.Person{{ID: "", Name: PrimaryPersonName}}
+	for rows.Next() {
+		var p models.Person
+		if err := rows.Scan(&p.ID, &p.Name); err != nil {
+			return nil, err
+		}
+		persons = append(persons, p)
+	}
+	return persons, nil
+}
+
+// GetHouseholdSummary computes the CGT position of every household member for
+// a tax year, each with their own exemption and losses carried forward.
+//
+// Parameters:
+//   - year: The tax year.
+//   - shareLosses: Whether a member's unused current-year losses are set
+//     against the other members' gains, as for jointly assessed spouses.
+//
+// Returns:
+//   - The HouseholdSummary, with one entry per member.
+//   - An error if the database query fails.
+func (s *Service) GetHouseholdSummary(year int, shareLosses bool) (HouseholdSummary, error) {
+	persons, err := s.GetPersons()
+	if err != nil {
+		return HouseholdSummary{}, err
+	}
+	disposals, flags, err := s.getChargeableDisposals()
+	if err != nil {
+		return HouseholdSummary{}, err
+	}
+	household := computeHouseholdSummary(year, persons, disposals, shareLosses)
+	for i := range household.Members {
+		member := &household.Members[i]
+		member.Summary.ResidenceFlags = flagsForYear(year, member.Person.ID, flags)
+	}
+	return household, nil
+}
+
+// computeHouseholdSummary walks forward from the earliest disposal, computing
+// each member's year separately and then applying any loss sharing, so that
+// the losses each member carries forward reflect what their spouse used.
+func computeHouseholdSummary(year int, persons []models.Person, disposals []cgtDisposal, shareLosses bool) HouseholdSummary {
+	byYear, firstYear := disposalsByYear(year, disposals)
+
+	lossesBF := make([]int64, len(persons))
+	summaries := make([]CGTSummary, len(persons))
+	for y := firstYear; y <= year; y++ {
+		for i, p := range persons {
+			var own []cgtDisposal
+			for _, d := range byYear[y] {
+				if d.OwnerID == p.ID {
+					own = append(own, d)
+				}
+			}
+			summaries[i] = summariseYear(y, own, lossesBF[i])
+		}
+		if shareLosses {
+			shareSpouseLosses(summaries)
+		}
+		for i := range summaries {
+			lossesBF[i] = summaries[i].LossesCarriedForwardCents
+		}
+	}
+
+	household := HouseholdSummary{Year: year, ShareLosses: shareLosses}
+	for i, p := range persons {
+		household.Members = append(household.Members, HouseholdMember{Person: p, Summary: summaries[i]})
+		household.ChargeableCents += summaries[i].ChargeableCents
+		household.TaxCents += summaries[i].TaxCents
+	}
+	return household
+}
+
+// shareSpouseLosses sets each member's unused current-year loss against the
+// other members' remaining gains. As with a person's own losses, the loss is
+// set off before the receiving member's annual exemption.
+func shareSpouseLosses(summaries []CGTSummary) {
+	for i := range summaries {
+		giver := &summaries[i]
+		available := max(giver.LossesCents-giver.GainsCents, 0)
+		for j := range summaries {
+			if i == j || available == 0 {
+				continue
+			}
+			used := applySpouseLoss(&summaries[j], available)
+			giver.LossesToSpouseCents += used
+			giver.LossesCarriedForwardCents -= used
+			available -= used
+		}
+	}
+}
+
+// applySpouseLoss reduces a summary's gains by a spouse's loss, recomputing
+// the exemption and tax, and returns the part of the loss used.
+func applySpouseLoss(summary *CGTSummary, lossCents int64) int64 {
+	remaining := summary.GainsCents - summary.LossesCents - summary.LossesUsedCents - summary.SpouseLossesCents
+	used := min(max(remaining, 0), lossCents)
+	if used == 0 {
+		return 0
+	}
+	summary.SpouseLossesCents += used
+
+	afterLosses := remaining - used
+	summary.ExemptionCents = min(afterLosses, AnnualExemptionCents)
+	summary.ChargeableCents = afterLosses - summary.ExemptionCents
+	summary.TaxCents = taxOn(summary.ChargeableCents)
+	summary.Initial.TaxCents = min(summary.Initial.TaxCents, summary.TaxCents)
+	summary.Later.TaxCents = summary.TaxCents - summary.Initial.TaxCents
+	return used
+}
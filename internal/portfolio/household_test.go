@@ -0,0 +1,88 @@
+package portfolio
+
+import (
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestComputeHouseholdSummary(t *testing.T) {
+	persons := []models.Person{{ID: "", Name: PrimaryPersonName}, {ID: "spouse", Name: "Spouse"}}
+	disposals := []cgtDisposal{
+		{SaleID: "a", Date: "2024-03-01", ProceedsCents: 900000, GainCents: 500000},
+		{SaleID: "b", OwnerID: "spouse", Date: "2024-04-01", ProceedsCents: 300000, GainCents: -200000},
+		{SaleID: "c", OwnerID: "spouse", Date: "2025-04-01", ProceedsCents: 300000, GainCents: 100000},
+	}
+
+	// Without sharing each spouse stands alone: 5000 - 1270 exemption.
+	separate := computeHouseholdSummary(2024, persons, disposals, false)
+	if separate.Members[0].Summary.ChargeableCents != 373000 || separate.Members[1].Summary.LossesCarriedForwardCents != 200000 {
+		t.Errorf("unexpected separate computation: %+v", separate.Members)
+	}
+
+	// With sharing the spouse's loss is set against the primary's gain before
+	// the primary's own exemption: 5000 - 2000 - 1270 = 1730 chargeable.
+	shared := computeHouseholdSummary(2024, persons, disposals, true)
+	primary, spouse := shared.Members[0].Summary, shared.Members[1].Summary
+	if primary.SpouseLossesCents != 200000 || primary.ChargeableCents != 173000 || shared.TaxCents != 57090 {
+		t.Errorf("unexpected shared computation: %+v", primary)
+	}
+	if spouse.LossesToSpouseCents != 200000 || spouse.LossesCarriedForwardCents != 0 {
+		t.Errorf("expected the spouse's loss to be used in full, got %+v", spouse)
+	}
+
+	// A loss used by the other spouse is not carried forward as well.
+	next := computeHouseholdSummary(2025, persons, disposals, true)
+	if got := next.Members[1].Summary; got.LossesUsedCents != 0 || got.ExemptionCents != 100000 {
+		t.Errorf("unexpected 2025 spouse computation: %+v", got)
+	}
+}
+
+func TestForPerson_SeparateFIFOPools(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	spouse, err := s.AddPerson("Spouse")
+	if err != nil {
+		t.Fatalf("AddPerson failed: %v", err)
+	}
+
+	if _, err := s.AddVest("2020-01-10", "ACME", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	spouseSvc := s.ForPerson(spouse.ID)
+	if _, err := spouseSvc.AddVest("2021-01-10", "ACME", 10, 5000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	sale, err := spouseSvc.AddSale("2024-03-01", "ACME", 10, 8000)
+	if err != nil {
+		t.Fatalf("AddSale failed: %v", err)
+	}
+	if err := s.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+
+	// The spouse's sale is matched against the spouse's lot, not the older one.
+	settled, _ := s.GetSettledSales()
+	if len(settled) != 1 || settled[0].EuroGainEUR != 30000 {
+		t.Fatalf("unexpected settlement: %+v", settled)
+	}
+
+	primarySummary, _ := s.GetCGTSummary(2024)
+	spouseSummary, _ := spouseSvc.GetCGTSummary(2024)
+	if primarySummary.Disposals != 0 || spouseSummary.GainsCents != 30000 {
+		t.Errorf("expected the gain on the spouse's summary only, got %+v / %+v", primarySummary, spouseSummary)
+	}
+
+	household, err := s.GetHouseholdSummary(2024, true)
+	if err != nil {
+		t.Fatalf("GetHouseholdSummary failed: %v", err)
+	}
+	if len(household.Members) != 2 || household.Members[1].Person.Name != "Spouse" {
+		t.Errorf("unexpected household members: %+v", household.Members)
+	}
+}
@@ -0,0 +1,129 @@
+package portfolio
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"irish-cgt-tracker/internal/models"
+)
+
+// NegligibleValueType is the settled sale type recorded for a negligible value claim.
+const NegligibleValueType = "NEGLIGIBLE VALUE"
+
+// ClaimNegligibleValue records a negligible value claim on one of the current
+// person's open lots: a deemed disposal and reacquisition of the remaining
+// shares at the claimed value, which crystallises the loss without a sale. The
+// deemed disposal is settled against the chosen lot rather than FIFO, and
+// flows into the annual CGT computation and loss ledger like any other
+// disposal. The shares reacquired form a successor lot acquired on the claim
+// date at the claimed value. The claimed lot therefore leaves GetInventory but
+// the shares do not: TCA 1997 s.538(2) deems them sold and immediately
+// reacquired, and they are still held. Everything is recorded in a single
+// transaction.
+//
+// Parameters:
+//   - vestID: The lot that has become of negligible value.
+//   - date: The date of the claim in "YYYY-MM-DD" format.
+//   - valueCents: The claimed value per share, in USD cents (EUR cents for crypto-assets).
+//
+// Returns:
+//   - A pointer to the models.Sale recording the deemed disposal.
+//   - An error if the lot is not open, the claim predates the acquisition,
+//     the exchange rate cannot be fetched or the database update fails.
+func (s *Service) ClaimNegligibleValue(vestID, date string, valueCents int64) (*models.Sale, error) {
+	if _, err := models.ParseDate(date); err != nil {
+		return nil, fmt.Errorf("invalid claim date: %w", err)
+	}
+	if valueCents < 0 {
+		return nil, fmt.Errorf("the claimed value cannot be negative")
+	}
+
+	inventory, err := s.getInventoryForOwner(s.owner, "")
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve inventory: %w", err)
+	}
+	var lot *InventoryItem
+	for i := range inventory {
+		if inventory[i].ID == vestID {
+			lot = &inventory[i]
+			break
+		}
+	}
+	if lot == nil {
+		return nil, fmt.Errorf("lot %s has no remaining shares", vestID)
+	}
+	if date < lot.Date {
+		return nil, fmt.Errorf("the claim date %s is before the lot was acquired on %s", date, lot.Date)
+	}
+	if lot.AssetClass == models.AssetClassETF {
+		return nil, fmt.Errorf("ETF losses get no relief under the exit tax regime")
+	}
+
+	price, rate := valueCents*models.CryptoPriceScale, models.CryptoRate
+	if lot.AssetClass != models.AssetClassCrypto {
+		price = valueCents
+		rate, err = s.transactionRate("negligible value claim on "+lot.Symbol, date)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch exchange rate for %s: %w", date, err)
+		}
+	}
+
+	sale := &models.Sale{
+		ID:         uuid.New().String(),
+		Date:       date,
+		Symbol:     lot.Symbol,
+		Quantity:   lot.RemainingQty,
+		PriceCents: price,
+		ECBRate:    rate,
+		IsSettled:  true,
+		OwnerID:    lot.OwnerID,
+	}
+	successor := &models.Vest{
+		ID:               uuid.New().String(),
+		Date:             date,
+		Symbol:           lot.Symbol,
+		Quantity:         lot.RemainingQty,
+		StrikePriceCents: price,
+		ECBRate:          rate,
+		Source:           models.SourceNegligibleValue,
+		ParentID:         lot.ID,
+		OwnerID:          lot.OwnerID,
+	}
+	ss := computeSettledSale(sale, &lot.Vest, lot.RemainingQty)
+	ss.Type = NegligibleValueType
+	err = s.inTx(func(tx *Service) error {
+		if err := tx.insertSale(sale); err != nil {
+			return err
+		}
+		if err := tx.saveLot(sale.ID, lot.ID, lot.RemainingQty); err != nil {
+			return fmt.Errorf("failed to save sale lot: %w", err)
+		}
+		if err := tx.insertSettledSale(ss); err != nil {
+			return fmt.Errorf("failed to store deemed disposal: %w", err)
+		}
+		return tx.insertVest(successor)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Negligible value claim recorded: %f %s on %s, loss %d EUR cents", lot.RemainingQty, lot.Symbol, date, ss.EuroGainEUR)
+	return sale, nil
+}
+
+// GetNegligibleValueClaims retrieves the deemed disposals recorded by the
+// current person's negligible value claims, newest first.
+func (s *Service) GetNegligibleValueClaims() ([]models.SettledSale, error) {
+	settled, err := s.GetSettledSales()
+	if err != nil {
+		return nil, err
+	}
+	var claims []models.SettledSale
+	for _, ss := range settled {
+		if ss.Type == NegligibleValueType && ss.OwnerID == s.owner {
+			claims = append(claims, ss)
+		}
+	}
+	return claims, nil
+}
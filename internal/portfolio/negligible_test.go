@@ -0,0 +1,76 @@
+package portfolio
+
+import (
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+)
+
+func TestClaimNegligibleValue(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	older, err := s.AddVest("2019-01-10", "DEAD", 100, 2000)
+	if err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	claimed, err := s.AddVest("2020-01-10", "DEAD", 50, 4000)
+	if err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+
+	if _, err := s.ClaimNegligibleValue(claimed.ID, "2019-06-01", 1); err == nil {
+		t.Error("expected an error for a claim before the lot was acquired")
+	}
+
+	// The claim applies to the chosen lot, not the oldest one.
+	if _, err := s.ClaimNegligibleValue(claimed.ID, "2024-03-01", 1); err != nil {
+		t.Fatalf("ClaimNegligibleValue failed: %v", err)
+	}
+	// The claimed lot leaves the inventory, but the shares are still held: they
+	// are deemed reacquired at the claimed value on the claim date (s.538(2)).
+	inventory, _ := s.GetInventory()
+	if len(inventory) != 2 || inventory[0].ID != older.ID {
+		t.Fatalf("expected the unclaimed lot and a successor lot, got %+v", inventory)
+	}
+	if successor := inventory[1]; successor.Date != "2024-03-01" || successor.RemainingQty != 50 || successor.StrikePriceCents != 1 {
+		t.Errorf("unexpected successor lot: %+v", successor)
+	}
+
+	claims, err := s.GetNegligibleValueClaims()
+	if err != nil || len(claims) != 1 {
+		t.Fatalf("expected 1 claim, got %d (%v)", len(claims), err)
+	}
+	if claims[0].VestID != claimed.ID || claims[0].EuroGainEUR != -199950 {
+		t.Errorf("unexpected deemed disposal: %+v", claims[0])
+	}
+
+	// The loss is carried forward by the annual computation.
+	summary, _ := s.GetCGTSummary(2024)
+	if summary.LossesCents != 199950 || summary.LossesCarriedForwardCents != 199950 {
+		t.Errorf("expected the loss in the 2024 computation, got %+v", summary)
+	}
+
+	if _, err := s.ClaimNegligibleValue(claimed.ID, "2024-03-01", 1); err == nil {
+		t.Error("expected an error for a lot with no remaining shares")
+	}
+
+	// A claim is made by the lot's owner, and each person sees their own claims.
+	spouse, _ := s.AddPerson("Alex")
+	theirs, _ := s.ForPerson(spouse.ID).AddVest("2021-01-10", "DEAD", 10, 3000)
+	if _, err := s.ClaimNegligibleValue(theirs.ID, "2024-03-01", 0); err == nil {
+		t.Error("expected an error for a claim on another person's lot")
+	}
+	if _, err := s.ForPerson(spouse.ID).ClaimNegligibleValue(theirs.ID, "2024-03-01", 0); err != nil {
+		t.Fatalf("ClaimNegligibleValue failed: %v", err)
+	}
+	if claims, _ := s.GetNegligibleValueClaims(); len(claims) != 1 {
+		t.Errorf("expected the spouse's claim to be listed separately, got %+v", claims)
+	}
+	if claims, _ := s.ForPerson(spouse.ID).GetNegligibleValueClaims(); len(claims) != 1 || claims[0].VestID != theirs.ID {
+		t.Errorf("unexpected claims for the spouse: %+v", claims)
+	}
+}
@@ -0,0 +1,212 @@
+package portfolio
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/google/uuid"
+	"irish-cgt-tracker/internal/models"
+)
+
+// RTSORates holds the rates used to compute Relevant Tax on Share Options.
+type RTSORates struct {
+	IncomeTax float64
+	USC       float64
+	PRSI      float64
+}
+
+// RTSOPaymentDays is the number of days after exercise within which the RTSO1
+// payment must be made.
+const RTSOPaymentDays = 30
+
+// RTSORatesFor returns the RTSO rates applicable on the given exercise date.
+// Income tax is charged at the higher rate unless Revenue has agreed that the
+// standard rate applies, in which case standardRate should be true. USC is
+// charged at 8%, and PRSI at the Class A1 employee rate in force on the date.
+func RTSORatesFor(date string, standardRate bool) RTSORates {
+	rates := RTSORates{IncomeTax: 0.40, USC: 0.08, PRSI: 0.04}
+	if standardRate {
+		rates.IncomeTax = 0.20
+	}
+	switch {
+	case date >= "2025-10-01":
+		rates.PRSI = 0.042
+	case date >= "2024-10-01":
+		rates.PRSI = 0.041
+	}
+	return rates
+}
+
+// AddOptionGrant records a grant of unapproved share options.
+//
+// Parameters:
+//   - grant: The grant details. ID is populated by this method.
+//
+// Returns:
+//   - A pointer to the stored models.OptionGrant.
+//   - An error if the grant is invalid or the database insertion fails.
+func (s *Service) AddOptionGrant(grant models.OptionGrant) (*models.OptionGrant, error) {
+	if _, err := models.ParseDate(grant.GrantDate); err != nil {
+		return nil, fmt.Errorf("invalid grant date: %w", err)
+	}
+	if grant.Symbol == "" || grant.Quantity <= 0 {
+		return nil, fmt.Errorf("an option grant requires a symbol and a positive quantity")
+	}
+
+	grant.ID = uuid.New().String()
+	query := `INSERT INTO option_grants (id, symbol, grant_date, quantity, exercise_price_cents) VALUES (?, ?, ?, ?, ?)`
+	if _, err := s.db.Exec(query, grant.ID, grant.Symbol, grant.GrantDate, grant.Quantity, grant.ExercisePriceCents); err != nil {
+		return nil, fmt.Errorf("failed to insert option grant: %w", err)
+	}
+	return &grant, nil
+}
+
+// GetOptionGrants retrieves all option grants with the quantity exercised so far.
+func (s *Service) GetOptionGrants() ([]models.OptionGrant, error) {
+	rows, err := s.db.Query(`
+		SELECT g.id, g.symbol, g.grant_date, g.quantity, g.exercise_price_cents,
+		       COALESCE(SUM(e.quantity), 0) as exercised_qty
+		FROM option_grants g
+		LEFT JOIN option_exercises e ON e.grant_id = g.id
+		GROUP BY g.id
+		ORDER BY g.grant_date ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var grants []models.OptionGrant
+	for rows.Next() {
+		var g models.OptionGrant
+		if err := rows.Scan(&g.ID, &g.Symbol, &g.GrantDate, &g.Quantity, &g.ExercisePriceCents, &g.ExercisedQty); err != nil {
+			return nil, err
+		}
+		grants = append(grants, g)
+	}
+	return grants, nil
+}
+
+// ExerciseOptions records the exercise of options under a grant.
+//
+// The spread (market value less exercise price) is converted to EUR at the ECB
+// rate on the exercise date and taxed under RTSO using the given rates. The
+// shares acquired form a new lot in the FIFO pool with a base cost equal to the
+// exercise price plus the amount taxed: the market value on exercise, or the
+// exercise price for options exercised underwater. The lot and the exercise are
+// recorded in a single transaction.
+//
+// Parameters:
+//   - grantID: The grant being exercised.
+//   - date: The exercise date in "YYYY-MM-DD" format.
+//   - qty: The number of options exercised.
+//   - marketPriceCents: The market value per share in USD cents on the exercise date.
+//   - rates: The RTSO rates to apply, typically from RTSORatesFor.
+//
+// Returns:
+//   - A pointer to the stored models.OptionExercise, including the RTSO breakdown.
+//   - An error if the grant cannot be found, too many options are exercised,
+//     the exchange rate cannot be fetched or the database insertion fails.
+func (s *Service) ExerciseOptions(grantID, date string, qty float64, marketPriceCents int64, rates RTSORates) (*models.OptionExercise, error) {
+	grant, err := s.getOptionGrant(grantID)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve option grant %s: %w", grantID, err)
+	}
+	if qty <= 0 || qty > grant.Quantity-grant.ExercisedQty+quantityEpsilon {
+		return nil, fmt.Errorf("cannot exercise %f options: %f remain unexercised", qty, grant.Quantity-grant.ExercisedQty)
+	}
+	exerciseDate, err := models.ParseDate(date)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exercise date: %w", err)
+	}
+
+	rate, err := s.transactionRate("option exercise", date)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch exchange rate for %s: %w", date, err)
+	}
+
+	spreadPerShare := math.Max(float64(marketPriceCents-grant.ExercisePriceCents), 0)
+	spreadEUR := spreadPerShare * qty * rate
+
+	vest := &models.Vest{
+		ID:               uuid.New().String(),
+		Date:             date,
+		Symbol:           grant.Symbol,
+		Quantity:         qty,
+		StrikePriceCents: grant.ExercisePriceCents + int64(spreadPerShare),
+		ECBRate:          rate,
+		Source:           models.SourceOptionExercise,
+	}
+
+	exercise := &models.OptionExercise{
+		ID:               uuid.New().String(),
+		GrantID:          grant.ID,
+		VestID:           vest.ID,
+		Date:             date,
+		Quantity:         qty,
+		MarketPriceCents: marketPriceCents,
+		ECBRate:          rate,
+		SpreadEURCents:   int64(math.Round(spreadEUR)),
+		IncomeTaxCents:   int64(math.Round(spreadEUR * rates.IncomeTax)),
+		USCCents:         int64(math.Round(spreadEUR * rates.USC)),
+		PRSICents:        int64(math.Round(spreadEUR * rates.PRSI)),
+		RTSODueDate:      exerciseDate.AddDate(0, 0, RTSOPaymentDays).Format("2006-01-02"),
+	}
+
+	err = s.inTx(func(tx *Service) error {
+		if err := tx.insertVest(vest); err != nil {
+			return err
+		}
+		query := `INSERT INTO option_exercises (id, grant_id, vest_id, date, quantity, market_price_cents, ecb_rate,
+			spread_eur_cents, income_tax_cents, usc_cents, prsi_cents, rtso_due_date) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		_, err := tx.db.Exec(query, exercise.ID, exercise.GrantID, exercise.VestID, exercise.Date, exercise.Quantity,
+			exercise.MarketPriceCents, exercise.ECBRate, exercise.SpreadEURCents, exercise.IncomeTaxCents,
+			exercise.USCCents, exercise.PRSICents, exercise.RTSODueDate)
+		if err != nil {
+			return fmt.Errorf("failed to insert option exercise: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Options exercised: %f of %s on %s, RTSO due %s", qty, grant.Symbol, date, exercise.RTSODueDate)
+	return exercise, nil
+}
+
+// GetOptionExercises retrieves all option exercises, newest first.
+func (s *Service) GetOptionExercises() ([]models.OptionExercise, error) {
+	rows, err := s.db.Query(`
+		SELECT id, grant_id, vest_id, date, quantity, market_price_cents, ecb_rate,
+		       spread_eur_cents, income_tax_cents, usc_cents, prsi_cents, rtso_due_date
+		FROM option_exercises ORDER BY date DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exercises []models.OptionExercise
+	for rows.Next() {
+		var e models.OptionExercise
+		if err := rows.Scan(&e.ID, &e.GrantID, &e.VestID, &e.Date, &e.Quantity, &e.MarketPriceCents, &e.ECBRate,
+			&e.SpreadEURCents, &e.IncomeTaxCents, &e.USCCents, &e.PRSICents, &e.RTSODueDate); err != nil {
+			return nil, err
+		}
+		exercises = append(exercises, e)
+	}
+	return exercises, nil
+}
+
+// getOptionGrant retrieves a single grant, including the quantity already exercised.
+func (s *Service) getOptionGrant(id string) (*models.OptionGrant, error) {
+	var g models.OptionGrant
+	row := s.db.QueryRow(`
+		SELECT g.id, g.symbol, g.grant_date, g.quantity, g.exercise_price_cents,
+		       COALESCE((SELECT SUM(e.quantity) FROM option_exercises e WHERE e.grant_id = g.id), 0)
+		FROM option_grants g WHERE g.id = ?`, id)
+	if err := row.Scan(&g.ID, &g.Symbol, &g.GrantDate, &g.Quantity, &g.ExercisePriceCents, &g.ExercisedQty); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
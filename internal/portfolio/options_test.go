@@ -0,0 +1,71 @@
+package portfolio
+
+import (
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestRTSORatesFor(t *testing.T) {
+	if got := RTSORatesFor("2024-06-01", false); got.IncomeTax != 0.40 || got.USC != 0.08 || got.PRSI != 0.04 {
+		t.Errorf("unexpected rates before October 2024: %+v", got)
+	}
+	if got := RTSORatesFor("2025-01-10", true); got.IncomeTax != 0.20 || got.PRSI != 0.041 {
+		t.Errorf("unexpected standard-rate rates for 2025: %+v", got)
+	}
+}
+
+func TestExerciseOptions(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 0.5)
+
+	s := NewService(database)
+	grant, err := s.AddOptionGrant(models.OptionGrant{Symbol: "ACME", GrantDate: "2020-01-01", Quantity: 100, ExercisePriceCents: 1000})
+	if err != nil {
+		t.Fatalf("AddOptionGrant failed: %v", err)
+	}
+
+	rates := RTSORates{IncomeTax: 0.40, USC: 0.08, PRSI: 0.04}
+	ex, err := s.ExerciseOptions(grant.ID, "2024-03-01", 60, 3000, rates)
+	if err != nil {
+		t.Fatalf("ExerciseOptions failed: %v", err)
+	}
+
+	// Spread: 60 x $20 = $1,200 = EUR 600.
+	if ex.SpreadEURCents != 60000 {
+		t.Errorf("expected spread of 60000 cents, got %d", ex.SpreadEURCents)
+	}
+	if ex.RTSOTotalCents() != 31200 {
+		t.Errorf("expected RTSO of 31200 cents, got %d", ex.RTSOTotalCents())
+	}
+	if ex.RTSODueDate != "2024-03-31" {
+		t.Errorf("expected RTSO due 2024-03-31, got %s", ex.RTSODueDate)
+	}
+
+	// The lot's base cost is exercise price plus the amount taxed: the market value.
+	inventory, _ := s.GetInventory()
+	if len(inventory) != 1 || inventory[0].StrikePriceCents != 3000 || inventory[0].Quantity != 60 {
+		t.Errorf("unexpected lot created by exercise: %+v", inventory)
+	}
+
+	if _, err := s.ExerciseOptions(grant.ID, "2024-04-01", 50, 3000, rates); err == nil {
+		t.Error("expected an error when exercising more options than remain")
+	}
+
+	// Underwater options have no spread to tax, so the base cost is the
+	// exercise price paid rather than the lower market value.
+	under, err := s.ExerciseOptions(grant.ID, "2024-05-01", 40, 800, rates)
+	if err != nil {
+		t.Fatalf("ExerciseOptions failed: %v", err)
+	}
+	if under.SpreadEURCents != 0 || under.RTSOTotalCents() != 0 {
+		t.Errorf("expected no RTSO on an underwater exercise, got %+v", under)
+	}
+	inventory, _ = s.GetInventory()
+	if len(inventory) != 2 || inventory[1].StrikePriceCents != 1000 {
+		t.Errorf("expected an underwater lot at the exercise price, got %+v", inventory)
+	}
+}
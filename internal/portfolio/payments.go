@@ -0,0 +1,192 @@
+package portfolio
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"irish-cgt-tracker/internal/models"
+)
+
+// LateInterestDailyRate is the statutory interest charged on CGT paid late:
+// 0.0219% for each day or part of a day (TCA 1997 s.1080).
+const LateInterestDailyRate = 0.000219
+
+// Payment statuses reported by PaymentReconciliation.Status.
+const (
+	PaymentStatusPaid        = "Paid"
+	PaymentStatusPaidLate    = "Paid late"
+	PaymentStatusOutstanding = "Outstanding"
+	PaymentStatusOverdue     = "Overdue"
+	PaymentStatusOverpaid    = "Overpaid"
+	PaymentStatusNone        = "Nothing due"
+)
+
+// PaymentReconciliation compares the payments made for one payment period
+// with the computed liability. All amounts are in EUR cents.
+type PaymentReconciliation struct {
+	// Period is the computed liability and due date; Key is its
+	// models.PaymentPeriodInitial or models.PaymentPeriodLater identifier.
+	Period   PeriodSummary
+	Key      string
+	Payments []models.CGTPayment
+	AsOf     string
+
+	PaidCents int64
+	// BalanceCents is the amount outstanding, or negative if overpaid.
+	BalanceCents int64
+	// LateCents is the part of the liability paid, or still unpaid, after the due date.
+	LateCents int64
+	// InterestCents estimates the statutory interest on late payment up to the
+	// reconciliation date.
+	InterestCents int64
+}
+
+// Status summarises the period's position.
+func (r PaymentReconciliation) Status() string {
+	switch {
+	case r.BalanceCents < 0:
+		return PaymentStatusOverpaid
+	case r.BalanceCents > 0 && r.AsOf > r.Period.DueDate:
+		return PaymentStatusOverdue
+	case r.BalanceCents > 0:
+		return PaymentStatusOutstanding
+	case r.LateCents > 0:
+		return PaymentStatusPaidLate
+	case r.Period.TaxCents == 0:
+		return PaymentStatusNone
+	}
+	return PaymentStatusPaid
+}
+
+// AddCGTPayment records a payment of CGT made to Revenue by the Service's person.
+//
+// Parameters:
+//   - p: The payment. ID and OwnerID are populated by this method.
+//
+// Returns:
+//   - A pointer to the stored models.CGTPayment.
+//   - An error if the payment is invalid or the database insertion fails.
+func (s *Service) AddCGTPayment(p models.CGTPayment) (*models.CGTPayment, error) {
+	if _, err := models.ParseDate(p.Date); err != nil {
+		return nil, fmt.Errorf("invalid payment date: %w", err)
+	}
+	if p.AmountCents <= 0 {
+		return nil, fmt.Errorf("a payment must be a positive amount")
+	}
+	if p.Year < 1900 {
+		return nil, fmt.Errorf("a payment requires the tax year it is for")
+	}
+	if p.Period != models.PaymentPeriodInitial && p.Period != models.PaymentPeriodLater {
+		return nil, fmt.Errorf("unknown payment period %q", p.Period)
+	}
+	p.ID = uuid.New().String()
+	p.OwnerID = s.owner
+	p.Reference = strings.TrimSpace(p.Reference)
+
+	query := `INSERT INTO cgt_payments (id, owner_id, date, amount_cents, year, period, reference) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	if _, err := s.db.Exec(query, p.ID, p.OwnerID, p.Date, p.AmountCents, p.Year, p.Period, p.Reference); err != nil {
+		return nil, fmt.Errorf("failed to insert payment: %w", err)
+	}
+	return &p, nil
+}
+
+// GetCGTPayments retrieves the Service's person's payments for a tax year,
+// oldest first.
+func (s *Service) GetCGTPayments(year int) ([]models.CGTPayment, error) {
+	rows, err := s.db.Query(`
+		SELECT id, owner_id, date, amount_cents, year, period, reference
+		FROM cgt_payments WHERE owner_id = ? AND year = ? ORDER BY date ASC`, s.owner, year)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []models.CGTPayment
+	for rows.Next() {
+		var p models.CGTPayment
+		if err := rows.Scan(&p.ID, &p.OwnerID, &p.Date, &p.AmountCents, &p.Year, &p.Period, &p.Reference); err != nil {
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+	return payments, nil
+}
+
+// ReconcileCGTPayments reconciles the Service's person's payments for a tax
+// year against the CGT computed for each payment period.
+//
+// Payments are applied to the period's liability in date order. Interest is
+// estimated at LateInterestDailyRate on each amount for every day it was paid
+// after the due date, and on any balance still unpaid for every day from the
+// due date to asOf.
+//
+// Parameters:
+//   - year: The tax year.
+//   - asOf: The date to reconcile to in "YYYY-MM-DD" format, typically today.
+//
+// Returns:
+//   - The reconciliations for the initial and later periods.
+//   - An error if the date is invalid or a database query fails.
+func (s *Service) ReconcileCGTPayments(year int, asOf string) ([]PaymentReconciliation, error) {
+	if _, err := models.ParseDate(asOf); err != nil {
+		return nil, fmt.Errorf("invalid reconciliation date: %w", err)
+	}
+	summary, err := s.GetCGTSummary(year)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := s.GetCGTPayments(year)
+	if err != nil {
+		return nil, err
+	}
+
+	reconciliations := []PaymentReconciliation{
+		{Period: summary.Initial, Key: models.PaymentPeriodInitial, AsOf: asOf},
+		{Period: summary.Later, Key: models.PaymentPeriodLater, AsOf: asOf},
+	}
+	for i := range reconciliations {
+		r := &reconciliations[i]
+		for _, p := range payments {
+			if p.Period == r.Key {
+				r.Payments = append(r.Payments, p)
+			}
+		}
+		sort.SliceStable(r.Payments, func(a, b int) bool { return r.Payments[a].Date < r.Payments[b].Date })
+
+		var interest float64
+		remaining := r.Period.TaxCents
+		for _, p := range r.Payments {
+			r.PaidCents += p.AmountCents
+			applied := min(p.AmountCents, max(remaining, 0))
+			remaining -= applied
+			if days := daysLate(r.Period.DueDate, p.Date); days > 0 {
+				r.LateCents += applied
+				interest += float64(applied) * LateInterestDailyRate * float64(days)
+			}
+		}
+		if days := daysLate(r.Period.DueDate, asOf); remaining > 0 && days > 0 {
+			r.LateCents += remaining
+			interest += float64(remaining) * LateInterestDailyRate * float64(days)
+		}
+		r.BalanceCents = r.Period.TaxCents - r.PaidCents
+		r.InterestCents = int64(math.Round(interest))
+	}
+	return reconciliations, nil
+}
+
+// daysLate returns the number of days from the due date to the date, or zero
+// if the date is not after it.
+func daysLate(dueDate, date string) int {
+	due, err := models.ParseDate(dueDate)
+	if err != nil {
+		return 0
+	}
+	d, err := models.ParseDate(date)
+	if err != nil || !d.After(due) {
+		return 0
+	}
+	return int(d.Sub(due).Hours() / 24)
+}
@@ -0,0 +1,66 @@
+package portfolio
+
+import (
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestReconcileCGTPayments(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	if _, err := s.AddVest("2020-01-10", "ACME", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	sale, _ := s.AddSale("2024-03-01", "ACME", 10, 40000)
+	if err := s.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+
+	// 570.90 is due for the initial period by 15 December; nothing is paid yet.
+	recs, err := s.ReconcileCGTPayments(2024, "2025-01-14")
+	if err != nil {
+		t.Fatalf("ReconcileCGTPayments failed: %v", err)
+	}
+	initial := recs[0]
+	if initial.Period.TaxCents != 57090 || initial.BalanceCents != 57090 || initial.Status() != PaymentStatusOverdue {
+		t.Errorf("unexpected unpaid period: %+v", initial)
+	}
+	// 30 days at 0.0219% a day on 570.90.
+	if initial.InterestCents != 375 {
+		t.Errorf("expected 3.75 interest, got %d", initial.InterestCents)
+	}
+
+	if _, err := s.AddCGTPayment(models.CGTPayment{Date: "2024-12-10", AmountCents: 50000, Year: 2024, Period: "ANNUAL"}); err == nil {
+		t.Error("expected an unknown period to be refused")
+	}
+	payments := []models.CGTPayment{
+		{Date: "2024-12-10", AmountCents: 50000, Year: 2024, Period: models.PaymentPeriodInitial, Reference: "ROS-1"},
+		{Date: "2025-01-14", AmountCents: 7090, Year: 2024, Period: models.PaymentPeriodInitial},
+		{Date: "2025-01-20", AmountCents: 10000, Year: 2024, Period: models.PaymentPeriodLater},
+	}
+	for _, p := range payments {
+		if _, err := s.AddCGTPayment(p); err != nil {
+			t.Fatalf("AddCGTPayment failed: %v", err)
+		}
+	}
+
+	recs, err = s.ReconcileCGTPayments(2024, "2025-03-01")
+	if err != nil {
+		t.Fatalf("ReconcileCGTPayments failed: %v", err)
+	}
+	initial, later := recs[0], recs[1]
+	// Only the 70.90 paid 30 days late attracts interest.
+	if initial.PaidCents != 57090 || initial.BalanceCents != 0 || initial.LateCents != 7090 || initial.InterestCents != 47 ||
+		initial.Status() != PaymentStatusPaidLate || len(initial.Payments) != 2 {
+		t.Errorf("unexpected initial period: %+v", initial)
+	}
+	if later.BalanceCents != -10000 || later.InterestCents != 0 || later.Status() != PaymentStatusOverpaid {
+		t.Errorf("unexpected later period: %+v", later)
+	}
+}
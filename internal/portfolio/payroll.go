@@ -0,0 +1,98 @@
+package portfolio
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+
+	"irish-cgt-tracker/internal/models"
+)
+
+// PayrollTolerance is the relative difference between the payroll taxable
+// amount and the tracker's cost basis above which a vest is flagged.
+// Differences under one euro are always ignored to absorb rounding.
+const PayrollTolerance = 0.005
+
+// VestReconciliation compares the EUR value payroll taxed for a vest with the
+// cost basis the tracker derives from quantity x price x ECB rate.
+type VestReconciliation struct {
+	models.Vest
+	// Payroll is nil when no payslip figures have been entered for the vest.
+	Payroll *models.VestPayroll
+	// ExpectedEURCents is quantity x price x ECB rate.
+	ExpectedEURCents int64
+	// DifferenceCents is payroll taxable amount less the expected amount.
+	DifferenceCents int64
+	// ImpliedRate is the EUR/USD rate payroll must have used at the recorded price.
+	ImpliedRate float64
+	// ImpliedPriceCents is the USD price payroll must have used at the ECB rate.
+	ImpliedPriceCents int64
+	// Flagged is true when the difference exceeds PayrollTolerance.
+	Flagged bool
+}
+
+// SetVestPayroll stores (or replaces) the payslip figures for a vest.
+func (s *Service) SetVestPayroll(p models.VestPayroll) error {
+	if p.TaxableEURCents <= 0 {
+		return fmt.Errorf("payroll taxable amount must be positive")
+	}
+	query := `INSERT OR REPLACE INTO vest_payroll (vest_id, taxable_eur_cents, paye_cents, usc_cents, prsi_cents) VALUES (?, ?, ?, ?, ?)`
+	if _, err := s.db.Exec(query, p.VestID, p.TaxableEURCents, p.PAYECents, p.USCCents, p.PRSICents); err != nil {
+		return fmt.Errorf("failed to store payroll for vest %s: %w", p.VestID, err)
+	}
+	return nil
+}
+
+// GetPayrollReconciliation builds the reconciliation report for every RSU vest,
+// oldest first. Vests without payroll figures are included but never flagged.
+func (s *Service) GetPayrollReconciliation() ([]VestReconciliation, error) {
+	rows, err := s.db.Query(`
+		SELECT v.id, v.date, v.symbol, v.quantity, v.strike_price_cents, v.ecb_rate,
+		       p.taxable_eur_cents, p.paye_cents, p.usc_cents, p.prsi_cents
+		FROM vests v
+		LEFT JOIN vest_payroll p ON p.vest_id = v.id
+		WHERE v.source = ?
+		ORDER BY v.date ASC`, models.SourceRSU)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var report []VestReconciliation
+	for rows.Next() {
+		var rec VestReconciliation
+		var taxable, paye, usc, prsi sql.NullInt64
+		if err := rows.Scan(&rec.ID, &rec.Date, &rec.Symbol, &rec.Quantity, &rec.StrikePriceCents, &rec.ECBRate,
+			&taxable, &paye, &usc, &prsi); err != nil {
+			return nil, err
+		}
+		rec.Source = models.SourceRSU
+
+		expected := rec.Quantity * float64(rec.StrikePriceCents) * rec.ECBRate
+		rec.ExpectedEURCents = int64(math.Round(expected))
+
+		if taxable.Valid {
+			rec.Payroll = &models.VestPayroll{
+				VestID:          rec.ID,
+				TaxableEURCents: taxable.Int64,
+				PAYECents:       paye.Int64,
+				USCCents:        usc.Int64,
+				PRSICents:       prsi.Int64,
+			}
+			rec.DifferenceCents = taxable.Int64 - rec.ExpectedEURCents
+
+			usdValue := rec.Quantity * float64(rec.StrikePriceCents)
+			if usdValue > 0 {
+				rec.ImpliedRate = float64(taxable.Int64) / usdValue
+			}
+			if rec.Quantity > 0 && rec.ECBRate > 0 {
+				rec.ImpliedPriceCents = int64(math.Round(float64(taxable.Int64) / rec.Quantity / rec.ECBRate))
+			}
+
+			diff := math.Abs(float64(rec.DifferenceCents))
+			rec.Flagged = diff > 100 && diff > expected*PayrollTolerance
+		}
+		report = append(report, rec)
+	}
+	return report, nil
+}
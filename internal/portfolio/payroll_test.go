@@ -0,0 +1,51 @@
+package portfolio
+
+import (
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestGetPayrollReconciliation(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 0.9)
+
+	s := NewService(database)
+	matching, _ := s.AddVest("2024-01-10", "GOOGL", 10, 10000) // Expected EUR 900.00
+	differing, _ := s.AddVest("2024-04-10", "GOOGL", 10, 10000)
+	if _, err := s.AddVest("2024-07-10", "GOOGL", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+
+	if err := s.SetVestPayroll(models.VestPayroll{VestID: matching.ID, TaxableEURCents: 90020, PAYECents: 36008}); err != nil {
+		t.Fatalf("SetVestPayroll failed: %v", err)
+	}
+	// Payroll used a rate of 0.95 instead of 0.9.
+	if err := s.SetVestPayroll(models.VestPayroll{VestID: differing.ID, TaxableEURCents: 95000}); err != nil {
+		t.Fatalf("SetVestPayroll failed: %v", err)
+	}
+
+	report, err := s.GetPayrollReconciliation()
+	if err != nil {
+		t.Fatalf("GetPayrollReconciliation failed: %v", err)
+	}
+	if len(report) != 3 {
+		t.Fatalf("expected 3 vests in the report, got %d", len(report))
+	}
+
+	if report[0].Flagged || report[0].DifferenceCents != 20 {
+		t.Errorf("expected a small unflagged difference, got %+v", report[0])
+	}
+	if !report[1].Flagged || report[1].DifferenceCents != 5000 {
+		t.Errorf("expected a flagged difference of 5000 cents, got %+v", report[1])
+	}
+	if report[1].ImpliedRate < 0.9499 || report[1].ImpliedRate > 0.9501 {
+		t.Errorf("expected an implied rate of 0.95, got %f", report[1].ImpliedRate)
+	}
+	if report[2].Payroll != nil || report[2].Flagged {
+		t.Errorf("expected a vest without payroll to be unflagged, got %+v", report[2])
+	}
+}
@@ -0,0 +1,298 @@
+package portfolio
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"irish-cgt-tracker/internal/models"
+)
+
+// PlanRequest describes a multi-year reduction of a holding.
+type PlanRequest struct {
+	Symbol string
+	// Quantity is the total number of shares to sell over the plan.
+	Quantity float64
+	// StartYear is the first tax year of the plan and Years its length.
+	StartYear int
+	Years     int
+	// PriceCents is the assumed price per share in USD cents for each year of
+	// the plan. The last price is used for any later years.
+	PriceCents []int64
+	// Rate is the assumed USD to EUR rate. If zero, today's ECB rate is used.
+	Rate float64
+	// From is the date the plan is made, in "YYYY-MM-DD" format. No sale is
+	// planned before it, and vests scheduled after it count as acquisitions.
+	From string
+}
+
+// PlannedSale is one sale in a SalePlan.
+type PlannedSale struct {
+	Year int
+	// Period is the CGT payment period the sale falls in.
+	Period     string
+	Date       string
+	Quantity   float64
+	PriceCents int64
+	// ProceedsEURCents and GainEURCents cover the lots chargeable to CGT.
+	ProceedsEURCents int64
+	GainEURCents     int64
+	// ExemptionUsedCents is the part of the year's exemption the sale uses.
+	ExemptionUsedCents int64
+	// TaxCents is the CGT (and any exit tax) the sale adds.
+	TaxCents int64
+	// Warning explains why the four-week rule could not be avoided, if so.
+	Warning string
+}
+
+// SalePlan is a proposed schedule of sales and its total tax.
+type SalePlan struct {
+	Symbol   string
+	ECBRate  float64
+	Sales    []PlannedSale
+	Quantity float64
+	TaxCents int64
+	// SingleSaleTaxCents is the tax if the whole quantity were sold in the
+	// first planned sale instead, for comparison.
+	SingleSaleTaxCents int64
+}
+
+// PlanSales proposes a schedule of sales that reduces a holding by the requested
+// quantity over several tax years while paying as little CGT as possible.
+//
+// CGT is charged at a flat rate, so the tax saved comes from using each year's
+// annual exemption and any losses. In every year but the last the plan sells
+// the most whole shares that add no tax, given the gains and losses already
+// realised or planned for that year; the balance is sold in the final year.
+// This is a greedy heuristic rather than a search for the schedule with the
+// lowest total tax: it can miss a cheaper schedule, for example when the
+// assumed price falls in later years or when later lots stand at a loss.
+// Sales are matched against the current inventory as SettleSale would match
+// them. Each is dated as late in the year as possible without an acquisition
+// in the four weeks before it, which matchFIFO would match first, and, when it
+// realises a loss, without an acquisition, including a scheduled vest, in the
+// four weeks after it. The CGT computation does not restrict such a loss to
+// gains on the reacquired shares, so the plan avoids it rather than model it.
+//
+// Parameters:
+//   - req: The symbol, quantity, years and assumed prices and rate.
+//
+// Returns:
+//   - The SalePlan.
+//   - An error if the request is invalid, not enough shares are held, the
+//     exchange rate cannot be fetched or the database query fails.
+func (s *Service) PlanSales(req PlanRequest) (*SalePlan, error) {
+	if _, err := models.ParseDate(req.From); err != nil {
+		return nil, fmt.Errorf("invalid start date: %w", err)
+	}
+	if req.Quantity <= 0 || req.Years <= 0 || len(req.PriceCents) == 0 {
+		return nil, fmt.Errorf("a plan requires a positive quantity, number of years and at least one price")
+	}
+	if req.StartYear < disposalYear(req.From) {
+		req.StartYear = disposalYear(req.From)
+	}
+
+	in, err := s.loadSimulationInputs(req.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	var lots []lotMatch
+	var held float64
+	for _, item := range in.inventory {
+		lots = append(lots, lotMatch{Lot: item, Shares: item.RemainingQty})
+		held += item.RemainingQty
+	}
+	if req.Quantity > held+quantityEpsilon {
+		return nil, fmt.Errorf("cannot plan to sell %g shares: only %g are held", req.Quantity, held)
+	}
+	rate, err := s.assumedRate(req.Rate, allCrypto(lots))
+	if err != nil {
+		return nil, err
+	}
+	acquisitions, err := s.plannedAcquisitions(req.Symbol, req.From, in.inventory)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &SalePlan{Symbol: req.Symbol, ECBRate: rate}
+	firstDate := lastDateOfYear(req.StartYear)
+	single, err := s.simulate(in, firstDate, req.Symbol, req.Quantity, req.PriceCents[0], rate, 0)
+	if err != nil {
+		return nil, err
+	}
+	plan.SingleSaleTaxCents = single.AdditionalTaxCents() + single.ExitTaxCents
+
+	remaining := req.Quantity
+	for i := 0; i < req.Years && remaining > quantityEpsilon; i++ {
+		year := req.StartYear + i
+		price := req.PriceCents[min(i, len(req.PriceCents)-1)]
+		yearEnd := lastDateOfYear(year)
+
+		qty := remaining
+		if i < req.Years-1 {
+			if qty, err = s.taxFreeQuantity(in, yearEnd, req.Symbol, remaining, price, rate); err != nil {
+				return nil, err
+			}
+			if qty == 0 {
+				continue
+			}
+		}
+
+		// The gain or loss does not depend on the day chosen, so the final
+		// date only needs the sign of the result.
+		sim, err := s.simulate(in, yearEnd, req.Symbol, qty, price, rate, 0)
+		if err != nil {
+			return nil, err
+		}
+		date, warning := fourWeekDate(year, req.From, acquisitions, sim.GainEURCents < 0)
+		if sim, err = s.simulate(in, date, req.Symbol, qty, price, rate, 0); err != nil {
+			return nil, err
+		}
+
+		sale := PlannedSale{
+			Year:               year,
+			Period:             sim.After.Initial.Label,
+			Date:               date,
+			Quantity:           qty,
+			PriceCents:         price,
+			ProceedsEURCents:   sim.ProceedsEURCents,
+			GainEURCents:       sim.GainEURCents,
+			ExemptionUsedCents: sim.After.ExemptionCents - sim.Before.ExemptionCents,
+			TaxCents:           sim.AdditionalTaxCents() + sim.ExitTaxCents,
+			Warning:            warning,
+		}
+		if date[5:7] == "12" {
+			sale.Period = sim.After.Later.Label
+		}
+		plan.Sales = append(plan.Sales, sale)
+		plan.Quantity += qty
+		plan.TaxCents += sale.TaxCents
+
+		in.disposals = append(in.disposals, sim.disposals...)
+		consumeLots(in.inventory, sim.Lots)
+		remaining -= qty
+	}
+	return plan, nil
+}
+
+// taxFreeQuantity returns the most whole shares, up to limit, that can be sold
+// on the date without adding any tax. It bisects on the assumption that the
+// tax never falls as more is sold, which holds unless a later lot stands at a
+// loss; shares missed that way are left for the final year of the plan.
+func (s *Service) taxFreeQuantity(in simulationInputs, date, symbol string, limit float64, priceCents int64, rate float64) (float64, error) {
+	taxFree := func(qty float64) (bool, error) {
+		sim, err := s.simulate(in, date, symbol, qty, priceCents, rate, 0)
+		if err != nil {
+			return false, err
+		}
+		return sim.AdditionalTaxCents()+sim.ExitTaxCents <= 0, nil
+	}
+
+	// Bisect with taxFree(lo) holding and taxFree(hi) failing.
+	lo, hi := 0.0, math.Floor(limit+quantityEpsilon)
+	if hi < 1 {
+		return 0, nil
+	}
+	if ok, err := taxFree(hi); err != nil || ok {
+		return hi, err
+	}
+	for hi-lo > 1 {
+		mid := math.Floor((lo + hi) / 2)
+		ok, err := taxFree(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// plannedAcquisitions returns the dates of the open lots and of the vests
+// scheduled after asOf for grants of the symbol, in ascending order.
+func (s *Service) plannedAcquisitions(symbol, asOf string, inventory []InventoryItem) ([]string, error) {
+	var dates []string
+	for _, item := range inventory {
+		dates = append(dates, item.Date)
+	}
+
+	grants, err := s.GetGrants()
+	if err != nil {
+		return nil, err
+	}
+	planned := map[string]bool{}
+	for _, g := range grants {
+		planned[g.ID] = symbol == "" || g.Symbol == symbol
+	}
+	schedule, err := s.GetVestSchedule(asOf)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range schedule {
+		if t.Status != models.TrancheVested && planned[t.GrantID] {
+			dates = append(dates, t.Date)
+		}
+	}
+	sort.Strings(dates)
+	return dates, nil
+}
+
+// fourWeekDate picks the latest date in the year, on or after from, with no
+// acquisition on or in the four weeks before it and, for a loss, none in the four
+// weeks after it either. Later dates are preferred as they fall in the later
+// payment period. If no date qualifies, the last day of the year is used with a
+// warning.
+func fourWeekDate(year int, from string, acquisitions []string, loss bool) (string, string) {
+	day := time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC)
+	first := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	if start, err := models.ParseDate(from); err == nil && start.After(first) {
+		first = start
+	}
+
+	for ; !day.Before(first); day = day.AddDate(0, 0, -1) {
+		if fourWeekClear(day, acquisitions, loss) {
+			return day.Format("2006-01-02"), ""
+		}
+	}
+	if loss {
+		return lastDateOfYear(year), "an acquisition within four weeks of every possible date restricts the use of this loss"
+	}
+	return lastDateOfYear(year), "shares acquired in the four weeks before the sale will be matched first"
+}
+
+// fourWeekClear reports whether a sale on the day avoids the four-week rule.
+func fourWeekClear(day time.Time, acquisitions []string, loss bool) bool {
+	before := day.AddDate(0, 0, -FourWeekDays).Format("2006-01-02")
+	after := day.AddDate(0, 0, FourWeekDays).Format("2006-01-02")
+	date := day.Format("2006-01-02")
+	for _, a := range acquisitions {
+		if a >= before && a <= date {
+			return false
+		}
+		if loss && a > date && a <= after {
+			return false
+		}
+	}
+	return true
+}
+
+// consumeLots reduces the remaining quantity of the inventory by the shares a
+// simulated sale matched.
+func consumeLots(inventory []InventoryItem, lots []SimulatedLot) {
+	for _, l := range lots {
+		for i := range inventory {
+			if inventory[i].ID == l.Lot.ID {
+				inventory[i].RemainingQty = math.Max(inventory[i].RemainingQty-l.Shares, 0)
+			}
+		}
+	}
+}
+
+// lastDateOfYear returns 31 December of the year in "YYYY-MM-DD" format.
+func lastDateOfYear(year int) string {
+	return fmt.Sprintf("%d-12-31", year)
+}
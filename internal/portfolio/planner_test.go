@@ -0,0 +1,79 @@
+package portfolio
+
+import (
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+)
+
+func TestPlanSales(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	if _, err := s.AddVest("2022-01-10", "ACME", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	if _, err := s.AddVest("2023-01-10", "ACME", 10, 20000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+
+	// At $400 the first lot gains 300 EUR a share, so four shares a year fit
+	// in the exemption. The final year sells the other 7: 2 x 300 + 5 x 200 =
+	// 1,600, of which 330 is chargeable.
+	plan, err := s.PlanSales(PlanRequest{
+		Symbol:     "ACME",
+		Quantity:   15,
+		StartYear:  2030,
+		Years:      3,
+		PriceCents: []int64{40000},
+		Rate:       1.0,
+		From:       "2030-01-01",
+	})
+	if err != nil {
+		t.Fatalf("PlanSales failed: %v", err)
+	}
+	if len(plan.Sales) != 3 {
+		t.Fatalf("expected a sale in each of 3 years, got %+v", plan.Sales)
+	}
+	for i, want := range []float64{4, 4, 7} {
+		if got := plan.Sales[i]; got.Quantity != want || got.Year != 2030+i || got.Date != lastDateOfYear(2030+i) {
+			t.Errorf("sale %d: expected %g shares on %d-12-31, got %+v", i, want, 2030+i, got)
+		}
+	}
+	if plan.Sales[0].TaxCents != 0 || plan.Sales[0].ExemptionUsedCents != 120000 {
+		t.Errorf("expected the first sale to use 1,200 of the exemption tax free, got %+v", plan.Sales[0])
+	}
+	if plan.TaxCents != 10890 || plan.SingleSaleTaxCents != 90090 {
+		t.Errorf("expected 108.90 planned against 900.90 in one sale, got %d and %d", plan.TaxCents, plan.SingleSaleTaxCents)
+	}
+
+	// Nothing is persisted.
+	inventory, _ := s.GetInventory()
+	if len(inventory) != 2 || inventory[0].RemainingQty != 10 {
+		t.Errorf("planning changed the inventory: %+v", inventory)
+	}
+
+	if _, err := s.PlanSales(PlanRequest{Symbol: "ACME", Quantity: 25, Years: 2, PriceCents: []int64{40000}, Rate: 1.0, From: "2030-01-01"}); err == nil {
+		t.Error("expected an error when planning to sell more shares than held")
+	}
+	if _, err := s.PlanSales(PlanRequest{Symbol: "ACME", Quantity: 5, Years: 2, PriceCents: []int64{40000}, Rate: 1.0}); err == nil {
+		t.Error("expected an error when the plan has no date")
+	}
+}
+
+func TestFourWeekDate(t *testing.T) {
+	acquisitions := []string{"2030-12-20"}
+
+	if date, warning := fourWeekDate(2030, "2030-01-01", acquisitions, false); date != "2030-12-19" || warning != "" {
+		t.Errorf("expected a gain to be realised the day before the acquisition, got %s (%s)", date, warning)
+	}
+	if date, _ := fourWeekDate(2030, "2030-01-01", acquisitions, true); date != "2030-11-21" {
+		t.Errorf("expected a loss to be realised more than four weeks before the acquisition, got %s", date)
+	}
+	if date, warning := fourWeekDate(2030, "2030-12-01", acquisitions, true); date != "2030-12-31" || warning == "" {
+		t.Errorf("expected a warning when the rule cannot be avoided, got %s (%s)", date, warning)
+	}
+}
@@ -0,0 +1,152 @@
+package portfolio
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"irish-cgt-tracker/internal/models"
+)
+
+// DefaultPriceTolerance is the deviation outside the day's trading range, as a
+// fraction of the nearest bound, above which a recorded price is flagged.
+const DefaultPriceTolerance = 0.02
+
+// Kinds of record checked by CheckRecordedPrices.
+const (
+	PriceCheckVest = "VEST"
+	PriceCheckSale = "SALE"
+)
+
+// PriceDeviation is a vest or sale whose recorded price lies outside the
+// security's trading range on that day by more than the tolerance.
+type PriceDeviation struct {
+	// Kind is PriceCheckVest or PriceCheckSale, and ID the record's ID.
+	Kind   string
+	ID     string
+	Date   string
+	Symbol string
+	// RecordedCents is the vest's cost per share or the sale price, in cents of
+	// the price currency.
+	RecordedCents int64
+	// LowCents and HighCents are the day's trading range (the close if only
+	// a closing price is stored).
+	LowCents  int64
+	HighCents int64
+	// Deviation is the distance outside the range as a fraction of the
+	// nearest bound, e.g. 0.1 for 10% above the high.
+	Deviation float64
+}
+
+// DeviationPercent returns the deviation as a percentage, for display.
+func (d PriceDeviation) DeviationPercent() float64 {
+	return d.Deviation * 100
+}
+
+// CheckRecordedPrices compares the price recorded on each vest and sale with
+// the stored price history and flags those outside the day's trading range by
+// more than the tolerance. Only lots whose cost is a market price (RSU
+// releases, ESPP purchases and option exercises) and sales at a traded price
+// are checked: negligible value claims and gifts made are deemed disposals at
+// a value rather than a trade, so they are skipped, as are records on days
+// without a stored price. Crypto-asset disposals are compared in EUR cents,
+// the currency of their price history.
+//
+// Parameters:
+//   - tolerance: The allowed deviation as a fraction, e.g. DefaultPriceTolerance.
+//
+// Returns:
+//   - The deviations, ordered by date.
+//   - An error if the tolerance is negative or a database query fails.
+func (s *Service) CheckRecordedPrices(tolerance float64) ([]PriceDeviation, error) {
+	if tolerance < 0 {
+		return nil, fmt.Errorf("the tolerance cannot be negative")
+	}
+	prices, err := s.getPriceHistory()
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve prices: %w", err)
+	}
+
+	var deviations []PriceDeviation
+	check := func(kind, id, date, symbol string, recorded int64) {
+		price, ok := prices[symbol+"|"+date]
+		if !ok {
+			return
+		}
+		low, high := price.Range()
+		var deviation float64
+		switch {
+		case recorded < low:
+			deviation = float64(low-recorded) / float64(low)
+		case recorded > high:
+			deviation = float64(recorded-high) / float64(high)
+		}
+		if deviation > tolerance {
+			deviations = append(deviations, PriceDeviation{
+				Kind:          kind,
+				ID:            id,
+				Date:          date,
+				Symbol:        symbol,
+				RecordedCents: recorded,
+				LowCents:      low,
+				HighCents:     high,
+				Deviation:     deviation,
+			})
+		}
+	}
+
+	rows, err := s.db.Query(`SELECT id, date, symbol, strike_price_cents FROM vests WHERE source IN (?, ?, ?)`,
+		models.SourceRSU, models.SourceESPP, models.SourceOptionExercise)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, date, symbol string
+		var cents int64
+		if err := rows.Scan(&id, &date, &symbol, &cents); err != nil {
+			return nil, err
+		}
+		check(PriceCheckVest, id, date, symbol, cents)
+	}
+
+	saleRows, err := s.db.Query(`
+		SELECT id, date, symbol, price_cents, ecb_rate FROM sales
+		WHERE id NOT IN (SELECT sale_id FROM settled_sales WHERE type = ? AND sale_id IS NOT NULL)
+		AND id NOT IN (SELECT sale_id FROM transfers WHERE sale_id IS NOT NULL)`, NegligibleValueType)
+	if err != nil {
+		return nil, err
+	}
+	defer saleRows.Close()
+	for saleRows.Next() {
+		var id, date, symbol string
+		var cents int64
+		var rate float64
+		if err := saleRows.Scan(&id, &date, &symbol, &cents, &rate); err != nil {
+			return nil, err
+		}
+		check(PriceCheckSale, id, date, symbol, int64(math.Round(models.UnitPrice(cents, rate))))
+	}
+
+	sort.SliceStable(deviations, func(i, j int) bool { return deviations[i].Date < deviations[j].Date })
+	return deviations, nil
+}
+
+// getPriceHistory returns every stored price keyed by "symbol|date".
+func (s *Service) getPriceHistory() (map[string]models.Price, error) {
+	rows, err := s.db.Query(`SELECT symbol, date, price_cents, open_cents, high_cents, low_cents, source FROM prices`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prices := map[string]models.Price{}
+	for rows.Next() {
+		var p models.Price
+		if err := rows.Scan(&p.Symbol, &p.Date, &p.PriceCents, &p.OpenCents, &p.HighCents, &p.LowCents, &p.Source); err != nil {
+			return nil, err
+		}
+		prices[p.Symbol+"|"+p.Date] = p
+	}
+	return prices, nil
+}
@@ -0,0 +1,89 @@
+package portfolio
+
+import (
+	"strings"
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestCheckRecordedPrices(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	ohlc := "Date,Open,High,Low,Close,Adj Close,Volume\n" +
+		"2024-03-01,100.00,105.00,98.00,102.00,102.00,1000\n" +
+		"2024-03-04,101.00,104.00,99.00,103.00,103.00,1000\n" +
+		"2024-06-03,150.00,155.00,148.00,152.00,152.00,1000\n"
+	if err := s.ImportOHLC(strings.NewReader(ohlc), "ACME"); err != nil {
+		t.Fatalf("ImportOHLC failed: %v", err)
+	}
+
+	// Within the range, slightly above it, and a typo ten times the price.
+	s.AddVest("2024-03-01", "ACME", 10, 10300)
+	s.AddVest("2024-03-04", "ACME", 10, 10600)
+	typo, _ := s.AddVest("2024-03-04", "ACME", 10, 103000)
+	// No price history for this date.
+	s.AddVest("2024-04-01", "ACME", 10, 999999)
+	sale, _ := s.AddSale("2024-06-03", "ACME", 5, 14000)
+
+	deviations, err := s.CheckRecordedPrices(DefaultPriceTolerance)
+	if err != nil {
+		t.Fatalf("CheckRecordedPrices failed: %v", err)
+	}
+	if len(deviations) != 2 {
+		t.Fatalf("expected the typo and the low sale to be flagged, got %+v", deviations)
+	}
+	if d := deviations[0]; d.Kind != PriceCheckVest || d.ID != typo.ID || d.HighCents != 10400 {
+		t.Errorf("unexpected vest deviation: %+v", d)
+	}
+	if d := deviations[1]; d.Kind != PriceCheckSale || d.ID != sale.ID || d.Deviation < 0.05 || d.Deviation > 0.06 {
+		t.Errorf("unexpected sale deviation: %+v", d)
+	}
+
+	// A looser tolerance still catches the typo but not the 5% low sale.
+	if deviations, _ := s.CheckRecordedPrices(0.10); len(deviations) != 1 {
+		t.Errorf("expected only the typo at a 10%% tolerance, got %+v", deviations)
+	}
+}
+
+func TestCheckRecordedPrices_SkipsDeemedAndCryptoDisposals(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 0.9)
+
+	s := NewService(database)
+	s.SetPrice(models.Price{Symbol: "ACME", Date: "2024-03-01", PriceCents: 10000, Source: "MANUAL"})
+	s.SetPrice(models.Price{Symbol: "BTC", Date: "2024-06-01", PriceCents: 5000000, Source: "MANUAL"})
+
+	// A gift made is valued rather than traded, so its price is not checked.
+	s.AddVest("2020-01-10", "ACME", 10, 5000)
+	if _, err := s.RecordTransfer(models.Transfer{
+		Date: "2024-03-01", Direction: models.TransferOut, Type: models.TransferGift,
+		Symbol: "ACME", Quantity: 1, MarketValueCents: 20000, Counterparty: "Niece",
+	}); err != nil {
+		t.Fatalf("gift out failed: %v", err)
+	}
+	// A crypto sale at the day's EUR price, stored in finer units.
+	trades := []models.CryptoTradeRecord{
+		{Date: "2024-01-05", Type: models.CryptoBuy, Asset: "BTC", Quantity: 1, ValueEURCents: 2000000},
+		{Date: "2024-06-01", Type: models.CryptoSell, Asset: "BTC", Quantity: 0.5, ValueEURCents: 2500000},
+	}
+	for _, trade := range trades {
+		if _, err := s.RecordCryptoTrade(trade); err != nil {
+			t.Fatalf("RecordCryptoTrade failed: %v", err)
+		}
+	}
+
+	deviations, err := s.CheckRecordedPrices(DefaultPriceTolerance)
+	if err != nil {
+		t.Fatalf("CheckRecordedPrices failed: %v", err)
+	}
+	if len(deviations) != 0 {
+		t.Errorf("expected no deviations, got %+v", deviations)
+	}
+}
@@ -0,0 +1,319 @@
+package portfolio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"irish-cgt-tracker/internal/importer"
+	"irish-cgt-tracker/internal/models"
+)
+
+// Price sources recorded alongside each stored price.
+const (
+	PriceSourceCSV    = "CSV"
+	PriceSourceOHLC   = "OHLC"
+	PriceSourceManual = "MANUAL"
+)
+
+// PriceProvider fetches the closing price of a security on a date. Prices are
+// in USD cents, or EUR cents for crypto-assets.
+type PriceProvider interface {
+	Name() string
+	FetchPrice(symbol, date string) (int64, error)
+}
+
+// HTTPPriceProvider fetches prices from a JSON endpoint. URLTemplate may
+// contain {symbol} and {date} placeholders, and the response must be an object
+// with a "price" field in major units, e.g. {"price": 176.77}.
+type HTTPPriceProvider struct {
+	URLTemplate string
+	Client      *http.Client
+}
+
+// Name identifies the provider as the source of stored prices.
+func (p *HTTPPriceProvider) Name() string {
+	if u, err := url.Parse(p.URLTemplate); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return "HTTP"
+}
+
+// FetchPrice requests the price for the symbol and date from the endpoint.
+func (p *HTTPPriceProvider) FetchPrice(symbol, date string) (int64, error) {
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	target := strings.NewReplacer("{symbol}", url.PathEscape(symbol), "{date}", date).Replace(p.URLTemplate)
+	resp, err := client.Get(target)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("price provider returned status %d for %s", resp.StatusCode, symbol)
+	}
+
+	var body struct {
+		Price *float64 `json:"price"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, err
+	}
+	if body.Price == nil {
+		return 0, fmt.Errorf("price provider returned no price for %s on %s", symbol, date)
+	}
+	return int64(math.Round(*body.Price * 100)), nil
+}
+
+// SetPrice stores the price of a security on a date, replacing any price
+// already stored for that date.
+//
+// Parameters:
+//   - price: The price to store. Source defaults to PriceSourceManual.
+//
+// Returns:
+//   - An error if the price is invalid or the database update fails.
+func (s *Service) SetPrice(price models.Price) error {
+	if _, err := models.ParseDate(price.Date); err != nil {
+		return fmt.Errorf("invalid price date: %w", err)
+	}
+	if price.Symbol == "" || price.PriceCents <= 0 {
+		return fmt.Errorf("a price requires a symbol and a positive amount")
+	}
+	if price.Source == "" {
+		price.Source = PriceSourceManual
+	}
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO prices (symbol, date, price_cents, open_cents, high_cents, low_cents, source) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		price.Symbol, price.Date, price.PriceCents, price.OpenCents, price.HighCents, price.LowCents, price.Source)
+	if err != nil {
+		return fmt.Errorf("failed to store price: %w", err)
+	}
+	return nil
+}
+
+// ImportPrices reads a price history CSV (Date,Symbol,Close) and stores each price.
+func (s *Service) ImportPrices(r io.Reader) error {
+	prices, err := importer.ParsePriceCSV(r)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range prices {
+		p.Source = PriceSourceCSV
+		if err := s.SetPrice(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ImportOHLC reads a daily OHLC price history for one security and stores each
+// day's close and trading range.
+func (s *Service) ImportOHLC(r io.Reader, symbol string) error {
+	prices, err := importer.ParseOHLCCSV(r)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range prices {
+		p.Symbol = symbol
+		p.Source = PriceSourceOHLC
+		if err := s.SetPrice(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RefreshPrices fetches the price on the date for every security with open
+// lots from the provider and stores it. A symbol the provider cannot price is
+// logged and skipped, so one failure does not block the others.
+//
+// Parameters:
+//   - provider: The price provider to query.
+//   - date: The price date in "YYYY-MM-DD" format, typically today.
+//
+// Returns:
+//   - The number of prices stored.
+//   - An error if the inventory cannot be read or a price cannot be stored.
+func (s *Service) RefreshPrices(provider PriceProvider, date string) (int, error) {
+	inventory, err := s.getAvailableInventory()
+	if err != nil {
+		return 0, fmt.Errorf("could not retrieve inventory: %w", err)
+	}
+
+	stored := 0
+	seen := map[string]bool{}
+	for _, item := range inventory {
+		if seen[item.Symbol] {
+			continue
+		}
+		seen[item.Symbol] = true
+
+		priceCents, err := provider.FetchPrice(item.Symbol, date)
+		if err != nil {
+			log.Printf("Could not fetch price for %s on %s: %v", item.Symbol, date, err)
+			continue
+		}
+		err = s.SetPrice(models.Price{Symbol: item.Symbol, Date: date, PriceCents: priceCents, Source: provider.Name()})
+		if err != nil {
+			return stored, err
+		}
+		stored++
+	}
+	return stored, nil
+}
+
+// GetLatestPrices returns the most recent price on or before the date for
+// each security, keyed by symbol.
+func (s *Service) GetLatestPrices(asOf string) (map[string]models.Price, error) {
+	rows, err := s.db.Query(`
+		SELECT p.symbol, p.date, p.price_cents, p.source
+		FROM prices p
+		WHERE p.date = (SELECT MAX(date) FROM prices WHERE symbol = p.symbol AND date <= ?)`, asOf)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prices := map[string]models.Price{}
+	for rows.Next() {
+		var p models.Price
+		if err := rows.Scan(&p.Symbol, &p.Date, &p.PriceCents, &p.Source); err != nil {
+			return nil, err
+		}
+		prices[p.Symbol] = p
+	}
+	return prices, nil
+}
+
+// LotValuation is the market value of one open lot.
+type LotValuation struct {
+	Lot InventoryItem
+	// Price is the latest stored price used to value the lot.
+	Price models.Price
+	// MarketValueEURCents, CostEURCents and GainEURCents are in EUR cents; the
+	// cost is converted at the acquisition rate and the value at the current rate.
+	MarketValueEURCents int64
+	CostEURCents        int64
+	GainEURCents        int64
+}
+
+// Valuation is the market value of the open lots and the tax that would be
+// due if they were all sold on the valuation date.
+type Valuation struct {
+	AsOf    string
+	ECBRate float64
+	Lots    []LotValuation
+	// Unpriced lists the symbols with open lots but no stored price.
+	Unpriced            []string
+	MarketValueEURCents int64
+	CostEURCents        int64
+	GainEURCents        int64
+	// EstimatedTaxCents is the CGT a sale of every priced lot would add to the
+	// year, after the exemption and losses; ExitTaxCents is the exit tax on ETF lots.
+	EstimatedTaxCents int64
+	ExitTaxCents      int64
+}
+
+// GetValuation values the open lots at the latest stored prices and estimates
+// the tax if the whole position were sold on the valuation date.
+//
+// USD prices are converted at the ECB rate for the date (the cached rate for
+// today, or the latest published before it); crypto-asset prices are in EUR.
+// The estimate runs every priced lot through the same dual-currency calculation
+// as SettleSale and compares the year's CGT with and without the disposals.
+//
+// Parameters:
+//   - asOf: The valuation date in "YYYY-MM-DD" format, typically today.
+//
+// Returns:
+//   - The Valuation.
+//   - An error if the exchange rate cannot be fetched or a database query fails.
+func (s *Service) GetValuation(asOf string) (*Valuation, error) {
+	if _, err := models.ParseDate(asOf); err != nil {
+		return nil, fmt.Errorf("invalid valuation date: %w", err)
+	}
+	in, err := s.loadSimulationInputs("")
+	if err != nil {
+		return nil, err
+	}
+	prices, err := s.GetLatestPrices(asOf)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve prices: %w", err)
+	}
+
+	valuation := &Valuation{AsOf: asOf, ECBRate: 1.0}
+	for _, item := range in.inventory {
+		if item.AssetClass != models.AssetClassCrypto {
+			if valuation.ECBRate, err = s.rates.FetchUSDToEUR(asOf); err != nil {
+				return nil, fmt.Errorf("failed to fetch exchange rate for %s: %w", asOf, err)
+			}
+			break
+		}
+	}
+
+	unpriced := map[string]bool{}
+	var disposals []cgtDisposal
+	for _, item := range in.inventory {
+		price, ok := prices[item.Symbol]
+		if !ok {
+			if !unpriced[item.Symbol] {
+				valuation.Unpriced = append(valuation.Unpriced, item.Symbol)
+			}
+			unpriced[item.Symbol] = true
+			continue
+		}
+
+		rate := valuation.ECBRate
+		if item.AssetClass == models.AssetClassCrypto {
+			rate = 1.0
+		}
+		value := float64(price.PriceCents) * rate * item.RemainingQty
+		cost := models.PriceEUR(item.StrikePriceCents, item.ECBRate) * item.RemainingQty
+		lot := LotValuation{
+			Lot:                 item,
+			Price:               price,
+			MarketValueEURCents: int64(math.Round(value)),
+			CostEURCents:        int64(math.Round(cost)),
+			GainEURCents:        int64(math.Round(value - cost)),
+		}
+		valuation.Lots = append(valuation.Lots, lot)
+		valuation.MarketValueEURCents += lot.MarketValueEURCents
+		valuation.CostEURCents += lot.CostEURCents
+		valuation.GainEURCents += lot.GainEURCents
+
+		if item.AssetClass == models.AssetClassETF {
+			unitCost, taxPaid := etfUnitCost(&item.Vest, in.deemed[item.ID], asOf)
+			d := creditDeemedTax(exitTaxDisposal("", &item.Vest, asOf, item.RemainingQty, value, unitCost*item.RemainingQty, "DISPOSAL"), taxPaid)
+			valuation.ExitTaxCents += d.TaxCents
+			continue
+		}
+		sale := &models.Sale{Date: asOf, Symbol: item.Symbol, PriceCents: price.PriceCents, ECBRate: rate, OwnerID: s.owner}
+		settled := computeSettledSale(sale, &item.Vest, item.RemainingQty)
+		disposals = append(disposals, cgtDisposal{
+			SaleID:        "valuation",
+			OwnerID:       s.owner,
+			Date:          asOf,
+			AcquiredDate:  item.Date,
+			ProceedsCents: settled.EuroSaleEUR,
+			GainCents:     settled.EuroGainEUR,
+		})
+	}
+
+	year := disposalYear(asOf)
+	before := s.ownSummary(year, in.disposals, in.periods)
+	after := s.ownSummary(year, append(in.disposals, disposals...), in.periods)
+	valuation.EstimatedTaxCents = after.TaxCents - before.TaxCents
+	return valuation, nil
+}
@@ -0,0 +1,109 @@
+package portfolio
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestGetValuation(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	if _, err := s.AddVest("2022-01-10", "ACME", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	if _, err := s.AddVest("2023-01-10", "ACME", 10, 20000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	if _, err := s.AddVest("2023-01-10", "OTHER", 5, 1000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+
+	csvData := "Date,Symbol,Close\n2024-05-31,ACME,$300.00\n2024-06-28,ACME,$400.00\n2024-07-31,ACME,$999.00\n"
+	if err := s.ImportPrices(strings.NewReader(csvData)); err != nil {
+		t.Fatalf("ImportPrices failed: %v", err)
+	}
+
+	valuation, err := s.GetValuation("2024-07-01")
+	if err != nil {
+		t.Fatalf("GetValuation failed: %v", err)
+	}
+	if len(valuation.Lots) != 2 || valuation.Lots[0].Price.Date != "2024-06-28" {
+		t.Fatalf("expected both ACME lots valued at the 28 June price, got %+v", valuation.Lots)
+	}
+	if len(valuation.Unpriced) != 1 || valuation.Unpriced[0] != "OTHER" {
+		t.Errorf("expected OTHER to be reported as unpriced, got %v", valuation.Unpriced)
+	}
+
+	// 20 shares worth 8,000 EUR against a cost of 3,000: the 5,000 gain less
+	// the 1,270 exemption is taxed at 33%.
+	if valuation.MarketValueEURCents != 800000 || valuation.GainEURCents != 500000 {
+		t.Errorf("unexpected totals: value %d, gain %d", valuation.MarketValueEURCents, valuation.GainEURCents)
+	}
+	if valuation.EstimatedTaxCents != 123090 {
+		t.Errorf("expected estimated CGT of 123090 cents, got %d", valuation.EstimatedTaxCents)
+	}
+}
+
+type stubPriceProvider map[string]int64
+
+func (p stubPriceProvider) Name() string { return "stub" }
+
+func (p stubPriceProvider) FetchPrice(symbol, date string) (int64, error) {
+	if price, ok := p[symbol]; ok {
+		return price, nil
+	}
+	return 0, fmt.Errorf("no price for %s", symbol)
+}
+
+func TestRefreshPrices(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	s.AddVest("2022-01-10", "ACME", 10, 10000)
+	s.AddVest("2022-01-10", "OTHER", 10, 10000)
+
+	stored, err := s.RefreshPrices(stubPriceProvider{"ACME": 12345}, "2024-07-01")
+	if err != nil || stored != 1 {
+		t.Fatalf("expected 1 price stored, got %d (%v)", stored, err)
+	}
+	prices, _ := s.GetLatestPrices("2024-07-01")
+	if p := prices["ACME"]; p.PriceCents != 12345 || p.Source != "stub" {
+		t.Errorf("unexpected stored price: %+v", p)
+	}
+
+	if err := s.SetPrice(models.Price{Symbol: "ACME", Date: "2024-07-01", PriceCents: -1}); err == nil {
+		t.Error("expected an error for a negative price")
+	}
+}
+
+func TestHTTPPriceProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ACME/2024-07-01" {
+			fmt.Fprintln(w, `{"price": 176.77}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	provider := &HTTPPriceProvider{URLTemplate: server.URL + "/{symbol}/{date}"}
+	price, err := provider.FetchPrice("ACME", "2024-07-01")
+	if err != nil || price != 17677 {
+		t.Errorf("expected 17677 cents, got %d (%v)", price, err)
+	}
+	if _, err := provider.FetchPrice("NONE", "2024-07-01"); err == nil {
+		t.Error("expected an error for an unknown symbol")
+	}
+}
@@ -0,0 +1,193 @@
+package portfolio
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"irish-cgt-tracker/internal/models"
+)
+
+// Default thresholds for ReminderOptions.
+const (
+	DefaultDeadlineReminderDays = 14
+	DefaultUnsettledDays        = 7
+)
+
+// ReminderOptions controls when reminders fall due.
+type ReminderOptions struct {
+	// DeadlineDays is how many days before a CGT payment deadline with an
+	// outstanding balance to send a reminder.
+	DeadlineDays int
+	// UnsettledDays is how long a sale may remain unsettled before a reminder.
+	UnsettledDays int
+}
+
+// Reminder is a notification that something needs attention.
+type Reminder struct {
+	// Key identifies the reminder so that it is only sent once.
+	Key     string
+	Subject string
+	Body    string
+}
+
+// transactionRate fetches the ECB rate for a transaction, recording any failure
+// so that it can be reported by GetDueReminders.
+func (s *Service) transactionRate(record, date string) (float64, error) {
+	rate, err := s.rates.FetchUSDToEUR(date)
+	if err != nil {
+		_, dbErr := s.db.Exec(`INSERT INTO rate_failures (id, record, date, error, failed_at) VALUES (?, ?, ?, ?, ?)`,
+			uuid.New().String(), record, date, err.Error(), time.Now().UTC().Format(time.RFC3339))
+		if dbErr != nil {
+			log.Printf("Could not record rate failure for %s on %s: %v", record, date, dbErr)
+		}
+	}
+	return rate, err
+}
+
+// GetRateFailures retrieves the transactions rejected because their exchange
+// rate could not be fetched, newest first.
+func (s *Service) GetRateFailures() ([]models.RateFailure, error) {
+	rows, err := s.db.Query(`SELECT id, record, date, error, failed_at FROM rate_failures ORDER BY failed_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failures []models.RateFailure
+	for rows.Next() {
+		var f models.RateFailure
+		if err := rows.Scan(&f.ID, &f.Record, &f.Date, &f.Error, &f.FailedAt); err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+	return failures, nil
+}
+
+// GetDueReminders lists the reminders due on a date that have not already been
+// sent, for every person in the household:
+//   - a CGT payment deadline within opts.DeadlineDays with a balance still to pay;
+//   - a sale left unsettled for more than opts.UnsettledDays;
+//   - a transaction rejected because its exchange rate could not be fetched.
+//
+// Parameters:
+//   - asOf: The reference date in "YYYY-MM-DD" format, typically today.
+//   - opts: The reminder thresholds. Zero values use the defaults.
+//
+// Returns:
+//   - The reminders, deadlines first.
+//   - An error if the date is invalid or a database query fails.
+func (s *Service) GetDueReminders(asOf string, opts ReminderOptions) ([]Reminder, error) {
+	date, err := models.ParseDate(asOf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reminder date: %w", err)
+	}
+	if opts.DeadlineDays <= 0 {
+		opts.DeadlineDays = DefaultDeadlineReminderDays
+	}
+	if opts.UnsettledDays <= 0 {
+		opts.UnsettledDays = DefaultUnsettledDays
+	}
+
+	var reminders []Reminder
+	persons, err := s.GetPersons()
+	if err != nil {
+		return nil, err
+	}
+	horizon := date.AddDate(0, 0, opts.DeadlineDays).Format("2006-01-02")
+	for _, p := range persons {
+		for year := date.Year() - 1; year <= date.Year(); year++ {
+			recs, err := s.ForPerson(p.ID).ReconcileCGTPayments(year, asOf)
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range recs {
+				if r.BalanceCents <= 0 || r.Period.DueDate < asOf || r.Period.DueDate > horizon {
+					continue
+				}
+				reminders = append(reminders, Reminder{
+					Key:     fmt.Sprintf("deadline-%s-%d-%s", p.ID, year, r.Key),
+					Subject: fmt.Sprintf("CGT payment of EUR %s due %s", centsString(r.BalanceCents), r.Period.DueDate),
+					Body: fmt.Sprintf("%s: CGT of EUR %s for %d, %s, is due by %s. EUR %s has been paid, leaving EUR %s to pay.",
+						p.Name, centsString(r.Period.TaxCents), year, r.Period.Label, r.Period.DueDate, centsString(r.PaidCents), centsString(r.BalanceCents)),
+				})
+			}
+		}
+	}
+
+	cutoff := date.AddDate(0, 0, -opts.UnsettledDays).Format("2006-01-02")
+	rows, err := s.db.Query(`SELECT id, date, symbol, quantity FROM sales WHERE is_settled = 0 AND date < ? ORDER BY date ASC`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, saleDate, symbol string
+		var qty float64
+		if err := rows.Scan(&id, &saleDate, &symbol, &qty); err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, Reminder{
+			Key:     "unsettled-" + id,
+			Subject: fmt.Sprintf("Sale of %g %s on %s is unsettled", qty, symbol, saleDate),
+			Body: fmt.Sprintf("The sale of %g %s on %s has been unsettled for more than %d days. Calculate its tax so that it is matched against your lots and included in the annual summary.",
+				qty, symbol, saleDate, opts.UnsettledDays),
+		})
+	}
+
+	failures, err := s.GetRateFailures()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range failures {
+		reminders = append(reminders, Reminder{
+			Key:     "rate-" + f.ID,
+			Subject: fmt.Sprintf("Exchange rate unavailable for %s on %s", f.Record, f.Date),
+			Body: fmt.Sprintf("The %s dated %s was not recorded because its ECB exchange rate could not be fetched (%s). Record it again once the rate service is available.",
+				f.Record, f.Date, f.Error),
+		})
+	}
+
+	sent, err := s.sentReminders()
+	if err != nil {
+		return nil, err
+	}
+	var due []Reminder
+	for _, r := range reminders {
+		if !sent[r.Key] {
+			due = append(due, r)
+		}
+	}
+	return due, nil
+}
+
+// MarkReminderSent records that a reminder was sent, so GetDueReminders no
+// longer returns it.
+func (s *Service) MarkReminderSent(key string) error {
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO sent_reminders (key, sent_at) VALUES (?, ?)`, key, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to record reminder: %w", err)
+	}
+	return nil
+}
+
+// sentReminders returns the keys of the reminders already sent.
+func (s *Service) sentReminders() (map[string]bool, error) {
+	rows, err := s.db.Query(`SELECT key FROM sent_reminders`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sent := map[string]bool{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		sent[key] = true
+	}
+	return sent, nil
+}
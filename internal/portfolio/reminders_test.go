@@ -0,0 +1,74 @@
+package portfolio
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+)
+
+func TestGetDueReminders(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	s.AddVest("2020-01-10", "ACME", 15, 10000)
+	sale, _ := s.AddSale("2024-03-01", "ACME", 10, 40000)
+	if err := s.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+	unsettled, _ := s.AddSale("2024-11-20", "ACME", 5, 40000)
+
+	// The rate service is down when the next vest is entered.
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer down.Close()
+	working := currency.BaseURL
+	currency.BaseURL = down.URL
+	if _, err := s.AddVest("2024-11-01", "ACME", 1, 10000); err == nil {
+		t.Fatal("expected the vest to fail without a rate")
+	}
+	currency.BaseURL = working
+
+	// Three weeks out the deadline is not yet due and the sale is recent.
+	reminders, err := s.GetDueReminders("2024-11-24", ReminderOptions{})
+	if err != nil {
+		t.Fatalf("GetDueReminders failed: %v", err)
+	}
+	if len(reminders) != 1 || !strings.HasPrefix(reminders[0].Key, "rate-") || !strings.Contains(reminders[0].Subject, "vest of ACME on 2024-11-01") {
+		t.Errorf("expected only the rate failure, got %+v", reminders)
+	}
+
+	reminders, err = s.GetDueReminders("2024-12-05", ReminderOptions{})
+	if err != nil {
+		t.Fatalf("GetDueReminders failed: %v", err)
+	}
+	keys := map[string]Reminder{}
+	for _, r := range reminders {
+		keys[r.Key] = r
+	}
+	if r, ok := keys["deadline--2024-INITIAL"]; !ok || r.Subject != "CGT payment of EUR 570.90 due 2024-12-15" {
+		t.Errorf("expected the payment deadline, got %+v", reminders)
+	}
+	if _, ok := keys["unsettled-"+unsettled.ID]; !ok || len(reminders) != 3 {
+		t.Errorf("expected the unsettled sale and rate failure, got %+v", reminders)
+	}
+
+	for _, r := range reminders {
+		if err := s.MarkReminderSent(r.Key); err != nil {
+			t.Fatalf("MarkReminderSent failed: %v", err)
+		}
+	}
+	reminders, err = s.GetDueReminders("2024-12-06", ReminderOptions{})
+	if err != nil {
+		t.Fatalf("GetDueReminders failed: %v", err)
+	}
+	if len(reminders) != 0 {
+		t.Errorf("expected sent reminders to be left out, got %+v", reminders)
+	}
+}
@@ -0,0 +1,316 @@
+package portfolio
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"irish-cgt-tracker/internal/models"
+	"irish-cgt-tracker/internal/pdf"
+)
+
+// reportMethodology explains how the report's figures are computed.
+const reportMethodology = `Disposals are matched against the shares held on a first-in, first-out basis (TCA 1997 s.580): each sale uses the oldest lot acquired on or before the sale date first.
+
+Dual-conversion rule: where shares are acquired and disposed of in a foreign currency, Revenue requires the cost and the proceeds to be converted to euro separately, each at the exchange rate of its own date. The cost is converted at the rate on the acquisition (vest) date and the proceeds at the rate on the disposal date, and the gain is the difference between the two euro amounts. The gain is not computed in dollars and converted once, so a movement in the exchange rate between acquisition and disposal forms part of the chargeable gain or allowable loss.
+
+Exchange rates are the European Central Bank euro reference rates for USD, expressed as EUR per 1 USD, for the transaction date or the last rate published before it, as retrieved from the Frankfurter API. Crypto-assets are priced in euro and need no conversion, and lots created by a corporate action keep the rate of the original lot.
+
+The year's gains and losses are netted, unused losses of earlier years are brought forward, and the annual personal exemption of EUR 1,270 is deducted before tax at 33%. Tax on disposals from 1 January to 30 November is due by 15 December, and on disposals in December by 31 January of the following year. Disposals of ETF units are taxed under the exit tax regime and are not included in this computation.`
+
+// reportProvenance shortens the rate provenances for the rates table.
+var reportProvenance = map[string]string{
+	RateProvenanceECB:  "ECB reference rate",
+	RateProvenanceEUR:  "Priced in EUR",
+	RateProvenanceLot:  "Rate of the original lot",
+	RateProvenanceNone: "Not converted",
+}
+
+// WriteCGTReport writes the annual CGT report for a tax year as a PDF: the
+// computation and payment deadlines, a table of disposals with the columns of
+// the settled sales page, the lots matched to each sale, the exchange rates
+// used and a statement of the methodology.
+//
+// Parameters:
+//   - w: The destination of the PDF.
+//   - year: The tax year.
+//
+// Returns:
+//   - An error if the report cannot be built or written.
+func (s *Service) WriteCGTReport(w io.Writer, year int) error {
+	pack, err := s.GetAuditPack(year)
+	if err != nil {
+		return err
+	}
+
+	r := newReportWriter(fmt.Sprintf("Capital Gains Tax Report %d: %s", year, pack.Person))
+	r.title(fmt.Sprintf("Capital Gains Tax Report: Tax Year %d", year))
+	r.text(fmt.Sprintf("%s. Generated %s. Amounts in USD are per the broker; amounts in EUR are converted as described under Methodology.", pack.Person, pack.GeneratedAt))
+
+	ws := pack.Worksheet
+	r.heading("Summary")
+	r.table([]reportColumn{{"Computation", 180, false}, {"EUR", 70, true}}, [][]string{
+		{"Disposals", fmt.Sprint(ws.Disposals)},
+		{"Consideration", centsString(ws.ConsiderationCents)},
+		{"Chargeable gains", centsString(ws.ChargeableGainsCents)},
+		{"Losses in year", centsString(ws.LossesCents)},
+		{"Losses brought forward used", centsString(ws.LossesBroughtForwardCents)},
+		{"Personal exemption", centsString(ws.ExemptionCents)},
+		{"Net chargeable gain", centsString(ws.NetChargeableGainCents)},
+		{fmt.Sprintf("Capital gains tax at %g%%", ws.TaxRate), centsString(ws.TaxCents)},
+		{"Losses carried forward", centsString(ws.LossesCarriedForwardCents)},
+	}, nil)
+	var periods [][]string
+	for _, p := range ws.Periods {
+		periods = append(periods, []string{p.Label, centsString(p.TaxCents), p.DueDate})
+	}
+	r.table([]reportColumn{{"Payment Period", 180, false}, {"Tax (EUR)", 70, true}, {"Due Date", 70, false}}, periods, nil)
+
+	r.heading("Disposals")
+	disposalCols := []reportColumn{
+		{"Date", 46, false}, {"Number of\nShares", 40, true}, {"Sale Price\n(USD)", 44, true}, {"Gain/Loss\n(USD)", 50, true},
+		{"Book Value\n(USD)", 50, true}, {"Exchange Rate\nat Vest", 48, true}, {"Gross Proceed\n(USD)", 54, true},
+		{"Vesting Value\n(USD)", 52, true}, {"Ticker", 36, false}, {"Exchange Rate\nat Sale", 48, true}, {"Euro Sale\n(EUR)", 50, true},
+		{"Euro Gain\n(EUR)", 50, true}, {"CGT Tax Due\n(EUR)", 50, true}, {"Completed\n(Y/N)", 38, false},
+		{"Net Proceeds\n(EUR)", 52, true}, {"Type\n(FIFO/FIFI)", 40, false},
+	}
+	var disposals [][]string
+	var gross, euroSale, euroGain, taxDue, net int64
+	for _, m := range pack.MatchedLots {
+		disposals = append(disposals, []string{
+			m.SaleDate, floatString(m.NumShares), centsString(m.SalePriceUSD), centsString(m.GainLossUSD),
+			centsString(m.BookValueUSD), floatString(m.ExchangeRateAtVest), centsString(m.GrossProceedUSD),
+			centsString(m.VestingValueUSD), m.Ticker, floatString(m.ExchangeRateAtSale), centsString(m.EuroSaleEUR),
+			centsString(m.EuroGainEUR), centsString(m.CGTTaxDueEUR), m.Completed, centsString(m.NetProceedsEUR), m.Type,
+		})
+		gross += m.GrossProceedUSD
+		euroSale += m.EuroSaleEUR
+		euroGain += m.EuroGainEUR
+		taxDue += m.CGTTaxDueEUR
+		net += m.NetProceedsEUR
+	}
+	if len(disposals) == 0 {
+		r.text("No disposals were settled in the year.")
+	} else {
+		total := []string{"Total", "", "", "", "", "", centsString(gross), "", "", "", centsString(euroSale), centsString(euroGain), centsString(taxDue), "", centsString(net), ""}
+		r.table(disposalCols, disposals, total)
+		r.note("CGT Tax Due is the gain on each lot at the CGT rate before losses and the personal exemption; see the Summary for the tax payable.")
+	}
+
+	r.heading("Lot Matching")
+	vests := map[string]models.Vest{}
+	for _, v := range pack.Vests {
+		vests[v.ID] = v
+	}
+	var lots [][]string
+	for _, m := range pack.MatchedLots {
+		v := vests[m.VestID]
+		lots = append(lots, []string{
+			m.SaleDate, m.Ticker, v.Date, v.Source, floatString(m.NumShares),
+			priceString(v.StrikePriceCents, v.ECBRate), floatString(m.ExchangeRateAtVest), centsString(m.EuroSaleEUR - m.EuroGainEUR),
+			centsString(m.SalePriceUSD), floatString(m.ExchangeRateAtSale), centsString(m.EuroSaleEUR), centsString(m.EuroGainEUR),
+		})
+	}
+	if len(lots) == 0 {
+		r.text("No lots were matched in the year.")
+	} else {
+		r.table([]reportColumn{
+			{"Sale Date", 50, false}, {"Ticker", 40, false}, {"Lot Acquired", 54, false}, {"Source", 70, false}, {"Shares", 46, true},
+			{"Cost per\nShare (USD)", 56, true}, {"Rate at\nAcquisition", 54, true}, {"Cost\n(EUR)", 60, true},
+			{"Price per\nShare (USD)", 56, true}, {"Rate at\nSale", 54, true}, {"Proceeds\n(EUR)", 60, true}, {"Gain\n(EUR)", 60, true},
+		}, lots, nil)
+		r.note("Cost (EUR) is the shares at the cost per share converted at the rate on acquisition; Proceeds (EUR) is the shares at the sale price converted at the rate on sale.")
+	}
+
+	r.heading("Exchange Rates Used")
+	labels := map[string]string{}
+	for _, v := range pack.Vests {
+		labels[models.AttachmentVest+" "+v.ID] = fmt.Sprintf("Acquisition of %s %s (%s)", floatString(v.Quantity), v.Symbol, v.Source)
+	}
+	for _, sale := range pack.Sales {
+		labels[models.AttachmentSale+" "+sale.ID] = fmt.Sprintf("Sale of %s %s", floatString(sale.Quantity), sale.Symbol)
+	}
+	for _, a := range pack.CorporateActions {
+		labels["CORPORATE_ACTION "+a.ID] = fmt.Sprintf("Corporate action on %s", a.Symbol)
+	}
+	var rates [][]string
+	for _, rate := range pack.Rates {
+		label, ok := labels[rate.Record]
+		if !ok {
+			label = rate.Record
+		}
+		rates = append(rates, []string{rate.Date, floatString(rate.Rate), reportProvenance[rate.Provenance], label})
+	}
+	if len(rates) == 0 {
+		r.text("No exchange rates were used in the year.")
+	} else {
+		r.table([]reportColumn{{"Date", 60, false}, {"EUR per USD", 60, true}, {"Source", 120, false}, {"Applied to", 300, false}}, rates, nil)
+	}
+
+	r.heading("Methodology")
+	r.text(reportMethodology)
+	if len(pack.ExitTaxDisposals) > 0 {
+		r.text(fmt.Sprintf("%d ETF disposals in the year are reported separately under the exit tax regime.", len(pack.ExitTaxDisposals)))
+	}
+
+	_, err = r.doc.WriteTo(w)
+	return err
+}
+
+// Report layout, in points on an A4 landscape page.
+const (
+	reportMargin   = 36.0
+	reportFontSize = 9.0
+	reportCellSize = 7.0
+	reportLeading  = 1.35
+)
+
+// reportColumn is a column of a report table. Columns are widened to fit
+// their contents, and the table is then narrowed to fit the page if needed.
+type reportColumn struct {
+	Title string // Lines separated by "\n".
+	Width float64
+	Right bool
+}
+
+// reportWriter lays out the report top to bottom, starting new pages as needed.
+type reportWriter struct {
+	doc  *pdf.Document
+	name string
+	y    float64
+}
+
+// newReportWriter starts a report with its first page.
+func newReportWriter(title string) *reportWriter {
+	r := &reportWriter{doc: pdf.New(pdf.A4Height, pdf.A4Width), name: title}
+	r.doc.SetTitle(title)
+	r.newPage()
+	return r
+}
+
+// newPage starts a page with the report's title and page number in the footer.
+func (r *reportWriter) newPage() {
+	r.doc.AddPage()
+	r.y = reportMargin
+	footer := r.doc.Height() - reportMargin/2
+	r.doc.Text(reportMargin, footer, pdf.Regular, 7, r.name)
+	r.doc.TextRight(r.doc.Width()-reportMargin, footer, pdf.Regular, 7, fmt.Sprintf("Page %d", r.doc.PageCount()))
+}
+
+// space ensures there is room for h points on the page, starting a new page if not.
+func (r *reportWriter) space(h float64) {
+	if r.y+h > r.doc.Height()-reportMargin {
+		r.newPage()
+	}
+}
+
+// title writes the report's main heading.
+func (r *reportWriter) title(s string) {
+	r.y += 16
+	r.doc.Text(reportMargin, r.y, pdf.Bold, 16, s)
+	r.y += 10
+}
+
+// heading writes a section heading, keeping it with the start of the section.
+func (r *reportWriter) heading(s string) {
+	r.space(60)
+	r.y += 18
+	r.doc.Text(reportMargin, r.y, pdf.Bold, 12, s)
+	r.doc.Line(reportMargin, r.y+4, r.doc.Width()-reportMargin, r.y+4, 0.5)
+	r.y += 8
+}
+
+// text writes wrapped paragraphs.
+func (r *reportWriter) text(s string) {
+	r.paragraph(reportFontSize, s)
+}
+
+// note writes a small wrapped paragraph below a table.
+func (r *reportWriter) note(s string) {
+	r.paragraph(reportCellSize, s)
+}
+
+// paragraph writes wrapped paragraphs at a font size.
+func (r *reportWriter) paragraph(size float64, s string) {
+	lineHeight := size * reportLeading
+	r.y += 4
+	for _, line := range pdf.Wrap(pdf.Regular, size, r.doc.Width()-2*reportMargin, s) {
+		r.space(lineHeight)
+		r.y += lineHeight
+		r.doc.Text(reportMargin, r.y, pdf.Regular, size, line)
+	}
+}
+
+// table writes a table with a shaded header, repeated on each page, and an
+// optional bold total row.
+func (r *reportWriter) table(cols []reportColumn, rows [][]string, total []string) {
+	widths := make([]float64, len(cols))
+	var width float64
+	headerLines := 1
+	for i, c := range cols {
+		widths[i] = c.Width
+		for _, title := range strings.Split(c.Title, "\n") {
+			widths[i] = max(widths[i], pdf.TextWidth(pdf.Bold, reportCellSize, title)+5)
+		}
+		for _, row := range append(rows, total) {
+			if i < len(row) {
+				widths[i] = max(widths[i], pdf.TextWidth(pdf.Bold, reportCellSize, row[i])+5)
+			}
+		}
+		width += widths[i]
+		headerLines = max(headerLines, strings.Count(c.Title, "\n")+1)
+	}
+	scale := min((r.doc.Width()-2*reportMargin)/width, 1)
+	rowHeight := reportCellSize * reportLeading
+
+	drawRow := func(cells []string, font pdf.Font) {
+		x := reportMargin
+		for i, c := range cols {
+			w := widths[i] * scale
+			if i < len(cells) && cells[i] != "" {
+				if c.Right {
+					r.doc.TextRight(x+w-3, r.y, font, reportCellSize, cells[i])
+				} else {
+					r.doc.Text(x+2, r.y, font, reportCellSize, cells[i])
+				}
+			}
+			x += w
+		}
+	}
+	header := func() {
+		r.doc.FillRect(reportMargin, r.y+2, width*scale, float64(headerLines)*rowHeight+4, 0.9)
+		for line := 0; line < headerLines; line++ {
+			r.y += rowHeight
+			var cells []string
+			for _, c := range cols {
+				titles := strings.Split(c.Title, "\n")
+				cell := ""
+				if line < len(titles) {
+					cell = titles[line]
+				}
+				cells = append(cells, cell)
+			}
+			drawRow(cells, pdf.Bold)
+		}
+		r.y += 4
+	}
+
+	r.y += 4
+	r.space(float64(headerLines+2) * rowHeight)
+	header()
+	for _, row := range rows {
+		if r.y+rowHeight > r.doc.Height()-reportMargin {
+			r.newPage()
+			header()
+		}
+		r.y += rowHeight
+		drawRow(row, pdf.Regular)
+	}
+	if total != nil {
+		r.space(rowHeight + 4)
+		r.doc.Line(reportMargin, r.y+2, reportMargin+width*scale, r.y+2, 0.5)
+		r.y += rowHeight + 2
+		drawRow(total, pdf.Bold)
+	}
+	r.y += 2
+}
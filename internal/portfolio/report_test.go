@@ -0,0 +1,64 @@
+package portfolio
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+)
+
+func TestWriteCGTReport(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 0.9)
+
+	s := NewService(database)
+	s.AddVest("2020-01-10", "ACME", 10, 10000)
+	s.AddVest("2021-01-10", "ACME", 10, 20000)
+	sale, _ := s.AddSale("2024-03-01", "ACME", 15, 40000)
+	if err := s.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := s.WriteCGTReport(&buf, 2024); err != nil {
+		t.Fatalf("WriteCGTReport failed: %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) {
+		t.Fatal("expected a PDF")
+	}
+	text := pdfText(t, buf.Bytes())
+	for _, want := range []string{
+		"(Capital Gains Tax Report: Tax Year 2024)",
+		"(Net chargeable gain)",
+		// Both lots of the sale, then the total proceeds of 15 x 400 x 0.9.
+		"(2020-01-10)", "(2021-01-10)", "(5400.00)",
+		"(Exchange Rates Used)",
+		"(Sale of 15 ACME)",
+		"(Dual-conversion rule:",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in the report", want)
+		}
+	}
+}
+
+// pdfText returns the decompressed content streams of a PDF.
+func pdfText(t *testing.T, data []byte) string {
+	t.Helper()
+	var text strings.Builder
+	for _, m := range regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`).FindAllSubmatch(data, -1) {
+		zr, err := zlib.NewReader(bytes.NewReader(m[1]))
+		if err != nil {
+			t.Fatalf("bad content stream: %v", err)
+		}
+		content, _ := io.ReadAll(zr)
+		text.Write(content)
+	}
+	return text.String()
+}
@@ -0,0 +1,200 @@
+package portfolio
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"irish-cgt-tracker/internal/models"
+)
+
+// TemporaryNonResidenceYears is the length of the anti-avoidance window: gains
+// on assets held at departure and disposed of while non-resident are charged
+// in the year of return if the person resumes residence within this period.
+const TemporaryNonResidenceYears = 5
+
+// Residence statuses recorded in ResidenceFlag.Status.
+const (
+	ResidenceNonResident          = "NON_RESIDENT"
+	ResidenceTemporaryNonResident = "TEMPORARY_NON_RESIDENT"
+)
+
+// ResidenceFlag describes a disposal that was not chargeable in the normal way
+// because the person was neither resident nor ordinarily resident when it was
+// made. All amounts are in EUR cents.
+type ResidenceFlag struct {
+	SaleID    string
+	OwnerID   string
+	Date      string
+	GainCents int64
+	Status    string
+	// ChargeDate is the date the gain is treated as accruing, i.e. the date of
+	// return for a temporary non-resident. It is empty if the gain is not
+	// chargeable, or not yet known to be.
+	ChargeDate string
+}
+
+// AddResidencePeriod records a residence period for the Service's person.
+// Periods of the same person may not overlap.
+//
+// Parameters:
+//   - p: The period details. ID and OwnerID are populated by this method.
+//
+// Returns:
+//   - A pointer to the stored models.ResidencePeriod.
+//   - An error if the dates are invalid, the period overlaps an existing one
+//     or the database insertion fails.
+func (s *Service) AddResidencePeriod(p models.ResidencePeriod) (*models.ResidencePeriod, error) {
+	if _, err := models.ParseDate(p.StartDate); err != nil {
+		return nil, fmt.Errorf("invalid start date: %w", err)
+	}
+	if p.EndDate != "" {
+		if _, err := models.ParseDate(p.EndDate); err != nil {
+			return nil, fmt.Errorf("invalid end date: %w", err)
+		}
+		if p.EndDate < p.StartDate {
+			return nil, fmt.Errorf("a residence period cannot end before it starts")
+		}
+	}
+	p.ID = uuid.New().String()
+	p.OwnerID = s.owner
+	last := 9999
+	if p.EndDate != "" {
+		last = disposalYear(p.EndDate)
+	}
+	if err := s.checkYearsOpen("owner_id = ?", disposalYear(p.StartDate), last, p.OwnerID); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.GetResidencePeriods()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range existing {
+		if e.OwnerID == p.OwnerID && periodsOverlap(e, p) {
+			return nil, fmt.Errorf("the period overlaps the existing period starting %s", e.StartDate)
+		}
+	}
+
+	query := `INSERT INTO residence_periods (id, owner_id, start_date, end_date, resident, ordinarily_resident) VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := s.db.Exec(query, p.ID, p.OwnerID, p.StartDate, p.EndDate, p.Resident, p.OrdinarilyResident); err != nil {
+		return nil, fmt.Errorf("failed to insert residence period: %w", err)
+	}
+	return &p, nil
+}
+
+// GetResidencePeriods retrieves the residence periods of every household
+// member, oldest first.
+func (s *Service) GetResidencePeriods() ([]models.ResidencePeriod, error) {
+	rows, err := s.db.Query(`
+		SELECT id, owner_id, start_date, end_date, resident, ordinarily_resident
+		FROM residence_periods ORDER BY start_date ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var periods []models.ResidencePeriod
+	for rows.Next() {
+		var p models.ResidencePeriod
+		if err := rows.Scan(&p.ID, &p.OwnerID, &p.StartDate, &p.EndDate, &p.Resident, &p.OrdinarilyResident); err != nil {
+			return nil, err
+		}
+		periods = append(periods, p)
+	}
+	return periods, nil
+}
+
+// getChargeableDisposals loads the settled disposals and applies each
+// person's residence timeline. It returns the disposals to include in the
+// annual computation, with temporary non-resident gains moved to the date of
+// return, and a flag for every disposal made while non-resident.
+func (s *Service) getChargeableDisposals() ([]cgtDisposal, []ResidenceFlag, error) {
+	disposals, err := s.getCGTDisposals()
+	if err != nil {
+		return nil, nil, err
+	}
+	periods, err := s.GetResidencePeriods()
+	if err != nil {
+		return nil, nil, err
+	}
+	chargeable, flags := applyResidence(disposals, periods)
+	return chargeable, flags, nil
+}
+
+// applyResidence classifies each disposal against the owner's residence
+// periods. The base cost is never rebased to the market value on arrival in
+// Ireland: a disposal made while resident is computed on the original cost.
+func applyResidence(disposals []cgtDisposal, periods []models.ResidencePeriod) ([]cgtDisposal, []ResidenceFlag) {
+	var chargeable []cgtDisposal
+	var flags []ResidenceFlag
+	for _, d := range disposals {
+		period, ok := periodOn(periods, d.OwnerID, d.Date)
+		if !ok || period.Resident || period.OrdinarilyResident {
+			chargeable = append(chargeable, d)
+			continue
+		}
+
+		flag := ResidenceFlag{SaleID: d.SaleID, OwnerID: d.OwnerID, Date: d.Date, GainCents: d.GainCents, Status: ResidenceNonResident}
+		departure := period.StartDate
+		windowEnd := addYears(departure, TemporaryNonResidenceYears)
+		if d.AcquiredDate != "" && d.AcquiredDate < departure && d.Date < windowEnd {
+			flag.Status = ResidenceTemporaryNonResident
+			if ret := returnDate(periods, d.OwnerID, d.Date); ret != "" && ret < windowEnd {
+				flag.ChargeDate = ret
+				d.Date = ret
+				chargeable = append(chargeable, d)
+			}
+		}
+		flags = append(flags, flag)
+	}
+	return chargeable, flags
+}
+
+// flagsForYear returns the owner's flags for disposals made or charged in a year.
+func flagsForYear(year int, ownerID string, flags []ResidenceFlag) []ResidenceFlag {
+	var out []ResidenceFlag
+	for _, f := range flags {
+		if f.OwnerID == ownerID && (disposalYear(f.Date) == year || disposalYear(f.ChargeDate) == year) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// periodOn returns the owner's residence period covering a date, if any.
+func periodOn(periods []models.ResidencePeriod, ownerID, date string) (models.ResidencePeriod, bool) {
+	for _, p := range periods {
+		if p.OwnerID == ownerID && p.StartDate <= date && (p.EndDate == "" || date <= p.EndDate) {
+			return p, true
+		}
+	}
+	return models.ResidencePeriod{}, false
+}
+
+// returnDate returns the start of the owner's first resident period after a
+// date, or "" if they have not yet returned.
+func returnDate(periods []models.ResidencePeriod, ownerID, date string) string {
+	for _, p := range periods {
+		if p.OwnerID == ownerID && p.StartDate > date && p.Resident {
+			return p.StartDate
+		}
+	}
+	return ""
+}
+
+// periodsOverlap reports whether two residence periods share any day.
+func periodsOverlap(a, b models.ResidencePeriod) bool {
+	aEnds := a.EndDate == "" || b.StartDate <= a.EndDate
+	bEnds := b.EndDate == "" || a.StartDate <= b.EndDate
+	return aEnds && bEnds
+}
+
+// addYears adds whole years to a "YYYY-MM-DD" date, returning the input if it
+// cannot be parsed.
+func addYears(date string, years int) string {
+	t, err := models.ParseDate(date)
+	if err != nil {
+		return date
+	}
+	return t.AddDate(years, 0, 0).Format("2006-01-02")
+}
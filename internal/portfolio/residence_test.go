@@ -0,0 +1,60 @@
+package portfolio
+
+import (
+	"testing"
+
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestApplyResidence(t *testing.T) {
+	periods := []models.ResidencePeriod{
+		{StartDate: "2015-01-01", EndDate: "2020-06-30", Resident: true, OrdinarilyResident: true},
+		{StartDate: "2020-07-01", EndDate: "2023-12-31"},
+		{StartDate: "2024-01-01", Resident: true},
+	}
+	disposals := []cgtDisposal{
+		{SaleID: "resident", Date: "2019-05-01", AcquiredDate: "2016-01-01", GainCents: 100},
+		{SaleID: "temporary", Date: "2021-05-01", AcquiredDate: "2018-01-01", GainCents: 200},
+		{SaleID: "abroad", Date: "2022-03-01", AcquiredDate: "2021-01-01", GainCents: 300},
+		{SaleID: "spouse", OwnerID: "spouse", Date: "2022-03-01", AcquiredDate: "2021-01-01", GainCents: 400},
+	}
+
+	chargeable, flags := applyResidence(disposals, periods)
+	if len(chargeable) != 3 {
+		t.Fatalf("expected 3 chargeable disposals, got %+v", chargeable)
+	}
+	// The temporary non-resident gain is charged in the year of return.
+	if chargeable[1].SaleID != "temporary" || chargeable[1].Date != "2024-01-01" {
+		t.Errorf("expected the temporary non-resident gain to move to the return date, got %+v", chargeable[1])
+	}
+	if len(flags) != 2 {
+		t.Fatalf("expected 2 residence flags, got %+v", flags)
+	}
+	if flags[0].Status != ResidenceTemporaryNonResident || flags[0].ChargeDate != "2024-01-01" {
+		t.Errorf("unexpected temporary non-resident flag: %+v", flags[0])
+	}
+	if flags[1].Status != ResidenceNonResident || flags[1].ChargeDate != "" {
+		t.Errorf("unexpected non-resident flag: %+v", flags[1])
+	}
+
+	if got := flagsForYear(2024, "", flags); len(got) != 1 || got[0].SaleID != "temporary" {
+		t.Errorf("expected the returned gain to be flagged in 2024, got %+v", got)
+	}
+}
+
+func TestAddResidencePeriod_Overlap(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	s := NewService(database)
+	if _, err := s.AddResidencePeriod(models.ResidencePeriod{StartDate: "2020-01-01", EndDate: "2022-12-31"}); err != nil {
+		t.Fatalf("AddResidencePeriod failed: %v", err)
+	}
+	if _, err := s.AddResidencePeriod(models.ResidencePeriod{StartDate: "2022-06-01", Resident: true}); err == nil {
+		t.Error("expected an error for an overlapping period")
+	}
+	if _, err := s.ForPerson("spouse").AddResidencePeriod(models.ResidencePeriod{StartDate: "2022-06-01", Resident: true}); err != nil {
+		t.Errorf("periods of different people may overlap: %v", err)
+	}
+}
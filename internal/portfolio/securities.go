@@ -0,0 +1,51 @@
+package portfolio
+
+import (
+	"fmt"
+
+	"irish-cgt-tracker/internal/models"
+)
+
+// SetSecurity classifies a ticker symbol, replacing any existing classification.
+func (s *Service) SetSecurity(sec models.Security) error {
+	if sec.Symbol == "" {
+		return fmt.Errorf("a security requires a symbol")
+	}
+	switch sec.AssetClass {
+	case models.AssetClassShare, models.AssetClassETF, models.AssetClassCrypto:
+	default:
+		return fmt.Errorf("unknown asset class %q", sec.AssetClass)
+	}
+
+	query := `INSERT OR REPLACE INTO securities (symbol, asset_class, name) VALUES (?, ?, ?)`
+	if _, err := s.db.Exec(query, sec.Symbol, sec.AssetClass, sec.Name); err != nil {
+		return fmt.Errorf("failed to store security %s: %w", sec.Symbol, err)
+	}
+	return nil
+}
+
+// GetSecurities retrieves all classified securities, ordered by symbol.
+func (s *Service) GetSecurities() ([]models.Security, error) {
+	rows, err := s.db.Query("SELECT symbol, asset_class, name FROM securities ORDER BY symbol ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var securities []models.Security
+	for rows.Next() {
+		var sec models.Security
+		if err := rows.Scan(&sec.Symbol, &sec.AssetClass, &sec.Name); err != nil {
+			return nil, err
+		}
+		securities = append(securities, sec)
+	}
+	return securities, nil
+}
+
+// isCrypto reports whether a symbol is classified as a crypto-asset.
+func (s *Service) isCrypto(symbol string) (bool, error) {
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM securities WHERE symbol = ? AND asset_class = ?", symbol, models.AssetClassCrypto).Scan(&n)
+	return n > 0, err
+}
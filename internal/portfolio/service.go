@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"time"
 
 	"github.com/google/uuid"
 	"irish-cgt-tracker/internal/currency"
@@ -12,10 +13,12 @@ import (
 	"irish-cgt-tracker/internal/models"
 )
 
-// `InventoryItem` augments a `Vest` with the calculated remaining quantity.
+// `InventoryItem` augments a `Vest` with the calculated remaining quantity
+// and the asset class of its security.
 type InventoryItem struct {
 	models.Vest
 	RemainingQty float64
+	AssetClass   string
 }
 
 // SaleDTO (Data Transfer Object) is a simple wrapper around the models.Sale struct.
@@ -25,10 +28,27 @@ type SaleDTO struct {
 	models.Sale
 }
 
+// querier is the part of *sql.DB and *sql.Tx used by the Service, so that the
+// same methods can run inside a transaction.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
 // Service provides methods for managing and calculating portfolio data.
 // It encapsulates the core business logic and database interactions.
 type Service struct {
-	db *sql.DB
+	db querier
+	// owner is the household member whose lots and sales this Service records.
+	// The empty string is the primary taxpayer.
+	owner string
+	// rates fetches and caches ECB exchange rates.
+	rates *currency.Client
+	// now returns the current time; it decides which tax years have ended.
+	now func() time.Time
+	// webhooks holds the webhook subscriptions events are queued for.
+	webhooks *webhookSubscriptions
 }
 
 // NewService creates and returns a new Service instance.
@@ -39,7 +59,47 @@ type Service struct {
 // Returns:
 //   - A pointer to the newly created Service.
 func NewService(db *sql.DB) *Service {
-	return &Service{db: db}
+	return &Service{db: db, rates: currency.NewClient(), now: time.Now, webhooks: &webhookSubscriptions{}}
+}
+
+// ForPerson returns a Service that records lots and sales as owned by the given
+// household member. Every other method behaves as on the original Service, and
+// sales are always matched FIFO against lots of the same owner.
+//
+// Parameters:
+//   - personID: The ID of a person created with AddPerson, or "" for the
+//     primary taxpayer.
+//
+// Returns:
+//   - A pointer to a Service sharing the same database connection.
+func (s *Service) ForPerson(personID string) *Service {
+	p := *s
+	p.owner = personID
+	return &p
+}
+
+// inTx runs fn with a Service whose queries share one transaction, committing
+// it if fn succeeds and rolling it back otherwise. A Service already inside a
+// transaction runs fn in that transaction.
+func (s *Service) inTx(fn func(tx *Service) error) error {
+	conn, ok := s.db.(*sql.DB)
+	if !ok {
+		return fn(s)
+	}
+	tx, err := conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	txService := *s
+	txService.db = tx
+	if err := fn(&txService); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
 }
 
 // GetInventory provides a public interface to the getAvailableInventory method.
@@ -54,7 +114,7 @@ func (s *Service) GetInventory() ([]InventoryItem, error) {
 //   - A slice of SaleDTO objects.
 //   - An error if the database query fails.
 func (s *Service) GetAllSales() ([]SaleDTO, error) {
-	rows, err := s.db.Query("SELECT id, date, quantity, price_cents, ecb_rate, is_settled FROM sales ORDER BY date DESC")
+	rows, err := s.db.Query("SELECT id, date, symbol, quantity, price_cents, ecb_rate, is_settled, owner_id FROM sales ORDER BY date DESC")
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +123,7 @@ func (s *Service) GetAllSales() ([]SaleDTO, error) {
 	var sales []SaleDTO
 	for rows.Next() {
 		var item SaleDTO
-		if err := rows.Scan(&item.ID, &item.Date, &item.Quantity, &item.PriceCents, &item.ECBRate, &item.IsSettled); err != nil {
+		if err := rows.Scan(&item.ID, &item.Date, &item.Symbol, &item.Quantity, &item.PriceCents, &item.ECBRate, &item.IsSettled, &item.OwnerID); err != nil {
 			return nil, err
 		}
 		sales = append(sales, item)
@@ -73,7 +133,7 @@ func (s *Service) GetAllSales() ([]SaleDTO, error) {
 
 func (s *Service) GetSettledSales() ([]models.SettledSale, error) {
 	rows, err := s.db.Query(`
-        SELECT sale_date, ticker, num_shares, sale_price_usd, gain_loss_usd, book_value_usd,
+        SELECT COALESCE(sale_id, ''), COALESCE(vest_id, ''), owner_id, sale_date, ticker, num_shares, sale_price_usd, gain_loss_usd, book_value_usd,
                exchange_rate_at_vest, gross_proceed_usd, vesting_value_usd, exchange_rate_at_sale,
                euro_sale_eur, euro_gain_eur, cgt_tax_due_eur, completed, net_proceeds_eur, type
         FROM settled_sales ORDER BY sale_date DESC
@@ -87,7 +147,7 @@ func (s *Service) GetSettledSales() ([]models.SettledSale, error) {
 	for rows.Next() {
 		var ss models.SettledSale
 		err := rows.Scan(
-			&ss.SaleDate, &ss.Ticker, &ss.NumShares, &ss.SalePriceUSD, &ss.GainLossUSD, &ss.BookValueUSD,
+			&ss.SaleID, &ss.VestID, &ss.OwnerID, &ss.SaleDate, &ss.Ticker, &ss.NumShares, &ss.SalePriceUSD, &ss.GainLossUSD, &ss.BookValueUSD,
 			&ss.ExchangeRateAtVest, &ss.GrossProceedUSD, &ss.VestingValueUSD, &ss.ExchangeRateAtSale,
 			&ss.EuroSaleEUR, &ss.EuroGainEUR, &ss.CGTTaxDueEUR, &ss.Completed, &ss.NetProceedsEUR, &ss.Type,
 		)
@@ -113,7 +173,7 @@ func (s *Service) GetSettledSales() ([]models.SettledSale, error) {
 //   - A pointer to the newly created models.Vest object.
 //   - An error if the exchange rate cannot be fetched or the database insertion fails.
 func (s *Service) AddVest(date string, symbol string, qty float64, strikePriceCents int64) (*models.Vest, error) {
-	rate, err := currency.FetchUSDToEUR(date)
+	rate, err := s.transactionRate("vest of "+symbol, date)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch exchange rate for %s: %w", date, err)
 	}
@@ -125,12 +185,11 @@ func (s *Service) AddVest(date string, symbol string, qty float64, strikePriceCe
 		Quantity:         qty,
 		StrikePriceCents: strikePriceCents,
 		ECBRate:          rate,
+		Source:           models.SourceRSU,
 	}
 
-	query := `INSERT INTO vests (id, date, symbol, quantity, strike_price_cents, ecb_rate) VALUES (?, ?, ?, ?, ?, ?)`
-	_, err = s.db.Exec(query, vest.ID, vest.Date, vest.Symbol, vest.Quantity, vest.StrikePriceCents, vest.ECBRate)
-	if err != nil {
-		return nil, fmt.Errorf("failed to insert vest: %w", err)
+	if err := s.insertVest(vest); err != nil {
+		return nil, err
 	}
 
 	log.Printf("Vest recorded: %f shares of %s on %s @ %.4f EUR/USD", qty, symbol, date, rate)
@@ -144,14 +203,15 @@ func (s *Service) AddVest(date string, symbol string, qty float64, strikePriceCe
 //
 // Parameters:
 //   - date: The sale date in "YYYY-MM-DD" format.
+//   - symbol: The stock ticker sold. Leave empty to match lots of any symbol.
 //   - qty: The number of shares sold.
 //   - priceCents: The sale price per share in USD cents.
 //
 // Returns:
 //   - A pointer to the newly created models.Sale object.
 //   - An error if the exchange rate cannot be fetched or the database insertion fails.
-func (s *Service) AddSale(date string, qty float64, priceCents int64) (*models.Sale, error) {
-	rate, err := currency.FetchUSDToEUR(date)
+func (s *Service) AddSale(date string, symbol string, qty float64, priceCents int64) (*models.Sale, error) {
+	rate, err := s.transactionRate("sale of "+symbol, date)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch exchange rate for %s: %w", date, err)
 	}
@@ -159,16 +219,15 @@ func (s *Service) AddSale(date string, qty float64, priceCents int64) (*models.S
 	sale := &models.Sale{
 		ID:         uuid.New().String(),
 		Date:       date,
+		Symbol:     symbol,
 		Quantity:   qty,
 		PriceCents: priceCents,
 		ECBRate:    rate,
 		IsSettled:  false,
 	}
 
-	query := `INSERT INTO sales (id, date, quantity, price_cents, ecb_rate, is_settled) VALUES (?, ?, ?, ?, ?, ?)`
-	_, err = s.db.Exec(query, sale.ID, sale.Date, sale.Quantity, sale.PriceCents, sale.ECBRate, sale.IsSettled)
-	if err != nil {
-		return nil, fmt.Errorf("failed to insert sale: %w", err)
+	if err := s.insertSale(sale); err != nil {
+		return nil, err
 	}
 
 	log.Printf("Sale recorded: %f shares on %s @ %.4f EUR/USD", qty, date, rate)
@@ -178,23 +237,69 @@ func (s *Service) AddSale(date string, qty float64, priceCents int64) (*models.S
 // getSale retrieves a single sale record by its ID. This is an internal helper function.
 func (s *Service) getSale(id string) (*models.Sale, error) {
 	var sale models.Sale
-	row := s.db.QueryRow("SELECT id, date, quantity, price_cents, ecb_rate, is_settled FROM sales WHERE id = ?", id)
-	if err := row.Scan(&sale.ID, &sale.Date, &sale.Quantity, &sale.PriceCents, &sale.ECBRate, &sale.IsSettled); err != nil {
+	row := s.db.QueryRow("SELECT id, date, symbol, quantity, price_cents, ecb_rate, is_settled, owner_id FROM sales WHERE id = ?", id)
+	if err := row.Scan(&sale.ID, &sale.Date, &sale.Symbol, &sale.Quantity, &sale.PriceCents, &sale.ECBRate, &sale.IsSettled, &sale.OwnerID); err != nil {
 		return nil, err
 	}
 	return &sale, nil
 }
 
+// insertSale persists a disposal to the sales table. It is shared by every flow
+// that records a disposal so that they all settle through SettleSale. Sales
+// without an owner are recorded against the Service's person.
+func (s *Service) insertSale(sale *models.Sale) error {
+	if sale.OwnerID == "" {
+		sale.OwnerID = s.owner
+	}
+	if err := s.checkYearOpen(sale.OwnerID, sale.Date); err != nil {
+		return err
+	}
+	query := `INSERT INTO sales (id, date, symbol, quantity, price_cents, ecb_rate, is_settled, owner_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.Exec(query, sale.ID, sale.Date, sale.Symbol, sale.Quantity, sale.PriceCents, sale.ECBRate, sale.IsSettled, sale.OwnerID)
+	if err != nil {
+		return fmt.Errorf("failed to insert sale: %w", err)
+	}
+	s.ForPerson(sale.OwnerID).emit(models.EventSaleAdded, sale)
+	return nil
+}
+
+// insertVest persists a lot to the vests table. It is shared by every flow that
+// creates an acquisition lot so that they all feed the owner's FIFO pool. Lots
+// without an owner are recorded against the Service's person.
+func (s *Service) insertVest(vest *models.Vest) error {
+	if vest.OwnerID == "" {
+		vest.OwnerID = s.owner
+	}
+	if err := s.checkYearOpen(vest.OwnerID, vest.Date); err != nil {
+		return err
+	}
+	query := `INSERT INTO vests (id, date, symbol, quantity, strike_price_cents, ecb_rate, source, parent_id, owner_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	var parentID interface{}
+	if vest.ParentID != "" {
+		parentID = vest.ParentID
+	}
+	_, err := s.db.Exec(query, vest.ID, vest.Date, vest.Symbol, vest.Quantity, vest.StrikePriceCents, vest.ECBRate, vest.Source, parentID, vest.OwnerID)
+	if err != nil {
+		return fmt.Errorf("failed to insert vest: %w", err)
+	}
+	s.ForPerson(vest.OwnerID).emit(models.EventVestAdded, vest)
+	return nil
+}
+
 // getAvailableInventory calculates the current inventory of unsold shares.
 // It queries all vests and joins with the sale_lots table to determine how many
-// shares from each vest have been sold. It returns a list of vests that still
+// shares from each vest have been sold, also subtracting any shares moved out
+// of a lot by a lot adjustment (e.g. a corporate action). It returns a list of vests that still
 // have a positive remaining quantity, ordered by date (oldest first) to support FIFO.
 func (s *Service) getAvailableInventory() ([]InventoryItem, error) {
 	query := `
 		SELECT
-			v.id, v.date, v.symbol, v.quantity, v.strike_price_cents, v.ecb_rate,
-			COALESCE(SUM(sl.quantity), 0) as used_qty
+			v.id, v.date, v.symbol, v.quantity, v.strike_price_cents, v.ecb_rate, v.owner_id,
+			COALESCE(sec.asset_class, 'SHARE') as asset_class,
+			COALESCE(SUM(sl.quantity), 0) +
+			COALESCE((SELECT SUM(la.quantity) FROM lot_adjustments la WHERE la.vest_id = v.id), 0) as used_qty
 		FROM vests v
+		LEFT JOIN securities sec ON sec.symbol = v.symbol
 		LEFT JOIN sale_lots sl ON v.id = sl.vest_id
 		GROUP BY v.id
 		ORDER BY v.date ASC`
@@ -208,18 +313,50 @@ func (s *Service) getAvailableInventory() ([]InventoryItem, error) {
 	for rows.Next() {
 		var item InventoryItem
 		var usedQty float64
-		if err := rows.Scan(&item.ID, &item.Date, &item.Symbol, &item.Quantity, &item.StrikePriceCents, &item.ECBRate, &usedQty); err != nil {
+		if err := rows.Scan(&item.ID, &item.Date, &item.Symbol, &item.Quantity, &item.StrikePriceCents, &item.ECBRate, &item.OwnerID, &item.AssetClass, &usedQty); err != nil {
 			return nil, err
 		}
 		item.RemainingQty = item.Quantity - usedQty
 
-		if item.RemainingQty > 0 {
+		if item.RemainingQty > quantityEpsilon { // Ignore floating point dust left by fractional lots
 			inventory = append(inventory, item)
 		}
 	}
 	return inventory, nil
 }
 
+// getInventoryForSymbol returns the available inventory, restricted to lots of the
+// given symbol. An empty symbol returns lots of every symbol.
+func (s *Service) getInventoryForSymbol(symbol string) ([]InventoryItem, error) {
+	inventory, err := s.getAvailableInventory()
+	if err != nil || symbol == "" {
+		return inventory, err
+	}
+	var filtered []InventoryItem
+	for _, item := range inventory {
+		if item.Symbol == symbol {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered, nil
+}
+
+// getInventoryForOwner returns the available inventory of a symbol restricted
+// to the lots of one household member, which form that person's FIFO pool.
+func (s *Service) getInventoryForOwner(ownerID, symbol string) ([]InventoryItem, error) {
+	inventory, err := s.getInventoryForSymbol(symbol)
+	if err != nil {
+		return nil, err
+	}
+	var filtered []InventoryItem
+	for _, item := range inventory {
+		if item.OwnerID == ownerID {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered, nil
+}
+
 // saveLot records the link between a sale and a vest for a specific quantity of shares.
 // This is an internal helper function called by the SettleSale calculator.
 func (s *Service) saveLot(saleID, vestID string, qty float64) error {
@@ -235,6 +372,9 @@ func (s *Service) markSaleSettled(saleID string) error {
 }
 
 // ImportVests parses a CSV of RSU releases and adds them to the portfolio.
+// Each release is reconciled against the scheduled tranches of its grant, and
+// a release whose order number is already reconciled is skipped, so importing
+// the same statement twice does not duplicate its lots.
 func (s *Service) ImportVests(r io.Reader, symbol string) error {
 	vests, err := importer.ParseVestCSV(r)
 	if err != nil {
@@ -242,7 +382,20 @@ func (s *Service) ImportVests(r io.Reader, symbol string) error {
 	}
 
 	for _, vest := range vests {
-		if _, err := s.AddVest(vest.Date, symbol, vest.Quantity, vest.StrikePriceCents); err != nil {
+		reconciled, err := s.releaseReconciled(vest.OrderNumber)
+		if err != nil {
+			return err
+		}
+		if reconciled {
+			log.Printf("Release %s of %s on %s is already recorded", vest.OrderNumber, symbol, vest.Date)
+			continue
+		}
+		recorded, err := s.AddVest(vest.Date, symbol, vest.Quantity, vest.StrikePriceCents)
+		if err != nil {
+			return err
+		}
+		recorded.OrderNumber, recorded.Plan = vest.OrderNumber, vest.Plan
+		if err := s.reconcileRelease(recorded); err != nil {
 			return err
 		}
 	}
@@ -251,14 +404,15 @@ func (s *Service) ImportVests(r io.Reader, symbol string) error {
 }
 
 // ImportSales parses a CSV of sales and adds them to the portfolio.
-func (s *Service) ImportSales(r io.Reader) error {
+// The symbol may be left empty when the broker export covers a single security.
+func (s *Service) ImportSales(r io.Reader, symbol string) error {
 	sales, err := importer.ParseSaleCSV(r)
 	if err != nil {
 		return err
 	}
 
 	for _, sale := range sales {
-		if _, err := s.AddSale(sale.Date, sale.Quantity, sale.PriceCents); err != nil {
+		if _, err := s.AddSale(sale.Date, symbol, sale.Quantity, sale.PriceCents); err != nil {
 			return err
 		}
 	}
@@ -3,6 +3,7 @@ package portfolio
 import (
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -29,8 +30,10 @@ func TestAddVest(t *testing.T) {
 
 	s := NewService(db)
 
+	mock.ExpectQuery("SELECT MIN\\(year\\) FROM closed_years").
+		WillReturnRows(sqlmock.NewRows([]string{"year"}).AddRow(nil))
 	mock.ExpectExec("INSERT INTO vests").
-		WithArgs(sqlmock.AnyArg(), "2024-01-01", "TEST", 100.0, int64(10000), 0.9).
+		WithArgs(sqlmock.AnyArg(), "2024-01-01", "TEST", 100.0, int64(10000), 0.9, "RSU", nil, "").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	_, err = s.AddVest("2024-01-01", "TEST", 100.0, 10000)
@@ -52,11 +55,11 @@ func TestGetAllSales(t *testing.T) {
 
 	s := NewService(db)
 
-	rows := sqlmock.NewRows([]string{"id", "date", "quantity", "price_cents", "ecb_rate", "is_settled"}).
-		AddRow("sale1", "2024-02-01", 100.0, 15000, 0.9, false).
-		AddRow("sale2", "2024-03-01", 50.0, 16000, 0.95, true)
+	rows := sqlmock.NewRows([]string{"id", "date", "symbol", "quantity", "price_cents", "ecb_rate", "is_settled", "owner_id"}).
+		AddRow("sale1", "2024-02-01", "TEST", 100.0, 15000, 0.9, false, "").
+		AddRow("sale2", "2024-03-01", "TEST", 50.0, 16000, 0.95, true, "")
 
-	mock.ExpectQuery("SELECT id, date, quantity, price_cents, ecb_rate, is_settled FROM sales ORDER BY date DESC").
+	mock.ExpectQuery("SELECT id, date, symbol, quantity, price_cents, ecb_rate, is_settled, owner_id FROM sales ORDER BY date DESC").
 		WillReturnRows(rows)
 
 	sales, err := s.GetAllSales()
@@ -73,6 +76,38 @@ func TestGetAllSales(t *testing.T) {
 	}
 }
 
+func TestGetSettledSales(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	s := NewService(db)
+
+	rows := sqlmock.NewRows([]string{"sale_id", "vest_id", "owner_id", "sale_date", "ticker", "num_shares", "sale_price_usd",
+		"gain_loss_usd", "book_value_usd", "exchange_rate_at_vest", "gross_proceed_usd", "vesting_value_usd", "exchange_rate_at_sale",
+		"euro_sale_eur", "euro_gain_eur", "cgt_tax_due_eur", "completed", "net_proceeds_eur", "type"}).
+		AddRow("sale1", "vest1", "spouse", "2024-03-01", "TEST", 10.0, 15000, 50000, 100000, 0.9, 150000, 100000, 0.95,
+			142500, 52500, 17325, "Y", 125175, "FIFO")
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(sale_id, ''), COALESCE(vest_id, ''), owner_id, sale_date, ticker")).
+		WillReturnRows(rows)
+
+	sales, err := s.GetSettledSales()
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if len(sales) != 1 || sales[0].OwnerID != "spouse" {
+		t.Errorf("expected the settled lot to keep its owner, got %+v", sales)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
 func TestAddSale(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -93,11 +128,13 @@ func TestAddSale(t *testing.T) {
 
 	s := NewService(db)
 
+	mock.ExpectQuery("SELECT MIN\\(year\\) FROM closed_years").
+		WillReturnRows(sqlmock.NewRows([]string{"year"}).AddRow(nil))
 	mock.ExpectExec("INSERT INTO sales").
-		WithArgs(sqlmock.AnyArg(), "2024-02-01", 50.0, int64(12000), 0.9, false).
+		WithArgs(sqlmock.AnyArg(), "2024-02-01", "TEST", 50.0, int64(12000), 0.9, false, "").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	_, err = s.AddSale("2024-02-01", 50.0, 12000)
+	_, err = s.AddSale("2024-02-01", "TEST", 50.0, 12000)
 	if err != nil {
 		t.Errorf("unexpected error: %s", err)
 	}
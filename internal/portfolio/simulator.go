@@ -0,0 +1,206 @@
+package portfolio
+
+import (
+	"fmt"
+	"math"
+
+	"irish-cgt-tracker/internal/models"
+)
+
+// SimulatedLot is the portion of a hypothetical sale matched against one lot.
+type SimulatedLot struct {
+	Lot    InventoryItem
+	Shares float64
+	// Settled is the dual-currency breakdown SettleSale would store for the lot.
+	Settled models.SettledSale
+	// ExitTax is set instead of Settled for ETF lots.
+	ExitTax *models.ExitTaxDisposal
+}
+
+// SaleSimulation is the outcome of a hypothetical sale. All EUR amounts are in
+// cents; Before and After are the seller's CGT position for the tax year of
+// the sale without and with it.
+type SaleSimulation struct {
+	Date       string
+	Symbol     string
+	Quantity   float64
+	PriceCents int64
+	ECBRate    float64
+	Lots       []SimulatedLot
+	// GrossEURCents is the sale value of every lot before fees and tax.
+	GrossEURCents int64
+	// FeeEURCents is the dealing cost deducted from the proceeds.
+	FeeEURCents int64
+	// ProceedsEURCents and GainEURCents cover the lots chargeable to CGT, net of fees.
+	ProceedsEURCents int64
+	GainEURCents     int64
+	// ExitTaxCents is the exit tax due on any ETF lots.
+	ExitTaxCents int64
+	Before       CGTSummary
+	After        CGTSummary
+	// disposals are the CGT disposals the sale would add, for callers that
+	// chain several simulations.
+	disposals []cgtDisposal
+}
+
+// AdditionalTaxCents returns the extra CGT the sale would add to the year's bill.
+func (s SaleSimulation) AdditionalTaxCents() int64 {
+	return s.After.TaxCents - s.Before.TaxCents
+}
+
+// NetProceedsCents returns what the seller keeps after fees, the additional
+// CGT and any exit tax.
+func (s SaleSimulation) NetProceedsCents() int64 {
+	return s.GrossEURCents - s.FeeEURCents - s.AdditionalTaxCents() - s.ExitTaxCents
+}
+
+// SimulateSale runs the same FIFO matching and dual-currency calculation as
+// SettleSale for a hypothetical sale, without persisting anything.
+//
+// Parameters:
+//   - date: The intended sale date in "YYYY-MM-DD" format.
+//   - symbol: The security to sell. Leave empty to match lots of any symbol.
+//   - qty: The number of shares to sell.
+//   - priceCents: The expected sale price per share in USD cents (EUR cents for crypto-assets).
+//
+// Returns:
+//   - The SaleSimulation, including the matched lots and the effect on the
+//     year's exemption, losses and CGT due by payment period.
+//   - An error if there are insufficient shares, the exchange rate cannot be
+//     fetched or the database query fails.
+func (s *Service) SimulateSale(date, symbol string, qty float64, priceCents int64) (*SaleSimulation, error) {
+	if _, err := models.ParseDate(date); err != nil {
+		return nil, fmt.Errorf("invalid sale date: %w", err)
+	}
+	if qty <= 0 {
+		return nil, fmt.Errorf("the quantity to sell must be positive")
+	}
+
+	in, err := s.loadSimulationInputs(symbol)
+	if err != nil {
+		return nil, err
+	}
+	sale := &models.Sale{Date: date, Symbol: symbol, Quantity: qty, PriceCents: priceCents, OwnerID: s.owner}
+	matches, unmatched := matchFIFO(sale, in.inventory)
+	if unmatched > quantityEpsilon {
+		return nil, fmt.Errorf("insufficient shares available: %f shares could not be matched", unmatched)
+	}
+
+	rate := 1.0
+	if !allCrypto(matches) {
+		if rate, err = s.rates.FetchUSDToEUR(date); err != nil {
+			return nil, fmt.Errorf("failed to fetch exchange rate for %s: %w", date, err)
+		}
+	}
+	return s.simulate(in, date, symbol, qty, priceCents, rate, 0)
+}
+
+// simulationInputs is the state a simulation reads from the database, loaded
+// once so that callers such as SolveNetProceeds can run many simulations.
+type simulationInputs struct {
+	inventory []InventoryItem
+	disposals []cgtDisposal
+	periods   []models.ResidencePeriod
+	deemed    map[string][]models.ExitTaxDisposal
+}
+
+// loadSimulationInputs loads the Service's person's open lots of the symbol,
+// all CGT disposals, the residence timeline and the recorded deemed disposals
+// of ETF lots.
+func (s *Service) loadSimulationInputs(symbol string) (simulationInputs, error) {
+	var in simulationInputs
+	var err error
+	if in.inventory, err = s.getInventoryForOwner(s.owner, symbol); err != nil {
+		return in, fmt.Errorf("could not retrieve inventory: %w", err)
+	}
+	if in.disposals, err = s.getCGTDisposals(); err != nil {
+		return in, err
+	}
+	if in.periods, err = s.GetResidencePeriods(); err != nil {
+		return in, err
+	}
+	if in.deemed, err = s.getDeemedDisposals(); err != nil {
+		return in, err
+	}
+	return in, nil
+}
+
+// simulate matches a hypothetical sale against the loaded inventory at the
+// given rate. feeCents, in EUR cents, is an incidental cost of disposal: it is
+// apportioned across the lots by shares and deducted from proceeds and gains.
+func (s *Service) simulate(in simulationInputs, date, symbol string, qty float64, priceCents int64, rate float64, feeCents int64) (*SaleSimulation, error) {
+	sale := &models.Sale{Date: date, Symbol: symbol, Quantity: qty, PriceCents: priceCents, ECBRate: rate, OwnerID: s.owner}
+	matches, unmatched := matchFIFO(sale, in.inventory)
+	if unmatched > quantityEpsilon {
+		return nil, fmt.Errorf("insufficient shares available: %f shares could not be matched", unmatched)
+	}
+
+	sim := &SaleSimulation{
+		Date:          date,
+		Symbol:        symbol,
+		Quantity:      qty,
+		PriceCents:    priceCents,
+		ECBRate:       rate,
+		GrossEURCents: int64(math.Round(float64(priceCents) * rate * qty)),
+		FeeEURCents:   feeCents,
+	}
+	var simulated []cgtDisposal
+	for _, m := range matches {
+		fee := float64(feeCents) * m.Shares / qty
+		lot := SimulatedLot{Lot: m.Lot, Shares: m.Shares}
+		if m.Lot.AssetClass == models.AssetClassETF {
+			proceeds := models.PriceEUR(sale.PriceCents, sale.ECBRate)*m.Shares - fee
+			unitCost, taxPaid := etfUnitCost(&m.Lot.Vest, in.deemed[m.Lot.ID], date)
+			d := creditDeemedTax(exitTaxDisposal("", &m.Lot.Vest, date, m.Shares, proceeds, unitCost*m.Shares, "DISPOSAL"), taxPaid)
+			lot.ExitTax = &d
+			sim.ExitTaxCents += d.TaxCents
+		} else {
+			lot.Settled = computeSettledSale(sale, &m.Lot.Vest, m.Shares)
+			proceeds := lot.Settled.EuroSaleEUR - int64(math.Round(fee))
+			gain := lot.Settled.EuroGainEUR - int64(math.Round(fee))
+			sim.ProceedsEURCents += proceeds
+			sim.GainEURCents += gain
+			simulated = append(simulated, cgtDisposal{
+				SaleID:        "simulated",
+				OwnerID:       s.owner,
+				Date:          date,
+				AcquiredDate:  m.Lot.Date,
+				ProceedsCents: proceeds,
+				GainCents:     gain,
+			})
+		}
+		sim.Lots = append(sim.Lots, lot)
+	}
+
+	year := disposalYear(date)
+	sim.Before = s.ownSummary(year, in.disposals, in.periods)
+	disposals := append(append([]cgtDisposal(nil), in.disposals...), simulated...)
+	sim.After = s.ownSummary(year, disposals, in.periods)
+	sim.disposals = simulated
+	return sim, nil
+}
+
+// ownSummary computes the Service's person's CGT summary for a year from the
+// given disposals after applying their residence timeline.
+func (s *Service) ownSummary(year int, disposals []cgtDisposal, periods []models.ResidencePeriod) CGTSummary {
+	chargeable, flags := applyResidence(disposals, periods)
+	var own []cgtDisposal
+	for _, d := range chargeable {
+		if d.OwnerID == s.owner {
+			own = append(own, d)
+		}
+	}
+	summary := computeCGTSummary(year, own, 0)
+	summary.ResidenceFlags = flagsForYear(year, s.owner, flags)
+	return summary
+}
+
+// allCrypto reports whether every matched lot is a crypto-asset priced in EUR.
+func allCrypto(matches []lotMatch) bool {
+	for _, m := range matches {
+		if m.Lot.AssetClass != models.AssetClassCrypto {
+			return false
+		}
+	}
+	return len(matches) > 0
+}
@@ -0,0 +1,85 @@
+package portfolio
+
+import (
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestSimulateSale(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	if _, err := s.AddVest("2022-01-10", "ACME", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	if _, err := s.AddVest("2023-01-10", "ACME", 10, 20000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	sale, _ := s.AddSale("2024-02-01", "ACME", 5, 20000)
+	if err := s.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+
+	// 5 left in the first lot ($100) and 10 in the second ($200), sold at $400.
+	sim, err := s.SimulateSale("2024-12-05", "ACME", 10, 40000)
+	if err != nil {
+		t.Fatalf("SimulateSale failed: %v", err)
+	}
+	if len(sim.Lots) != 2 || sim.Lots[0].Shares != 5 || sim.Lots[1].Shares != 5 {
+		t.Fatalf("unexpected FIFO matching: %+v", sim.Lots)
+	}
+	if sim.GainEURCents != 250000 {
+		t.Errorf("expected a gain of 250000 cents, got %d", sim.GainEURCents)
+	}
+
+	// The earlier 500 EUR gain is covered by the exemption; the simulated sale
+	// uses the remaining 770 of it and falls in the later payment period.
+	if sim.Before.TaxCents != 0 || sim.Before.ExemptionCents != 50000 {
+		t.Errorf("unexpected position before the sale: %+v", sim.Before)
+	}
+	if sim.After.ExemptionCents != AnnualExemptionCents || sim.After.ChargeableCents != 173000 {
+		t.Errorf("unexpected position after the sale: %+v", sim.After)
+	}
+	if sim.AdditionalTaxCents() != 57090 || sim.After.Later.TaxCents != 57090 {
+		t.Errorf("unexpected tax effect: %d total, %d later", sim.AdditionalTaxCents(), sim.After.Later.TaxCents)
+	}
+
+	// Nothing is persisted.
+	inventory, _ := s.GetInventory()
+	if len(inventory) != 2 || inventory[0].RemainingQty != 5 {
+		t.Errorf("simulation changed the inventory: %+v", inventory)
+	}
+
+	if _, err := s.SimulateSale("2024-12-05", "ACME", 100, 40000); err == nil {
+		t.Error("expected an error when selling more shares than held")
+	}
+}
+
+func TestSimulateSale_Crypto(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 0.9)
+
+	s := NewService(database)
+	if _, err := s.RecordCryptoTrade(models.CryptoTradeRecord{Date: "2024-01-05", Type: models.CryptoBuy, Asset: "BTC", Quantity: 1, ValueEURCents: 2000000}); err != nil {
+		t.Fatalf("RecordCryptoTrade failed: %v", err)
+	}
+
+	// Half a BTC at EUR 50,000 against a cost of EUR 20,000, with no USD rate.
+	sim, err := s.SimulateSale("2024-06-01", "BTC", 0.5, 5000000)
+	if err != nil {
+		t.Fatalf("SimulateSale failed: %v", err)
+	}
+	if sim.ECBRate != 1 || len(sim.Lots) != 1 {
+		t.Fatalf("unexpected simulation: %+v", sim)
+	}
+	lot := sim.Lots[0]
+	if models.UnitPrice(lot.Lot.StrikePriceCents, lot.Lot.ECBRate) != 2000000 || lot.Settled.EuroSaleEUR != 2500000 || lot.Settled.EuroGainEUR != 1500000 {
+		t.Errorf("unexpected crypto lot: cost %d at %v, %+v", lot.Lot.StrikePriceCents, lot.Lot.ECBRate, lot.Settled)
+	}
+}
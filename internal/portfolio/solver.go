@@ -0,0 +1,142 @@
+package portfolio
+
+import (
+	"fmt"
+	"math"
+
+	"irish-cgt-tracker/internal/models"
+)
+
+// solverIterations bounds the bisection used for fractional quantities, which
+// narrows the bracket well below quantityEpsilon for any realistic holding.
+const solverIterations = 100
+
+// SolveNetProceeds finds the smallest quantity to sell so that, after fees,
+// the additional CGT and any exit tax, the seller receives at least the target
+// net amount in EUR.
+//
+// Each candidate quantity is run through the same FIFO matching and
+// dual-currency calculation as SimulateSale, so lot-by-lot gains, losses and
+// the remaining annual exemption for the tax year are all taken into account.
+// Shares are sold in whole units; crypto-assets may be sold fractionally.
+//
+// Parameters:
+//   - date: The intended sale date in "YYYY-MM-DD" format.
+//   - symbol: The security to sell. Leave empty to match lots of any symbol.
+//   - targetNetCents: The net amount wanted, in EUR cents.
+//   - priceCents: The expected sale price per share in USD cents (EUR cents for crypto-assets).
+//   - rate: The USD to EUR rate to apply. If zero, today's ECB rate is used.
+//   - feeCents: The dealing costs of the sale, in EUR cents.
+//
+// Returns:
+//   - The SaleSimulation for the quantity found.
+//   - An error if the inputs are invalid, selling the whole holding would not
+//     reach the target, the exchange rate cannot be fetched or the database
+//     query fails.
+func (s *Service) SolveNetProceeds(date, symbol string, targetNetCents, priceCents int64, rate float64, feeCents int64) (*SaleSimulation, error) {
+	if _, err := models.ParseDate(date); err != nil {
+		return nil, fmt.Errorf("invalid sale date: %w", err)
+	}
+	if targetNetCents <= 0 || priceCents <= 0 {
+		return nil, fmt.Errorf("the target and price must be positive")
+	}
+	if rate < 0 || feeCents < 0 {
+		return nil, fmt.Errorf("the rate and fees cannot be negative")
+	}
+
+	in, err := s.loadSimulationInputs(symbol)
+	if err != nil {
+		return nil, err
+	}
+	var available []lotMatch
+	var held float64
+	for _, item := range in.inventory {
+		if item.Date <= date {
+			available = append(available, lotMatch{Lot: item, Shares: item.RemainingQty})
+			held += item.RemainingQty
+		}
+	}
+	if held <= quantityEpsilon {
+		return nil, fmt.Errorf("no shares available to sell on %s", date)
+	}
+
+	crypto := allCrypto(available)
+	if rate, err = s.assumedRate(rate, crypto); err != nil {
+		return nil, err
+	}
+
+	net := func(qty float64) (*SaleSimulation, error) {
+		return s.simulate(in, date, symbol, qty, priceCents, rate, feeCents)
+	}
+
+	whole, err := net(held)
+	if err != nil {
+		return nil, err
+	}
+	if whole.NetProceedsCents() < targetNetCents {
+		return nil, fmt.Errorf("selling all %g shares would only raise %.2f EUR net", held, float64(whole.NetProceedsCents())/100)
+	}
+
+	// Net proceeds never fall as more is sold (tax is charged at less than
+	// 100% of the gain), so bisect for the smallest sufficient quantity with
+	// net(lo) short of the target and net(hi) reaching it.
+	lo, hi := 0.0, held
+	if crypto {
+		for i := 0; i < solverIterations && hi-lo > quantityEpsilon; i++ {
+			mid := (lo + hi) / 2
+			sim, err := net(mid)
+			if err != nil {
+				return nil, err
+			}
+			if sim.NetProceedsCents() >= targetNetCents {
+				hi = mid
+			} else {
+				lo = mid
+			}
+		}
+		return net(hi)
+	}
+
+	// A fractional remainder (e.g. from a stock dividend) can only be sold by
+	// selling the whole holding.
+	wholeShares := math.Floor(held + quantityEpsilon)
+	if wholeShares < 1 {
+		return whole, nil
+	}
+	if sim, err := net(math.Min(wholeShares, held)); err != nil {
+		return nil, err
+	} else if sim.NetProceedsCents() < targetNetCents {
+		return whole, nil
+	}
+	hi = math.Min(wholeShares, held)
+	for hi-lo > 1 {
+		mid := math.Floor((lo + hi) / 2)
+		sim, err := net(mid)
+		if err != nil {
+			return nil, err
+		}
+		if sim.NetProceedsCents() >= targetNetCents {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return net(hi)
+}
+
+// assumedRate returns the USD to EUR rate to use for a hypothetical sale:
+// 1.0 for crypto-assets (priced in EUR), the given rate if set, or otherwise
+// today's ECB rate.
+func (s *Service) assumedRate(rate float64, crypto bool) (float64, error) {
+	switch {
+	case crypto:
+		return 1.0, nil
+	case rate > 0:
+		return rate, nil
+	}
+	rate, err := s.rates.TodayUSDToEUR()
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch today's exchange rate: %w", err)
+	}
+	return rate, nil
+}
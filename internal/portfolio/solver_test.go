@@ -0,0 +1,54 @@
+package portfolio
+
+import (
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+)
+
+func TestSolveNetProceeds(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	if _, err := s.AddVest("2022-01-10", "ACME", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	if _, err := s.AddVest("2023-01-10", "ACME", 10, 20000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+
+	// At $400 and a rate of 1.0 the first lot gains 300 EUR a share and the
+	// second 200. Four shares gain 1,200 EUR, inside the exemption, so net is
+	// 1,600 less the 10 EUR fee, short of the 1,700 target.
+	sim, err := s.SolveNetProceeds("2024-06-01", "ACME", 170000, 40000, 1.0, 1000)
+	if err != nil {
+		t.Fatalf("SolveNetProceeds failed: %v", err)
+	}
+	if sim.Quantity != 5 {
+		t.Fatalf("expected to sell 5 shares, got %f", sim.Quantity)
+	}
+	// Gain of 1,500 less the 10 EUR fee leaves 230 - 10 = 220 chargeable.
+	if sim.AdditionalTaxCents() != 7260 || sim.NetProceedsCents() != 200000-1000-7260 {
+		t.Errorf("unexpected net position: tax %d, net %d", sim.AdditionalTaxCents(), sim.NetProceedsCents())
+	}
+
+	// Crossing into the second lot: 11 shares net 3,763.10 EUR after 636.90
+	// of CGT, so 12 are needed for 4,000 EUR net.
+	sim, err = s.SolveNetProceeds("2024-06-01", "ACME", 400000, 40000, 1.0, 0)
+	if err != nil {
+		t.Fatalf("SolveNetProceeds failed: %v", err)
+	}
+	if sim.Quantity != 12 || len(sim.Lots) != 2 {
+		t.Errorf("expected 12 shares across both lots, got %f across %d", sim.Quantity, len(sim.Lots))
+	}
+	if fewer, _ := s.SimulateSale("2024-06-01", "ACME", sim.Quantity-1, 40000); fewer.NetProceedsCents() >= 400000 {
+		t.Errorf("a smaller sale already reaches the target: %d", fewer.NetProceedsCents())
+	}
+
+	if _, err := s.SolveNetProceeds("2024-06-01", "ACME", 10000000, 40000, 1.0, 0); err == nil {
+		t.Error("expected an error for a target above the whole holding")
+	}
+}
@@ -0,0 +1,232 @@
+package portfolio
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"irish-cgt-tracker/internal/models"
+)
+
+const (
+	// CGTRate is the standard rate of Capital Gains Tax.
+	CGTRate = 0.33
+	// AnnualExemptionCents is the personal annual exemption of €1,270, in EUR cents.
+	AnnualExemptionCents = 127000
+)
+
+// PeriodSummary is the CGT position for one of the two payment periods of a tax year.
+type PeriodSummary struct {
+	// Label describes the period, e.g. "Initial (1 Jan - 30 Nov)".
+	Label string
+	// DueDate is the payment deadline for the period in "YYYY-MM-DD" format.
+	DueDate string
+	// GainsCents and LossesCents are the gains and losses realised in the period.
+	GainsCents  int64
+	LossesCents int64
+	// TaxCents is the CGT payable by DueDate.
+	TaxCents int64
+}
+
+// CGTSummary is the annual Capital Gains Tax computation for one tax year.
+// All amounts are in EUR cents; losses are stored as positive numbers.
+type CGTSummary struct {
+	Year int
+	// Disposals is the number of disposals (sales or part disposals) in the year.
+	Disposals int
+	// ConsiderationCents is the total EUR disposal proceeds.
+	ConsiderationCents int64
+	// GainsCents and LossesCents are the gross gains and losses for the year.
+	GainsCents  int64
+	LossesCents int64
+	// LossesBroughtForwardCents is the unused loss available from earlier years,
+	// and LossesUsedCents the part of it set against this year's gains.
+	LossesBroughtForwardCents int64
+	LossesUsedCents           int64
+	// ExemptionCents is the portion of the annual exemption used.
+	ExemptionCents int64
+	// ChargeableCents is the net chargeable gain after losses and exemption.
+	ChargeableCents int64
+	// TaxCents is the total CGT due for the year.
+	TaxCents int64
+	// LossesCarriedForwardCents is the unused loss available to later years.
+	LossesCarriedForwardCents int64
+	// SpouseLossesCents is a jointly assessed spouse's current-year loss set
+	// against this year's gains, and LossesToSpouseCents is the part of this
+	// person's current-year loss used that way. Both are zero outside a
+	// household computation with loss sharing.
+	SpouseLossesCents   int64
+	LossesToSpouseCents int64
+	// ResidenceFlags lists the disposals realised or charged in the year that
+	// were affected by the person's residence status.
+	ResidenceFlags []ResidenceFlag
+	// Initial and Later split the tax between the two payment periods.
+	Initial PeriodSummary
+	Later   PeriodSummary
+}
+
+// Periods returns the initial and later payment periods in order.
+func (s CGTSummary) Periods() []PeriodSummary {
+	return []PeriodSummary{s.Initial, s.Later}
+}
+
+// cgtDisposal is a single chargeable disposal as fed into the annual computation.
+type cgtDisposal struct {
+	SaleID        string
+	OwnerID       string
+	Date          string
+	AcquiredDate  string
+	ProceedsCents int64
+	GainCents     int64
+	// AssetClass is the security's classification; it is only loaded from
+	// settled sales, for the return worksheet.
+	AssetClass string
+}
+
+// GetCGTSummary computes the CGT position for a tax year from the settled sales
+// of the Service's person. Losses from earlier years are carried forward
+// automatically.
+func (s *Service) GetCGTSummary(year int) (CGTSummary, error) {
+	disposals, err := s.getCGTDisposals()
+	if err != nil {
+		return CGTSummary{}, err
+	}
+	periods, err := s.GetResidencePeriods()
+	if err != nil {
+		return CGTSummary{}, err
+	}
+	return s.ownSummary(year, disposals, periods), nil
+}
+
+// getCGTDisposals loads every settled lot as a disposal, oldest first.
+func (s *Service) getCGTDisposals() ([]cgtDisposal, error) {
+	rows, err := s.db.Query(`
+		SELECT COALESCE(ss.sale_id, ''), ss.owner_id, ss.sale_date, COALESCE(v.date, ''), ss.euro_sale_eur, ss.euro_gain_eur,
+		       COALESCE(sec.asset_class, ?)
+		FROM settled_sales ss
+		LEFT JOIN vests v ON v.id = ss.vest_id
+		LEFT JOIN securities sec ON sec.symbol = ss.ticker
+		ORDER BY ss.sale_date ASC`, models.AssetClassShare)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var disposals []cgtDisposal
+	for rows.Next() {
+		var d cgtDisposal
+		if err := rows.Scan(&d.SaleID, &d.OwnerID, &d.Date, &d.AcquiredDate, &d.ProceedsCents, &d.GainCents, &d.AssetClass); err != nil {
+			return nil, err
+		}
+		disposals = append(disposals, d)
+	}
+	return disposals, nil
+}
+
+// computeCGTSummary computes the summary for the given year, walking forward
+// from the earliest disposal so that unused losses are carried into later
+// years. openingLossesCents is any loss available before the first disposal.
+func computeCGTSummary(year int, disposals []cgtDisposal, openingLossesCents int64) CGTSummary {
+	byYear, firstYear := disposalsByYear(year, disposals)
+
+	lossesBF := openingLossesCents
+	var summary CGTSummary
+	for y := firstYear; y <= year; y++ {
+		summary = summariseYear(y, byYear[y], lossesBF)
+		lossesBF = summary.LossesCarriedForwardCents
+	}
+	return summary
+}
+
+// disposalsByYear groups the disposals up to and including year by tax year,
+// returning the groups and the earliest year with a disposal.
+func disposalsByYear(year int, disposals []cgtDisposal) (map[int][]cgtDisposal, int) {
+	byYear := map[int][]cgtDisposal{}
+	firstYear := year
+	for _, d := range disposals {
+		y := disposalYear(d.Date)
+		if y == 0 || y > year {
+			continue
+		}
+		byYear[y] = append(byYear[y], d)
+		if y < firstYear {
+			firstYear = y
+		}
+	}
+	return byYear, firstYear
+}
+
+// summariseYear applies the Irish ordering for a single year: current-year
+// losses first, then losses brought forward, then the annual exemption.
+// The initial period (1 Jan - 30 Nov) is computed as if the year ended on
+// 30 November; the later period (December) pays the balance.
+func summariseYear(year int, disposals []cgtDisposal, lossesBF int64) CGTSummary {
+	summary := CGTSummary{
+		Year:                      year,
+		LossesBroughtForwardCents: lossesBF,
+		Initial: PeriodSummary{
+			Label:   "Initial (1 Jan - 30 Nov)",
+			DueDate: fmt.Sprintf("%d-12-15", year),
+		},
+		Later: PeriodSummary{
+			Label:   "Later (1 Dec - 31 Dec)",
+			DueDate: fmt.Sprintf("%d-01-31", year+1),
+		},
+	}
+
+	sales := map[string]bool{}
+	for _, d := range disposals {
+		period := &summary.Initial
+		if d.Date[5:7] == "12" {
+			period = &summary.Later
+		}
+		if d.GainCents >= 0 {
+			period.GainsCents += d.GainCents
+		} else {
+			period.LossesCents += -d.GainCents
+		}
+		summary.ConsiderationCents += d.ProceedsCents
+		key := d.SaleID
+		if key == "" {
+			key = d.Date
+		}
+		sales[key] = true
+	}
+	summary.Disposals = len(sales)
+	summary.GainsCents = summary.Initial.GainsCents + summary.Later.GainsCents
+	summary.LossesCents = summary.Initial.LossesCents + summary.Later.LossesCents
+
+	net := summary.GainsCents - summary.LossesCents
+	if net > 0 {
+		summary.LossesUsedCents = min(lossesBF, net)
+	}
+	afterLosses := max(net-summary.LossesUsedCents, 0)
+	summary.ExemptionCents = min(afterLosses, AnnualExemptionCents)
+	summary.ChargeableCents = afterLosses - summary.ExemptionCents
+	summary.TaxCents = taxOn(summary.ChargeableCents)
+	summary.LossesCarriedForwardCents = lossesBF - summary.LossesUsedCents + max(-net, 0)
+
+	initialNet := summary.Initial.GainsCents - summary.Initial.LossesCents
+	initialChargeable := max(initialNet-lossesBF-AnnualExemptionCents, 0)
+	summary.Initial.TaxCents = min(taxOn(initialChargeable), summary.TaxCents)
+	summary.Later.TaxCents = summary.TaxCents - summary.Initial.TaxCents
+
+	return summary
+}
+
+// taxOn returns the CGT due on a chargeable gain, rounded to the cent.
+func taxOn(chargeableCents int64) int64 {
+	return int64(math.Round(float64(chargeableCents) * CGTRate))
+}
+
+// disposalYear extracts the year from a "YYYY-MM-DD" date, returning 0 if invalid.
+func disposalYear(date string) int {
+	if len(date) < 4 {
+		return 0
+	}
+	y, err := strconv.Atoi(date[:4])
+	if err != nil {
+		return 0
+	}
+	return y
+}
@@ -0,0 +1,36 @@
+package portfolio
+
+import "testing"
+
+func TestComputeCGTSummary(t *testing.T) {
+	disposals := []cgtDisposal{
+		{SaleID: "a", Date: "2023-05-01", ProceedsCents: 500000, GainCents: -300000},
+		{SaleID: "b", Date: "2024-03-01", ProceedsCents: 1000000, GainCents: 800000},
+		{SaleID: "b", Date: "2024-03-01", ProceedsCents: 200000, GainCents: -100000},
+		{SaleID: "c", Date: "2024-12-10", ProceedsCents: 300000, GainCents: 200000},
+	}
+
+	prior := computeCGTSummary(2023, disposals, 0)
+	if prior.TaxCents != 0 || prior.LossesCarriedForwardCents != 300000 {
+		t.Errorf("expected a 3000 EUR loss carried forward from 2023, got %+v", prior)
+	}
+
+	s := computeCGTSummary(2024, disposals, 0)
+	if s.Disposals != 2 || s.ConsiderationCents != 1500000 {
+		t.Errorf("unexpected disposal totals: %d disposals, %d consideration", s.Disposals, s.ConsiderationCents)
+	}
+	// Net gain 9000 - 3000 b/f - 1270 exemption = 4730 chargeable.
+	if s.LossesUsedCents != 300000 || s.ExemptionCents != AnnualExemptionCents || s.ChargeableCents != 473000 {
+		t.Errorf("unexpected computation: %+v", s)
+	}
+	if s.TaxCents != 156090 {
+		t.Errorf("expected tax of 156090 cents, got %d", s.TaxCents)
+	}
+	// Initial period: 7000 - 3000 - 1270 = 2730 chargeable; December pays the balance.
+	if s.Initial.TaxCents != 90090 || s.Later.TaxCents != 66000 {
+		t.Errorf("unexpected period split: initial %d, later %d", s.Initial.TaxCents, s.Later.TaxCents)
+	}
+	if s.Initial.DueDate != "2024-12-15" || s.Later.DueDate != "2025-01-31" {
+		t.Errorf("unexpected due dates: %s / %s", s.Initial.DueDate, s.Later.DueDate)
+	}
+}
@@ -0,0 +1,363 @@
+package portfolio
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"irish-cgt-tracker/internal/models"
+)
+
+// YearDelta compares a closed year's computation as filed with the current
+// figures. All amounts are in EUR cents; each delta is current less filed.
+type YearDelta struct {
+	Closure models.YearClosure
+	Filed   *CGTWorksheet
+	Current *CGTWorksheet
+	// Amendment is the amendment in progress, if the year has been reopened.
+	Amendment *models.YearAmendment
+
+	ConsiderationDeltaCents        int64
+	NetChargeableGainDeltaCents    int64
+	TaxDeltaCents                  int64
+	LossesCarriedForwardDeltaCents int64
+}
+
+// Changed reports whether the current figures differ from those filed.
+func (d YearDelta) Changed() bool {
+	return d.ConsiderationDeltaCents != 0 || d.NetChargeableGainDeltaCents != 0 ||
+		d.TaxDeltaCents != 0 || d.LossesCarriedForwardDeltaCents != 0
+}
+
+// CloseYear closes a tax year for the Service's person once the return is
+// filed. It snapshots the year's worksheet and locks the year, so vests, sales,
+// corporate actions, transfers and residence periods dated in it can no longer
+// be recorded and its sales can no longer be settled or unsettled.
+//
+// Closing a year reopened by ReopenYear completes the amendment: the new
+// figures replace the snapshot and the amended tax is recorded.
+//
+// Parameters:
+//   - year: The tax year, which must have ended.
+//
+// Returns:
+//   - The YearClosure.
+//   - An error if the year has not ended, is already closed, has unsettled
+//     sales or a database update fails.
+func (s *Service) CloseYear(year int) (*models.YearClosure, error) {
+	if year >= s.now().Year() {
+		return nil, fmt.Errorf("tax year %d has not ended", year)
+	}
+	existing, err := s.getYearClosure(year)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.Locked {
+		return nil, fmt.Errorf("tax year %d is already closed", year)
+	}
+
+	var unsettled int
+	err = s.db.QueryRow("SELECT COUNT(*) FROM sales WHERE owner_id = ? AND is_settled = 0 AND date LIKE ?",
+		s.owner, fmt.Sprintf("%d-%%", year)).Scan(&unsettled)
+	if err != nil {
+		return nil, err
+	}
+	if unsettled > 0 {
+		return nil, fmt.Errorf("settle the %d unsettled sales in %d before closing the year", unsettled, year)
+	}
+
+	ws, err := s.GetCGTWorksheet(year)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := json.Marshal(ws)
+	if err != nil {
+		return nil, err
+	}
+	closure := &models.YearClosure{
+		OwnerID:  s.owner,
+		Year:     year,
+		ClosedAt: s.now().UTC().Format(time.RFC3339),
+		Locked:   true,
+		TaxCents: ws.TaxCents,
+	}
+	err = s.inTx(func(tx *Service) error {
+		_, err := tx.db.Exec(`INSERT OR REPLACE INTO closed_years (owner_id, year, closed_at, locked, tax_cents, snapshot) VALUES (?, ?, ?, ?, ?, ?)`,
+			closure.OwnerID, closure.Year, closure.ClosedAt, closure.Locked, closure.TaxCents, string(snapshot))
+		if err != nil {
+			return fmt.Errorf("failed to close tax year: %w", err)
+		}
+		if existing != nil {
+			_, err = tx.db.Exec(`UPDATE year_amendments SET closed_at = ?, amended_tax_cents = ? WHERE owner_id = ? AND year = ? AND closed_at = ''`,
+				closure.ClosedAt, closure.TaxCents, s.owner, year)
+			if err != nil {
+				return fmt.Errorf("failed to record amendment: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.emit(models.EventYearClosed, closure)
+	return closure, nil
+}
+
+// ReopenYear unlocks a closed tax year so that its return can be amended. The
+// filed snapshot is kept, so GetYearDelta shows the effect of each change on
+// the tax due until CloseYear is called again.
+//
+// Parameters:
+//   - year: The closed tax year.
+//   - reason: Why the return is being amended.
+//
+// Returns:
+//   - The YearAmendment in progress.
+//   - An error if the year is not closed, no reason is given or a database
+//     update fails.
+func (s *Service) ReopenYear(year int, reason string) (*models.YearAmendment, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, fmt.Errorf("a reason is required to amend a closed year")
+	}
+	closure, err := s.getYearClosure(year)
+	if err != nil {
+		return nil, err
+	}
+	if closure == nil || !closure.Locked {
+		return nil, fmt.Errorf("tax year %d is not closed", year)
+	}
+
+	amendment := &models.YearAmendment{
+		ID:            uuid.New().String(),
+		OwnerID:       s.owner,
+		Year:          year,
+		Reason:        reason,
+		ReopenedAt:    s.now().UTC().Format(time.RFC3339),
+		FiledTaxCents: closure.TaxCents,
+	}
+	_, err = s.db.Exec(`INSERT INTO year_amendments (id, owner_id, year, reason, reopened_at, filed_tax_cents) VALUES (?, ?, ?, ?, ?, ?)`,
+		amendment.ID, amendment.OwnerID, amendment.Year, amendment.Reason, amendment.ReopenedAt, amendment.FiledTaxCents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record amendment: %w", err)
+	}
+	if _, err := s.db.Exec("UPDATE closed_years SET locked = 0 WHERE owner_id = ? AND year = ?", s.owner, year); err != nil {
+		return nil, fmt.Errorf("failed to reopen tax year: %w", err)
+	}
+	return amendment, nil
+}
+
+// GetYearClosures retrieves the Service's person's closed years, newest first.
+func (s *Service) GetYearClosures() ([]models.YearClosure, error) {
+	rows, err := s.db.Query(`SELECT owner_id, year, closed_at, locked, tax_cents FROM closed_years WHERE owner_id = ? ORDER BY year DESC`, s.owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var closures []models.YearClosure
+	for rows.Next() {
+		var c models.YearClosure
+		if err := rows.Scan(&c.OwnerID, &c.Year, &c.ClosedAt, &c.Locked, &c.TaxCents); err != nil {
+			return nil, err
+		}
+		closures = append(closures, c)
+	}
+	return closures, nil
+}
+
+// GetYearAmendments retrieves the Service's person's amendments, newest first.
+func (s *Service) GetYearAmendments() ([]models.YearAmendment, error) {
+	rows, err := s.db.Query(`
+		SELECT id, owner_id, year, reason, reopened_at, closed_at, filed_tax_cents, amended_tax_cents
+		FROM year_amendments WHERE owner_id = ? ORDER BY reopened_at DESC`, s.owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var amendments []models.YearAmendment
+	for rows.Next() {
+		var a models.YearAmendment
+		if err := rows.Scan(&a.ID, &a.OwnerID, &a.Year, &a.Reason, &a.ReopenedAt, &a.ClosedAt, &a.FiledTaxCents, &a.AmendedTaxCents); err != nil {
+			return nil, err
+		}
+		amendments = append(amendments, a)
+	}
+	return amendments, nil
+}
+
+// GetYearDelta compares a closed year's filed computation with the current
+// figures. A change to an earlier open year can still alter a closed year
+// through the losses carried forward, so a locked year may also show a delta.
+//
+// Parameters:
+//   - year: The closed tax year.
+//
+// Returns:
+//   - The YearDelta.
+//   - An error if the year is not closed or a database query fails.
+func (s *Service) GetYearDelta(year int) (*YearDelta, error) {
+	closure, err := s.getYearClosure(year)
+	if err != nil {
+		return nil, err
+	}
+	if closure == nil {
+		return nil, fmt.Errorf("tax year %d is not closed", year)
+	}
+
+	var snapshot string
+	err = s.db.QueryRow("SELECT snapshot FROM closed_years WHERE owner_id = ? AND year = ?", s.owner, year).Scan(&snapshot)
+	if err != nil {
+		return nil, err
+	}
+	var filed CGTWorksheet
+	if err := json.Unmarshal([]byte(snapshot), &filed); err != nil {
+		return nil, fmt.Errorf("invalid snapshot for %d: %w", year, err)
+	}
+	current, err := s.GetCGTWorksheet(year)
+	if err != nil {
+		return nil, err
+	}
+
+	delta := &YearDelta{
+		Closure:                        *closure,
+		Filed:                          &filed,
+		Current:                        current,
+		ConsiderationDeltaCents:        current.ConsiderationCents - filed.ConsiderationCents,
+		NetChargeableGainDeltaCents:    current.NetChargeableGainCents - filed.NetChargeableGainCents,
+		TaxDeltaCents:                  current.TaxCents - filed.TaxCents,
+		LossesCarriedForwardDeltaCents: current.LossesCarriedForwardCents - filed.LossesCarriedForwardCents,
+	}
+	if !closure.Locked {
+		amendments, err := s.GetYearAmendments()
+		if err != nil {
+			return nil, err
+		}
+		for i := range amendments {
+			if amendments[i].Year == year && amendments[i].ClosedAt == "" {
+				delta.Amendment = &amendments[i]
+				break
+			}
+		}
+	}
+	return delta, nil
+}
+
+// GetYearDeltas compares every closed year of the Service's person with its
+// filed computation, newest first.
+func (s *Service) GetYearDeltas() ([]YearDelta, error) {
+	closures, err := s.GetYearClosures()
+	if err != nil {
+		return nil, err
+	}
+	var deltas []YearDelta
+	for _, c := range closures {
+		delta, err := s.GetYearDelta(c.Year)
+		if err != nil {
+			return nil, err
+		}
+		deltas = append(deltas, *delta)
+	}
+	return deltas, nil
+}
+
+// UnsettleSale reverses the settlement of a sale, removing its matched lots and
+// tax calculations so that it can be settled again, for example after a
+// back-dated vest is recorded while amending a year. Later sales matched
+// against the same security must be unsettled first, as FIFO matching depends
+// on the order of settlement.
+//
+// Parameters:
+//   - saleID: The settled sale.
+//
+// Returns:
+//   - An error if the sale is not settled, its year is closed, a later sale
+//     depends on it or a database update fails.
+func (s *Service) UnsettleSale(saleID string) error {
+	sale, err := s.getSale(saleID)
+	if err != nil {
+		return fmt.Errorf("could not retrieve sale %s: %w", saleID, err)
+	}
+	if !sale.IsSettled {
+		return fmt.Errorf("sale %s is not settled", saleID)
+	}
+	if err := s.checkYearOpen(sale.OwnerID, sale.Date); err != nil {
+		return err
+	}
+
+	var later int
+	err = s.db.QueryRow(`
+		SELECT COUNT(DISTINCT s.id) FROM sales s
+		JOIN sale_lots sl ON sl.sale_id = s.id
+		JOIN vests v ON v.id = sl.vest_id
+		WHERE s.owner_id = ? AND s.id != ? AND s.is_settled = 1 AND (s.date > ? OR (s.date = ? AND s.rowid > (SELECT rowid FROM sales WHERE id = ?)))
+		  AND v.symbol IN (SELECT v2.symbol FROM sale_lots sl2 JOIN vests v2 ON v2.id = sl2.vest_id WHERE sl2.sale_id = ?)`,
+		sale.OwnerID, sale.ID, sale.Date, sale.Date, sale.ID, sale.ID).Scan(&later)
+	if err != nil {
+		return err
+	}
+	if later > 0 {
+		return fmt.Errorf("%d later sales were matched against the same security; unsettle them first", later)
+	}
+
+	err = s.inTx(func(tx *Service) error {
+		for _, query := range []string{
+			"DELETE FROM sale_lots WHERE sale_id = ?",
+			"DELETE FROM settled_sales WHERE sale_id = ?",
+			"DELETE FROM exit_tax_disposals WHERE sale_id = ?",
+			"UPDATE sales SET is_settled = 0 WHERE id = ?",
+		} {
+			if _, err := tx.db.Exec(query, sale.ID); err != nil {
+				return fmt.Errorf("failed to unsettle sale: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sale.IsSettled = false
+	s.ForPerson(sale.OwnerID).emit(models.EventSaleUnsettled, sale)
+	return nil
+}
+
+// getYearClosure retrieves the Service's person's closure of a year, or nil if
+// the year has not been closed.
+func (s *Service) getYearClosure(year int) (*models.YearClosure, error) {
+	var c models.YearClosure
+	err := s.db.QueryRow("SELECT owner_id, year, closed_at, locked, tax_cents FROM closed_years WHERE owner_id = ? AND year = ?", s.owner, year).
+		Scan(&c.OwnerID, &c.Year, &c.ClosedAt, &c.Locked, &c.TaxCents)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// checkYearOpen returns an error if the tax year of the date is locked for
+// the person.
+func (s *Service) checkYearOpen(ownerID, date string) error {
+	year := disposalYear(date)
+	return s.checkYearsOpen("owner_id = ?", year, year, ownerID)
+}
+
+// checkYearsOpen returns an error if any tax year from first to last is
+// locked for the people matching the condition.
+func (s *Service) checkYearsOpen(condition string, first, last int, args ...any) error {
+	var year sql.NullInt64
+	args = append(args, first, last)
+	err := s.db.QueryRow("SELECT MIN(year) FROM closed_years WHERE locked = 1 AND "+condition+" AND year BETWEEN ? AND ?", args...).Scan(&year)
+	if err != nil {
+		return err
+	}
+	if year.Valid {
+		return fmt.Errorf("tax year %d is closed; reopen it to amend the return first", year.Int64)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package portfolio
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestCloseAndAmendYear(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	if _, err := s.AddVest("2020-01-10", "ACME", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	sale, _ := s.AddSale("2024-03-01", "ACME", 10, 40000)
+
+	s.now = func() time.Time { return time.Date(2024, 12, 31, 12, 0, 0, 0, time.UTC) }
+	if _, err := s.CloseYear(2024); err == nil || !strings.Contains(err.Error(), "not ended") {
+		t.Errorf("expected a year in progress to stay open, got %v", err)
+	}
+	s.now = func() time.Time { return time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC) }
+
+	if _, err := s.CloseYear(2024); err == nil || !strings.Contains(err.Error(), "unsettled") {
+		t.Errorf("expected unsettled sales to block closing, got %v", err)
+	}
+	if err := s.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+
+	// A 3,000 gain less the 1,270 exemption is taxed at 33%.
+	closure, err := s.CloseYear(2024)
+	if err != nil {
+		t.Fatalf("CloseYear failed: %v", err)
+	}
+	if !closure.Locked || closure.TaxCents != 57090 || closure.ClosedAt != "2025-01-02T12:00:00Z" {
+		t.Errorf("unexpected closure: %+v", closure)
+	}
+	if _, err := s.CloseYear(2024); err == nil {
+		t.Error("expected an error closing a closed year")
+	}
+
+	// The year's transactions are locked, for every kind of record.
+	if _, err := s.AddVest("2024-02-01", "ACME", 5, 20000); err == nil {
+		t.Error("expected a vest in a closed year to be refused")
+	}
+	if _, err := s.AddSale("2024-06-01", "ACME", 1, 40000); err == nil {
+		t.Error("expected a sale in a closed year to be refused")
+	}
+	if err := s.UnsettleSale(sale.ID); err == nil {
+		t.Error("expected unsettling a sale in a closed year to be refused")
+	}
+	if _, err := s.AddResidencePeriod(models.ResidencePeriod{StartDate: "2023-01-01"}); err == nil {
+		t.Error("expected an open-ended residence period covering a closed year to be refused")
+	}
+	if _, err := s.AddVest("2025-01-10", "ACME", 1, 10000); err != nil {
+		t.Errorf("expected later years to stay open: %v", err)
+	}
+	// Another person's year is unaffected.
+	spouse, _ := s.AddPerson("Spouse")
+	if _, err := s.ForPerson(spouse.ID).AddVest("2024-02-01", "ACME", 1, 10000); err != nil {
+		t.Errorf("expected another person's year to stay open: %v", err)
+	}
+
+	// Amend: reopen, record a missed vest acquired before the sale and settle again.
+	if _, err := s.ReopenYear(2024, ""); err == nil {
+		t.Error("expected a reason to be required")
+	}
+	if _, err := s.ReopenYear(2024, "Missed ESPP lot"); err != nil {
+		t.Fatalf("ReopenYear failed: %v", err)
+	}
+	if _, err := s.AddVest("2019-06-01", "ACME", 10, 30000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	if err := s.UnsettleSale(sale.ID); err != nil {
+		t.Fatalf("UnsettleSale failed: %v", err)
+	}
+	if err := s.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+
+	// The sale now matches the $300 lot: a 1,000 gain, fully exempt.
+	delta, err := s.GetYearDelta(2024)
+	if err != nil {
+		t.Fatalf("GetYearDelta failed: %v", err)
+	}
+	if delta.Amendment == nil || delta.Amendment.Reason != "Missed ESPP lot" || !delta.Changed() {
+		t.Errorf("expected an amendment in progress: %+v", delta)
+	}
+	if delta.Filed.TaxCents != 57090 || delta.Current.TaxCents != 0 || delta.TaxDeltaCents != -57090 || delta.NetChargeableGainDeltaCents != -173000 {
+		t.Errorf("unexpected delta: tax %d -> %d, delta %d, gain delta %d", delta.Filed.TaxCents, delta.Current.TaxCents, delta.TaxDeltaCents, delta.NetChargeableGainDeltaCents)
+	}
+
+	if _, err := s.CloseYear(2024); err != nil {
+		t.Fatalf("CloseYear failed: %v", err)
+	}
+	amendments, _ := s.GetYearAmendments()
+	if len(amendments) != 1 || amendments[0].ClosedAt == "" || amendments[0].FiledTaxCents != 57090 || amendments[0].AmendedTaxCents != 0 {
+		t.Errorf("unexpected amendments: %+v", amendments)
+	}
+	if delta, _ := s.GetYearDelta(2024); delta.Changed() || delta.Amendment != nil {
+		t.Errorf("expected no delta once the amendment is filed: %+v", delta)
+	}
+}
+
+func TestUnsettleSaleRequiresLaterSalesFirst(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	s.AddVest("2020-01-10", "ACME", 10, 10000)
+	first, _ := s.AddSale("2023-03-01", "ACME", 4, 40000)
+	second, _ := s.AddSale("2024-03-01", "ACME", 4, 40000)
+	s.SettleSale(first.ID)
+	s.SettleSale(second.ID)
+
+	if err := s.UnsettleSale(first.ID); err == nil {
+		t.Error("expected the later sale to block unsettling")
+	}
+	if err := s.UnsettleSale(second.ID); err != nil {
+		t.Fatalf("UnsettleSale failed: %v", err)
+	}
+	if err := s.UnsettleSale(first.ID); err != nil {
+		t.Fatalf("UnsettleSale failed: %v", err)
+	}
+	inventory, _ := s.GetInventory()
+	if len(inventory) != 1 || inventory[0].RemainingQty != 10 {
+		t.Errorf("expected the lot to be restored, got %+v", inventory)
+	}
+}
+
+func TestCloseYearIsAtomic(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	if _, err := s.CloseYear(2023); err != nil {
+		t.Fatalf("CloseYear failed: %v", err)
+	}
+	if _, err := s.ReopenYear(2023, "Missed dividend"); err != nil {
+		t.Fatalf("ReopenYear failed: %v", err)
+	}
+
+	// If the amendment cannot be completed the year must stay open.
+	if _, err := database.Exec("DROP TABLE year_amendments"); err != nil {
+		t.Fatalf("failed to drop table: %v", err)
+	}
+	if _, err := s.CloseYear(2023); err == nil {
+		t.Fatal("expected closing to fail")
+	}
+	if closure, _ := s.getYearClosure(2023); closure == nil || closure.Locked {
+		t.Errorf("expected the year to stay reopened, got %+v", closure)
+	}
+}
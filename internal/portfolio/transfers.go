@@ -0,0 +1,464 @@
+package portfolio
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/google/uuid"
+	"irish-cgt-tracker/internal/models"
+)
+
+// RecordTransfer records shares moving into or out of the portfolio other
+// than by a purchase or sale.
+//
+//   - A gift or inheritance received creates a lot acquired at market value on
+//     the transfer date.
+//   - A spouse transfer in creates a lot for each of the spouse's lots, with
+//     its original acquisition date and cost, converted at the ECB rate on that
+//     original date.
+//   - A gift made is a disposal at market value: a sale is recorded and settled
+//     FIFO so that the gain is included in the CGT computation.
+//   - A spouse transfer out is at no gain/no loss: shares are removed from the
+//     oldest lots via lot adjustments without any disposal being recorded.
+//
+// When the spouse is a household member, the shares move into their pool: a
+// transfer out creates a matching lot for them from each lot given up, keeping
+// its date, cost and rate, and a linked transfer in is recorded on their side.
+// A transfer in from a household spouse is recorded as their transfer out.
+// Everything is recorded in a single transaction.
+//
+// Parameters:
+//   - t: The transfer details. ID, ECBRate, VestID, SaleID, LinkedID and the
+//     lots' rates and IDs are populated by this method.
+//
+// Returns:
+//   - A pointer to the stored models.Transfer.
+//   - An error if the transfer is invalid, the exchange rate cannot be fetched,
+//     there are insufficient shares to transfer out or the database update fails.
+func (s *Service) RecordTransfer(t models.Transfer) (*models.Transfer, error) {
+	if err := validateTransfer(&t); err != nil {
+		return nil, err
+	}
+	t.OwnerID = s.owner
+	if t.SpouseInHousehold {
+		if err := s.checkSpouse(t.SpouseID); err != nil {
+			return nil, err
+		}
+		if t.Direction == models.TransferIn {
+			return s.ForPerson(t.SpouseID).receiveFromSpouse(t)
+		}
+	}
+	if err := s.checkYearOpen(s.owner, t.Date); err != nil {
+		return nil, err
+	}
+
+	crypto, err := s.isCrypto(t.Symbol)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case crypto:
+		scaleCryptoTransfer(&t)
+	case t.Type != models.TransferSpouse:
+		if t.ECBRate, err = s.transactionRate("transfer of "+t.Symbol, t.Date); err != nil {
+			return nil, fmt.Errorf("failed to fetch exchange rate for %s: %w", t.Date, err)
+		}
+	case t.Direction == models.TransferIn:
+		for i := range t.Lots {
+			lot := &t.Lots[i]
+			if lot.ECBRate, err = s.transactionRate("transfer of "+t.Symbol, lot.Date); err != nil {
+				return nil, fmt.Errorf("failed to fetch exchange rate for %s: %w", lot.Date, err)
+			}
+		}
+	}
+	t.ID = uuid.New().String()
+
+	err = s.inTx(func(tx *Service) error {
+		switch {
+		case t.Direction == models.TransferIn:
+			if err := tx.transferIn(&t); err != nil {
+				return err
+			}
+		case t.Type == models.TransferGift:
+			if err := tx.giftOut(&t); err != nil {
+				return err
+			}
+		default:
+			if err := tx.spouseTransferOut(&t); err != nil {
+				return err
+			}
+		}
+		return tx.insertTransfer(&t)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Transfer recorded: %s %s of %f %s on %s", t.Type, t.Direction, t.Quantity, t.Symbol, t.Date)
+	return &t, nil
+}
+
+// scaleCryptoTransfer records the EUR values entered for a crypto-asset
+// transfer at CryptoRate, in the units of models.CryptoPriceScale that its lots
+// and disposals hold. Lots given up by a transfer out already carry them.
+func scaleCryptoTransfer(t *models.Transfer) {
+	if t.Type != models.TransferSpouse {
+		t.MarketValueCents *= models.CryptoPriceScale
+		t.ECBRate = models.CryptoRate
+		return
+	}
+	if t.Direction == models.TransferIn {
+		for i := range t.Lots {
+			t.Lots[i].CostCents *= models.CryptoPriceScale
+			t.Lots[i].ECBRate = models.CryptoRate
+		}
+		t.OriginalCostCents *= models.CryptoPriceScale
+	}
+}
+
+// receiveFromSpouse records a transfer in from a household spouse, acting as
+// that spouse, by recording their transfer out and returning the linked
+// transfer in.
+func (s *Service) receiveFromSpouse(in models.Transfer) (*models.Transfer, error) {
+	out := in
+	out.Direction = models.TransferOut
+	out.SpouseID = in.OwnerID
+	out.OriginalDate, out.OriginalCostCents, out.Lots = "", 0, nil
+	recorded, err := s.RecordTransfer(out)
+	if err != nil {
+		return nil, err
+	}
+	return s.ForPerson(in.OwnerID).getTransfer(recorded.LinkedID)
+}
+
+// checkSpouse returns an error unless the given person is another member of
+// the household.
+func (s *Service) checkSpouse(spouseID string) error {
+	if spouseID == s.owner {
+		return fmt.Errorf("a spouse transfer must be between two different people")
+	}
+	persons, err := s.GetPersons()
+	if err != nil {
+		return err
+	}
+	for _, p := range persons {
+		if p.ID == spouseID {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown household member %q", spouseID)
+}
+
+// insertTransfer saves a transfer and its lots.
+func (s *Service) insertTransfer(t *models.Transfer) error {
+	query := `INSERT INTO transfers (id, date, direction, type, symbol, quantity, market_value_cents, ecb_rate,
+		counterparty, original_date, original_cost_cents, vest_id, sale_id, owner_id, spouse_in_household, spouse_id, linked_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.db.Exec(query, t.ID, t.Date, t.Direction, t.Type, t.Symbol, t.Quantity, t.MarketValueCents, t.ECBRate,
+		t.Counterparty, t.OriginalDate, t.OriginalCostCents, nullIfEmpty(t.VestID), nullIfEmpty(t.SaleID),
+		t.OwnerID, t.SpouseInHousehold, t.SpouseID, nullIfEmpty(t.LinkedID))
+	if err != nil {
+		return fmt.Errorf("failed to insert transfer: %w", err)
+	}
+	for _, lot := range t.Lots {
+		_, err := s.db.Exec("INSERT INTO transfer_lots (transfer_id, vest_id, original_date, quantity, cost_cents, ecb_rate) VALUES (?, ?, ?, ?, ?, ?)",
+			t.ID, lot.VestID, lot.Date, lot.Quantity, lot.CostCents, lot.ECBRate)
+		if err != nil {
+			return fmt.Errorf("failed to insert transfer lot: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetTransfers retrieves the transfers made or received by the current
+// person, newest first.
+func (s *Service) GetTransfers() ([]models.Transfer, error) {
+	return s.queryTransfers("owner_id = ?", s.owner)
+}
+
+// getTransfer retrieves a single transfer of the current person.
+func (s *Service) getTransfer(id string) (*models.Transfer, error) {
+	transfers, err := s.queryTransfers("owner_id = ? AND id = ?", s.owner, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(transfers) == 0 {
+		return nil, fmt.Errorf("transfer %s not found", id)
+	}
+	return &transfers[0], nil
+}
+
+// queryTransfers retrieves the transfers matching the condition, newest
+// first, with their lots.
+func (s *Service) queryTransfers(condition string, args ...any) ([]models.Transfer, error) {
+	rows, err := s.db.Query(`
+		SELECT id, date, direction, type, symbol, quantity, market_value_cents, ecb_rate,
+		       counterparty, original_date, original_cost_cents, COALESCE(vest_id, ''), COALESCE(sale_id, ''),
+		       owner_id, spouse_in_household, spouse_id, COALESCE(linked_id, '')
+		FROM transfers WHERE `+condition+` ORDER BY date DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []models.Transfer
+	index := map[string]int{}
+	for rows.Next() {
+		var t models.Transfer
+		if err := rows.Scan(&t.ID, &t.Date, &t.Direction, &t.Type, &t.Symbol, &t.Quantity, &t.MarketValueCents, &t.ECBRate,
+			&t.Counterparty, &t.OriginalDate, &t.OriginalCostCents, &t.VestID, &t.SaleID,
+			&t.OwnerID, &t.SpouseInHousehold, &t.SpouseID, &t.LinkedID); err != nil {
+			return nil, err
+		}
+		index[t.ID] = len(transfers)
+		transfers = append(transfers, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	lotRows, err := s.db.Query(`
+		SELECT l.transfer_id, l.vest_id, l.original_date, l.quantity, l.cost_cents, l.ecb_rate
+		FROM transfer_lots l JOIN transfers ON transfers.id = l.transfer_id
+		WHERE `+condition+` ORDER BY l.original_date ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer lotRows.Close()
+	for lotRows.Next() {
+		var transferID string
+		var lot models.TransferLot
+		if err := lotRows.Scan(&transferID, &lot.VestID, &lot.Date, &lot.Quantity, &lot.CostCents, &lot.ECBRate); err != nil {
+			return nil, err
+		}
+		if i, ok := index[transferID]; ok {
+			transfers[i].Lots = append(transfers[i].Lots, lot)
+		}
+	}
+	return transfers, nil
+}
+
+// validateTransfer checks that the fields required by the transfer type are present.
+func validateTransfer(t *models.Transfer) error {
+	if _, err := models.ParseDate(t.Date); err != nil {
+		return fmt.Errorf("invalid transfer date: %w", err)
+	}
+	if t.Symbol == "" || t.Quantity <= 0 {
+		return fmt.Errorf("a transfer requires a symbol and a positive quantity")
+	}
+	switch t.Direction {
+	case models.TransferIn, models.TransferOut:
+	default:
+		return fmt.Errorf("unknown transfer direction %q", t.Direction)
+	}
+
+	switch t.Type {
+	case models.TransferGift:
+		if t.MarketValueCents <= 0 {
+			return fmt.Errorf("a gift requires the market value per share on the transfer date")
+		}
+	case models.TransferInheritance:
+		if t.Direction != models.TransferIn {
+			return fmt.Errorf("inherited shares can only be transferred in")
+		}
+		if t.MarketValueCents <= 0 {
+			return fmt.Errorf("an inheritance requires the market value per share on the date of death")
+		}
+	case models.TransferSpouse:
+		if t.Direction == models.TransferIn && !t.SpouseInHousehold {
+			return validateSpouseLots(t)
+		}
+		t.OriginalDate, t.OriginalCostCents, t.Lots = "", 0, nil
+	default:
+		return fmt.Errorf("unknown transfer type %q", t.Type)
+	}
+	if t.SpouseInHousehold && t.Type != models.TransferSpouse {
+		return fmt.Errorf("only a spouse transfer can be made to a household member")
+	}
+	return nil
+}
+
+// validateSpouseLots checks the lots of a spouse transfer in, taking a single
+// lot from OriginalDate and OriginalCostCents when none are given.
+func validateSpouseLots(t *models.Transfer) error {
+	if len(t.Lots) == 0 {
+		t.Lots = []models.TransferLot{{Date: t.OriginalDate, Quantity: t.Quantity, CostCents: t.OriginalCostCents}}
+	}
+	var total float64
+	for _, lot := range t.Lots {
+		if _, err := models.ParseDate(lot.Date); err != nil {
+			return fmt.Errorf("a spouse transfer in requires the original acquisition date: %w", err)
+		}
+		if lot.Date > t.Date {
+			return fmt.Errorf("the original acquisition date %s is after the transfer", lot.Date)
+		}
+		if lot.CostCents <= 0 {
+			return fmt.Errorf("a spouse transfer in requires the original cost per share")
+		}
+		if lot.Quantity <= 0 {
+			return fmt.Errorf("each lot transferred requires a positive quantity")
+		}
+		total += lot.Quantity
+	}
+	if math.Abs(total-t.Quantity) > quantityEpsilon {
+		return fmt.Errorf("the lots transferred hold %f shares, not %f", total, t.Quantity)
+	}
+	if len(t.Lots) == 1 {
+		t.OriginalDate, t.OriginalCostCents = t.Lots[0].Date, t.Lots[0].CostCents
+	} else {
+		t.OriginalDate, t.OriginalCostCents = "", 0
+	}
+	return nil
+}
+
+// transferIn creates the lot acquired by a gift or inheritance, or the lots
+// acquired by a spouse transfer.
+func (s *Service) transferIn(t *models.Transfer) error {
+	if t.Type == models.TransferSpouse {
+		// The spouse's acquisitions are inherited, so FIFO treats the shares
+		// as held from the original dates at the original costs.
+		for i := range t.Lots {
+			lot := &t.Lots[i]
+			vest := &models.Vest{
+				ID:               uuid.New().String(),
+				Date:             lot.Date,
+				Symbol:           t.Symbol,
+				Quantity:         lot.Quantity,
+				StrikePriceCents: lot.CostCents,
+				ECBRate:          lot.ECBRate,
+				Source:           models.SourceTransfer,
+			}
+			if err := s.insertVest(vest); err != nil {
+				return err
+			}
+			lot.VestID = vest.ID
+		}
+		if len(t.Lots) == 1 {
+			t.VestID = t.Lots[0].VestID
+		}
+		return nil
+	}
+
+	vest := &models.Vest{
+		ID:               uuid.New().String(),
+		Date:             t.Date,
+		Symbol:           t.Symbol,
+		Quantity:         t.Quantity,
+		StrikePriceCents: t.MarketValueCents,
+		ECBRate:          t.ECBRate,
+		Source:           models.SourceTransfer,
+	}
+	if err := s.insertVest(vest); err != nil {
+		return err
+	}
+	t.VestID = vest.ID
+	return nil
+}
+
+// giftOut records a gift made as a disposal at market value and settles it.
+func (s *Service) giftOut(t *models.Transfer) error {
+	sale := &models.Sale{
+		ID:         uuid.New().String(),
+		Date:       t.Date,
+		Symbol:     t.Symbol,
+		Quantity:   t.Quantity,
+		PriceCents: t.MarketValueCents,
+		ECBRate:    t.ECBRate,
+	}
+	if err := s.insertSale(sale); err != nil {
+		return err
+	}
+	if err := s.SettleSale(sale.ID); err != nil {
+		return err
+	}
+	t.SaleID = sale.ID
+	return nil
+}
+
+// spouseTransferOut removes shares from the oldest lots held on the transfer
+// date without recording a disposal. For a household spouse, each lot given up
+// is matched by a lot in their pool and a linked transfer in is recorded.
+func (s *Service) spouseTransferOut(t *models.Transfer) error {
+	inventory, err := s.getInventoryForOwner(s.owner, t.Symbol)
+	if err != nil {
+		return fmt.Errorf("could not retrieve inventory: %w", err)
+	}
+
+	remaining := t.Quantity
+	for _, item := range inventory {
+		if remaining <= quantityEpsilon || item.Date > t.Date {
+			break
+		}
+		qty := math.Min(remaining, item.RemainingQty)
+		t.Lots = append(t.Lots, models.TransferLot{
+			VestID: item.ID, Date: item.Date, Quantity: qty, CostCents: item.StrikePriceCents, ECBRate: item.ECBRate,
+		})
+		remaining -= qty
+	}
+	if remaining > quantityEpsilon {
+		return fmt.Errorf("insufficient shares of %s to transfer: %f shares short", t.Symbol, remaining)
+	}
+
+	for _, lot := range t.Lots {
+		_, err := s.db.Exec("INSERT INTO lot_adjustments (vest_id, reference_id, date, quantity, reason) VALUES (?, ?, ?, ?, ?)",
+			lot.VestID, t.ID, t.Date, lot.Quantity, "SPOUSE_TRANSFER")
+		if err != nil {
+			return fmt.Errorf("failed to record lot adjustment: %w", err)
+		}
+	}
+	if !t.SpouseInHousehold {
+		return nil
+	}
+
+	spouse := s.ForPerson(t.SpouseID)
+	if err := spouse.checkYearOpen(t.SpouseID, t.Date); err != nil {
+		return err
+	}
+	in := models.Transfer{
+		ID:                uuid.New().String(),
+		Date:              t.Date,
+		Direction:         models.TransferIn,
+		Type:              models.TransferSpouse,
+		Symbol:            t.Symbol,
+		Quantity:          t.Quantity,
+		OwnerID:           t.SpouseID,
+		SpouseInHousehold: true,
+		SpouseID:          s.owner,
+		LinkedID:          t.ID,
+	}
+	for _, lot := range t.Lots {
+		vest := &models.Vest{
+			ID:               uuid.New().String(),
+			Date:             lot.Date,
+			Symbol:           t.Symbol,
+			Quantity:         lot.Quantity,
+			StrikePriceCents: lot.CostCents,
+			ECBRate:          lot.ECBRate,
+			Source:           models.SourceTransfer,
+			ParentID:         lot.VestID,
+		}
+		if err := spouse.insertVest(vest); err != nil {
+			return err
+		}
+		in.Lots = append(in.Lots, models.TransferLot{
+			VestID: vest.ID, Date: lot.Date, Quantity: lot.Quantity, CostCents: lot.CostCents, ECBRate: lot.ECBRate,
+		})
+	}
+	if len(in.Lots) == 1 {
+		in.VestID = in.Lots[0].VestID
+		in.OriginalDate, in.OriginalCostCents = in.Lots[0].Date, in.Lots[0].CostCents
+	}
+	if err := spouse.insertTransfer(&in); err != nil {
+		return err
+	}
+	t.LinkedID = in.ID
+	return nil
+}
+
+// nullIfEmpty maps an empty string to a SQL NULL.
+func nullIfEmpty(v string) sql.NullString {
+	return sql.NullString{String: v, Valid: v != ""}
+}
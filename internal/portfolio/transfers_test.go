@@ -0,0 +1,229 @@
+package portfolio
+
+import (
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestRecordTransfer(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 0.9)
+
+	s := NewService(database)
+	if _, err := s.AddVest("2020-01-10", "ACME", 100, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+
+	// A gift made is a disposal at market value: 10 x ($150 - $100) x 0.9.
+	gift, err := s.RecordTransfer(models.Transfer{
+		Date: "2024-03-01", Direction: models.TransferOut, Type: models.TransferGift,
+		Symbol: "ACME", Quantity: 10, MarketValueCents: 15000, Counterparty: "Niece",
+	})
+	if err != nil {
+		t.Fatalf("gift out failed: %v", err)
+	}
+	settled, _ := s.GetSettledSales()
+	if len(settled) != 1 || settled[0].SaleID != gift.SaleID || settled[0].EuroGainEUR != 45000 {
+		t.Errorf("unexpected gift disposal: %+v", settled)
+	}
+
+	// A spouse transfer out removes shares without a disposal.
+	if _, err := s.RecordTransfer(models.Transfer{
+		Date: "2024-04-01", Direction: models.TransferOut, Type: models.TransferSpouse, Symbol: "ACME", Quantity: 20,
+	}); err != nil {
+		t.Fatalf("spouse transfer out failed: %v", err)
+	}
+	if settled, _ := s.GetSettledSales(); len(settled) != 1 {
+		t.Errorf("spouse transfer should not be a disposal, got %d settled rows", len(settled))
+	}
+
+	// A spouse transfer in keeps the spouse's original date and cost.
+	in, err := s.RecordTransfer(models.Transfer{
+		Date: "2024-05-01", Direction: models.TransferIn, Type: models.TransferSpouse, Symbol: "ACME", Quantity: 5,
+		OriginalDate: "2019-06-01", OriginalCostCents: 5000,
+	})
+	if err != nil {
+		t.Fatalf("spouse transfer in failed: %v", err)
+	}
+
+	inventory, _ := s.GetInventory()
+	if len(inventory) != 2 {
+		t.Fatalf("expected 2 open lots, got %d", len(inventory))
+	}
+	if inventory[0].ID != in.VestID || inventory[0].Date != "2019-06-01" || inventory[0].StrikePriceCents != 5000 {
+		t.Errorf("unexpected spouse lot: %+v", inventory[0])
+	}
+	if inventory[1].RemainingQty != 70 {
+		t.Errorf("expected 70 shares left in the original lot, got %f", inventory[1].RemainingQty)
+	}
+
+	if _, err := s.RecordTransfer(models.Transfer{
+		Date: "2024-06-01", Direction: models.TransferOut, Type: models.TransferSpouse, Symbol: "ACME", Quantity: 500,
+	}); err == nil {
+		t.Error("expected an error when transferring more shares than held")
+	}
+
+	transfers, err := s.GetTransfers()
+	if err != nil || len(transfers) != 3 {
+		t.Errorf("expected 3 transfers, got %d (%v)", len(transfers), err)
+	}
+}
+
+func TestRecordTransfer_HouseholdSpouse(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 0.9)
+
+	s := NewService(database)
+	spouse, _ := s.AddPerson("Alex")
+	s.AddVest("2019-01-10", "ACME", 10, 10000)
+	s.AddVest("2020-01-10", "ACME", 10, 12000)
+
+	// The spouse takes over a matching lot for each lot given up.
+	out, err := s.RecordTransfer(models.Transfer{
+		Date: "2024-03-01", Direction: models.TransferOut, Type: models.TransferSpouse, Symbol: "ACME", Quantity: 15,
+		SpouseInHousehold: true, SpouseID: spouse.ID,
+	})
+	if err != nil {
+		t.Fatalf("spouse transfer out failed: %v", err)
+	}
+	if len(out.Lots) != 2 || out.LinkedID == "" {
+		t.Fatalf("expected two linked lots, got %+v", out)
+	}
+
+	theirs, _ := s.getInventoryForOwner(spouse.ID, "ACME")
+	if len(theirs) != 2 {
+		t.Fatalf("expected two lots in the spouse's pool, got %+v", theirs)
+	}
+	if theirs[0].Date != "2019-01-10" || theirs[0].RemainingQty != 10 || theirs[0].StrikePriceCents != 10000 {
+		t.Errorf("unexpected first spouse lot: %+v", theirs[0])
+	}
+	if theirs[1].Date != "2020-01-10" || theirs[1].RemainingQty != 5 || theirs[1].StrikePriceCents != 12000 || theirs[1].ECBRate != 0.9 {
+		t.Errorf("unexpected second spouse lot: %+v", theirs[1])
+	}
+	mine, _ := s.getInventoryForOwner("", "ACME")
+	if len(mine) != 1 || mine[0].RemainingQty != 5 {
+		t.Errorf("expected 5 shares left in the giver's pool, got %+v", mine)
+	}
+
+	// Each person sees only their own side of the transfer.
+	given, _ := s.GetTransfers()
+	received, _ := s.ForPerson(spouse.ID).GetTransfers()
+	if len(given) != 1 || len(received) != 1 {
+		t.Fatalf("expected one transfer on each side, got %d and %d", len(given), len(received))
+	}
+	if received[0].ID != out.LinkedID || received[0].LinkedID != out.ID || received[0].Direction != models.TransferIn || len(received[0].Lots) != 2 {
+		t.Errorf("unexpected linked transfer in: %+v", received[0])
+	}
+
+	// A transfer in from a household spouse is recorded as their transfer out.
+	in, err := s.ForPerson(spouse.ID).RecordTransfer(models.Transfer{
+		Date: "2024-04-01", Direction: models.TransferIn, Type: models.TransferSpouse, Symbol: "ACME", Quantity: 5,
+		SpouseInHousehold: true, SpouseID: "",
+	})
+	if err != nil {
+		t.Fatalf("spouse transfer in failed: %v", err)
+	}
+	if in.OwnerID != spouse.ID || in.VestID == "" || in.OriginalDate != "2020-01-10" {
+		t.Errorf("unexpected transfer in: %+v", in)
+	}
+	if mine, _ := s.getInventoryForOwner("", "ACME"); len(mine) != 0 {
+		t.Errorf("expected the giver's pool to be empty, got %+v", mine)
+	}
+
+	if _, err := s.RecordTransfer(models.Transfer{
+		Date: "2024-05-01", Direction: models.TransferOut, Type: models.TransferSpouse, Symbol: "ACME", Quantity: 1,
+		SpouseInHousehold: true, SpouseID: "",
+	}); err == nil {
+		t.Error("expected an error for a transfer to oneself")
+	}
+}
+
+func TestRecordTransfer_SpouseLots(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 0.9)
+
+	s := NewService(database)
+	in, err := s.RecordTransfer(models.Transfer{
+		Date: "2024-05-01", Direction: models.TransferIn, Type: models.TransferSpouse, Symbol: "ACME", Quantity: 8,
+		Lots: []models.TransferLot{
+			{Date: "2018-02-01", Quantity: 3, CostCents: 4000},
+			{Date: "2021-07-01", Quantity: 5, CostCents: 9000},
+		},
+	})
+	if err != nil {
+		t.Fatalf("spouse transfer in failed: %v", err)
+	}
+	inventory, _ := s.GetInventory()
+	if len(inventory) != 2 || inventory[0].Date != "2018-02-01" || inventory[0].Quantity != 3 || inventory[1].StrikePriceCents != 9000 {
+		t.Errorf("unexpected lots: %+v", inventory)
+	}
+	if in.VestID != "" || in.Lots[1].VestID != inventory[1].ID {
+		t.Errorf("expected each lot to be linked to its vest, got %+v", in)
+	}
+
+	if _, err := s.RecordTransfer(models.Transfer{
+		Date: "2024-05-01", Direction: models.TransferIn, Type: models.TransferSpouse, Symbol: "ACME", Quantity: 10,
+		Lots: []models.TransferLot{{Date: "2018-02-01", Quantity: 3, CostCents: 4000}},
+	}); err == nil {
+		t.Error("expected an error when the lots do not add up to the quantity")
+	}
+}
+
+func TestRecordTransfer_Validation(t *testing.T) {
+	s := NewService(nil)
+	_, err := s.RecordTransfer(models.Transfer{
+		Date: "2024-01-01", Direction: models.TransferOut, Type: models.TransferInheritance, Symbol: "ACME", Quantity: 1, MarketValueCents: 100,
+	})
+	if err == nil {
+		t.Error("expected an error for inherited shares transferred out")
+	}
+	_, err = s.RecordTransfer(models.Transfer{
+		Date: "2024-01-01", Direction: models.TransferIn, Type: models.TransferSpouse, Symbol: "ACME", Quantity: 1,
+	})
+	if err == nil {
+		t.Error("expected an error for a spouse transfer in without the original cost")
+	}
+}
+
+func TestRecordTransfer_Crypto(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 0.9)
+
+	s := NewService(database)
+	s.SetSecurity(models.Security{Symbol: "BTC", AssetClass: models.AssetClassCrypto})
+
+	// Crypto-assets are valued in EUR, so no USD rate applies.
+	inherited, err := s.RecordTransfer(models.Transfer{
+		Date: "2023-01-10", Direction: models.TransferIn, Type: models.TransferInheritance,
+		Symbol: "BTC", Quantity: 2, MarketValueCents: 3000000, Counterparty: "Estate",
+	})
+	if err != nil {
+		t.Fatalf("inheritance failed: %v", err)
+	}
+	if inherited.ECBRate != models.CryptoRate || models.UnitPrice(inherited.MarketValueCents, inherited.ECBRate) != 3000000 {
+		t.Errorf("unexpected crypto transfer: %+v", inherited)
+	}
+	inventory, _ := s.GetInventory()
+	if len(inventory) != 1 || models.PriceEUR(inventory[0].StrikePriceCents, inventory[0].ECBRate) != 3000000 {
+		t.Fatalf("unexpected inherited lot: %+v", inventory)
+	}
+
+	// A gift made at EUR 40,000 a unit: 1 x (40,000 - 30,000).
+	if _, err := s.RecordTransfer(models.Transfer{
+		Date: "2024-03-01", Direction: models.TransferOut, Type: models.TransferGift,
+		Symbol: "BTC", Quantity: 1, MarketValueCents: 4000000, Counterparty: "Niece",
+	}); err != nil {
+		t.Fatalf("gift out failed: %v", err)
+	}
+	settled, _ := s.GetSettledSales()
+	if len(settled) != 1 || settled[0].EuroSaleEUR != 4000000 || settled[0].EuroGainEUR != 1000000 {
+		t.Errorf("unexpected gift disposal: %+v", settled)
+	}
+}
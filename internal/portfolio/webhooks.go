@@ -0,0 +1,356 @@
+package portfolio
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"irish-cgt-tracker/internal/models"
+)
+
+// WebhookEvents lists the events that can be delivered to webhooks.
+var WebhookEvents = []string{
+	models.EventVestAdded,
+	models.EventSaleAdded,
+	models.EventSaleSettled,
+	models.EventSaleUnsettled,
+	models.EventImportCompleted,
+	models.EventYearClosed,
+}
+
+// webhookRetryDelays are the waits before each retry of a failed delivery. A
+// delivery is abandoned once they are exhausted.
+var webhookRetryDelays = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 6 * time.Hour}
+
+// Headers sent with each webhook delivery.
+const (
+	WebhookEventHeader     = "X-CGT-Event"
+	WebhookDeliveryHeader  = "X-CGT-Delivery"
+	WebhookSignatureHeader = "X-CGT-Signature"
+)
+
+// WebhookPayload is the JSON body posted to webhooks.
+type WebhookPayload struct {
+	Event      string `json:"event"`
+	OwnerID    string `json:"owner_id"`
+	OccurredAt string `json:"occurred_at"` // RFC 3339 time of the event.
+	// Data is the affected record, e.g. the models.Sale for sale events.
+	Data any `json:"data"`
+}
+
+// webhookSubscriptions caches the events each webhook subscribes to, keyed by
+// webhook ID, so that recording an event does not query the webhooks table.
+// It is shared by every Service derived from the one NewService returned.
+type webhookSubscriptions struct {
+	mu     sync.RWMutex
+	events map[string][]string
+}
+
+// set records the events a webhook subscribes to.
+func (w *webhookSubscriptions) set(id string, events []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.events == nil {
+		w.events = map[string][]string{}
+	}
+	w.events[id] = events
+}
+
+// remove forgets a deleted webhook.
+func (w *webhookSubscriptions) remove(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.events, id)
+}
+
+// subscribers returns the IDs of the webhooks subscribed to an event.
+func (w *webhookSubscriptions) subscribers(event string) []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	var ids []string
+	for id, events := range w.events {
+		if len(events) == 0 || slices.Contains(events, event) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// SignWebhookPayload returns the value of the signature header for a payload:
+// "sha256=" followed by the hex HMAC-SHA256 of the body keyed with the secret.
+// Receivers should compute it over the raw body and compare in constant time.
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// AddWebhook registers an endpoint to receive portfolio events.
+//
+// Parameters:
+//   - w: The webhook. ID and CreatedAt are populated by this method. An empty
+//     Events list subscribes to every event.
+//
+// Returns:
+//   - A pointer to the stored models.Webhook.
+//   - An error if the URL, secret or events are invalid or the insertion fails.
+func (s *Service) AddWebhook(w models.Webhook) (*models.Webhook, error) {
+	u, err := url.Parse(strings.TrimSpace(w.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("webhook URL must be an absolute http or https URL")
+	}
+	if w.Secret == "" {
+		return nil, fmt.Errorf("a webhook requires a signing secret")
+	}
+	for _, e := range w.Events {
+		if !slices.Contains(WebhookEvents, e) {
+			return nil, fmt.Errorf("unknown webhook event %q", e)
+		}
+	}
+	w.ID = uuid.New().String()
+	w.URL = u.String()
+	w.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	_, err = s.db.Exec(`INSERT INTO webhooks (id, url, secret, events, created_at) VALUES (?, ?, ?, ?, ?)`,
+		w.ID, w.URL, w.Secret, strings.Join(w.Events, ","), w.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert webhook: %w", err)
+	}
+	s.webhooks.set(w.ID, w.Events)
+	return &w, nil
+}
+
+// LoadWebhooks reads the registered webhooks into the subscriptions events are
+// queued for. It is called once at startup; until then RecordEvent only sees
+// webhooks added by AddWebhook.
+//
+// Returns:
+//   - An error if the database query fails.
+func (s *Service) LoadWebhooks() error {
+	webhooks, err := s.GetWebhooks()
+	if err != nil {
+		return fmt.Errorf("failed to load webhooks: %w", err)
+	}
+	for _, w := range webhooks {
+		s.webhooks.set(w.ID, w.Events)
+	}
+	return nil
+}
+
+// GetWebhooks retrieves the registered webhooks, oldest first.
+func (s *Service) GetWebhooks() ([]models.Webhook, error) {
+	rows, err := s.db.Query(`SELECT id, url, secret, events, created_at FROM webhooks ORDER BY created_at ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []models.Webhook
+	for rows.Next() {
+		var w models.Webhook
+		var events string
+		if err := rows.Scan(&w.ID, &w.URL, &w.Secret, &events, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		if events != "" {
+			w.Events = strings.Split(events, ",")
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log.
+func (s *Service) DeleteWebhook(id string) error {
+	err := s.inTx(func(tx *Service) error {
+		if _, err := tx.db.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete webhook deliveries: %w", err)
+		}
+		if _, err := tx.db.Exec(`DELETE FROM webhooks WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete webhook: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.webhooks.remove(id)
+	return nil
+}
+
+// RecordEvent queues a delivery of an event to every webhook subscribed to it,
+// as loaded by LoadWebhooks or added since. The deliveries are posted by
+// DeliverWebhooks.
+//
+// Parameters:
+//   - event: One of WebhookEvents.
+//   - data: The affected record, encoded as the payload's data.
+//
+// Returns:
+//   - An error if the payload cannot be encoded or a database insert fails.
+func (s *Service) RecordEvent(event string, data any) error {
+	targets := s.webhooks.subscribers(event)
+	if len(targets) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	payload, err := json.Marshal(WebhookPayload{Event: event, OwnerID: s.owner, OccurredAt: now, Data: data})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+	for _, id := range targets {
+		if err := s.queueDelivery(id, event, string(payload), now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emit records an event for webhooks. The event follows a change that has
+// already been saved, so a failure is logged rather than returned.
+func (s *Service) emit(event string, data any) {
+	if err := s.RecordEvent(event, data); err != nil {
+		log.Printf("Failed to queue %s webhooks: %v", event, err)
+	}
+}
+
+// queueDelivery inserts a pending delivery due immediately.
+func (s *Service) queueDelivery(webhookID, event, payload, now string) error {
+	_, err := s.db.Exec(`INSERT INTO webhook_deliveries (id, webhook_id, event, payload, status, created_at, next_attempt_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		uuid.New().String(), webhookID, event, payload, models.DeliveryPending, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to queue webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// GetWebhookDeliveries retrieves the most recent deliveries, newest first.
+//
+// Parameters:
+//   - limit: The maximum number of deliveries to return.
+func (s *Service) GetWebhookDeliveries(limit int) ([]models.WebhookDelivery, error) {
+	rows, err := s.db.Query(`
+		SELECT id, webhook_id, event, payload, status, attempts, response_code, error, created_at, next_attempt_at, delivered_at
+		FROM webhook_deliveries ORDER BY created_at DESC, rowid DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.ResponseCode, &d.Error,
+			&d.CreatedAt, &d.NextAttemptAt, &d.DeliveredAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+// ReplayWebhookDelivery queues the payload of an earlier delivery again, e.g.
+// after fixing the receiving endpoint. The original delivery stays in the log.
+func (s *Service) ReplayWebhookDelivery(id string) error {
+	var webhookID, event, payload string
+	err := s.db.QueryRow(`SELECT webhook_id, event, payload FROM webhook_deliveries WHERE id = ?`, id).Scan(&webhookID, &event, &payload)
+	if err != nil {
+		return fmt.Errorf("could not retrieve delivery %s: %w", id, err)
+	}
+	return s.queueDelivery(webhookID, event, payload, time.Now().UTC().Format(time.RFC3339))
+}
+
+// DeliverWebhooks posts every pending delivery that is due. A delivery
+// succeeds on a 2xx response; otherwise it is retried after each of
+// webhookRetryDelays in turn and then marked failed.
+//
+// Parameters:
+//   - client: The HTTP client used to post the payloads.
+//   - now: The current time.
+//
+// Returns:
+//   - The number of deliveries that succeeded.
+//   - An error if a database query fails.
+func (s *Service) DeliverWebhooks(client *http.Client, now time.Time) (int, error) {
+	rows, err := s.db.Query(`
+		SELECT d.id, d.event, d.payload, d.attempts, w.url, w.secret
+		FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+		WHERE d.status = ? AND d.next_attempt_at <= ?
+		ORDER BY d.created_at ASC, d.rowid ASC`, models.DeliveryPending, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	type due struct {
+		id, event, payload, url, secret string
+		attempts                        int
+	}
+	var pending []due
+	for rows.Next() {
+		var d due
+		if err := rows.Scan(&d.id, &d.event, &d.payload, &d.attempts, &d.url, &d.secret); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pending = append(pending, d)
+	}
+	rows.Close()
+
+	delivered := 0
+	for _, d := range pending {
+		code, postErr := postWebhook(client, d.url, d.secret, d.id, d.event, []byte(d.payload))
+		attempts := d.attempts + 1
+		status, next, deliveredAt, errMsg := models.DeliveryPending, "", "", ""
+		switch {
+		case postErr == nil:
+			status, deliveredAt = models.DeliveryDelivered, now.UTC().Format(time.RFC3339)
+			delivered++
+		case attempts > len(webhookRetryDelays):
+			status, errMsg = models.DeliveryFailed, postErr.Error()
+		default:
+			next, errMsg = now.Add(webhookRetryDelays[attempts-1]).UTC().Format(time.RFC3339), postErr.Error()
+		}
+		_, err := s.db.Exec(`UPDATE webhook_deliveries SET status = ?, attempts = ?, response_code = ?, error = ?, next_attempt_at = ?, delivered_at = ? WHERE id = ?`,
+			status, attempts, code, errMsg, next, deliveredAt, d.id)
+		if err != nil {
+			return delivered, fmt.Errorf("failed to update webhook delivery: %w", err)
+		}
+	}
+	return delivered, nil
+}
+
+// postWebhook posts a signed payload, returning the response status code and
+// an error unless the endpoint accepted it.
+func postWebhook(client *http.Client, target, secret, deliveryID, event string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "irish-cgt-tracker-webhooks")
+	req.Header.Set(WebhookEventHeader, event)
+	req.Header.Set(WebhookDeliveryHeader, deliveryID)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(secret, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
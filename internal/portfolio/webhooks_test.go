@@ -0,0 +1,153 @@
+package portfolio
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	var received []WebhookPayload
+	failing := true
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(WebhookSignatureHeader) != SignWebhookPayload("s3cret", body) {
+			t.Errorf("bad signature %q", r.Header.Get(WebhookSignatureHeader))
+		}
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var p WebhookPayload
+		json.Unmarshal(body, &p)
+		received = append(received, p)
+	}))
+	defer endpoint.Close()
+
+	s := NewService(database)
+	if _, err := s.AddWebhook(models.Webhook{URL: "ftp://example.com", Secret: "x"}); err == nil {
+		t.Error("expected a non-HTTP URL to be refused")
+	}
+	if _, err := s.AddWebhook(models.Webhook{URL: endpoint.URL, Secret: "x", Events: []string{"vest.deleted"}}); err == nil {
+		t.Error("expected an unknown event to be refused")
+	}
+	if _, err := s.AddWebhook(models.Webhook{URL: endpoint.URL, Secret: "s3cret", Events: []string{models.EventSaleSettled}}); err != nil {
+		t.Fatalf("AddWebhook failed: %v", err)
+	}
+
+	// Only the settlement is delivered to the filtered webhook.
+	s.AddVest("2020-01-10", "ACME", 10, 10000)
+	sale, _ := s.AddSale("2024-03-01", "ACME", 10, 40000)
+	if err := s.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+
+	now := time.Now()
+	client := endpoint.Client()
+	if n, err := s.DeliverWebhooks(client, now); err != nil || n != 0 {
+		t.Fatalf("expected the delivery to fail, got %d: %v", n, err)
+	}
+	deliveries, _ := s.GetWebhookDeliveries(10)
+	if len(deliveries) != 1 {
+		t.Fatalf("expected one delivery, got %+v", deliveries)
+	}
+	d := deliveries[0]
+	if d.Event != models.EventSaleSettled || d.Status != models.DeliveryPending || d.Attempts != 1 || d.ResponseCode != 503 {
+		t.Errorf("unexpected failed delivery: %+v", d)
+	}
+
+	// The retry waits a minute.
+	failing = false
+	if n, _ := s.DeliverWebhooks(client, now.Add(30*time.Second)); n != 0 {
+		t.Error("expected the retry to wait")
+	}
+	if n, err := s.DeliverWebhooks(client, now.Add(2*time.Minute)); err != nil || n != 1 {
+		t.Fatalf("expected the retry to succeed, got %d: %v", n, err)
+	}
+	if len(received) != 1 || received[0].Event != models.EventSaleSettled {
+		t.Fatalf("unexpected payloads: %+v", received)
+	}
+	if data := received[0].Data.(map[string]any); data["id"] != sale.ID || data["is_settled"] != true {
+		t.Errorf("unexpected payload data: %+v", data)
+	}
+
+	if err := s.ReplayWebhookDelivery(d.ID); err != nil {
+		t.Fatalf("ReplayWebhookDelivery failed: %v", err)
+	}
+	if n, _ := s.DeliverWebhooks(client, time.Now()); n != 1 || len(received) != 2 {
+		t.Errorf("expected the replay to be delivered, got %d", n)
+	}
+	deliveries, _ = s.GetWebhookDeliveries(10)
+	if len(deliveries) != 2 || deliveries[0].Status != models.DeliveryDelivered || deliveries[1].Status != models.DeliveryDelivered {
+		t.Errorf("expected both deliveries in the log, got %+v", deliveries)
+	}
+}
+
+func TestWebhookDeliveryGivesUp(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer endpoint.Close()
+
+	s := NewService(database)
+	s.AddWebhook(models.Webhook{URL: endpoint.URL, Secret: "s3cret"})
+	if err := s.RecordEvent(models.EventImportCompleted, map[string]string{"type": "vests"}); err != nil {
+		t.Fatalf("RecordEvent failed: %v", err)
+	}
+
+	now := time.Now()
+	for i := 0; i <= len(webhookRetryDelays); i++ {
+		s.DeliverWebhooks(endpoint.Client(), now)
+		now = now.Add(7 * time.Hour)
+	}
+	deliveries, _ := s.GetWebhookDeliveries(10)
+	if len(deliveries) != 1 || deliveries[0].Status != models.DeliveryFailed || deliveries[0].Attempts != len(webhookRetryDelays)+1 {
+		t.Errorf("expected the delivery to be abandoned, got %+v", deliveries)
+	}
+}
+
+func TestLoadWebhooks(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	hook, err := NewService(database).AddWebhook(models.Webhook{URL: "https://example.com/hook", Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("AddWebhook failed: %v", err)
+	}
+
+	// A restarted Service queues events only once the webhooks are loaded.
+	s := NewService(database)
+	s.RecordEvent(models.EventImportCompleted, nil)
+	if deliveries, _ := s.GetWebhookDeliveries(10); len(deliveries) != 0 {
+		t.Errorf("expected no deliveries before loading, got %+v", deliveries)
+	}
+	if err := s.LoadWebhooks(); err != nil {
+		t.Fatalf("LoadWebhooks failed: %v", err)
+	}
+	s.ForPerson("p1").RecordEvent(models.EventImportCompleted, nil)
+	if deliveries, _ := s.GetWebhookDeliveries(10); len(deliveries) != 1 {
+		t.Errorf("expected one delivery after loading, got %+v", deliveries)
+	}
+
+	if err := s.DeleteWebhook(hook.ID); err != nil {
+		t.Fatalf("DeleteWebhook failed: %v", err)
+	}
+	s.RecordEvent(models.EventImportCompleted, nil)
+	if deliveries, _ := s.GetWebhookDeliveries(10); len(deliveries) != 0 {
+		t.Errorf("expected the deleted webhook and its log to be gone, got %+v", deliveries)
+	}
+}
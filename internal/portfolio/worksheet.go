@@ -0,0 +1,151 @@
+package portfolio
+
+import (
+	"sort"
+
+	"irish-cgt-tracker/internal/models"
+)
+
+// Asset categories used for the disposal counts on the Form 11 and Form 12
+// capital gains panels.
+const (
+	WorksheetShares = "Shares or securities (quoted)"
+	WorksheetOther  = "Other assets (crypto-assets)"
+)
+
+// WorksheetAssets is the number of disposals and total consideration for one
+// asset category.
+type WorksheetAssets struct {
+	Category           string `json:"category"`
+	Disposals          int    `json:"disposals"`
+	ConsiderationCents int64  `json:"consideration_cents"`
+}
+
+// WorksheetPeriod is one payment period's entries on the panel.
+type WorksheetPeriod struct {
+	Label              string `json:"label"`
+	ConsiderationCents int64  `json:"consideration_cents"`
+	// NetChargeableGainCents is the part of the year's net chargeable gain
+	// arising in the period.
+	NetChargeableGainCents int64  `json:"net_chargeable_gain_cents"`
+	TaxCents               int64  `json:"tax_cents"`
+	DueDate                string `json:"due_date"`
+}
+
+// CGTWorksheet holds the figures entered on the capital gains panel of Form 11
+// or Form 12 for one person and tax year. All amounts are in EUR cents.
+type CGTWorksheet struct {
+	Year   int    `json:"year"`
+	Person string `json:"person"`
+	// Assets counts the disposals by asset category.
+	Assets             []WorksheetAssets `json:"assets"`
+	Disposals          int               `json:"disposals"`
+	ConsiderationCents int64             `json:"consideration_cents"`
+	// ChargeableGainsCents and LossesCents are the year's gross gains and losses.
+	ChargeableGainsCents int64 `json:"chargeable_gains_cents"`
+	LossesCents          int64 `json:"losses_cents"`
+	// LossesBroughtForwardCents is the part of earlier years' losses used.
+	LossesBroughtForwardCents int64             `json:"losses_brought_forward_cents"`
+	ExemptionCents            int64             `json:"exemption_cents"`
+	NetChargeableGainCents    int64             `json:"net_chargeable_gain_cents"`
+	TaxRate                   float64           `json:"tax_rate"`
+	Periods                   []WorksheetPeriod `json:"periods"`
+	TaxCents                  int64             `json:"tax_cents"`
+	LossesCarriedForwardCents int64             `json:"losses_carried_forward_cents"`
+}
+
+// GetCGTWorksheet produces the Form 11 / Form 12 capital gains panel for the
+// Service's person and a tax year from their settled sales. It uses the same
+// computation as GetCGTSummary, adding the consideration for each payment
+// period and the disposal counts by asset category that the panel asks for.
+// ETF disposals are taxed under the exit tax regime and are not included.
+//
+// Parameters:
+//   - year: The tax year.
+//
+// Returns:
+//   - The CGTWorksheet.
+//   - An error if a database query fails.
+func (s *Service) GetCGTWorksheet(year int) (*CGTWorksheet, error) {
+	disposals, err := s.getCGTDisposals()
+	if err != nil {
+		return nil, err
+	}
+	periods, err := s.GetResidencePeriods()
+	if err != nil {
+		return nil, err
+	}
+	persons, err := s.GetPersons()
+	if err != nil {
+		return nil, err
+	}
+
+	summary := s.ownSummary(year, disposals, periods)
+	ws := &CGTWorksheet{
+		Year:                      year,
+		Disposals:                 summary.Disposals,
+		ConsiderationCents:        summary.ConsiderationCents,
+		ChargeableGainsCents:      summary.GainsCents,
+		LossesCents:               summary.LossesCents,
+		LossesBroughtForwardCents: summary.LossesUsedCents,
+		ExemptionCents:            summary.ExemptionCents,
+		NetChargeableGainCents:    summary.ChargeableCents,
+		TaxRate:                   CGTRate * 100,
+		TaxCents:                  summary.TaxCents,
+		LossesCarriedForwardCents: summary.LossesCarriedForwardCents,
+	}
+	for _, p := range persons {
+		if p.ID == s.owner {
+			ws.Person = p.Name
+		}
+	}
+
+	initial := WorksheetPeriod{Label: summary.Initial.Label, TaxCents: summary.Initial.TaxCents, DueDate: summary.Initial.DueDate}
+	later := WorksheetPeriod{Label: summary.Later.Label, TaxCents: summary.Later.TaxCents, DueDate: summary.Later.DueDate}
+
+	chargeable, _ := applyResidence(disposals, periods)
+	assets := map[string]*WorksheetAssets{}
+	sales := map[string]bool{}
+	for _, d := range chargeable {
+		if d.OwnerID != s.owner || disposalYear(d.Date) != year {
+			continue
+		}
+		if d.Date[5:7] == "12" {
+			later.ConsiderationCents += d.ProceedsCents
+		} else {
+			initial.ConsiderationCents += d.ProceedsCents
+		}
+
+		category := WorksheetShares
+		if d.AssetClass == models.AssetClassCrypto {
+			category = WorksheetOther
+		}
+		a, ok := assets[category]
+		if !ok {
+			a = &WorksheetAssets{Category: category}
+			assets[category] = a
+		}
+		a.ConsiderationCents += d.ProceedsCents
+		key := d.SaleID
+		if key == "" {
+			key = d.Date
+		}
+		if !sales[category+"|"+key] {
+			sales[category+"|"+key] = true
+			a.Disposals++
+		}
+	}
+	for _, a := range assets {
+		ws.Assets = append(ws.Assets, *a)
+	}
+	// Shares first, as on the panel.
+	sort.Slice(ws.Assets, func(i, j int) bool { return ws.Assets[i].Category > ws.Assets[j].Category })
+
+	// The initial period is computed as if the year ended on 30 November, so
+	// its net chargeable gain is the part taxed in that period.
+	initialNet := summary.Initial.GainsCents - summary.Initial.LossesCents
+	initial.NetChargeableGainCents = min(max(initialNet-summary.LossesBroughtForwardCents-AnnualExemptionCents, 0), summary.ChargeableCents)
+	later.NetChargeableGainCents = summary.ChargeableCents - initial.NetChargeableGainCents
+	ws.Periods = []WorksheetPeriod{initial, later}
+	return ws, nil
+}
@@ -0,0 +1,54 @@
+package portfolio
+
+import (
+	"strings"
+	"testing"
+
+	"irish-cgt-tracker/internal/currency"
+	"irish-cgt-tracker/internal/db"
+)
+
+func TestGetCGTWorksheet(t *testing.T) {
+	database, cleanup := db.NewTestDB(t)
+	defer cleanup()
+	currency.UseTestRate(t, 1.0)
+
+	s := NewService(database)
+	if _, err := s.AddVest("2020-01-10", "ACME", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	sale, _ := s.AddSale("2024-03-01", "ACME", 5, 40000)
+	if err := s.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+	csvData := `Date,Type,Asset,Quantity,Price EUR,Quote Asset,Quote Quantity,Fee EUR
+2024-01-05,BUY,BTC,1,20000.00,EUR,,0
+2024-12-20,SELL,BTC,0.5,30000.00,EUR,,0`
+	if err := s.ImportCrypto(strings.NewReader(csvData)); err != nil {
+		t.Fatalf("ImportCrypto failed: %v", err)
+	}
+
+	// A 1,500 share gain in March and a 5,000 crypto gain in December.
+	ws, err := s.GetCGTWorksheet(2024)
+	if err != nil {
+		t.Fatalf("GetCGTWorksheet failed: %v", err)
+	}
+	if ws.Person != PrimaryPersonName || ws.Disposals != 2 || ws.ConsiderationCents != 1700000 {
+		t.Errorf("unexpected header: %+v", ws)
+	}
+	if len(ws.Assets) != 2 || ws.Assets[0].Category != WorksheetShares || ws.Assets[0].ConsiderationCents != 200000 ||
+		ws.Assets[1].Category != WorksheetOther || ws.Assets[1].Disposals != 1 {
+		t.Errorf("unexpected disposals by asset type: %+v", ws.Assets)
+	}
+	if ws.ChargeableGainsCents != 650000 || ws.ExemptionCents != AnnualExemptionCents || ws.NetChargeableGainCents != 523000 || ws.TaxCents != 172590 {
+		t.Errorf("unexpected computation: %+v", ws)
+	}
+
+	initial, later := ws.Periods[0], ws.Periods[1]
+	if initial.ConsiderationCents != 200000 || initial.NetChargeableGainCents != 23000 || initial.TaxCents != 7590 {
+		t.Errorf("unexpected initial period: %+v", initial)
+	}
+	if later.ConsiderationCents != 1500000 || later.NetChargeableGainCents != 500000 || later.TaxCents != 165000 {
+		t.Errorf("unexpected later period: %+v", later)
+	}
+}
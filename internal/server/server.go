@@ -1,14 +1,25 @@
 package server
 
 import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
 	"html/template"
+	"io"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"irish-cgt-tracker/internal/auth"
 	"irish-cgt-tracker/internal/models"
+	"irish-cgt-tracker/internal/notify"
 	"irish-cgt-tracker/internal/portfolio"
 )
 
@@ -20,6 +31,12 @@ type Server struct {
 	loginTmpl    *template.Template
 	importTmpl   *template.Template
 	settledTmpl  *template.Template // For the new export page
+	pages        map[string]*template.Template
+	prices       portfolio.PriceProvider
+	icsToken     string // Authorises calendar subscriptions, which cannot log in.
+	mailer       notify.Mailer
+	reminderOpts portfolio.ReminderOptions
+	remindEvery  time.Duration
 	sessions     *auth.SessionStore
 	useAuth      bool
 }
@@ -45,6 +62,19 @@ func NewServer(svc *portfolio.Service, useAuth bool, templateRoot string) *Serve
 			usd := float64(cents) / 100.0
 			return usd * rate
 		},
+		// unitPrice returns a stored lot or sale price in units of its currency.
+		"unitPrice": func(cents int64, rate float64) float64 {
+			return models.UnitPrice(cents, rate) / 100.0
+		},
+		// priceEUR returns a stored lot or sale price in EUR.
+		"priceEUR": func(cents int64, rate float64) float64 {
+			return models.PriceEUR(cents, rate) / 100.0
+		},
+		// eurRate returns the rate converting a lot or sale price to EUR.
+		"eurRate": func(rate float64) float64 {
+			_, eurRate := models.PriceScale(rate)
+			return eurRate
+		},
 	}
 
 	tmpl, err := template.New("index.html").Funcs(funcMap).ParseFiles(filepath.Join(templateRoot, "index.html"))
@@ -64,17 +94,70 @@ func NewServer(svc *portfolio.Service, useAuth bool, templateRoot string) *Serve
 		log.Fatalf("Failed to parse import templates: %v", err)
 	}
 
+	// Feature pages are rendered by name from the pages map.
+	pages := map[string]*template.Template{}
+	for name, file := range map[string]string{
+		"corporate_actions": "corporate_actions.html",
+		"options":           "options.html",
+		"reconciliation":    "reconciliation.html",
+		"summary":           "summary.html",
+		"dividends":         "dividends.html",
+		"securities":        "securities.html",
+		"etf":               "etf.html",
+		"transfers":         "transfers.html",
+		"household":         "household.html",
+		"residence":         "residence.html",
+		"negligible_value":  "negligible.html",
+		"grants":            "grants.html",
+		"simulate":          "simulate.html",
+		"planner":           "planner.html",
+		"valuation":         "valuation.html",
+		"price_check":       "price_check.html",
+		"worksheet":         "worksheet.html",
+		"audit":             "audit.html",
+		"tax_years":         "tax_years.html",
+		"webhooks":          "webhooks.html",
+	} {
+		page, err := template.New(file).Funcs(funcMap).ParseFiles(filepath.Join(templateRoot, file))
+		if err != nil {
+			log.Fatalf("Failed to parse %s templates: %v", name, err)
+		}
+		pages[name] = page
+	}
+
 	return &Server{
 		svc:         svc,
 		tmpl:        tmpl,
 		loginTmpl:   loginTmpl,
 		importTmpl:  importTmpl,
 		settledTmpl: settledTmpl,
+		pages:       pages,
 		sessions:    auth.NewSessionStore(),
 		useAuth:     useAuth,
 	}
 }
 
+// SetPriceProvider configures the provider used to refresh prices from the
+// valuation page. Without one, prices come only from CSV uploads and manual entry.
+func (s *Server) SetPriceProvider(provider portfolio.PriceProvider) {
+	s.prices = provider
+}
+
+// SetCalendarToken sets the secret that authorises requests for the calendar
+// feed with a "token" query parameter, so that calendar applications can
+// subscribe without a session. Without one, the feed requires a session.
+func (s *Server) SetCalendarToken(token string) {
+	s.icsToken = token
+}
+
+// SetMailer enables email reminders. Once the server starts, it checks for
+// due reminders immediately and then at every interval, emailing each one once.
+func (s *Server) SetMailer(mailer notify.Mailer, opts portfolio.ReminderOptions, interval time.Duration) {
+	s.mailer = mailer
+	s.reminderOpts = opts
+	s.remindEvery = interval
+}
+
 // Start configures the HTTP routes and starts the web server on the specified address.
 // It sets up handlers for public routes (like login) and protected application routes.
 // If authentication is enabled, it wraps the main router with an auth middleware.
@@ -94,6 +177,34 @@ func (s *Server) Start(addr string) {
 	mux.HandleFunc("/sales/", s.handleSettleOrSales)
 	mux.HandleFunc("/settled", s.handleSettled)
 	mux.HandleFunc("/import", s.handleImport)
+	mux.HandleFunc("/corporate-actions", s.handleCorporateActions)
+	mux.HandleFunc("/options", s.handleOptions)
+	mux.HandleFunc("/reconciliation", s.handleReconciliation)
+	mux.HandleFunc("/summary", s.handleSummary)
+	mux.HandleFunc("/payments", s.handleAddPayment)
+	mux.HandleFunc("/dividends", s.handleDividends)
+	mux.HandleFunc("/securities", s.handleSecurities)
+	mux.HandleFunc("/etf", s.handleETF)
+	mux.HandleFunc("/transfers", s.handleTransfers)
+	mux.HandleFunc("/household", s.handleHousehold)
+	mux.HandleFunc("/residence", s.handleResidence)
+	mux.HandleFunc("/negligible-value", s.handleNegligibleValue)
+	mux.HandleFunc("/grants", s.handleGrants)
+	mux.HandleFunc("/simulate", s.handleSimulate)
+	mux.HandleFunc("/planner", s.handlePlanner)
+	mux.HandleFunc("/valuation", s.handleValuation)
+	mux.HandleFunc("/price-check", s.handlePriceCheck)
+	mux.HandleFunc("/worksheet", s.handleWorksheet)
+	mux.HandleFunc("/audit", s.handleAudit)
+	mux.HandleFunc("/tax-years", s.handleTaxYears)
+	mux.HandleFunc("/calendar.ics", s.handleCalendar)
+	mux.HandleFunc("/webhooks", s.handleWebhooks)
+	mux.HandleFunc("/report", s.handleReport)
+
+	if s.mailer != nil {
+		go s.runReminders()
+	}
+	go s.runWebhooks()
 
 	// Apply authentication middleware if enabled
 	var handler http.Handler = mux
@@ -108,6 +219,11 @@ func (s *Server) Start(addr string) {
 // wrapAuth is a helper function that applies the authentication middleware to a given handler.
 func (s *Server) wrapAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The calendar feed checks its own token or session.
+		if r.URL.Path == "/calendar.ics" {
+			next.ServeHTTP(w, r)
+			return
+		}
 		auth.Middleware(s.sessions, next.ServeHTTP)(w, r)
 	})
 }
@@ -147,8 +263,9 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 // DataDTO is a composite struct that aggregates all the necessary data
 // for rendering the main application view (the index.html template).
     type DataDTO struct {
-        Vests []portfolio.InventoryItem
-        Sales []portfolio.SaleDTO
+        Vests   []portfolio.InventoryItem
+        Sales   []portfolio.SaleDTO
+        Persons []models.Person
     }
 
     // SettledDataDTO holds the data for the export view.
@@ -193,7 +310,7 @@ func (s *Server) handleAddVest(w http.ResponseWriter, r *http.Request) {
 	priceFloat, _ := strconv.ParseFloat(r.FormValue("price"), 64)
 	priceCents := int64(priceFloat * 100)
 
-	if _, err := s.svc.AddVest(date, symbol, qty, priceCents); err != nil {
+	if _, err := s.svc.ForPerson(r.FormValue("owner")).AddVest(date, symbol, qty, priceCents); err != nil {
 		log.Println("Error adding vest:", err)
 		http.Error(w, "Failed to add vest", http.StatusInternalServerError)
 		return
@@ -211,11 +328,12 @@ func (s *Server) handleAddSale(w http.ResponseWriter, r *http.Request) {
 	}
 
 	date := r.FormValue("date")
+	symbol := r.FormValue("symbol")
 	qty, _ := strconv.ParseFloat(r.FormValue("qty"), 64)
 	priceFloat, _ := strconv.ParseFloat(r.FormValue("price"), 64)
 	priceCents := int64(priceFloat * 100)
 
-	if _, err := s.svc.AddSale(date, qty, priceCents); err != nil {
+	if _, err := s.svc.ForPerson(r.FormValue("owner")).AddSale(date, symbol, qty, priceCents); err != nil {
 		log.Println("Error adding sale:", err)
 		http.Error(w, "Failed to add sale", http.StatusInternalServerError)
 		return
@@ -225,8 +343,8 @@ func (s *Server) handleAddSale(w http.ResponseWriter, r *http.Request) {
 
 // handleSettleOrSales provides basic routing for actions related to sales.
 // It specifically handles POST requests to "/sales/{id}/settle" to trigger the
-// CGT calculation for a given sale. After a successful settlement, it
-// re-renders the data tables for an HTMX update.
+// CGT calculation for a given sale, and "/sales/{id}/unsettle" to reverse it.
+// After a successful action, it re-renders the data tables for an HTMX update.
 func (s *Server) handleSettleOrSales(w http.ResponseWriter, r *http.Request) {
 	id := r.URL.Path[len("/sales/"):]
 	if len(id) > 36 { // Basic sanity check for UUID length
@@ -241,6 +359,15 @@ func (s *Server) handleSettleOrSales(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		s.renderTables(w)
+		return
+	}
+	if r.URL.Path == "/sales/"+id+"/unsettle" && r.Method == http.MethodPost {
+		if err := s.svc.UnsettleSale(id); err != nil {
+			log.Println("Error unsettling sale:", err)
+			http.Error(w, "Unsettle Failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.renderTables(w)
 	}
 }
 
@@ -268,12 +395,26 @@ func (s *Server) fetchData() (DataDTO, error) {
 	if err != nil {
 		return DataDTO{}, err
 	}
-	return DataDTO{Vests: vests, Sales: sales}, nil
+	persons, err := s.svc.GetPersons()
+	if err != nil {
+		return DataDTO{}, err
+	}
+	return DataDTO{Vests: vests, Sales: sales, Persons: persons}, nil
+}
+
+// ImportDTO holds the data for the import page.
+type ImportDTO struct {
+	Persons []models.Person
 }
 
 func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		s.importTmpl.Execute(w, nil)
+		persons, err := s.svc.GetPersons()
+		if err != nil {
+			http.Error(w, "Failed to fetch household members: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.importTmpl.Execute(w, ImportDTO{Persons: persons})
 		return
 	}
 
@@ -287,18 +428,57 @@ func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
 
 		importType := r.FormValue("importType")
 		symbol := r.FormValue("symbol")
+		svc := s.svc.ForPerson(r.FormValue("owner"))
 		if importType == "vests" {
 			if symbol == "" {
 				http.Error(w, "Stock symbol is required for vests", http.StatusBadRequest)
 				return
 			}
-			if err := s.svc.ImportVests(file, symbol); err != nil {
+			if err := svc.ImportVests(file, symbol); err != nil {
 				log.Println("Error importing vests:", err)
 				http.Error(w, "Failed to import vests", http.StatusInternalServerError)
 				return
 			}
+		} else if importType == "espp" {
+			if symbol == "" {
+				http.Error(w, "Stock symbol is required for ESPP purchases", http.StatusBadRequest)
+				return
+			}
+			if err := svc.ImportESPP(file, symbol); err != nil {
+				log.Println("Error importing ESPP purchases:", err)
+				http.Error(w, "Failed to import ESPP purchases", http.StatusInternalServerError)
+				return
+			}
+		} else if importType == "dividends" {
+			if err := svc.ImportDividends(file, r.FormValue("account")); err != nil {
+				log.Println("Error importing dividends:", err)
+				http.Error(w, "Failed to import dividends", http.StatusInternalServerError)
+				return
+			}
+		} else if importType == "crypto" {
+			if err := svc.ImportCrypto(file); err != nil {
+				log.Println("Error importing crypto trades:", err)
+				http.Error(w, "Failed to import crypto trades", http.StatusInternalServerError)
+				return
+			}
+		} else if importType == "prices" {
+			if err := svc.ImportPrices(file); err != nil {
+				log.Println("Error importing prices:", err)
+				http.Error(w, "Failed to import prices", http.StatusInternalServerError)
+				return
+			}
+		} else if importType == "ohlc" {
+			if symbol == "" {
+				http.Error(w, "Stock symbol is required for price histories", http.StatusBadRequest)
+				return
+			}
+			if err := svc.ImportOHLC(file, symbol); err != nil {
+				log.Println("Error importing price history:", err)
+				http.Error(w, "Failed to import price history", http.StatusInternalServerError)
+				return
+			}
 		} else if importType == "sales" {
-			if err := s.svc.ImportSales(file); err != nil {
+			if err := svc.ImportSales(file, symbol); err != nil {
 				log.Println("Error importing sales:", err)
 				http.Error(w, "Failed to import sales", http.StatusInternalServerError)
 				return
@@ -307,7 +487,1259 @@ func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Invalid import type", http.StatusBadRequest)
 			return
 		}
+		if err := svc.RecordEvent(models.EventImportCompleted, map[string]string{"type": importType, "symbol": symbol}); err != nil {
+			log.Println("Error queuing import webhooks:", err)
+		}
 
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	}
 }
+
+// CorporateActionsDTO holds the data for the corporate actions page.
+type CorporateActionsDTO struct {
+	Actions []models.CorporateAction
+	Error   string
+}
+
+// handleCorporateActions lists recorded corporate actions (GET) and applies a
+// new one from the submitted form (POST), redirecting back to the list.
+func (s *Server) handleCorporateActions(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		ratio, _ := strconv.ParseFloat(r.FormValue("ratio"), 64)
+		oldValue, _ := strconv.ParseFloat(r.FormValue("old_value"), 64)
+		newValue, _ := strconv.ParseFloat(r.FormValue("new_value"), 64)
+		cash, _ := strconv.ParseFloat(r.FormValue("cash"), 64)
+
+		action := models.CorporateAction{
+			Date:          r.FormValue("date"),
+			Type:          r.FormValue("type"),
+			Symbol:        r.FormValue("symbol"),
+			NewSymbol:     r.FormValue("new_symbol"),
+			Ratio:         ratio,
+			OldValueCents: int64(math.Round(oldValue * 100)),
+			NewValueCents: int64(math.Round(newValue * 100)),
+			CashCents:     int64(math.Round(cash * 100)),
+		}
+		if _, err := s.svc.ApplyCorporateAction(action); err != nil {
+			log.Println("Error applying corporate action:", err)
+			s.renderCorporateActions(w, err.Error())
+			return
+		}
+		http.Redirect(w, r, "/corporate-actions", http.StatusSeeOther)
+		return
+	}
+	s.renderCorporateActions(w, "")
+}
+
+// renderCorporateActions renders the corporate actions page with an optional error message.
+func (s *Server) renderCorporateActions(w http.ResponseWriter, errMsg string) {
+	actions, err := s.svc.GetCorporateActions()
+	if err != nil {
+		http.Error(w, "Failed to fetch corporate actions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.pages["corporate_actions"].Execute(w, CorporateActionsDTO{Actions: actions, Error: errMsg})
+}
+
+// OptionsDTO holds the data for the share options page.
+type OptionsDTO struct {
+	Grants    []models.OptionGrant
+	Exercises []models.OptionExercise
+	Error     string
+}
+
+// handleOptions lists option grants and exercises (GET) and records a new grant
+// or exercise from the submitted form (POST), redirecting back to the list.
+func (s *Server) handleOptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		var err error
+		switch r.FormValue("action") {
+		case "grant":
+			qty, _ := strconv.ParseFloat(r.FormValue("qty"), 64)
+			price, _ := strconv.ParseFloat(r.FormValue("price"), 64)
+			_, err = s.svc.AddOptionGrant(models.OptionGrant{
+				Symbol:             r.FormValue("symbol"),
+				GrantDate:          r.FormValue("date"),
+				Quantity:           qty,
+				ExercisePriceCents: int64(math.Round(price * 100)),
+			})
+		case "exercise":
+			date := r.FormValue("date")
+			qty, _ := strconv.ParseFloat(r.FormValue("qty"), 64)
+			price, _ := strconv.ParseFloat(r.FormValue("price"), 64)
+			rates := portfolio.RTSORatesFor(date, r.FormValue("standard_rate") == "on")
+			_, err = s.svc.ExerciseOptions(r.FormValue("grant_id"), date, qty, int64(math.Round(price*100)), rates)
+		default:
+			http.Error(w, "Invalid action", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Println("Error recording options:", err)
+			s.renderOptions(w, err.Error())
+			return
+		}
+		http.Redirect(w, r, "/options", http.StatusSeeOther)
+		return
+	}
+	s.renderOptions(w, "")
+}
+
+// renderOptions renders the share options page with an optional error message.
+func (s *Server) renderOptions(w http.ResponseWriter, errMsg string) {
+	grants, err := s.svc.GetOptionGrants()
+	if err != nil {
+		http.Error(w, "Failed to fetch option grants: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	exercises, err := s.svc.GetOptionExercises()
+	if err != nil {
+		http.Error(w, "Failed to fetch option exercises: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.pages["options"].Execute(w, OptionsDTO{Grants: grants, Exercises: exercises, Error: errMsg})
+}
+
+// ReconciliationDTO holds the data for the payroll reconciliation page.
+type ReconciliationDTO struct {
+	Vests []portfolio.VestReconciliation
+	Error string
+}
+
+// handleReconciliation shows the payroll reconciliation report (GET) and stores
+// the payslip figures entered for a vest (POST), redirecting back to the report.
+func (s *Server) handleReconciliation(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		payroll := models.VestPayroll{
+			VestID:          r.FormValue("vest_id"),
+			TaxableEURCents: parseCents(r.FormValue("taxable")),
+			PAYECents:       parseCents(r.FormValue("paye")),
+			USCCents:        parseCents(r.FormValue("usc")),
+			PRSICents:       parseCents(r.FormValue("prsi")),
+		}
+		if err := s.svc.SetVestPayroll(payroll); err != nil {
+			log.Println("Error storing payroll:", err)
+			s.renderReconciliation(w, err.Error())
+			return
+		}
+		http.Redirect(w, r, "/reconciliation", http.StatusSeeOther)
+		return
+	}
+	s.renderReconciliation(w, "")
+}
+
+// renderReconciliation renders the payroll reconciliation page with an optional error message.
+func (s *Server) renderReconciliation(w http.ResponseWriter, errMsg string) {
+	report, err := s.svc.GetPayrollReconciliation()
+	if err != nil {
+		http.Error(w, "Failed to build reconciliation: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.pages["reconciliation"].Execute(w, ReconciliationDTO{Vests: report, Error: errMsg})
+}
+
+// parseCents converts a decimal amount entered in a form (in euro or dollars)
+// to whole cents. Empty or invalid input yields zero.
+func parseCents(value string) int64 {
+	f, _ := strconv.ParseFloat(value, 64)
+	return int64(math.Round(f * 100))
+}
+
+// SummaryDTO holds the data for the annual summary page.
+type SummaryDTO struct {
+	Year          int
+	CGT           portfolio.CGTSummary
+	ForeignIncome portfolio.ForeignIncomeSummary
+	// Payments reconciles the CGT paid for each period as of today.
+	Payments []portfolio.PaymentReconciliation
+}
+
+// handleSummary renders the annual CGT computation alongside the foreign
+// dividend income for the tax year given in the "year" query parameter
+// (defaulting to the current year).
+func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
+	year := parseYear(r.URL.Query().Get("year"))
+
+	cgt, err := s.svc.GetCGTSummary(year)
+	if err != nil {
+		http.Error(w, "Failed to compute CGT summary: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	income, err := s.svc.GetForeignIncomeSummary(year)
+	if err != nil {
+		http.Error(w, "Failed to compute foreign income: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	payments, err := s.svc.ReconcileCGTPayments(year, time.Now().Format("2006-01-02"))
+	if err != nil {
+		http.Error(w, "Failed to reconcile payments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.pages["summary"].Execute(w, SummaryDTO{Year: year, CGT: cgt, ForeignIncome: income, Payments: payments})
+}
+
+// handleAddPayment records a CGT payment from the form on the annual summary
+// page and redirects back to the summary for the payment's tax year.
+func (s *Server) handleAddPayment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/summary", http.StatusSeeOther)
+		return
+	}
+	year := parseYear(r.FormValue("year"))
+	payment := models.CGTPayment{
+		Date:        r.FormValue("date"),
+		AmountCents: parseCents(r.FormValue("amount")),
+		Year:        year,
+		Period:      r.FormValue("period"),
+		Reference:   r.FormValue("reference"),
+	}
+	if _, err := s.svc.AddCGTPayment(payment); err != nil {
+		log.Println("Error adding payment:", err)
+		http.Error(w, "Failed to record payment: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/summary?year="+strconv.Itoa(year), http.StatusSeeOther)
+}
+
+// parseYear parses a tax year from a query parameter, defaulting to the current year.
+func parseYear(value string) int {
+	if year, err := strconv.Atoi(value); err == nil && year > 1900 {
+		return year
+	}
+	return time.Now().Year()
+}
+
+// DividendsDTO holds the data for the dividends page.
+type DividendsDTO struct {
+	Owner     string
+	Persons   []models.Person
+	Dividends []models.Dividend
+	Error     string
+}
+
+// handleDividends lists a household member's dividends (GET) and records a
+// new dividend for them from the submitted form (POST), redirecting back to
+// the list.
+func (s *Server) handleDividends(w http.ResponseWriter, r *http.Request) {
+	owner := r.FormValue("owner")
+	if r.Method == http.MethodPost {
+		dividend := models.Dividend{
+			Date:             r.FormValue("date"),
+			Symbol:           r.FormValue("symbol"),
+			Account:          r.FormValue("account"),
+			GrossCents:       parseCents(r.FormValue("gross")),
+			WithholdingCents: parseCents(r.FormValue("withholding")),
+		}
+		if _, err := s.svc.ForPerson(owner).AddDividend(dividend); err != nil {
+			log.Println("Error adding dividend:", err)
+			s.renderDividends(w, owner, err.Error())
+			return
+		}
+		http.Redirect(w, r, "/dividends?owner="+url.QueryEscape(owner), http.StatusSeeOther)
+		return
+	}
+	s.renderDividends(w, owner, "")
+}
+
+// renderDividends renders a household member's dividends with an optional
+// error message.
+func (s *Server) renderDividends(w http.ResponseWriter, owner, errMsg string) {
+	dividends, err := s.svc.ForPerson(owner).GetDividends()
+	if err != nil {
+		http.Error(w, "Failed to fetch dividends: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	persons, err := s.svc.GetPersons()
+	if err != nil {
+		http.Error(w, "Failed to fetch household members: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.pages["dividends"].Execute(w, DividendsDTO{Owner: owner, Persons: persons, Dividends: dividends, Error: errMsg})
+}
+
+// SecuritiesDTO holds the data for the securities page.
+type SecuritiesDTO struct {
+	Securities []models.Security
+	Error      string
+}
+
+// handleSecurities lists classified securities (GET) and sets the asset class
+// of a symbol from the submitted form (POST), redirecting back to the list.
+func (s *Server) handleSecurities(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		sec := models.Security{
+			Symbol:     r.FormValue("symbol"),
+			AssetClass: r.FormValue("asset_class"),
+			Name:       r.FormValue("name"),
+		}
+		if err := s.svc.SetSecurity(sec); err != nil {
+			log.Println("Error classifying security:", err)
+			s.renderSecurities(w, err.Error())
+			return
+		}
+		http.Redirect(w, r, "/securities", http.StatusSeeOther)
+		return
+	}
+	s.renderSecurities(w, "")
+}
+
+// renderSecurities renders the securities page with an optional error message.
+func (s *Server) renderSecurities(w http.ResponseWriter, errMsg string) {
+	securities, err := s.svc.GetSecurities()
+	if err != nil {
+		http.Error(w, "Failed to fetch securities: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.pages["securities"].Execute(w, SecuritiesDTO{Securities: securities, Error: errMsg})
+}
+
+// ETFDTO holds the data for the ETF exit tax page.
+type ETFDTO struct {
+	DeemedDisposals []portfolio.DeemedDisposal
+	Disposals       []models.ExitTaxDisposal
+	// Prices holds the current price entered for each ETF symbol, in dollars.
+	Prices map[string]string
+	Rate   string
+	Error  string
+}
+
+// handleETF renders the upcoming eight-year deemed disposals and the exit tax
+// on ETF disposals (GET), and records the deemed disposals that have fallen
+// due (POST), redirecting back to the page.
+func (s *Server) handleETF(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if _, err := s.svc.RecordDeemedDisposals(time.Now().Format("2006-01-02")); err != nil {
+			log.Println("Error recording deemed disposals:", err)
+			s.renderETF(w, r, err.Error())
+			return
+		}
+		http.Redirect(w, r, "/etf", http.StatusSeeOther)
+		return
+	}
+	s.renderETF(w, r, "")
+}
+
+// renderETF renders the ETF page with an optional error message. Current
+// prices are read from "price_<SYMBOL>" query parameters (in dollars) and
+// converted at the "rate" parameter.
+func (s *Server) renderETF(w http.ResponseWriter, r *http.Request, errMsg string) {
+	q := r.URL.Query()
+	rate, _ := strconv.ParseFloat(q.Get("rate"), 64)
+	prices := map[string]int64{}
+	entered := map[string]string{}
+	for key, values := range q {
+		if symbol, ok := strings.CutPrefix(key, "price_"); ok && values[0] != "" {
+			prices[symbol] = parseCents(values[0])
+			entered[symbol] = values[0]
+		}
+	}
+
+	upcoming, err := s.svc.GetUpcomingDeemedDisposals(time.Now(), prices, rate)
+	if err != nil {
+		http.Error(w, "Failed to compute deemed disposals: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	disposals, err := s.svc.GetExitTaxDisposals()
+	if err != nil {
+		http.Error(w, "Failed to fetch ETF disposals: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, d := range upcoming {
+		if _, ok := entered[d.Symbol]; !ok {
+			entered[d.Symbol] = ""
+		}
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.pages["etf"].Execute(w, ETFDTO{DeemedDisposals: upcoming, Disposals: disposals, Prices: entered, Rate: q.Get("rate"), Error: errMsg})
+}
+
+// TransfersDTO holds the data for the transfers page.
+type TransfersDTO struct {
+	Owner     string
+	Persons   []models.Person
+	Transfers []models.Transfer
+	// Names maps a person ID to their display name.
+	Names map[string]string
+	Error string
+}
+
+// handleTransfers lists a household member's gifts, inheritances and spouse
+// transfers (GET) and records a new transfer (POST).
+func (s *Server) handleTransfers(w http.ResponseWriter, r *http.Request) {
+	owner := r.FormValue("owner")
+	if r.Method == http.MethodPost {
+		qty, _ := strconv.ParseFloat(r.FormValue("quantity"), 64)
+		transfer := models.Transfer{
+			Date:             r.FormValue("date"),
+			Direction:        r.FormValue("direction"),
+			Type:             r.FormValue("type"),
+			Symbol:           r.FormValue("symbol"),
+			Quantity:         qty,
+			MarketValueCents: parseCents(r.FormValue("market_value")),
+			Counterparty:     r.FormValue("counterparty"),
+		}
+		if spouse, ok := r.Form["spouse"]; ok && spouse[0] != "external" {
+			transfer.SpouseInHousehold, transfer.SpouseID = true, spouse[0]
+		}
+		lotQty, lotCost := r.Form["lot_quantity"], r.Form["lot_cost"]
+		for i, date := range r.Form["lot_date"] {
+			if date == "" || i >= len(lotQty) || i >= len(lotCost) {
+				continue
+			}
+			q, _ := strconv.ParseFloat(lotQty[i], 64)
+			transfer.Lots = append(transfer.Lots, models.TransferLot{Date: date, Quantity: q, CostCents: parseCents(lotCost[i])})
+		}
+		if _, err := s.svc.ForPerson(owner).RecordTransfer(transfer); err != nil {
+			log.Println("Error recording transfer:", err)
+			s.renderTransfers(w, owner, err.Error())
+			return
+		}
+		http.Redirect(w, r, "/transfers?owner="+url.QueryEscape(owner), http.StatusSeeOther)
+		return
+	}
+	s.renderTransfers(w, owner, "")
+}
+
+// renderTransfers renders a household member's transfers with an optional
+// error message.
+func (s *Server) renderTransfers(w http.ResponseWriter, owner, errMsg string) {
+	transfers, err := s.svc.ForPerson(owner).GetTransfers()
+	if err != nil {
+		http.Error(w, "Failed to fetch transfers: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	persons, err := s.svc.GetPersons()
+	if err != nil {
+		http.Error(w, "Failed to fetch household members: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	names := map[string]string{}
+	for _, p := range persons {
+		names[p.ID] = p.Name
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.pages["transfers"].Execute(w, TransfersDTO{Owner: owner, Persons: persons, Transfers: transfers, Names: names, Error: errMsg})
+}
+
+// HouseholdDTO holds the data for the household page.
+type HouseholdDTO struct {
+	Year      int
+	Household portfolio.HouseholdSummary
+	Error     string
+}
+
+// handleHousehold shows the household CGT computation for a year (GET) and
+// adds a household member (POST).
+func (s *Server) handleHousehold(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if _, err := s.svc.AddPerson(strings.TrimSpace(r.FormValue("name"))); err != nil {
+			log.Println("Error adding person:", err)
+			s.renderHousehold(w, parseYear(""), false, err.Error())
+			return
+		}
+		http.Redirect(w, r, "/household", http.StatusSeeOther)
+		return
+	}
+	query := r.URL.Query()
+	s.renderHousehold(w, parseYear(query.Get("year")), query.Get("share_losses") == "on", "")
+}
+
+// renderHousehold renders the household page with an optional error message.
+func (s *Server) renderHousehold(w http.ResponseWriter, year int, shareLosses bool, errMsg string) {
+	household, err := s.svc.GetHouseholdSummary(year, shareLosses)
+	if err != nil {
+		http.Error(w, "Failed to compute household summary: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.pages["household"].Execute(w, HouseholdDTO{Year: year, Household: household, Error: errMsg})
+}
+
+// ResidenceDTO holds the data for the residence timeline page.
+type ResidenceDTO struct {
+	Periods []models.ResidencePeriod
+	Persons []models.Person
+	// Names maps a person ID to their display name.
+	Names map[string]string
+	Error string
+}
+
+// handleResidence lists the residence timeline (GET) and records a new
+// residence period (POST).
+func (s *Server) handleResidence(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		period := models.ResidencePeriod{
+			StartDate:          r.FormValue("start_date"),
+			EndDate:            r.FormValue("end_date"),
+			Resident:           r.FormValue("resident") == "on",
+			OrdinarilyResident: r.FormValue("ordinarily_resident") == "on",
+		}
+		if _, err := s.svc.ForPerson(r.FormValue("owner")).AddResidencePeriod(period); err != nil {
+			log.Println("Error adding residence period:", err)
+			s.renderResidence(w, err.Error())
+			return
+		}
+		http.Redirect(w, r, "/residence", http.StatusSeeOther)
+		return
+	}
+	s.renderResidence(w, "")
+}
+
+// renderResidence renders the residence timeline page with an optional error message.
+func (s *Server) renderResidence(w http.ResponseWriter, errMsg string) {
+	periods, err := s.svc.GetResidencePeriods()
+	if err != nil {
+		http.Error(w, "Failed to fetch residence periods: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	persons, err := s.svc.GetPersons()
+	if err != nil {
+		http.Error(w, "Failed to fetch household members: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	names := map[string]string{}
+	for _, p := range persons {
+		names[p.ID] = p.Name
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.pages["residence"].Execute(w, ResidenceDTO{Periods: periods, Persons: persons, Names: names, Error: errMsg})
+}
+
+// NegligibleValueDTO holds the data for the negligible value claims page.
+type NegligibleValueDTO struct {
+	Owner    string
+	Persons  []models.Person
+	Lots     []portfolio.InventoryItem
+	Claims   []models.SettledSale
+	Selected string
+	Error    string
+}
+
+// handleNegligibleValue lists a household member's negligible value claims
+// (GET) and records a claim against one of their open lots (POST).
+func (s *Server) handleNegligibleValue(w http.ResponseWriter, r *http.Request) {
+	owner := r.FormValue("owner")
+	if r.Method == http.MethodPost {
+		vestID := r.FormValue("vest_id")
+		if _, err := s.svc.ForPerson(owner).ClaimNegligibleValue(vestID, r.FormValue("date"), parseCents(r.FormValue("value"))); err != nil {
+			log.Println("Error recording negligible value claim:", err)
+			s.renderNegligibleValue(w, owner, vestID, err.Error())
+			return
+		}
+		http.Redirect(w, r, "/negligible-value?owner="+url.QueryEscape(owner), http.StatusSeeOther)
+		return
+	}
+	s.renderNegligibleValue(w, owner, r.URL.Query().Get("vest"), "")
+}
+
+// renderNegligibleValue renders a household member's lots and negligible
+// value claims with an optional error message.
+func (s *Server) renderNegligibleValue(w http.ResponseWriter, owner, selected, errMsg string) {
+	inventory, err := s.svc.GetInventory()
+	if err != nil {
+		http.Error(w, "Failed to fetch inventory: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var lots []portfolio.InventoryItem
+	for _, item := range inventory {
+		if item.OwnerID == owner {
+			lots = append(lots, item)
+		}
+	}
+	claims, err := s.svc.ForPerson(owner).GetNegligibleValueClaims()
+	if err != nil {
+		http.Error(w, "Failed to fetch claims: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	persons, err := s.svc.GetPersons()
+	if err != nil {
+		http.Error(w, "Failed to fetch household members: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.pages["negligible_value"].Execute(w, NegligibleValueDTO{
+		Owner: owner, Persons: persons, Lots: lots, Claims: claims, Selected: selected, Error: errMsg,
+	})
+}
+
+// GrantsDTO holds the data for the grants and vesting schedule page.
+type GrantsDTO struct {
+	Owner    string
+	Persons  []models.Person
+	Grants   []models.Grant
+	Schedule []models.VestTranche
+	AsOf     string
+	Error    string
+}
+
+// handleGrants lists a household member's RSU grants and their projected
+// vesting schedule (GET) and records a new grant for them (POST).
+func (s *Server) handleGrants(w http.ResponseWriter, r *http.Request) {
+	owner := r.FormValue("owner")
+	if r.Method == http.MethodPost {
+		total, _ := strconv.ParseFloat(r.FormValue("total_units"), 64)
+		cadence, _ := strconv.Atoi(r.FormValue("cadence_months"))
+		tranches, _ := strconv.Atoi(r.FormValue("tranches"))
+		cliff, _ := strconv.Atoi(r.FormValue("cliff_months"))
+
+		grant := models.Grant{
+			GrantNumber:   r.FormValue("grant_number"),
+			Symbol:        r.FormValue("symbol"),
+			Plan:          r.FormValue("plan"),
+			GrantDate:     r.FormValue("grant_date"),
+			TotalUnits:    total,
+			VestStartDate: r.FormValue("vest_start_date"),
+			CadenceMonths: cadence,
+			Tranches:      tranches,
+			CliffMonths:   cliff,
+		}
+		if _, err := s.svc.ForPerson(owner).AddGrant(grant); err != nil {
+			log.Println("Error adding grant:", err)
+			s.renderGrants(w, owner, err.Error())
+			return
+		}
+		http.Redirect(w, r, "/grants?owner="+url.QueryEscape(owner), http.StatusSeeOther)
+		return
+	}
+	s.renderGrants(w, owner, "")
+}
+
+// renderGrants renders a household member's grants page with an optional
+// error message.
+func (s *Server) renderGrants(w http.ResponseWriter, owner, errMsg string) {
+	asOf := time.Now().Format("2006-01-02")
+	svc := s.svc.ForPerson(owner)
+	grants, err := svc.GetGrants()
+	if err != nil {
+		http.Error(w, "Failed to fetch grants: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	schedule, err := svc.GetVestSchedule(asOf)
+	if err != nil {
+		http.Error(w, "Failed to project vesting schedule: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	persons, err := s.svc.GetPersons()
+	if err != nil {
+		http.Error(w, "Failed to fetch household members: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.pages["grants"].Execute(w, GrantsDTO{Owner: owner, Persons: persons, Grants: grants, Schedule: schedule, AsOf: asOf, Error: errMsg})
+}
+
+// SimulateDTO holds the form values and result for the sale simulator page.
+type SimulateDTO struct {
+	Date     string
+	Symbol   string
+	Quantity string
+	Price    string
+	Owner    string
+	// Target, Rate and Fee are set when solving for a net amount instead.
+	Target     string
+	Rate       string
+	Fee        string
+	Persons    []models.Person
+	Simulation *portfolio.SaleSimulation
+	Error      string
+}
+
+// handleSimulate shows what a hypothetical sale would cost in tax, or, when a
+// target is given, the smallest sale that nets that amount. Nothing is
+// persisted, so the forms are submitted with GET.
+func (s *Server) handleSimulate(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	data := SimulateDTO{
+		Date:     query.Get("date"),
+		Symbol:   query.Get("symbol"),
+		Quantity: query.Get("qty"),
+		Price:    query.Get("price"),
+		Owner:    query.Get("owner"),
+		Target:   query.Get("target"),
+		Rate:     query.Get("rate"),
+		Fee:      query.Get("fee"),
+	}
+	if data.Date == "" {
+		data.Date = time.Now().Format("2006-01-02")
+	}
+
+	persons, err := s.svc.GetPersons()
+	if err != nil {
+		http.Error(w, "Failed to fetch household members: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Persons = persons
+
+	var sim *portfolio.SaleSimulation
+	switch {
+	case data.Target != "":
+		rate, _ := strconv.ParseFloat(data.Rate, 64)
+		sim, err = s.svc.ForPerson(data.Owner).SolveNetProceeds(data.Date, data.Symbol, parseCents(data.Target), parseCents(data.Price), rate, parseCents(data.Fee))
+	case data.Quantity != "":
+		qty, _ := strconv.ParseFloat(data.Quantity, 64)
+		sim, err = s.svc.ForPerson(data.Owner).SimulateSale(data.Date, data.Symbol, qty, parseCents(data.Price))
+	}
+	if err != nil {
+		data.Error = err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	data.Simulation = sim
+	s.pages["simulate"].Execute(w, data)
+}
+
+// PlannerDTO holds the form values and proposed schedule for the sale planner page.
+type PlannerDTO struct {
+	Symbol    string
+	Quantity  string
+	StartYear string
+	Years     string
+	Prices    string
+	Rate      string
+	Owner     string
+	Persons   []models.Person
+	Plan      *portfolio.SalePlan
+	Error     string
+}
+
+// handlePlanner proposes a multi-year schedule of sales. Nothing is persisted,
+// so the form is submitted with GET; format=csv downloads the plan instead.
+func (s *Server) handlePlanner(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	data := PlannerDTO{
+		Symbol:    query.Get("symbol"),
+		Quantity:  query.Get("qty"),
+		StartYear: query.Get("start"),
+		Years:     query.Get("years"),
+		Prices:    query.Get("prices"),
+		Rate:      query.Get("rate"),
+		Owner:     query.Get("owner"),
+	}
+	if data.StartYear == "" {
+		data.StartYear = strconv.Itoa(time.Now().Year())
+	}
+
+	persons, err := s.svc.GetPersons()
+	if err != nil {
+		http.Error(w, "Failed to fetch household members: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Persons = persons
+
+	if data.Quantity != "" {
+		req := portfolio.PlanRequest{Symbol: data.Symbol, StartYear: parseYear(data.StartYear), From: time.Now().Format("2006-01-02")}
+		req.Quantity, _ = strconv.ParseFloat(data.Quantity, 64)
+		req.Years, _ = strconv.Atoi(data.Years)
+		req.Rate, _ = strconv.ParseFloat(data.Rate, 64)
+		for _, price := range strings.Split(data.Prices, ",") {
+			if price = strings.TrimSpace(price); price != "" {
+				req.PriceCents = append(req.PriceCents, parseCents(price))
+			}
+		}
+		data.Plan, err = s.svc.ForPerson(data.Owner).PlanSales(req)
+		if err != nil {
+			data.Error = err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+		} else if query.Get("format") == "csv" {
+			writePlanCSV(w, data.Plan)
+			return
+		}
+	}
+	s.pages["planner"].Execute(w, data)
+}
+
+// writePlanCSV writes a sale plan as a CSV download, with amounts in major units.
+func writePlanCSV(w http.ResponseWriter, plan *portfolio.SalePlan) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="sale-plan.csv"`)
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"Year", "Period", "Date", "Symbol", "Quantity", "Price USD", "Rate", "Proceeds EUR", "Gain EUR", "Exemption Used EUR", "Tax EUR", "Warning"})
+	for _, sale := range plan.Sales {
+		out.Write([]string{
+			strconv.Itoa(sale.Year),
+			sale.Period,
+			sale.Date,
+			plan.Symbol,
+			strconv.FormatFloat(sale.Quantity, 'f', -1, 64),
+			formatCents(sale.PriceCents),
+			strconv.FormatFloat(plan.ECBRate, 'f', -1, 64),
+			formatCents(sale.ProceedsEURCents),
+			formatCents(sale.GainEURCents),
+			formatCents(sale.ExemptionUsedCents),
+			formatCents(sale.TaxCents),
+			sale.Warning,
+		})
+	}
+	out.Flush()
+}
+
+// formatCents formats an amount in cents as major units with two decimals.
+func formatCents(cents int64) string {
+	return strconv.FormatFloat(float64(cents)/100, 'f', 2, 64)
+}
+
+// ValuationDTO holds the data for the valuation page.
+type ValuationDTO struct {
+	Valuation   *portfolio.Valuation
+	Owner       string
+	Persons     []models.Person
+	HasProvider bool
+	Error       string
+}
+
+// handleValuation shows the market value and unrealised gain of the open lots
+// (GET), stores a price entered by hand (POST) or refreshes prices from the
+// configured provider (POST with action=refresh).
+func (s *Server) handleValuation(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		today := time.Now().Format("2006-01-02")
+		if r.FormValue("action") == "refresh" {
+			if s.prices == nil {
+				s.renderValuation(w, "", "No price provider is configured")
+				return
+			}
+			stored, err := s.svc.RefreshPrices(s.prices, today)
+			if err != nil {
+				log.Println("Error refreshing prices:", err)
+				s.renderValuation(w, "", err.Error())
+				return
+			}
+			log.Printf("Refreshed %d prices from %s", stored, s.prices.Name())
+		} else {
+			price := models.Price{
+				Symbol:     r.FormValue("symbol"),
+				Date:       r.FormValue("date"),
+				PriceCents: parseCents(r.FormValue("price")),
+			}
+			if err := s.svc.SetPrice(price); err != nil {
+				log.Println("Error storing price:", err)
+				s.renderValuation(w, "", err.Error())
+				return
+			}
+		}
+		http.Redirect(w, r, "/valuation", http.StatusSeeOther)
+		return
+	}
+	s.renderValuation(w, r.URL.Query().Get("owner"), "")
+}
+
+// renderValuation renders the valuation page for a household member with an
+// optional error message.
+func (s *Server) renderValuation(w http.ResponseWriter, owner, errMsg string) {
+	persons, err := s.svc.GetPersons()
+	if err != nil {
+		http.Error(w, "Failed to fetch household members: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := ValuationDTO{Owner: owner, Persons: persons, HasProvider: s.prices != nil, Error: errMsg}
+	data.Valuation, err = s.svc.ForPerson(owner).GetValuation(time.Now().Format("2006-01-02"))
+	if err != nil && data.Error == "" {
+		data.Error = err.Error()
+	}
+	if data.Error != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.pages["valuation"].Execute(w, data)
+}
+
+// PriceCheckDTO holds the data for the price check page.
+type PriceCheckDTO struct {
+	// Tolerance is the allowed deviation in percent.
+	Tolerance  float64
+	Deviations []portfolio.PriceDeviation
+	Error      string
+}
+
+// handlePriceCheck lists vests and sales whose recorded price lies outside the
+// day's trading range by more than the tolerance given in percent.
+func (s *Server) handlePriceCheck(w http.ResponseWriter, r *http.Request) {
+	data := PriceCheckDTO{Tolerance: portfolio.DefaultPriceTolerance * 100}
+	if value := r.URL.Query().Get("tolerance"); value != "" {
+		data.Tolerance, _ = strconv.ParseFloat(value, 64)
+	}
+
+	deviations, err := s.svc.CheckRecordedPrices(data.Tolerance / 100)
+	if err != nil {
+		data.Error = err.Error()
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	data.Deviations = deviations
+	s.pages["price_check"].Execute(w, data)
+}
+
+// WorksheetDTO holds the data for the return worksheet page.
+type WorksheetDTO struct {
+	Owner     string
+	Persons   []models.Person
+	Worksheet *portfolio.CGTWorksheet
+}
+
+// handleWorksheet renders the Form 11 / Form 12 capital gains panel for a
+// person and tax year as a printable page, or as JSON with format=json.
+func (s *Server) handleWorksheet(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	owner := query.Get("owner")
+	ws, err := s.svc.ForPerson(owner).GetCGTWorksheet(parseYear(query.Get("year")))
+	if err != nil {
+		http.Error(w, "Failed to compute worksheet: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if query.Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ws)
+		return
+	}
+
+	persons, err := s.svc.GetPersons()
+	if err != nil {
+		http.Error(w, "Failed to fetch household members: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.pages["worksheet"].Execute(w, WorksheetDTO{Owner: owner, Persons: persons, Worksheet: ws})
+}
+
+// AuditDTO holds the data for the audit pack page.
+type AuditDTO struct {
+	Owner   string
+	Persons []models.Person
+	Pack    *portfolio.AuditPack
+	// Attachments lists all uploaded evidence, not only the year's.
+	Attachments []models.Attachment
+	Error       string
+}
+
+// handleAudit shows the audit pack for a person and tax year, with download=1
+// streams it as a zip archive, and on POST attaches an uploaded evidence file
+// to one of the year's vests or sales.
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if err := r.ParseMultipartForm(portfolio.MaxAttachmentBytes); err != nil {
+			http.Error(w, "Failed to read upload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		owner, year := r.FormValue("owner"), parseYear(r.FormValue("year"))
+		file, header, err := r.FormFile("evidence")
+		if err != nil {
+			s.renderAudit(w, owner, year, "Choose a file to attach")
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, portfolio.MaxAttachmentBytes+1))
+		if err != nil {
+			http.Error(w, "Failed to read upload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		entityType, entityID, _ := strings.Cut(r.FormValue("record"), ":")
+		attachment := models.Attachment{
+			EntityType:  entityType,
+			EntityID:    entityID,
+			Filename:    header.Filename,
+			ContentType: header.Header.Get("Content-Type"),
+			Data:        data,
+		}
+		if _, err := s.svc.AddAttachment(attachment); err != nil {
+			log.Println("Error adding attachment:", err)
+			s.renderAudit(w, owner, year, err.Error())
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/audit?year=%d&owner=%s", year, url.QueryEscape(owner)), http.StatusSeeOther)
+		return
+	}
+
+	query := r.URL.Query()
+	owner, year := query.Get("owner"), parseYear(query.Get("year"))
+	if query.Get("download") != "" {
+		// Build the archive in memory so a failure can still be reported.
+		var buf bytes.Buffer
+		if err := s.svc.ForPerson(owner).WriteAuditPack(&buf, year); err != nil {
+			http.Error(w, "Failed to build audit pack: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=audit-pack-%d.zip", year))
+		w.Write(buf.Bytes())
+		return
+	}
+	s.renderAudit(w, owner, year, "")
+}
+
+// renderAudit renders the audit pack page with an optional error message.
+func (s *Server) renderAudit(w http.ResponseWriter, owner string, year int, errMsg string) {
+	pack, err := s.svc.ForPerson(owner).GetAuditPack(year)
+	if err != nil {
+		http.Error(w, "Failed to build audit pack: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	attachments, err := s.svc.GetAttachments()
+	if err != nil {
+		http.Error(w, "Failed to fetch attachments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	persons, err := s.svc.GetPersons()
+	if err != nil {
+		http.Error(w, "Failed to fetch household members: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.pages["audit"].Execute(w, AuditDTO{Owner: owner, Persons: persons, Pack: pack, Attachments: attachments, Error: errMsg})
+}
+
+// TaxYearsDTO holds the data for the tax year close and amendment page.
+type TaxYearsDTO struct {
+	Owner      string
+	Persons    []models.Person
+	Deltas     []portfolio.YearDelta
+	Amendments []models.YearAmendment
+	// Year is the default for the close form: the last tax year.
+	Year  int
+	Error string
+}
+
+// handleTaxYears lists a person's closed years with any change since filing
+// (GET), and closes or reopens a year for amendment (POST), redirecting back.
+func (s *Server) handleTaxYears(w http.ResponseWriter, r *http.Request) {
+	owner := r.FormValue("owner")
+	if r.Method == http.MethodPost {
+		svc := s.svc.ForPerson(owner)
+		year, err := strconv.Atoi(r.FormValue("year"))
+		if err == nil {
+			if r.FormValue("action") == "reopen" {
+				_, err = svc.ReopenYear(year, r.FormValue("reason"))
+			} else {
+				_, err = svc.CloseYear(year)
+			}
+		}
+		if err != nil {
+			log.Println("Error updating tax year:", err)
+			s.renderTaxYears(w, owner, err.Error())
+			return
+		}
+		http.Redirect(w, r, "/tax-years?owner="+url.QueryEscape(owner), http.StatusSeeOther)
+		return
+	}
+	s.renderTaxYears(w, owner, "")
+}
+
+// renderTaxYears renders the tax year page with an optional error message.
+func (s *Server) renderTaxYears(w http.ResponseWriter, owner, errMsg string) {
+	svc := s.svc.ForPerson(owner)
+	deltas, err := svc.GetYearDeltas()
+	if err != nil {
+		http.Error(w, "Failed to compare closed years: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	amendments, err := svc.GetYearAmendments()
+	if err != nil {
+		http.Error(w, "Failed to fetch amendments: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	persons, err := s.svc.GetPersons()
+	if err != nil {
+		http.Error(w, "Failed to fetch household members: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.pages["tax_years"].Execute(w, TaxYearsDTO{
+		Owner:      owner,
+		Persons:    persons,
+		Deltas:     deltas,
+		Amendments: amendments,
+		Year:       time.Now().Year() - 1,
+		Error:      errMsg,
+	})
+}
+
+// handleCalendar serves the tax deadlines and projected vests of a person as
+// an iCalendar feed. When authentication is enabled, the request must carry
+// the calendar token or a valid session.
+func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
+	if !s.calendarAuthorised(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	events, err := s.svc.ForPerson(r.URL.Query().Get("owner")).GetTaxCalendar(time.Now().Format("2006-01-02"))
+	if err != nil {
+		http.Error(w, "Failed to build calendar: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", "inline; filename=cgt-calendar.ics")
+	portfolio.WriteCalendar(w, "Irish CGT Tracker", events)
+}
+
+// calendarAuthorised reports whether a calendar request carries the calendar
+// token or, failing that, a valid session.
+func (s *Server) calendarAuthorised(r *http.Request) bool {
+	token := r.URL.Query().Get("token")
+	if s.icsToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.icsToken)) == 1 {
+		return true
+	}
+	if !s.useAuth {
+		return true
+	}
+	cookie, err := r.Cookie("session_token")
+	return err == nil && s.sessions.IsValid(cookie.Value)
+}
+
+// runReminders sends due reminders now and then at every reminder interval.
+func (s *Server) runReminders() {
+	interval := s.remindEvery
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := s.sendReminders(time.Now().Format("2006-01-02")); err != nil {
+			log.Printf("Reminder check failed after %d sent: %v", n, err)
+		} else if n > 0 {
+			log.Printf("Sent %d reminders", n)
+		}
+		<-ticker.C
+	}
+}
+
+// sendReminders emails each reminder due on a date and records it as sent, so
+// it is not sent again. A reminder that fails to send is retried at the next
+// check.
+//
+// Returns:
+//   - The number of reminders sent.
+//   - An error if the reminders could not be listed or an email failed.
+func (s *Server) sendReminders(asOf string) (int, error) {
+	reminders, err := s.svc.GetDueReminders(asOf, s.reminderOpts)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, r := range reminders {
+		if err := s.mailer.Send(r.Subject, r.Body); err != nil {
+			return sent, err
+		}
+		if err := s.svc.MarkReminderSent(r.Key); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// WebhooksDTO holds the data for the webhook configuration page.
+type WebhooksDTO struct {
+	Webhooks   []models.Webhook
+	Deliveries []models.WebhookDelivery
+	Events     []string
+	Error      string
+}
+
+// handleWebhooks lists the webhooks and recent deliveries (GET), and adds or
+// deletes a webhook or replays a delivery (POST).
+func (s *Server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		var err error
+		switch r.FormValue("action") {
+		case "delete":
+			err = s.svc.DeleteWebhook(r.FormValue("id"))
+		case "replay":
+			err = s.svc.ReplayWebhookDelivery(r.FormValue("id"))
+		default:
+			_, err = s.svc.AddWebhook(models.Webhook{
+				URL:    r.FormValue("url"),
+				Secret: r.FormValue("secret"),
+				Events: r.Form["events"],
+			})
+		}
+		if err != nil {
+			log.Println("Error updating webhooks:", err)
+			s.renderWebhooks(w, err.Error())
+			return
+		}
+		http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+		return
+	}
+	s.renderWebhooks(w, "")
+}
+
+// renderWebhooks renders the webhook page with an optional error message.
+func (s *Server) renderWebhooks(w http.ResponseWriter, errMsg string) {
+	webhooks, err := s.svc.GetWebhooks()
+	if err != nil {
+		http.Error(w, "Failed to fetch webhooks: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	deliveries, err := s.svc.GetWebhookDeliveries(50)
+	if err != nil {
+		http.Error(w, "Failed to fetch webhook deliveries: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if errMsg != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	s.pages["webhooks"].Execute(w, WebhooksDTO{
+		Webhooks:   webhooks,
+		Deliveries: deliveries,
+		Events:     portfolio.WebhookEvents,
+		Error:      errMsg,
+	})
+}
+
+// runWebhooks posts queued webhook deliveries every few seconds.
+func (s *Server) runWebhooks() {
+	client := &http.Client{Timeout: 10 * time.Second}
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := s.svc.DeliverWebhooks(client, time.Now()); err != nil {
+			log.Printf("Webhook delivery failed: %v", err)
+		}
+	}
+}
+
+// handleReport downloads the annual CGT report of a person and tax year as a PDF.
+func (s *Server) handleReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	year := parseYear(query.Get("year"))
+	// Build the report in memory so a failure can still be reported.
+	var buf bytes.Buffer
+	if err := s.svc.ForPerson(query.Get("owner")).WriteCGTReport(&buf, year); err != nil {
+		http.Error(w, "Failed to build report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=cgt-report-%d.pdf", year))
+	w.Write(buf.Bytes())
+}
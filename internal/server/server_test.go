@@ -1,18 +1,27 @@
 package server
 
 import (
+	"archive/zip"
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
+	"irish-cgt-tracker/internal/currency"
 	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/models"
 	"irish-cgt-tracker/internal/portfolio"
 )
 
 func TestHandleImport(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
 	db, cleanup := db.NewTestDB(t)
 	defer cleanup()
 
@@ -84,3 +93,899 @@ func TestHandleImport(t *testing.T) {
 		t.Errorf("expected price 100, got %d", sales[0].PriceCents)
 	}
 }
+
+func TestHandleCorporateActions(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	if _, err := svc.AddVest("2022-01-01", "OLD", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+
+	form := url.Values{
+		"type":       {"MERGER"},
+		"date":       {"2024-01-02"},
+		"symbol":     {"OLD"},
+		"new_symbol": {"NEW"},
+		"ratio":      {"2"},
+		"new_value":  {"75.00"},
+	}
+	req, _ := http.NewRequest("POST", "/corporate-actions", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	server.handleCorporateActions(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	inventory, _ := svc.GetInventory()
+	if len(inventory) != 1 || inventory[0].Symbol != "NEW" || inventory[0].Quantity != 20 {
+		t.Fatalf("expected the OLD lot to be replaced by 20 NEW shares, got %+v", inventory)
+	}
+
+	req, _ = http.NewRequest("GET", "/corporate-actions", nil)
+	rr = httptest.NewRecorder()
+	server.handleCorporateActions(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "MERGER") {
+		t.Errorf("expected the merger to be listed, got %d", rr.Code)
+	}
+}
+
+func TestHandleOptions(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	form := url.Values{"action": {"grant"}, "date": {"2021-05-01"}, "symbol": {"ACME"}, "qty": {"100"}, "price": {"10.00"}}
+	req, _ := http.NewRequest("POST", "/options", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	server.handleOptions(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	grants, _ := svc.GetOptionGrants()
+	if len(grants) != 1 {
+		t.Fatalf("expected 1 grant, got %d", len(grants))
+	}
+
+	form = url.Values{"action": {"exercise"}, "grant_id": {grants[0].ID}, "date": {"2024-02-01"}, "qty": {"10"}, "price": {"30.00"}}
+	req, _ = http.NewRequest("POST", "/options", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	server.handleOptions(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/options", nil)
+	rr = httptest.NewRecorder()
+	server.handleOptions(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "2024-03-02") {
+		t.Errorf("expected the RTSO1 deadline to be listed, got %d", rr.Code)
+	}
+}
+
+func TestHandleReconciliation(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	vest, err := svc.AddVest("2024-01-10", "GOOGL", 10, 10000)
+	if err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+
+	form := url.Values{"vest_id": {vest.ID}, "taxable": {"950.00"}, "paye": {"380.00"}}
+	req, _ := http.NewRequest("POST", "/reconciliation", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	server.handleReconciliation(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/reconciliation", nil)
+	rr = httptest.NewRecorder()
+	server.handleReconciliation(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Mismatch") {
+		t.Errorf("expected the vest to be flagged, got %d", rr.Code)
+	}
+}
+
+func TestHandleSummary(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	form := url.Values{"date": {"2025-06-16"}, "symbol": {"GOOGL"}, "account": {"Broker"}, "gross": {"100.00"}, "withholding": {"15.00"}}
+	req, _ := http.NewRequest("POST", "/dividends", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	server.handleDividends(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/summary?year=2025", nil)
+	rr = httptest.NewRecorder()
+	server.handleSummary(rr, req)
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || !strings.Contains(body, "Annual Summary 2025") || !strings.Contains(body, "2025-12-15") {
+		t.Errorf("expected the 2025 summary with its payment deadlines, got %d", rr.Code)
+	}
+	if !strings.Contains(body, "90.00") {
+		t.Error("expected the dividend converted at 0.9 to be listed in the foreign income summary")
+	}
+}
+
+func TestHandleETF(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	form := url.Values{"symbol": {"VWCE"}, "asset_class": {"ETF"}}
+	req, _ := http.NewRequest("POST", "/securities", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	server.handleSecurities(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if _, err := svc.AddVest("2020-02-03", "VWCE", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+
+	req, _ = http.NewRequest("GET", "/etf?price_VWCE=150.00&rate=1", nil)
+	rr = httptest.NewRecorder()
+	server.handleETF(rr, req)
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || !strings.Contains(body, "2028-02-03") {
+		t.Errorf("expected the 2028 deemed disposal to be listed, got %d", rr.Code)
+	}
+	// Gain of 10 x ($150 - $90 cost at 0.9) = EUR 600, taxed at 41%.
+	if !strings.Contains(body, "246.00") {
+		t.Error("expected the estimated exit tax to be shown")
+	}
+
+	// A lot past its eighth anniversary cannot be recorded without a price.
+	svc.AddVest("2010-01-15", "VWCE", 5, 10000)
+	req, _ = http.NewRequest("POST", "/etf", nil)
+	rr = httptest.NewRecorder()
+	server.handleETF(rr, req)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "no price of VWCE") {
+		t.Errorf("expected the missing price to be reported, got %d", rr.Code)
+	}
+	svc.SetPrice(models.Price{Symbol: "VWCE", Date: "2018-01-15", PriceCents: 15000})
+	svc.SetPrice(models.Price{Symbol: "VWCE", Date: "2026-01-15", PriceCents: 20000})
+	rr = httptest.NewRecorder()
+	server.handleETF(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d: %s", rr.Code, rr.Body.String())
+	}
+	disposals, _ := svc.GetExitTaxDisposals()
+	if len(disposals) != 2 || disposals[0].Type != "DEEMED" || disposals[1].Type != "DEEMED" {
+		t.Errorf("expected the 2018 and 2026 deemed disposals to be recorded, got %+v", disposals)
+	}
+}
+
+func TestHandleTransfers(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	form := url.Values{
+		"direction":    {"IN"},
+		"type":         {"INHERITANCE"},
+		"date":         {"2024-02-01"},
+		"symbol":       {"ACME"},
+		"quantity":     {"10"},
+		"market_value": {"120.00"},
+		"counterparty": {"Estate"},
+	}
+	req, _ := http.NewRequest("POST", "/transfers", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	server.handleTransfers(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	inventory, _ := svc.GetInventory()
+	if len(inventory) != 1 || inventory[0].StrikePriceCents != 12000 {
+		t.Fatalf("expected an inherited lot at market value, got %+v", inventory)
+	}
+
+	form.Set("direction", "OUT")
+	req, _ = http.NewRequest("POST", "/transfers", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	server.handleTransfers(rr, req)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "only be transferred in") {
+		t.Errorf("expected a validation error, got %d", rr.Code)
+	}
+
+	// A spouse transfer to a household member is listed on their side.
+	spouse, _ := svc.AddPerson("Alex")
+	form = url.Values{
+		"owner":     {""},
+		"direction": {"OUT"},
+		"type":      {"SPOUSE"},
+		"date":      {"2024-03-01"},
+		"symbol":    {"ACME"},
+		"quantity":  {"4"},
+		"spouse":    {spouse.ID},
+	}
+	req, _ = http.NewRequest("POST", "/transfers", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	server.handleTransfers(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d: %s", rr.Code, rr.Body.String())
+	}
+	req, _ = http.NewRequest("GET", "/transfers?owner="+spouse.ID, nil)
+	rr = httptest.NewRecorder()
+	server.handleTransfers(rr, req)
+	if body := rr.Body.String(); !strings.Contains(body, "2024-02-01, 4, 120.00") || strings.Contains(body, "Estate") {
+		t.Errorf("expected only the spouse's transfer in with its lot, got %s", body)
+	}
+}
+
+func TestHandleHousehold(t *testing.T) {
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	form := url.Values{"name": {"Spouse"}}
+	req, _ := http.NewRequest("POST", "/household", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	server.handleHousehold(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/household?year=2024&share_losses=on", nil)
+	rr = httptest.NewRecorder()
+	server.handleHousehold(rr, req)
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || !strings.Contains(body, "Spouse") || !strings.Contains(body, "Primary") {
+		t.Errorf("expected both household members to be listed, got %d", rr.Code)
+	}
+}
+
+func TestHandleResidence(t *testing.T) {
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	form := url.Values{
+		"owner":      {""},
+		"start_date": {"2021-07-01"},
+		"end_date":   {"2023-06-30"},
+	}
+	req, _ := http.NewRequest("POST", "/residence", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	server.handleResidence(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	form.Set("start_date", "2023-01-01")
+	req, _ = http.NewRequest("POST", "/residence", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	server.handleResidence(rr, req)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "overlaps") {
+		t.Errorf("expected an overlap error, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "2021-07-01") {
+		t.Error("expected the existing period to be listed")
+	}
+}
+
+func TestHandleNegligibleValue(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	vest, err := svc.AddVest("2020-01-01", "DEAD", 10, 5000)
+	if err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "/negligible-value?vest="+vest.ID, nil)
+	rr := httptest.NewRecorder()
+	server.handleNegligibleValue(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `value="`+vest.ID+`" selected`) {
+		t.Fatalf("expected the lot to be preselected, got %d", rr.Code)
+	}
+
+	form := url.Values{"vest_id": {vest.ID}, "date": {"2024-05-01"}, "value": {"0.01"}}
+	req, _ = http.NewRequest("POST", "/negligible-value", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	server.handleNegligibleValue(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	inventory, _ := svc.GetInventory()
+	if len(inventory) != 1 || inventory[0].ID == vest.ID || inventory[0].StrikePriceCents != 1 {
+		t.Errorf("expected the claimed lot to be replaced by a successor lot, got %+v", inventory)
+	}
+
+	// Another person's lots and claims are listed on their own page.
+	spouse, _ := svc.AddPerson("Alex")
+	theirs, _ := svc.ForPerson(spouse.ID).AddVest("2021-01-01", "GONE", 5, 4000)
+	req, _ = http.NewRequest("GET", "/negligible-value?owner="+spouse.ID+"&vest="+theirs.ID, nil)
+	rr = httptest.NewRecorder()
+	server.handleNegligibleValue(rr, req)
+	if body := rr.Body.String(); !strings.Contains(body, `value="`+theirs.ID+`" selected`) || strings.Contains(body, "DEAD") {
+		t.Errorf("expected only the spouse's lot, got %s", body)
+	}
+}
+
+func TestHandleGrants(t *testing.T) {
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	form := url.Values{
+		"grant_number":    {"C123"},
+		"symbol":          {"GOOG"},
+		"grant_date":      {"2030-01-01"},
+		"vest_start_date": {"2030-01-01"},
+		"total_units":     {"40"},
+		"tranches":        {"4"},
+		"cadence_months":  {"3"},
+	}
+	req, _ := http.NewRequest("POST", "/grants", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	server.handleGrants(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected status 303, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/grants", nil)
+	rr = httptest.NewRecorder()
+	server.handleGrants(rr, req)
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || !strings.Contains(body, "2030-04-01") || !strings.Contains(body, "UPCOMING") {
+		t.Errorf("expected the projected tranches to be listed, got %d", rr.Code)
+	}
+}
+
+func TestHandleSimulate(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	if _, err := svc.AddVest("2022-01-01", "ACME", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "/simulate?date=2024-03-01&symbol=ACME&qty=4&price=300.00", nil)
+	rr := httptest.NewRecorder()
+	server.handleSimulate(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Matched Lots") {
+		t.Fatalf("expected a simulation result, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	inventory, _ := svc.GetInventory()
+	if len(inventory) != 1 || inventory[0].RemainingQty != 10 {
+		t.Errorf("the simulation must not change the inventory, got %+v", inventory)
+	}
+
+	req, _ = http.NewRequest("GET", "/simulate?date=2024-03-01&symbol=ACME&qty=40&price=300.00", nil)
+	rr = httptest.NewRecorder()
+	server.handleSimulate(rr, req)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "insufficient shares") {
+		t.Errorf("expected an insufficient shares error, got %d", rr.Code)
+	}
+
+	// At $300 and 0.9 each share nets 270 EUR, with the gain inside the exemption.
+	req, _ = http.NewRequest("GET", "/simulate?date=2024-03-01&symbol=ACME&target=1000.00&price=300.00&rate=0.9", nil)
+	rr = httptest.NewRecorder()
+	server.handleSimulate(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Selling 4 shares") {
+		t.Errorf("expected a 4 share solution, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// A crypto lot shows its EUR cost per unit rather than the stored price.
+	if _, err := svc.RecordCryptoTrade(models.CryptoTradeRecord{Date: "2024-01-05", Type: models.CryptoBuy, Asset: "BTC", Quantity: 1, ValueEURCents: 2000000}); err != nil {
+		t.Fatalf("RecordCryptoTrade failed: %v", err)
+	}
+	req, _ = http.NewRequest("GET", "/simulate?date=2024-06-01&symbol=BTC&qty=0.5&price=50000.00", nil)
+	rr = httptest.NewRecorder()
+	server.handleSimulate(rr, req)
+	if body := rr.Body.String(); rr.Code != http.StatusOK || !strings.Contains(body, "<td>20000.00</td>") {
+		t.Errorf("expected the crypto lot's cost in EUR, got %d: %s", rr.Code, body)
+	}
+}
+
+func TestHandlePlanner(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	if _, err := svc.AddVest("2022-01-01", "ACME", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+
+	start := time.Now().Year() + 1
+	query := fmt.Sprintf("/planner?symbol=ACME&qty=10&start=%d&years=2&prices=400.00&rate=1", start)
+	req, _ := http.NewRequest("GET", query, nil)
+	rr := httptest.NewRecorder()
+	server.handlePlanner(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Proposed Sales") {
+		t.Fatalf("expected a plan, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", query+"&format=csv", nil)
+	rr = httptest.NewRecorder()
+	server.handlePlanner(rr, req)
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	if rr.Header().Get("Content-Type") != "text/csv" || len(lines) != 3 {
+		t.Fatalf("expected a CSV with a header and two sales, got %q", rr.Body.String())
+	}
+	if !strings.HasPrefix(lines[1], fmt.Sprintf("%d,", start)) || !strings.Contains(lines[1], ",ACME,4,400.00,") {
+		t.Errorf("unexpected first planned sale: %s", lines[1])
+	}
+}
+
+func TestHandleValuation(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	if _, err := svc.AddVest("2022-01-01", "ACME", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+
+	form := url.Values{"symbol": {"ACME"}, "date": {"2024-01-02"}, "price": {"250.00"}}
+	req, _ := http.NewRequest("POST", "/valuation", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	server.handleValuation(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect after saving a price, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// 10 shares at $250 and 0.9 against a cost of $100 at 0.9.
+	req, _ = http.NewRequest("GET", "/valuation", nil)
+	rr = httptest.NewRecorder()
+	server.handleValuation(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "2250.00") || !strings.Contains(rr.Body.String(), "1350.00") {
+		t.Errorf("expected the lot valued at 2250.00 with a 1350.00 gain, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	form = url.Values{"action": {"refresh"}}
+	req, _ = http.NewRequest("POST", "/valuation", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	server.handleValuation(rr, req)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "No price provider") {
+		t.Errorf("expected an error without a price provider, got %d", rr.Code)
+	}
+}
+
+func TestHandlePriceCheck(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	ohlc := "Date,Open,High,Low,Close\n2024-03-01,100.00,105.00,98.00,102.00\n"
+	if err := svc.ImportOHLC(strings.NewReader(ohlc), "ACME"); err != nil {
+		t.Fatalf("ImportOHLC failed: %v", err)
+	}
+	if _, err := svc.AddVest("2024-03-01", "ACME", 10, 120000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "/price-check", nil)
+	rr := httptest.NewRecorder()
+	server.handlePriceCheck(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "1200.00") || !strings.Contains(rr.Body.String(), "1042.9%") {
+		t.Errorf("expected the mistyped vest price to be flagged, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/price-check?tolerance=-1", nil)
+	rr = httptest.NewRecorder()
+	server.handlePriceCheck(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a negative tolerance to be rejected, got %d", rr.Code)
+	}
+}
+
+func TestHandleWorksheet(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	if _, err := svc.AddVest("2022-01-01", "ACME", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	sale, _ := svc.AddSale("2024-03-01", "ACME", 10, 40000)
+	if err := svc.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "/worksheet?year=2024", nil)
+	rr := httptest.NewRecorder()
+	server.handleWorksheet(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Shares or securities (quoted)") {
+		t.Fatalf("expected the printable worksheet, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/worksheet?year=2024&format=json", nil)
+	rr = httptest.NewRecorder()
+	server.handleWorksheet(rr, req)
+	var ws portfolio.CGTWorksheet
+	if err := json.NewDecoder(rr.Body).Decode(&ws); err != nil {
+		t.Fatalf("expected JSON, got error %v", err)
+	}
+	// 10 shares: $4,000 at 0.9 less $1,000 at 0.9 is a 2,700 EUR gain.
+	if ws.Year != 2024 || ws.Disposals != 1 || ws.ConsiderationCents != 360000 || ws.NetChargeableGainCents != 143000 {
+		t.Errorf("unexpected worksheet: %+v", ws)
+	}
+}
+
+func TestHandleAudit(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	if _, err := svc.AddVest("2022-01-01", "ACME", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	sale, _ := svc.AddSale("2024-03-01", "ACME", 10, 40000)
+	if err := svc.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("year", "2024")
+	writer.WriteField("record", "SALE:"+sale.ID)
+	part, _ := writer.CreateFormFile("evidence", "confirmation.pdf")
+	part.Write([]byte("%PDF-1.4"))
+	writer.Close()
+
+	req, _ := http.NewRequest("POST", "/audit", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rr := httptest.NewRecorder()
+	server.handleAudit(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect after upload, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/audit?year=2024", nil)
+	rr = httptest.NewRecorder()
+	server.handleAudit(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "confirmation.pdf") {
+		t.Fatalf("expected the attachment to be listed, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/audit?year=2024&download=1", nil)
+	rr = httptest.NewRecorder()
+	server.handleAudit(rr, req)
+	if rr.Header().Get("Content-Type") != "application/zip" || !strings.Contains(rr.Header().Get("Content-Disposition"), "audit-pack-2024.zip") {
+		t.Fatalf("expected a zip download, got headers %v", rr.Header())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	found := false
+	for _, f := range zr.File {
+		found = found || strings.HasSuffix(f.Name, "confirmation.pdf")
+	}
+	if !found {
+		t.Error("expected the evidence file in the archive")
+	}
+}
+
+func TestHandleTaxYears(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	if _, err := svc.AddVest("2022-01-01", "ACME", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	sale, _ := svc.AddSale("2024-03-01", "ACME", 10, 40000)
+	if err := svc.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "/tax-years", strings.NewReader(url.Values{"action": {"close"}, "year": {"2024"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	server.handleTaxYears(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect after closing, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Unsettling a sale in the closed year is refused.
+	req, _ = http.NewRequest("POST", "/sales/"+sale.ID+"/unsettle", nil)
+	rr = httptest.NewRecorder()
+	server.handleSettleOrSales(rr, req)
+	if rr.Code == http.StatusOK {
+		t.Error("expected unsettling a sale in a closed year to fail")
+	}
+
+	req, _ = http.NewRequest("POST", "/tax-years", strings.NewReader(url.Values{"action": {"reopen"}, "year": {"2024"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	server.handleTaxYears(rr, req)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "reason is required") {
+		t.Errorf("expected a reason to be required, got %d", rr.Code)
+	}
+
+	req, _ = http.NewRequest("POST", "/tax-years", strings.NewReader(url.Values{"action": {"reopen"}, "year": {"2024"}, "reason": {"Late broker statement"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	server.handleTaxYears(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect after reopening, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/tax-years", nil)
+	rr = httptest.NewRecorder()
+	server.handleTaxYears(rr, req)
+	body := rr.Body.String()
+	if rr.Code != http.StatusOK || !strings.Contains(body, "Amending: Late broker statement") || !strings.Contains(body, "Close Amended Year") {
+		t.Errorf("expected the amendment in progress, got %d: %s", rr.Code, body)
+	}
+}
+
+func TestHandleAddPayment(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	if _, err := svc.AddVest("2022-01-01", "ACME", 10, 10000); err != nil {
+		t.Fatalf("AddVest failed: %v", err)
+	}
+	sale, _ := svc.AddSale("2024-03-01", "ACME", 10, 40000)
+	if err := svc.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+
+	form := url.Values{"date": {"2024-12-01"}, "amount": {"100.00"}, "year": {"2024"}, "period": {"INITIAL"}, "reference": {"ROS-123"}}
+	req, _ := http.NewRequest("POST", "/payments", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	server.handleAddPayment(rr, req)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/summary?year=2024" {
+		t.Fatalf("expected a redirect to the summary, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// The 2,700 EUR gain less the exemption leaves 471.90 due, 100.00 of it paid.
+	req, _ = http.NewRequest("GET", "/summary?year=2024", nil)
+	rr = httptest.NewRecorder()
+	server.handleSummary(rr, req)
+	body := rr.Body.String()
+	if !strings.Contains(body, "ROS-123") || !strings.Contains(body, "371.90") || !strings.Contains(body, "Overdue") {
+		t.Errorf("expected the payment reconciled against the liability, got: %s", body)
+	}
+}
+
+func TestHandleCalendar(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, true, "../../web/templates")
+	handler := server.wrapAuth(http.HandlerFunc(server.handleCalendar))
+
+	req, _ := http.NewRequest("GET", "/calendar.ics", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token or session, got %d", rr.Code)
+	}
+
+	server.SetCalendarToken("s3cret")
+	req, _ = http.NewRequest("GET", "/calendar.ics?token=wrong", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 with the wrong token, got %d", rr.Code)
+	}
+
+	req, _ = http.NewRequest("GET", "/calendar.ics?token=s3cret", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/calendar") {
+		t.Fatalf("expected the calendar, got %d", rr.Code)
+	}
+	year := time.Now().Year()
+	if !strings.Contains(rr.Body.String(), fmt.Sprintf("DTSTART;VALUE=DATE:%d1215", year)) || !strings.Contains(rr.Body.String(), fmt.Sprintf("Tax return for %d due", year)) {
+		t.Errorf("expected this year's deadlines, got %s", rr.Body.String())
+	}
+
+	// A logged-in browser session also works.
+	req, _ = http.NewRequest("GET", "/calendar.ics", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: server.sessions.CreateSession()})
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected the calendar with a session, got %d", rr.Code)
+	}
+}
+
+// fakeMailer records the emails sent, failing while err is set.
+type fakeMailer struct {
+	subjects []string
+	err      error
+}
+
+func (m *fakeMailer) Send(subject, body string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.subjects = append(m.subjects, subject)
+	return nil
+}
+
+func TestSendReminders(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	svc.AddVest("2024-01-02", "ACME", 10, 10000)
+	svc.AddSale("2024-01-10", "ACME", 5, 12000)
+	server := NewServer(svc, false, "../../web/templates")
+	mailer := &fakeMailer{err: fmt.Errorf("connection refused")}
+	server.SetMailer(mailer, portfolio.ReminderOptions{UnsettledDays: 10}, time.Hour)
+
+	if n, err := server.sendReminders("2024-02-01"); err == nil || n != 0 {
+		t.Fatalf("expected the send to fail, got %d sent", n)
+	}
+	mailer.err = nil
+	if n, err := server.sendReminders("2024-02-01"); err != nil || n != 1 {
+		t.Fatalf("expected the failed reminder to be retried, got %d sent: %v", n, err)
+	}
+	if !strings.Contains(mailer.subjects[0], "5 ACME on 2024-01-10 is unsettled") {
+		t.Errorf("unexpected reminder: %q", mailer.subjects[0])
+	}
+	if n, _ := server.sendReminders("2024-02-02"); n != 0 {
+		t.Errorf("expected the reminder to be sent once, got %d more", n)
+	}
+}
+
+func TestHandleWebhooks(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/webhooks", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		server.handleWebhooks(rr, req)
+		return rr
+	}
+	if rr := post(url.Values{"url": {"not a url"}, "secret": {"s3cret"}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid URL, got %d", rr.Code)
+	}
+	form := url.Values{"url": {"https://example.com/hook"}, "secret": {"s3cret"}, "events": {"import.completed", "year.closed"}}
+	if rr := post(form); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected 303 after adding a webhook, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Completing an import queues a delivery.
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("csvFile", "vests.csv")
+	io.WriteString(part, `Vest Date,Order Number,Plan,Type,Status,Price,Quantity,Net Cash Proceeds,Net Share Proceeds,Tax Payment Method
+25-Nov-2025,RB9995EE17,GSU Class C,Release,Staged,$318.47,14.094,$0.00,6.752,Fractional Shares`)
+	writer.WriteField("importType", "vests")
+	writer.WriteField("symbol", "GOOGL")
+	writer.Close()
+	req, _ := http.NewRequest("POST", "/import", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	server.handleImport(httptest.NewRecorder(), req)
+
+	deliveries, _ := svc.GetWebhookDeliveries(10)
+	if len(deliveries) != 1 || deliveries[0].Event != "import.completed" || !strings.Contains(deliveries[0].Payload, `"symbol":"GOOGL"`) {
+		t.Fatalf("expected only the import delivery, got %+v", deliveries)
+	}
+
+	if rr := post(url.Values{"action": {"replay"}, "id": {deliveries[0].ID}}); rr.Code != http.StatusSeeOther {
+		t.Errorf("expected 303 after a replay, got %d", rr.Code)
+	}
+	req, _ = http.NewRequest("GET", "/webhooks", nil)
+	rr := httptest.NewRecorder()
+	server.handleWebhooks(rr, req)
+	if rr.Code != http.StatusOK || strings.Count(rr.Body.String(), ">import.completed<") != 2 || !strings.Contains(rr.Body.String(), "https://example.com/hook") {
+		t.Errorf("expected the webhook and both deliveries, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandleReport(t *testing.T) {
+	currency.UseTestRate(t, 0.9)
+	db, cleanup := db.NewTestDB(t)
+	defer cleanup()
+
+	svc := portfolio.NewService(db)
+	server := NewServer(svc, false, "../../web/templates")
+	svc.AddVest("2022-01-01", "ACME", 10, 10000)
+	sale, _ := svc.AddSale("2024-03-01", "ACME", 10, 40000)
+	if err := svc.SettleSale(sale.ID); err != nil {
+		t.Fatalf("SettleSale failed: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "/report?year=2024", nil)
+	rr := httptest.NewRecorder()
+	server.handleReport(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/pdf" {
+		t.Fatalf("expected a PDF, got %d", rr.Code)
+	}
+	if rr.Header().Get("Content-Disposition") != "attachment; filename=cgt-report-2024.pdf" || !strings.HasPrefix(rr.Body.String(), "%PDF-") {
+		t.Errorf("unexpected download: %q", rr.Header().Get("Content-Disposition"))
+	}
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"irish-cgt-tracker/internal/db"
+	"irish-cgt-tracker/internal/notify"
 	"irish-cgt-tracker/internal/portfolio"
 	"irish-cgt-tracker/internal/server"
 )
@@ -21,7 +28,15 @@ import (
 //    and enabling authentication.
 // 5. Starts the web server, making it listen for incoming HTTP requests on
 //    all network interfaces on port 8080.
+//
+// Run with the "report" subcommand to write an annual CGT report as a PDF
+// instead of starting the server; see runReport.
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		runReport(os.Args[2:])
+		return
+	}
+
 	// 1. Setup Database
 	// Ensure the directory for the database file exists.
 	if err := os.MkdirAll("./data", 0755); err != nil {
@@ -34,11 +49,40 @@ func main() {
 	// 2. Setup Core Application Logic
 	// Instantiate the service layer with the database connection.
 	svc := portfolio.NewService(database)
+	// Load the webhook subscriptions that events are queued for.
+	if err := svc.LoadWebhooks(); err != nil {
+		log.Fatalf("Failed to load webhooks: %v", err)
+	}
 
 	// 3. Setup Web Server
 	// Create a new server instance, enabling authentication.
 	srv := server.NewServer(svc, true, "web/templates")
 
+	// Optionally fetch prices for the valuation page from a JSON endpoint,
+	// e.g. PRICE_PROVIDER_URL=https://prices.example.com/{symbol}/{date}.
+	if url := os.Getenv("PRICE_PROVIDER_URL"); url != "" {
+		srv.SetPriceProvider(&portfolio.HTTPPriceProvider{URLTemplate: url})
+	}
+	// Allow calendar applications to subscribe to /calendar.ics?token=...
+	srv.SetCalendarToken(os.Getenv("CALENDAR_TOKEN"))
+	// Optionally email reminders of payment deadlines, unsettled sales and
+	// failed rate fetches, e.g. SMTP_HOST=localhost SMTP_PORT=1025 for MailHog.
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		mailer := &notify.SMTPMailer{
+			Host:     host,
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+			To:       strings.Split(os.Getenv("REMINDER_TO"), ","),
+		}
+		opts := portfolio.ReminderOptions{}
+		opts.DeadlineDays, _ = strconv.Atoi(os.Getenv("REMINDER_DEADLINE_DAYS"))
+		opts.UnsettledDays, _ = strconv.Atoi(os.Getenv("REMINDER_UNSETTLED_DAYS"))
+		interval, _ := time.ParseDuration(os.Getenv("REMINDER_INTERVAL"))
+		srv.SetMailer(mailer, opts, interval)
+	}
+
 	// Define the server address. Listening on 0.0.0.0 makes it accessible
 	// from outside its container or on the local network.
 	addr := "0.0.0.0:8080"
@@ -48,3 +92,41 @@ func main() {
 	// This function will block until the server is stopped.
 	srv.Start(addr)
 }
+
+// runReport writes the annual CGT report for a tax year as a PDF, e.g.
+//
+//	cgt-tracker report -year 2024 -o cgt-report-2024.pdf
+//
+// The report is written to standard output unless -o is given, so that it can
+// be redirected from a container without a shell.
+func runReport(args []string) {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	year := flags.Int("year", time.Now().Year()-1, "tax year to report on")
+	owner := flags.String("owner", "", "household member ID (default: the primary person)")
+	dbPath := flags.String("db", "./data/portfolio.db", "path to the portfolio database")
+	out := flags.String("o", "", "output file (default: standard output)")
+	flags.Parse(args)
+
+	if _, err := os.Stat(*dbPath); err != nil {
+		log.Fatalf("Cannot open database: %v", err)
+	}
+	database := db.InitDB(*dbPath)
+	defer database.Close()
+	svc := portfolio.NewService(database).ForPerson(*owner)
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("Failed to create report file: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := svc.WriteCGTReport(w, *year); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, "Wrote CGT report for %d to %s\n", *year, *out)
+	}
+}